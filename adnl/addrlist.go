@@ -0,0 +1,97 @@
+package adnl
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+const (
+	tlAddressUDP  uint32 = 0x670da6e7 // adnl.address.udp ip:int port:int = adnl.Address
+	tlAddressUDP6 uint32 = 0xe31d63fa // adnl.address.udp6 ip:int128 port:int = adnl.Address
+)
+
+// AddressList is the set of endpoints a node announces (adnl.addressList).
+// It is carried inside DHT node descriptors and address records.
+type AddressList struct {
+	Addrs      []netip.AddrPort
+	Version    int32
+	ReinitDate int32
+	Priority   int32
+	ExpireAt   int32 // unix time; 0 means no expiry
+}
+
+// Write appends the bare TL form of the list.
+func (l AddressList) Write(w *tl.Writer) {
+	w.WriteUint32(uint32(len(l.Addrs)))
+	for _, a := range l.Addrs {
+		ip := a.Addr().Unmap()
+		if ip.Is4() {
+			b := ip.As4()
+			w.WriteUint32(tlAddressUDP)
+			w.WriteUint32(binary.BigEndian.Uint32(b[:]))
+		} else {
+			b := ip.As16()
+			w.WriteUint32(tlAddressUDP6)
+			w.WriteRaw(b[:])
+		}
+		w.WriteUint32(uint32(a.Port()))
+	}
+	w.WriteInt32(l.Version)
+	w.WriteInt32(l.ReinitDate)
+	w.WriteInt32(l.Priority)
+	w.WriteInt32(l.ExpireAt)
+}
+
+// maxListAddrs bounds the number of addresses accepted in a decoded list.
+const maxListAddrs = 16
+
+// ReadAddressList decodes a bare adnl.addressList.
+func ReadAddressList(r *tl.Reader) (AddressList, error) {
+	var l AddressList
+	n := r.Uint32()
+	if n > maxListAddrs {
+		return l, errors.New("adnl: too many addresses in list")
+	}
+	for i := uint32(0); i < n && r.Err() == nil; i++ {
+		var ip netip.Addr
+		switch c := r.Uint32(); c {
+		case tlAddressUDP:
+			var b [4]byte
+			binary.BigEndian.PutUint32(b[:], r.Uint32())
+			ip = netip.AddrFrom4(b)
+		case tlAddressUDP6:
+			var b [16]byte
+			copy(b[:], r.Raw(16))
+			ip = netip.AddrFrom16(b)
+		default:
+			if r.Err() != nil {
+				break
+			}
+			return l, fmt.Errorf("adnl: unsupported address constructor %08x", c)
+		}
+		port := r.Uint32()
+		if port > 0xffff {
+			return l, errors.New("adnl: invalid port in address list")
+		}
+		l.Addrs = append(l.Addrs, netip.AddrPortFrom(ip, uint16(port)))
+	}
+	l.Version = r.Int32()
+	l.ReinitDate = r.Int32()
+	l.Priority = r.Int32()
+	l.ExpireAt = r.Int32()
+	return l, r.Err()
+}
+
+// Address returns the first endpoint of the list as an Address for pub.
+func (l AddressList) Address(pub ed25519.PublicKey) (Address, bool) {
+	if len(l.Addrs) == 0 {
+		return Address{}, false
+	}
+	a := l.Addrs[0]
+	return AddressFromKey(pub, a.Addr().Unmap().String(), int(a.Port())), true
+}
@@ -0,0 +1,100 @@
+package adnl
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+// jsonAddressList is the TL-JSON form of adnl.addressList used in global
+// configs. IPv4 addresses are signed big-endian integers, IPv6 addresses
+// base64 int128 values.
+type jsonAddressList struct {
+	Type       string        `json:"@type,omitempty"`
+	Addrs      []jsonAddress `json:"addrs"`
+	Version    int32         `json:"version"`
+	ReinitDate int32         `json:"reinit_date"`
+	Priority   int32         `json:"priority"`
+	ExpireAt   int32         `json:"expire_at"`
+}
+
+type jsonAddress struct {
+	Type string          `json:"@type"`
+	IP   json.RawMessage `json:"ip"`
+	Port int32           `json:"port"`
+}
+
+// MarshalJSON encodes the list in the TL-JSON form of global configs.
+func (l AddressList) MarshalJSON() ([]byte, error) {
+	out := jsonAddressList{
+		Type:       "adnl.addressList",
+		Addrs:      []jsonAddress{},
+		Version:    l.Version,
+		ReinitDate: l.ReinitDate,
+		Priority:   l.Priority,
+		ExpireAt:   l.ExpireAt,
+	}
+	for _, a := range l.Addrs {
+		ip := a.Addr().Unmap()
+		var (
+			typ string
+			raw []byte
+			err error
+		)
+		if ip.Is4() {
+			b := ip.As4()
+			typ = "adnl.address.udp"
+			raw, err = json.Marshal(int32(binary.BigEndian.Uint32(b[:])))
+		} else {
+			b := ip.As16()
+			typ = "adnl.address.udp6"
+			raw, err = json.Marshal(b[:])
+		}
+		if err != nil {
+			return nil, err
+		}
+		out.Addrs = append(out.Addrs, jsonAddress{Type: typ, IP: raw, Port: int32(a.Port())})
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes the TL-JSON form of global configs.
+func (l *AddressList) UnmarshalJSON(b []byte) error {
+	var in jsonAddressList
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	if len(in.Addrs) > maxListAddrs {
+		return errors.New("adnl: too many addresses in list")
+	}
+	out := AddressList{Version: in.Version, ReinitDate: in.ReinitDate, Priority: in.Priority, ExpireAt: in.ExpireAt}
+	for _, a := range in.Addrs {
+		if a.Port < 0 || a.Port > 0xffff {
+			return errors.New("adnl: invalid port in address list")
+		}
+		var ip netip.Addr
+		switch a.Type {
+		case "adnl.address.udp":
+			var v int32
+			if err := json.Unmarshal(a.IP, &v); err != nil {
+				return fmt.Errorf("adnl: bad udp address: %w", err)
+			}
+			var b [4]byte
+			binary.BigEndian.PutUint32(b[:], uint32(v))
+			ip = netip.AddrFrom4(b)
+		case "adnl.address.udp6":
+			var v []byte
+			if err := json.Unmarshal(a.IP, &v); err != nil || len(v) != 16 {
+				return errors.New("adnl: bad udp6 address")
+			}
+			ip = netip.AddrFrom16([16]byte(v))
+		default:
+			return fmt.Errorf("adnl: unsupported address type %q", a.Type)
+		}
+		out.Addrs = append(out.Addrs, netip.AddrPortFrom(ip, uint16(a.Port)))
+	}
+	*l = out
+	return nil
+}
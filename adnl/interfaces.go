@@ -1,15 +1,25 @@
 package adnl
 
-import "context"
+import (
+	"context"
+	"crypto/ed25519"
+	"time"
+)
 
 // Address represents an ADNL-style address.
 type Address struct {
 	ID   string // peer ID or similar identity
 	Host string
 	Port int
+	// PubKey is the peer's ed25519 key. Datagram transports need it to
+	// encrypt the first packets; ID is derived from it when empty.
+	PubKey ed25519.PublicKey
 }
 
-// Message is a raw ADNL message payload.
+// Message is a serialized ADNL message: adnl.message.custom,
+// adnl.message.query or adnl.message.answer, boxed. Its constructor is the
+// message kind, which datagram transports send as is; stream transports
+// frame it unchanged. Build one with NewMessage.
 type Message []byte
 
 // Transport abstracts low-level connectivity.
@@ -33,3 +43,30 @@ type Node interface {
 	LocalAddr() Address
 	SendTo(ctx context.Context, to Address, msg Message) error
 }
+
+// PeerConn is a Conn that knows the address of its remote end.
+type PeerConn interface {
+	Conn
+	RemoteAddr() Address
+}
+
+// Acceptor is a Transport that surfaces connections opened by remote peers.
+type Acceptor interface {
+	Transport
+	LocalAddr() Address
+	Accept(ctx context.Context) (PeerConn, error)
+}
+
+// MessageHandler is invoked for every inbound message delivered to a Node.
+type MessageHandler func(ctx context.Context, from Address, msg Message)
+
+// ReceivingNode is a Node that delivers inbound messages to a handler.
+type ReceivingNode interface {
+	Node
+	SetMessageHandler(h MessageHandler)
+}
+
+// Pinger is implemented by connections that support a transport-level ping.
+type Pinger interface {
+	Ping(ctx context.Context) (time.Duration, error)
+}
@@ -0,0 +1,112 @@
+package adnl
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/big"
+)
+
+// TL constructor IDs used when hashing keys into short IDs.
+const (
+	tlPubEd25519 uint32 = 0x4813b4c6 // pub.ed25519 key:int256 = PublicKey
+	tlPubAES     uint32 = 0x2dbcadd4 // pub.aes key:int256 = PublicKey
+)
+
+// KeyID returns the 256-bit short ID of an ed25519 public key: the SHA-256 of
+// its TL-serialized pub.ed25519 form. ADNL packets are addressed by this ID.
+func KeyID(pub ed25519.PublicKey) [32]byte {
+	return tlKeyHash(tlPubEd25519, pub)
+}
+
+// AddressFromKey returns an Address for the given key and UDP/TCP endpoint.
+func AddressFromKey(pub ed25519.PublicKey, host string, port int) Address {
+	id := KeyID(pub)
+	return Address{ID: hex.EncodeToString(id[:]), Host: host, Port: port, PubKey: pub}
+}
+
+// ParseID decodes a hex-encoded short ID as found in Address.ID.
+func ParseID(s string) ([32]byte, error) {
+	var id [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return id, err
+	}
+	if len(b) != len(id) {
+		return id, errors.New("adnl: short id must be 32 bytes")
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+func tlKeyHash(constructor uint32, key []byte) [32]byte {
+	h := sha256.New()
+	var tag [4]byte
+	binary.LittleEndian.PutUint32(tag[:], constructor)
+	h.Write(tag[:])
+	h.Write(key)
+	var out [32]byte
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+// curve25519 field prime 2^255 - 19.
+var fieldP = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// x25519Private converts an ed25519 private key into the equivalent X25519 scalar.
+func x25519Private(priv ed25519.PrivateKey) (*ecdh.PrivateKey, error) {
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, errors.New("adnl: invalid ed25519 private key size")
+	}
+	h := sha512.Sum512(priv.Seed())
+	return ecdh.X25519().NewPrivateKey(h[:32])
+}
+
+// x25519Public maps an ed25519 public key (Edwards y) to its Montgomery u
+// coordinate: u = (1 + y) / (1 - y) mod p.
+func x25519Public(pub ed25519.PublicKey) (*ecdh.PublicKey, error) {
+	if len(pub) != ed25519.PublicKeySize {
+		return nil, errors.New("adnl: invalid ed25519 public key size")
+	}
+	be := make([]byte, len(pub))
+	for i := range pub {
+		be[len(pub)-1-i] = pub[i]
+	}
+	be[0] &= 0x7f // drop the sign bit of x
+	y := new(big.Int).SetBytes(be)
+	if y.Cmp(fieldP) >= 0 {
+		return nil, errors.New("adnl: non-canonical ed25519 public key")
+	}
+	num := new(big.Int).Add(big.NewInt(1), y)
+	den := new(big.Int).Sub(big.NewInt(1), y)
+	den.Mod(den, fieldP)
+	if den.Sign() == 0 {
+		return nil, errors.New("adnl: ed25519 public key has no montgomery form")
+	}
+	u := num.Mul(num, den.ModInverse(den, fieldP))
+	u.Mod(u, fieldP)
+	out := make([]byte, 32)
+	ub := u.Bytes()
+	for i := range ub {
+		out[i] = ub[len(ub)-1-i]
+	}
+	return ecdh.X25519().NewPublicKey(out)
+}
+
+// sharedSecret computes the ECDH secret between a local ed25519 identity and a
+// remote ed25519 public key.
+func sharedSecret(priv ed25519.PrivateKey, pub ed25519.PublicKey) ([]byte, error) {
+	xp, err := x25519Private(priv)
+	if err != nil {
+		return nil, err
+	}
+	xpub, err := x25519Public(pub)
+	if err != nil {
+		return nil, err
+	}
+	return xp.ECDH(xpub)
+}
@@ -0,0 +1,156 @@
+package adnl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// memQueue bounds the datagrams buffered per endpoint; further datagrams are
+// dropped as a real socket would.
+const memQueue = 1024
+
+// MemNetwork is an in-process datagram network. Its PacketConns can be handed
+// to UDPConfig.PacketConn so that several transports talk to each other
+// without sockets, which keeps tests of ADNL and DHT code hermetic.
+type MemNetwork struct {
+	mu    sync.Mutex
+	conns map[string]*memPacketConn
+	next  int
+}
+
+// NewMemNetwork creates an empty network.
+func NewMemNetwork() *MemNetwork {
+	return &MemNetwork{conns: make(map[string]*memPacketConn)}
+}
+
+// ListenPacket returns an endpoint bound to addr ("ip:port"). An empty addr
+// picks a fresh address of the form 10.0.x.y:30303.
+func (n *MemNetwork) ListenPacket(addr string) (net.PacketConn, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var ua *net.UDPAddr
+	if addr == "" {
+		n.next++
+		ua = &net.UDPAddr{IP: net.IPv4(10, 0, byte(n.next>>8), byte(n.next)), Port: 30303}
+	} else {
+		var err error
+		if ua, err = net.ResolveUDPAddr("udp", addr); err != nil {
+			return nil, err
+		}
+	}
+	key := ua.String()
+	if _, ok := n.conns[key]; ok {
+		return nil, fmt.Errorf("adnl: memnet address %s already in use", key)
+	}
+	c := &memPacketConn{
+		net:   n,
+		addr:  ua,
+		inbox: make(chan memDatagram, memQueue),
+		done:  make(chan struct{}),
+	}
+	n.conns[key] = c
+	return c, nil
+}
+
+func (n *MemNetwork) lookup(addr net.Addr) *memPacketConn {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.conns[addr.String()]
+}
+
+func (n *MemNetwork) remove(c *memPacketConn) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conns[c.addr.String()] == c {
+		delete(n.conns, c.addr.String())
+	}
+}
+
+type memDatagram struct {
+	data []byte
+	from net.Addr
+}
+
+// memPacketConn implements net.PacketConn on top of a MemNetwork.
+type memPacketConn struct {
+	net  *MemNetwork
+	addr *net.UDPAddr
+
+	inbox chan memDatagram
+	done  chan struct{}
+	once  sync.Once
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (c *memPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return 0, nil, os.ErrDeadlineExceeded
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case dg := <-c.inbox:
+		return copy(b, dg.data), dg.from, nil
+	case <-c.done:
+		return 0, nil, net.ErrClosed
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+// WriteTo delivers b to the endpoint bound to addr. Datagrams to unknown
+// addresses, or to endpoints whose queue is full, are silently dropped.
+func (c *memPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.done:
+		return 0, net.ErrClosed
+	default:
+	}
+	if addr == nil {
+		return 0, errors.New("adnl: memnet write to nil address")
+	}
+	if dst := c.net.lookup(addr); dst != nil {
+		select {
+		case dst.inbox <- memDatagram{data: append([]byte(nil), b...), from: c.addr}:
+		default:
+		}
+	}
+	return len(b), nil
+}
+
+func (c *memPacketConn) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+		c.net.remove(c)
+	})
+	return nil
+}
+
+func (c *memPacketConn) LocalAddr() net.Addr { return c.addr }
+
+func (c *memPacketConn) SetDeadline(t time.Time) error { return c.SetReadDeadline(t) }
+
+func (c *memPacketConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *memPacketConn) SetWriteDeadline(t time.Time) error { return nil }
+
+var _ net.PacketConn = (*memPacketConn)(nil)
@@ -0,0 +1,50 @@
+package adnl
+
+import (
+	"errors"
+
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+// MessageKind is the ADNL message constructor a Message is boxed with.
+type MessageKind uint32
+
+// Message kinds carried by Message.
+const (
+	KindCustom MessageKind = MessageKind(tlMessageCustom) // adnl.message.custom data:bytes
+	KindQuery  MessageKind = MessageKind(tlMessageQuery)  // adnl.message.query query_id:int256 query:bytes
+	KindAnswer MessageKind = MessageKind(tlMessageAnswer) // adnl.message.answer query_id:int256 answer:bytes
+)
+
+// ErrBadMessage is returned when sending a Message that is not a well-formed
+// custom, query or answer message.
+var ErrBadMessage = errors.New("adnl: malformed message")
+
+// NewMessage boxes data as a message of the given kind. queryID is ignored
+// for KindCustom.
+func NewMessage(kind MessageKind, queryID [32]byte, data []byte) Message {
+	m := message{kind: uint32(kind), queryID: queryID, data: data}
+	var w tl.Writer
+	m.encode(&w)
+	return w.Bytes()
+}
+
+// Kind returns the constructor msg is boxed with, without validating the rest.
+func (msg Message) Kind() MessageKind {
+	return MessageKind(tl.NewReader(msg).Uint32())
+}
+
+// parseMessage decodes msg, which must be exactly one custom, query or answer
+// message.
+func parseMessage(msg []byte) (message, error) {
+	r := tl.NewReader(msg)
+	m, err := decodeMessage(r)
+	if err != nil || r.Len() != 0 {
+		return m, ErrBadMessage
+	}
+	switch MessageKind(m.kind) {
+	case KindCustom, KindQuery, KindAnswer:
+		return m, nil
+	}
+	return m, ErrBadMessage
+}
@@ -0,0 +1,171 @@
+package adnl
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// LocalNode implements Node on top of an Acceptor. It keeps one connection per
+// remote peer and hands every inbound message to the registered MessageHandler.
+type LocalNode struct {
+	t Acceptor
+
+	mu      sync.Mutex
+	handler MessageHandler
+	conns   map[string]PeerConn
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewNode creates a node over the given transport.
+func NewNode(t Acceptor) *LocalNode {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &LocalNode{t: t, conns: make(map[string]PeerConn), ctx: ctx, cancel: cancel}
+}
+
+// Start starts the transport and begins accepting inbound peers.
+func (n *LocalNode) Start(ctx context.Context) error {
+	if err := n.t.Start(ctx); err != nil {
+		return err
+	}
+	n.wg.Add(1)
+	go n.acceptLoop()
+	return nil
+}
+
+// Close stops the node and its transport.
+func (n *LocalNode) Close(ctx context.Context) error {
+	n.cancel()
+	err := n.t.Close(ctx)
+	n.wg.Wait()
+	return err
+}
+
+func (n *LocalNode) Transport() Transport { return n.t }
+func (n *LocalNode) LocalAddr() Address   { return n.t.LocalAddr() }
+
+// SetMessageHandler registers the handler for inbound messages. Messages from
+// one peer are delivered sequentially; a slow handler delays only that peer.
+func (n *LocalNode) SetMessageHandler(h MessageHandler) {
+	n.mu.Lock()
+	n.handler = h
+	n.mu.Unlock()
+}
+
+// SendTo sends msg to the peer, dialing it on first use. A connection the
+// transport closed meanwhile, e.g. after the peer went idle, is dialed again
+// once.
+func (n *LocalNode) SendTo(ctx context.Context, to Address, msg Message) error {
+	for redialed := false; ; redialed = true {
+		c, err := n.conn(ctx, to)
+		if err != nil {
+			return err
+		}
+		err = c.Send(ctx, msg)
+		if !errors.Is(err, ErrClosed) {
+			return err
+		}
+		n.drop(peerKey(to), c)
+		if redialed {
+			return err
+		}
+	}
+}
+
+func (n *LocalNode) conn(ctx context.Context, to Address) (PeerConn, error) {
+	key := peerKey(to)
+	n.mu.Lock()
+	c, ok := n.conns[key]
+	n.mu.Unlock()
+	if ok {
+		return c, nil
+	}
+	raw, err := n.t.Dial(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	pc, ok := raw.(PeerConn)
+	if !ok {
+		pc = fixedConn{Conn: raw, addr: to}
+	}
+	n.mu.Lock()
+	if cur, ok := n.conns[key]; ok {
+		n.mu.Unlock()
+		return cur, nil
+	}
+	n.conns[key] = pc
+	n.mu.Unlock()
+	n.wg.Add(1)
+	go n.recvLoop(key, pc)
+	return pc, nil
+}
+
+func (n *LocalNode) acceptLoop() {
+	defer n.wg.Done()
+	for {
+		c, err := n.t.Accept(n.ctx)
+		if err != nil {
+			return
+		}
+		key := peerKey(c.RemoteAddr())
+		n.mu.Lock()
+		if old, ok := n.conns[key]; ok && old != c {
+			_ = old.Close(n.ctx)
+		}
+		n.conns[key] = c
+		n.mu.Unlock()
+		n.wg.Add(1)
+		go n.recvLoop(key, c)
+	}
+}
+
+func (n *LocalNode) recvLoop(key string, c PeerConn) {
+	defer n.wg.Done()
+	for {
+		msg, err := c.Recv(n.ctx)
+		if err != nil {
+			n.drop(key, c)
+			return
+		}
+		n.mu.Lock()
+		h := n.handler
+		n.mu.Unlock()
+		if h != nil {
+			h(n.ctx, c.RemoteAddr(), msg)
+		}
+	}
+}
+
+func (n *LocalNode) drop(key string, c PeerConn) {
+	n.mu.Lock()
+	if cur, ok := n.conns[key]; ok && cur == c {
+		delete(n.conns, key)
+	}
+	n.mu.Unlock()
+}
+
+// peerKey identifies a peer: by key ID when known, otherwise by endpoint.
+func peerKey(a Address) string {
+	if id, ok := addrID(a); ok {
+		return hex.EncodeToString(id[:])
+	}
+	if a.ID != "" {
+		return a.ID
+	}
+	return net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+}
+
+// fixedConn adapts a Conn without address information to PeerConn.
+type fixedConn struct {
+	Conn
+	addr Address
+}
+
+func (c fixedConn) RemoteAddr() Address { return c.addr }
+
+var _ ReceivingNode = (*LocalNode)(nil)
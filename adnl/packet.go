@@ -0,0 +1,372 @@
+package adnl
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+// ADNL message and packet constructors.
+const (
+	tlMessageCreateChannel  uint32 = 0xe673c3bb
+	tlMessageConfirmChannel uint32 = 0x60dd1d69
+	tlMessageCustom         uint32 = 0x204818f5
+	tlMessageNop            uint32 = 0x17f8dfda
+	tlMessageReinit         uint32 = 0x10c20520 // adnl.message.reinit date:int
+	tlMessagePart           uint32 = 0xfd452d39
+	tlMessageQuery          uint32 = 0xb48bf97a // adnl.message.query query_id:int256 query:bytes
+	tlMessageAnswer         uint32 = 0x0fac8416 // adnl.message.answer query_id:int256 answer:bytes
+	tlPacketContents        uint32 = 0xd142cd89
+)
+
+// packetContents flags, matching adnl.packetContents.
+const (
+	flagFrom                        = 1 << 0
+	flagFromShort                   = 1 << 1
+	flagMessage                     = 1 << 2
+	flagMessages                    = 1 << 3
+	flagAddress                     = 1 << 4
+	flagPriorityAddress             = 1 << 5
+	flagSeqno                       = 1 << 6
+	flagConfirmSeqno                = 1 << 7
+	flagRecvAddrListVersion         = 1 << 8
+	flagRecvPriorityAddrListVersion = 1 << 9
+	flagReinitDate                  = 1 << 10
+	flagSignature                   = 1 << 11
+
+	// maxPacketMessages bounds the messages accepted in one packet.
+	maxPacketMessages = 16
+)
+
+var errBadPacket = errors.New("adnl: malformed packet")
+
+type message struct {
+	kind uint32
+
+	// createChannel / confirmChannel
+	key     ed25519.PublicKey
+	peerKey ed25519.PublicKey
+	date    uint32 // also reinit
+
+	// custom / part / query / answer
+	data []byte
+
+	// part
+	hash      [32]byte
+	totalSize uint32
+	offset    uint32
+
+	// query / answer
+	queryID [32]byte
+}
+
+// packet is an adnl.packetContents. flags records which optional fields are
+// present; decoded packets keep every field and both random pads, so that
+// they serialize back to the exact bytes their sender signed.
+type packet struct {
+	rand1, rand2 []byte
+	flags        uint32
+
+	from                        ed25519.PublicKey
+	fromShort                   [32]byte
+	messages                    []message
+	address                     AddressList
+	priorityAddress             AddressList
+	seqno                       uint64
+	confirmSeqno                uint64
+	recvAddrListVersion         int32
+	recvPriorityAddrListVersion int32
+	reinitDate                  uint32
+	dstReinitDate               uint32
+	signature                   []byte
+}
+
+func (m *message) encode(w *tl.Writer) {
+	w.WriteUint32(m.kind)
+	switch m.kind {
+	case tlMessageCreateChannel:
+		w.WriteRaw(m.key)
+		w.WriteUint32(m.date)
+	case tlMessageConfirmChannel:
+		w.WriteRaw(m.key)
+		w.WriteRaw(m.peerKey)
+		w.WriteUint32(m.date)
+	case tlMessageCustom:
+		w.WriteBytes(m.data)
+	case tlMessageReinit:
+		w.WriteUint32(m.date)
+	case tlMessageQuery, tlMessageAnswer:
+		w.WriteRaw(m.queryID[:])
+		w.WriteBytes(m.data)
+	case tlMessagePart:
+		w.WriteRaw(m.hash[:])
+		w.WriteUint32(m.totalSize)
+		w.WriteUint32(m.offset)
+		w.WriteBytes(m.data)
+	}
+}
+
+func decodeMessage(r *tl.Reader) (message, error) {
+	m := message{kind: r.Uint32()}
+	switch m.kind {
+	case tlMessageCreateChannel:
+		m.key = ed25519.PublicKey(r.Raw(ed25519.PublicKeySize))
+		m.date = r.Uint32()
+	case tlMessageConfirmChannel:
+		m.key = ed25519.PublicKey(r.Raw(ed25519.PublicKeySize))
+		m.peerKey = ed25519.PublicKey(r.Raw(ed25519.PublicKeySize))
+		m.date = r.Uint32()
+	case tlMessageCustom:
+		m.data = r.Bytes()
+	case tlMessageReinit:
+		m.date = r.Uint32()
+	case tlMessageQuery, tlMessageAnswer:
+		m.queryID = r.Int256()
+		m.data = r.Bytes()
+	case tlMessagePart:
+		m.hash = r.Int256()
+		m.totalSize = r.Uint32()
+		m.offset = r.Uint32()
+		m.data = r.Bytes()
+	case tlMessageNop:
+	default:
+		if r.Err() == nil {
+			return m, errBadPacket
+		}
+	}
+	return m, r.Err()
+}
+
+// newPacket returns a packet carrying msgs with fresh random pads. The
+// caller fills in the other fields and calls setFlags.
+func newPacket(msgs []message) *packet {
+	return &packet{rand1: randomPad(), rand2: randomPad(), messages: msgs}
+}
+
+// setFlags derives the flags of a packet built locally from its fields.
+// Sequence numbers and reinit dates are always sent.
+func (p *packet) setFlags() {
+	p.flags = flagSeqno | flagConfirmSeqno | flagReinitDate
+	if p.from != nil {
+		p.flags |= flagFrom
+	}
+	switch {
+	case len(p.messages) == 1:
+		p.flags |= flagMessage
+	case len(p.messages) > 1:
+		p.flags |= flagMessages
+	}
+}
+
+// encode serializes the packet. The signature is included only when
+// withSignature is set; without it the result is the form the sender signs:
+// the whole packet with the signature flag and field cleared.
+func (p *packet) encode(withSignature bool) []byte {
+	flags := p.flags &^ flagSignature
+	if withSignature && p.signature != nil {
+		flags |= flagSignature
+	}
+
+	var w tl.Writer
+	w.WriteUint32(tlPacketContents)
+	w.WriteBytes(p.rand1)
+	w.WriteUint32(flags)
+	if flags&flagFrom != 0 {
+		w.WriteUint32(tlPubEd25519)
+		w.WriteRaw(p.from)
+	}
+	if flags&flagFromShort != 0 {
+		w.WriteRaw(p.fromShort[:])
+	}
+	msgs := p.messages
+	if flags&flagMessage != 0 && len(msgs) > 0 {
+		msgs[0].encode(&w)
+		msgs = msgs[1:]
+	}
+	if flags&flagMessages != 0 {
+		w.WriteUint32(uint32(len(msgs)))
+		for i := range msgs {
+			msgs[i].encode(&w)
+		}
+	}
+	if flags&flagAddress != 0 {
+		p.address.Write(&w)
+	}
+	if flags&flagPriorityAddress != 0 {
+		p.priorityAddress.Write(&w)
+	}
+	if flags&flagSeqno != 0 {
+		w.WriteUint64(p.seqno)
+	}
+	if flags&flagConfirmSeqno != 0 {
+		w.WriteUint64(p.confirmSeqno)
+	}
+	if flags&flagRecvAddrListVersion != 0 {
+		w.WriteInt32(p.recvAddrListVersion)
+	}
+	if flags&flagRecvPriorityAddrListVersion != 0 {
+		w.WriteInt32(p.recvPriorityAddrListVersion)
+	}
+	if flags&flagReinitDate != 0 {
+		w.WriteUint32(p.reinitDate)
+		w.WriteUint32(p.dstReinitDate)
+	}
+	if flags&flagSignature != 0 {
+		w.WriteBytes(p.signature)
+	}
+	w.WriteBytes(p.rand2)
+	return w.Bytes()
+}
+
+func (p *packet) sign(priv ed25519.PrivateKey) {
+	p.flags &^= flagSignature
+	p.signature = ed25519.Sign(priv, p.encode(false))
+	p.flags |= flagSignature
+}
+
+// verify checks the signature against pub, the sender's key.
+func (p *packet) verify(pub ed25519.PublicKey) bool {
+	if len(pub) != ed25519.PublicKeySize || len(p.signature) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(pub, p.encode(false), p.signature)
+}
+
+func decodePacket(b []byte) (*packet, error) {
+	r := tl.NewReader(b)
+	if r.Uint32() != tlPacketContents {
+		return nil, errBadPacket
+	}
+	p := &packet{rand1: r.Bytes(), flags: r.Uint32()}
+	if p.flags&flagFrom != 0 {
+		if r.Uint32() != tlPubEd25519 {
+			return nil, errBadPacket
+		}
+		p.from = ed25519.PublicKey(r.Raw(ed25519.PublicKeySize))
+	}
+	if p.flags&flagFromShort != 0 {
+		p.fromShort = r.Int256()
+	}
+	if p.flags&flagMessage != 0 {
+		m, err := decodeMessage(r)
+		if err != nil {
+			return nil, err
+		}
+		p.messages = append(p.messages, m)
+	}
+	if p.flags&flagMessages != 0 {
+		n := r.Uint32()
+		if n > maxPacketMessages {
+			return nil, errBadPacket
+		}
+		for i := uint32(0); i < n; i++ {
+			m, err := decodeMessage(r)
+			if err != nil {
+				return nil, err
+			}
+			p.messages = append(p.messages, m)
+		}
+	}
+	var err error
+	if p.flags&flagAddress != 0 {
+		if p.address, err = ReadAddressList(r); err != nil {
+			return nil, err
+		}
+	}
+	if p.flags&flagPriorityAddress != 0 {
+		if p.priorityAddress, err = ReadAddressList(r); err != nil {
+			return nil, err
+		}
+	}
+	if p.flags&flagSeqno != 0 {
+		p.seqno = r.Uint64()
+	}
+	if p.flags&flagConfirmSeqno != 0 {
+		p.confirmSeqno = r.Uint64()
+	}
+	if p.flags&flagRecvAddrListVersion != 0 {
+		p.recvAddrListVersion = r.Int32()
+	}
+	if p.flags&flagRecvPriorityAddrListVersion != 0 {
+		p.recvPriorityAddrListVersion = r.Int32()
+	}
+	if p.flags&flagReinitDate != 0 {
+		p.reinitDate = r.Uint32()
+		p.dstReinitDate = r.Uint32()
+	}
+	if p.flags&flagSignature != 0 {
+		p.signature = r.Bytes()
+	}
+	p.rand2 = r.Bytes()
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	if p.from != nil && p.flags&flagFromShort != 0 && KeyID(p.from) != p.fromShort {
+		return nil, errBadPacket
+	}
+	return p, nil
+}
+
+func randomPad() []byte {
+	b := make([]byte, 7)
+	_, _ = rand.Read(b)
+	return b
+}
+
+// newCipher derives the AES-256-CTR stream for a packet from the shared secret
+// and the plaintext checksum, as ADNL does: key = secret[0:16] || checksum[16:32],
+// iv = checksum[0:4] || secret[20:32].
+func newCipher(secret, checksum []byte) (cipher.Stream, error) {
+	if len(secret) != 32 || len(checksum) != 32 {
+		return nil, errors.New("adnl: invalid cipher material")
+	}
+	key := make([]byte, 0, 32)
+	key = append(key, secret[:16]...)
+	key = append(key, checksum[16:32]...)
+	iv := make([]byte, 0, 16)
+	iv = append(iv, checksum[:4]...)
+	iv = append(iv, secret[20:32]...)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewCTR(block, iv), nil
+}
+
+// seal returns checksum || ciphertext for plain.
+func seal(secret, plain []byte) ([]byte, error) {
+	sum := sha256.Sum256(plain)
+	s, err := newCipher(secret, sum[:])
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 32+len(plain))
+	copy(out, sum[:])
+	s.XORKeyStream(out[32:], plain)
+	return out, nil
+}
+
+// open reverses seal and verifies the checksum.
+func open(secret, sealed []byte) ([]byte, error) {
+	if len(sealed) < 32 {
+		return nil, errBadPacket
+	}
+	sum := sealed[:32]
+	s, err := newCipher(secret, sum)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(sealed)-32)
+	s.XORKeyStream(plain, sealed[32:])
+	got := sha256.Sum256(plain)
+	if subtle.ConstantTimeCompare(got[:], sum) != 1 {
+		return nil, errors.New("adnl: checksum mismatch")
+	}
+	return plain, nil
+}
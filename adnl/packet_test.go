@@ -0,0 +1,155 @@
+package adnl
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+func testKey(t *testing.T, seed byte) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+	return priv.Public().(ed25519.PublicKey), priv
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	pub, priv := testKey(t, 1)
+	addrs := AddressList{Addrs: []netip.AddrPort{netip.MustParseAddrPort("1.2.3.4:3000")}, Version: 7, ReinitDate: 8}
+	tests := []struct {
+		name string
+		pkt  *packet
+	}{
+		{"one message", &packet{
+			rand1: []byte{1, 2, 3}, rand2: []byte{4, 5, 6, 7, 8, 9, 10},
+			flags: flagFrom | flagMessage | flagSeqno | flagConfirmSeqno | flagReinitDate,
+			from:  pub, messages: []message{{kind: tlMessageCustom, data: []byte("hi")}},
+			seqno: 5, confirmSeqno: 4, reinitDate: 100, dstReinitDate: 200,
+		}},
+		{"every optional field", &packet{
+			rand1: []byte{1}, rand2: []byte{2},
+			flags: flagFrom | flagFromShort | flagMessages | flagAddress | flagPriorityAddress |
+				flagSeqno | flagConfirmSeqno | flagRecvAddrListVersion | flagRecvPriorityAddrListVersion | flagReinitDate,
+			from: pub, fromShort: KeyID(pub),
+			messages: []message{
+				{kind: tlMessageNop},
+				{kind: tlMessageReinit, date: 9},
+				{kind: tlMessageQuery, queryID: [32]byte{1}, data: []byte("q")},
+				{kind: tlMessageAnswer, queryID: [32]byte{2}, data: []byte("a")},
+			},
+			address: addrs, priorityAddress: addrs,
+			seqno: 1, confirmSeqno: 2, recvAddrListVersion: 3, recvPriorityAddrListVersion: 4,
+		}},
+		{"short id only", &packet{
+			rand1: []byte{}, rand2: []byte{},
+			flags:     flagFromShort | flagMessage | flagSeqno,
+			fromShort: KeyID(pub), messages: []message{{kind: tlMessageNop}}, seqno: 3,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.pkt.sign(priv)
+			b := tt.pkt.encode(true)
+			got, err := decodePacket(b)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.pkt) {
+				t.Fatalf("decoded packet differs:\n got %+v\nwant %+v", got, tt.pkt)
+			}
+			if !got.verify(pub) {
+				t.Fatal("signature does not verify after decoding")
+			}
+			if !bytes.Equal(got.encode(true), b) {
+				t.Fatal("re-encoding changes the packet")
+			}
+		})
+	}
+}
+
+// TestPacketSignedForm checks the signed bytes against adnl.packetContents
+// written out field by field: the whole packet, pads included, with the
+// signature flag and field cleared.
+func TestPacketSignedForm(t *testing.T) {
+	pub, priv := testKey(t, 2)
+	p := newPacket([]message{{kind: tlMessageCustom, data: []byte("payload")}})
+	p.from = pub
+	p.seqno, p.confirmSeqno, p.reinitDate, p.dstReinitDate = 10, 9, 1000, 0
+	p.setFlags()
+	p.sign(priv)
+
+	var w tl.Writer
+	w.WriteUint32(tlPacketContents)
+	w.WriteBytes(p.rand1)
+	w.WriteUint32(flagFrom | flagMessage | flagSeqno | flagConfirmSeqno | flagReinitDate)
+	w.WriteUint32(tlPubEd25519)
+	w.WriteRaw(pub)
+	w.WriteUint32(tlMessageCustom)
+	w.WriteBytes([]byte("payload"))
+	w.WriteUint64(10)
+	w.WriteUint64(9)
+	w.WriteUint32(1000)
+	w.WriteUint32(0)
+	w.WriteBytes(p.rand2)
+	if !ed25519.Verify(pub, w.Bytes(), p.signature) {
+		t.Fatal("signature does not cover the schema serialization")
+	}
+}
+
+func TestPacketTampering(t *testing.T) {
+	pub, priv := testKey(t, 3)
+	other, _ := testKey(t, 4)
+	tests := []struct {
+		name   string
+		mutate func(p *packet)
+		key    ed25519.PublicKey
+	}{
+		{"untouched", func(p *packet) {}, pub},
+		{"wrong key", func(p *packet) {}, other},
+		{"rand1", func(p *packet) { p.rand1 = []byte{0xff} }, pub},
+		{"rand2", func(p *packet) { p.rand2 = []byte{0xff} }, pub},
+		{"flags", func(p *packet) { p.flags |= flagRecvAddrListVersion }, pub},
+		{"seqno", func(p *packet) { p.seqno++ }, pub},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPacket([]message{{kind: tlMessageNop}})
+			p.from = pub
+			p.seqno = 1
+			p.setFlags()
+			p.sign(priv)
+			tt.mutate(p)
+			want := tt.name == "untouched"
+			if got := p.verify(tt.key); got != want {
+				t.Fatalf("verify = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodePacketRejects(t *testing.T) {
+	pub, _ := testKey(t, 5)
+	other, _ := testKey(t, 6)
+	mismatch := &packet{rand1: []byte{}, rand2: []byte{}, flags: flagFrom | flagFromShort, from: pub, fromShort: KeyID(other)}
+	unknown := &packet{rand1: []byte{}, rand2: []byte{}, flags: flagMessage, messages: []message{{kind: 0xdeadbeef}}}
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"empty", nil},
+		{"wrong constructor", []byte{1, 2, 3, 4}},
+		{"truncated", newPacket(nil).encode(false)[:6]},
+		{"short id mismatch", mismatch.encode(false)},
+		{"unknown message", unknown.encode(false)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodePacket(tt.b); err == nil {
+				t.Fatal("decodePacket accepted a bad packet")
+			}
+		})
+	}
+}
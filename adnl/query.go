@@ -0,0 +1,201 @@
+package adnl
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultQueryTimeout applies to queries whose context carries no deadline.
+const DefaultQueryTimeout = 10 * time.Second
+
+// maxInflightHandlers bounds concurrently executing query handlers.
+const maxInflightHandlers = 256
+
+// ErrQueryTimeout is returned when no answer arrives in time.
+var ErrQueryTimeout = errors.New("adnl: query timed out")
+
+// QueryHandler answers a query. The query bytes start with the TL constructor
+// the handler was registered for. ADNL has no error answer: when the handler
+// fails the query is dropped and the sender times out, so protocols that
+// report errors do so inside their answers (e.g. liteServer.error).
+type QueryHandler func(ctx context.Context, from Address, query []byte) ([]byte, error)
+
+type pendingQuery struct {
+	// peer is the key ID of the queried peer; answers from other peers are
+	// ignored. It is unset when the query was addressed without an ID.
+	peer    [32]byte
+	peerSet bool
+	ch      chan []byte
+}
+
+// RPC adds query/answer semantics on top of a ReceivingNode. Queries carry a
+// random 256-bit ID that correlates the answer; inbound queries are routed to
+// handlers by their leading TL constructor. RPC is itself a ReceivingNode:
+// plain messages pass through SendTo and the handler set with SetMessageHandler.
+type RPC struct {
+	node ReceivingNode
+
+	mu       sync.Mutex
+	pending  map[[32]byte]*pendingQuery
+	handlers map[uint32]QueryHandler
+	onMsg    MessageHandler
+	inflight chan struct{}
+}
+
+// NewRPC wraps node and installs itself as the node's message handler.
+func NewRPC(node ReceivingNode) *RPC {
+	r := &RPC{
+		node:     node,
+		pending:  make(map[[32]byte]*pendingQuery),
+		handlers: make(map[uint32]QueryHandler),
+		inflight: make(chan struct{}, maxInflightHandlers),
+	}
+	node.SetMessageHandler(r.dispatch)
+	return r
+}
+
+func (r *RPC) Transport() Transport { return r.node.Transport() }
+func (r *RPC) LocalAddr() Address   { return r.node.LocalAddr() }
+
+// SetMessageHandler registers the handler for plain (non-query) messages.
+func (r *RPC) SetMessageHandler(h MessageHandler) {
+	r.mu.Lock()
+	r.onMsg = h
+	r.mu.Unlock()
+}
+
+// Handle registers h for queries boxed with the given TL constructor. A nil
+// handler removes the registration.
+func (r *RPC) Handle(constructor uint32, h QueryHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h == nil {
+		delete(r.handlers, constructor)
+		return
+	}
+	r.handlers[constructor] = h
+}
+
+// SendTo sends msg as the data of an adnl.message.custom.
+func (r *RPC) SendTo(ctx context.Context, to Address, msg Message) error {
+	return r.node.SendTo(ctx, to, NewMessage(KindCustom, [32]byte{}, msg))
+}
+
+// Query sends query to the peer and waits for its answer. If ctx has no
+// deadline DefaultQueryTimeout applies.
+func (r *RPC) Query(ctx context.Context, to Address, query []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultQueryTimeout)
+		defer cancel()
+	}
+	var id [32]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	pq := &pendingQuery{ch: make(chan []byte, 1)}
+	pq.peer, pq.peerSet = addrID(to)
+	r.mu.Lock()
+	r.pending[id] = pq
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, id)
+		r.mu.Unlock()
+	}()
+
+	if err := r.node.SendTo(ctx, to, NewMessage(KindQuery, id, query)); err != nil {
+		return nil, err
+	}
+	select {
+	case answer := <-pq.ch:
+		return answer, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w: %w", ErrQueryTimeout, ctx.Err())
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (r *RPC) dispatch(ctx context.Context, from Address, msg Message) {
+	m, err := parseMessage(msg)
+	if err != nil {
+		return
+	}
+	switch MessageKind(m.kind) {
+	case KindCustom:
+		r.mu.Lock()
+		h := r.onMsg
+		r.mu.Unlock()
+		if h != nil {
+			h(ctx, from, m.data)
+		}
+	case KindQuery:
+		r.serve(ctx, from, m.queryID, m.data)
+	case KindAnswer:
+		r.complete(from, m.queryID, m.data)
+	}
+}
+
+func (r *RPC) complete(from Address, id [32]byte, answer []byte) {
+	r.mu.Lock()
+	pq, ok := r.pending[id]
+	if ok && pq.peerSet {
+		got, known := addrID(from)
+		ok = known && got == pq.peer
+	}
+	if ok {
+		delete(r.pending, id)
+	}
+	r.mu.Unlock()
+	if ok {
+		pq.ch <- answer
+	}
+}
+
+// addrID returns the key ID of a, from its public key or its ID in any hex
+// case.
+func addrID(a Address) ([32]byte, bool) {
+	if len(a.PubKey) == ed25519.PublicKeySize {
+		return KeyID(a.PubKey), true
+	}
+	id, err := ParseID(a.ID)
+	return id, err == nil
+}
+
+func (r *RPC) serve(ctx context.Context, from Address, id [32]byte, query []byte) {
+	var constructor uint32
+	if len(query) >= 4 {
+		constructor = binary.LittleEndian.Uint32(query)
+	}
+	r.mu.Lock()
+	h, ok := r.handlers[constructor]
+	r.mu.Unlock()
+	if !ok {
+		return // unknown query: dropped, as ADNL has no error answer
+	}
+	select {
+	case r.inflight <- struct{}{}:
+	default:
+		return // overloaded: the sender times out and may retry
+	}
+	go func() {
+		defer func() { <-r.inflight }()
+		hctx, cancel := context.WithTimeout(ctx, DefaultQueryTimeout)
+		defer cancel()
+		answer, err := h(hctx, from, query)
+		if err != nil {
+			return
+		}
+		_ = r.node.SendTo(ctx, from, NewMessage(KindAnswer, id, answer))
+	}()
+}
+
+var _ ReceivingNode = (*RPC)(nil)
@@ -0,0 +1,263 @@
+package adnl
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+const tlTestQuery uint32 = 0x7e57c0de
+
+func newTestRPC(t *testing.T, nw *MemNetwork) *RPC {
+	t.Helper()
+	node := NewNode(newTestTransport(t, nw, UDPConfig{}))
+	r := NewRPC(node)
+	if err := node.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = node.Close(context.Background()) })
+	return r
+}
+
+func testQuery(body string) []byte {
+	var w tl.Writer
+	w.WriteUint32(tlTestQuery)
+	w.WriteString(body)
+	return w.Bytes()
+}
+
+func TestRPCQuery(t *testing.T) {
+	nw := NewMemNetwork()
+	client, server := newTestRPC(t, nw), newTestRPC(t, nw)
+	server.Handle(tlTestQuery, func(ctx context.Context, from Address, query []byte) ([]byte, error) {
+		r := tl.NewReader(query)
+		r.Uint32()
+		if body := r.String(); body != "ping" {
+			return nil, errors.New("unexpected query " + body)
+		}
+		return []byte("pong"), nil
+	})
+
+	addr := server.LocalAddr()
+	upper := addr
+	upper.ID = strings.ToUpper(addr.ID)
+	noID := addr
+	noID.ID = ""
+	tests := []struct {
+		name    string
+		to      Address
+		query   []byte
+		wantErr error
+	}{
+		{"answered", addr, testQuery("ping"), nil},
+		{"uppercase id", upper, testQuery("ping"), nil},
+		{"no id", noID, testQuery("ping"), nil},
+		{"handler error is dropped", addr, testQuery("boom"), ErrQueryTimeout},
+		{"unknown constructor is dropped", addr, []byte{1, 2, 3, 4}, ErrQueryTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			answer, err := client.Query(ctx, tt.to, tt.query)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Query error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(answer) != "pong" {
+				t.Fatalf("answer %q, want pong", answer)
+			}
+		})
+	}
+}
+
+func TestRPCCompleteMatchesKeyID(t *testing.T) {
+	pub, _ := testKey(t, 7)
+	other, _ := testKey(t, 8)
+	id := KeyID(pub)
+	tests := []struct {
+		name string
+		to   Address // the queried address
+		from Address // the sender of the answer
+		want bool
+	}{
+		{"same key", Address{PubKey: pub}, Address{PubKey: pub}, true},
+		{"uppercase id", Address{ID: strings.ToUpper(hex.EncodeToString(id[:]))}, Address{PubKey: pub}, true},
+		{"queried without id", Address{Host: "1.2.3.4", Port: 1}, Address{PubKey: other}, true},
+		{"other key", Address{PubKey: pub}, Address{PubKey: other}, false},
+		{"sender without id", Address{PubKey: pub}, Address{Host: "1.2.3.4", Port: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RPC{pending: make(map[[32]byte]*pendingQuery)}
+			pq := &pendingQuery{ch: make(chan []byte, 1)}
+			pq.peer, pq.peerSet = addrID(tt.to)
+			qid := [32]byte{1}
+			r.pending[qid] = pq
+			r.complete(tt.from, qid, []byte("answer"))
+			got := len(pq.ch) == 1
+			if got != tt.want {
+				t.Fatalf("answer accepted = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// recordingConn keeps a copy of every datagram written through it.
+type recordingConn struct {
+	net.PacketConn
+	mu   sync.Mutex
+	sent [][]byte
+}
+
+func (c *recordingConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	c.sent = append(c.sent, append([]byte(nil), b...))
+	c.mu.Unlock()
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+// wireMessages decrypts the datagrams c sent to the receiving transport and
+// returns the custom, query, answer and reassembled part messages in them.
+func wireMessages(t *testing.T, c *recordingConn, to *UDPTransport) []message {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var msgs []message
+	parts := make(map[[32]byte][]byte)
+	for _, b := range c.sent {
+		var head [32]byte
+		copy(head[:], b)
+		var plain []byte
+		var err error
+		if head == to.keyID {
+			secret, serr := sharedSecret(to.id.Private, ed25519.PublicKey(b[32:64]))
+			if serr != nil {
+				t.Fatal(serr)
+			}
+			plain, err = open(secret, b[64:])
+		} else {
+			to.mu.Lock()
+			p := to.chans[head]
+			to.mu.Unlock()
+			if p == nil {
+				t.Fatalf("datagram for unknown channel %x", head[:4])
+			}
+			plain, err = open(p.inboundKey(head), b[32:])
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkt, err := decodePacket(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range pkt.messages {
+			switch m.kind {
+			case tlMessageCustom, tlMessageQuery, tlMessageAnswer:
+				msgs = append(msgs, m)
+			case tlMessagePart:
+				buf := append(parts[m.hash], m.data...)
+				parts[m.hash] = buf
+				if len(buf) < int(m.totalSize) {
+					continue
+				}
+				whole, err := parseMessage(buf)
+				if err != nil {
+					t.Fatalf("parts do not carry a serialized message: %v", err)
+				}
+				msgs = append(msgs, whole)
+			}
+		}
+	}
+	return msgs
+}
+
+func TestRPCWireFormat(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	nw := NewMemNetwork()
+	newRecorded := func() (*RPC, *UDPTransport, *recordingConn) {
+		pc, err := nw.ListenPacket("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc := &recordingConn{PacketConn: pc}
+		tr := newTestTransport(t, nw, UDPConfig{PacketConn: rc})
+		node := NewNode(tr)
+		r := NewRPC(node)
+		if err := node.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = node.Close(context.Background()) })
+		return r, tr, rc
+	}
+	client, clientTr, clientConn := newRecorded()
+	server, serverTr, serverConn := newRecorded()
+	server.Handle(tlTestQuery, func(ctx context.Context, from Address, query []byte) ([]byte, error) {
+		return []byte("pong"), nil
+	})
+	received := make(chan []byte, 2)
+	server.SetMessageHandler(func(ctx context.Context, from Address, msg Message) { received <- msg })
+
+	big := bytes.Repeat([]byte("0123456789"), 300)
+	if _, err := client.Query(ctx, server.LocalAddr(), testQuery("ping")); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range [][]byte{[]byte("note"), big} {
+		if err := client.SendTo(ctx, server.LocalAddr(), msg); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-received:
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+	}
+
+	type wire struct {
+		kind uint32
+		data string
+	}
+	tests := []struct {
+		name string
+		got  []message
+		want []wire
+	}{
+		{"client to server", wireMessages(t, clientConn, serverTr), []wire{
+			{tlMessageQuery, string(testQuery("ping"))},
+			{tlMessageCustom, "note"},
+			{tlMessageCustom, string(big)}, // sent as parts
+		}},
+		{"server to client", wireMessages(t, serverConn, clientTr), []wire{
+			{tlMessageAnswer, "pong"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.got) != len(tt.want) {
+				t.Fatalf("%d messages on the wire, want %d", len(tt.got), len(tt.want))
+			}
+			for i, m := range tt.got {
+				if m.kind != tt.want[i].kind || string(m.data) != tt.want[i].data {
+					t.Errorf("message %d: %08x with %d bytes, want %08x with %d bytes",
+						i, m.kind, len(m.data), tt.want[i].kind, len(tt.want[i].data))
+				}
+			}
+		})
+	}
+}
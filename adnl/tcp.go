@@ -0,0 +1,574 @@
+package adnl
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+)
+
+// TCP-level service constructors.
+const (
+	tlTCPPing uint32 = 0x4d082b9a // tcp.ping random_id:long = tcp.Pong
+	tlTCPPong uint32 = 0xdc69fb03 // tcp.pong random_id:long = tcp.Pong
+)
+
+const (
+	tcpHandshakeSize    = 256
+	tcpHandshakeTimeout = 10 * time.Second
+	// maxTCPFrameSize bounds a single frame (nonce + payload + checksum).
+	maxTCPFrameSize = 1 << 24
+	tcpRecvQueue    = 64
+)
+
+// TCPConfig configures a TCPTransport.
+type TCPConfig struct {
+	// Identity is the server key; it is required only for Listen. Outbound
+	// connections use a fresh one-time key for every handshake.
+	Identity keyring.Identity
+}
+
+// TCPTransport implements Transport over TCP as used by lite-servers. The
+// client opens a connection with a 256-byte handshake carrying AES-CTR session
+// parameters encrypted to the server key; afterwards both directions exchange
+// length-prefixed frames: size | nonce[32] | payload | sha256(nonce||payload).
+type TCPTransport struct {
+	id keyring.Identity
+
+	mu      sync.Mutex
+	ln      net.Listener
+	started bool
+	closed  bool
+	conns   map[*tcpConn]struct{}
+	accept  chan *tcpConn
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewTCPTransport creates a TCP transport.
+func NewTCPTransport(cfg TCPConfig) *TCPTransport {
+	return &TCPTransport{
+		id:     cfg.Identity,
+		conns:  make(map[*tcpConn]struct{}),
+		accept: make(chan *tcpConn, acceptQueue),
+		done:   make(chan struct{}),
+	}
+}
+
+// Listen binds a TCP listener on addr.Host:addr.Port. Connections are served
+// once Start is called.
+func (t *TCPTransport) Listen(addr Address) error {
+	if len(t.id.Private) != ed25519.PrivateKeySize {
+		return errors.New("adnl: tcp listen requires a server identity")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ln != nil {
+		return errors.New("adnl: transport is already listening")
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(addr.Host, strconv.Itoa(addr.Port)))
+	if err != nil {
+		return err
+	}
+	t.ln = ln
+	return nil
+}
+
+// Start begins accepting inbound connections if Listen was called.
+func (t *TCPTransport) Start(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrClosed
+	}
+	if t.started {
+		return nil
+	}
+	t.started = true
+	if t.ln != nil {
+		t.wg.Add(1)
+		go t.acceptLoop(t.ln)
+	}
+	return nil
+}
+
+// Close stops listening and closes all connections.
+func (t *TCPTransport) Close(ctx context.Context) error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.done)
+	ln := t.ln
+	conns := make([]*tcpConn, 0, len(t.conns))
+	for c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+
+	var err error
+	if ln != nil {
+		err = ln.Close()
+	}
+	for _, c := range conns {
+		_ = c.Close(ctx)
+	}
+	t.wg.Wait()
+	return err
+}
+
+// LocalAddr returns the listening address and server key.
+func (t *TCPTransport) LocalAddr() Address {
+	var addr Address
+	if len(t.id.Public) == ed25519.PublicKeySize {
+		addr = AddressFromKey(t.id.Public, "", 0)
+	}
+	t.mu.Lock()
+	ln := t.ln
+	t.mu.Unlock()
+	if ln != nil {
+		if ta, ok := ln.Addr().(*net.TCPAddr); ok {
+			addr.Host = ta.IP.String()
+			addr.Port = ta.Port
+		}
+	}
+	return addr
+}
+
+// Dial connects to the server at addr and performs the handshake. addr.PubKey
+// must hold the server key. The returned connection is ready once the server
+// has confirmed the handshake.
+func (t *TCPTransport) Dial(ctx context.Context, addr Address) (Conn, error) {
+	if len(addr.PubKey) != ed25519.PublicKeySize {
+		return nil, ErrNoPubKey
+	}
+	t.mu.Lock()
+	closed := t.closed
+	t.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", net.JoinHostPort(addr.Host, strconv.Itoa(addr.Port)))
+	if err != nil {
+		return nil, err
+	}
+	c, err := clientHandshake(ctx, nc, addr)
+	if err != nil {
+		_ = nc.Close()
+		return nil, err
+	}
+	if !t.track(c) {
+		_ = c.Close(ctx)
+		return nil, ErrClosed
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// Accept waits for an inbound connection that completed the handshake.
+func (t *TCPTransport) Accept(ctx context.Context) (PeerConn, error) {
+	select {
+	case c := <-t.accept:
+		return c, nil
+	case <-t.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *TCPTransport) acceptLoop(ln net.Listener) {
+	defer t.wg.Done()
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			c, err := serverHandshake(nc, t.id)
+			if err != nil {
+				_ = nc.Close()
+				return
+			}
+			if !t.track(c) {
+				_ = c.Close(context.Background())
+				return
+			}
+			go c.readLoop()
+			select {
+			case t.accept <- c:
+			case <-t.done:
+			}
+		}()
+	}
+}
+
+func (t *TCPTransport) track(c *tcpConn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false
+	}
+	t.conns[c] = struct{}{}
+	c.onClose = func() {
+		t.mu.Lock()
+		delete(t.conns, c)
+		t.mu.Unlock()
+	}
+	return true
+}
+
+// tcpConn is one ADNL-over-TCP session and implements PeerConn.
+type tcpConn struct {
+	nc     net.Conn
+	remote Address
+
+	wmu sync.Mutex
+	tx  cipher.Stream
+
+	rx   cipher.Stream
+	br   *bufio.Reader
+	in   chan Message
+	err  error         // read error, valid once done is closed
+	done chan struct{} // closed when the read loop exits
+
+	pmu   sync.Mutex
+	pings map[uint64]chan struct{}
+
+	onClose   func()
+	closeOnce sync.Once
+	shut      chan struct{} // closed by Close
+}
+
+func newCTR(key, iv []byte) (cipher.Stream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewCTR(block, iv), nil
+}
+
+func newTCPConn(nc net.Conn, remote Address, params []byte, server bool) (*tcpConn, error) {
+	// From the client's point of view params[0:32]/[64:80] key and IV the
+	// server-to-client direction and params[32:64]/[80:96] the reverse.
+	rxKey, rxIV, txKey, txIV := params[0:32], params[64:80], params[32:64], params[80:96]
+	if server {
+		rxKey, rxIV, txKey, txIV = txKey, txIV, rxKey, rxIV
+	}
+	rx, err := newCTR(rxKey, rxIV)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := newCTR(txKey, txIV)
+	if err != nil {
+		return nil, err
+	}
+	return &tcpConn{
+		nc:     nc,
+		remote: remote,
+		tx:     tx,
+		rx:     rx,
+		br:     bufio.NewReader(nc),
+		in:     make(chan Message, tcpRecvQueue),
+		pings:  make(map[uint64]chan struct{}),
+		done:   make(chan struct{}),
+		shut:   make(chan struct{}),
+	}, nil
+}
+
+func clientHandshake(ctx context.Context, nc net.Conn, addr Address) (*tcpConn, error) {
+	params := make([]byte, 160)
+	if _, err := rand.Read(params); err != nil {
+		return nil, err
+	}
+	epub, epriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := sharedSecret(epriv, addr.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(secret, params)
+	if err != nil {
+		return nil, err
+	}
+	serverID := KeyID(addr.PubKey)
+	hs := make([]byte, 0, tcpHandshakeSize)
+	hs = append(hs, serverID[:]...)
+	hs = append(hs, epub...)
+	hs = append(hs, sealed...)
+
+	deadline := time.Now().Add(tcpHandshakeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = nc.SetDeadline(deadline)
+	if _, err := nc.Write(hs); err != nil {
+		return nil, err
+	}
+	remote := addr
+	if remote.ID == "" {
+		remote = AddressFromKey(addr.PubKey, addr.Host, addr.Port)
+	}
+	c, err := newTCPConn(nc, remote, params, false)
+	if err != nil {
+		return nil, err
+	}
+	// The server confirms the session with an empty frame.
+	if _, err := c.readFrame(); err != nil {
+		return nil, fmt.Errorf("adnl: tcp handshake: %w", err)
+	}
+	_ = nc.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func serverHandshake(nc net.Conn, id keyring.Identity) (*tcpConn, error) {
+	_ = nc.SetDeadline(time.Now().Add(tcpHandshakeTimeout))
+	hs := make([]byte, tcpHandshakeSize)
+	if _, err := io.ReadFull(nc, hs); err != nil {
+		return nil, err
+	}
+	if want := KeyID(id.Public); subtle.ConstantTimeCompare(hs[:32], want[:]) != 1 {
+		return nil, errors.New("adnl: tcp handshake for unknown key")
+	}
+	clientKey := ed25519.PublicKey(append([]byte(nil), hs[32:64]...))
+	secret, err := sharedSecret(id.Private, clientKey)
+	if err != nil {
+		return nil, err
+	}
+	params, err := open(secret, hs[64:])
+	if err != nil {
+		return nil, err
+	}
+	remote := AddressFromKey(clientKey, "", 0)
+	if ta, ok := nc.RemoteAddr().(*net.TCPAddr); ok {
+		remote.Host = ta.IP.String()
+		remote.Port = ta.Port
+	}
+	c, err := newTCPConn(nc, remote, params, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.writeFrame(nil); err != nil {
+		return nil, err
+	}
+	_ = nc.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// RemoteAddr returns the peer address. For server-side connections the key is
+// the client's one-time handshake key.
+func (c *tcpConn) RemoteAddr() Address { return c.remote }
+
+// Send writes msg as one frame.
+func (c *tcpConn) Send(ctx context.Context, msg Message) error {
+	select {
+	case <-c.shut:
+		return ErrClosed
+	default:
+	}
+	if len(msg)+64 > maxTCPFrameSize {
+		return fmt.Errorf("adnl: message too large (%d bytes)", len(msg))
+	}
+	d, _ := ctx.Deadline()
+	return c.writeFrameBy(msg, d)
+}
+
+// Recv returns the next non-service frame.
+func (c *tcpConn) Recv(ctx context.Context) (Message, error) {
+	select {
+	case msg := <-c.in:
+		return msg, nil
+	case <-c.done:
+		select {
+		case msg := <-c.in:
+			return msg, nil
+		default:
+		}
+		if c.err != nil && !errors.Is(c.err, net.ErrClosed) {
+			return nil, c.err
+		}
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close closes the underlying TCP connection.
+func (c *tcpConn) Close(ctx context.Context) error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.shut)
+		err = c.nc.Close()
+		if c.onClose != nil {
+			c.onClose()
+		}
+	})
+	return err
+}
+
+// Ping implements Pinger: it sends tcp.ping and waits for the matching tcp.pong, returning the RTT.
+func (c *tcpConn) Ping(ctx context.Context) (time.Duration, error) {
+	var idb [8]byte
+	if _, err := rand.Read(idb[:]); err != nil {
+		return 0, err
+	}
+	id := binary.LittleEndian.Uint64(idb[:])
+	ch := make(chan struct{})
+	c.pmu.Lock()
+	c.pings[id] = ch
+	c.pmu.Unlock()
+	defer func() {
+		c.pmu.Lock()
+		delete(c.pings, id)
+		c.pmu.Unlock()
+	}()
+	start := time.Now()
+	if err := c.Send(ctx, tcpService(tlTCPPing, id)); err != nil {
+		return 0, err
+	}
+	select {
+	case <-ch:
+		return time.Since(start), nil
+	case <-c.done:
+		return 0, ErrClosed
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func tcpService(constructor uint32, id uint64) []byte {
+	b := make([]byte, 12)
+	binary.LittleEndian.PutUint32(b, constructor)
+	binary.LittleEndian.PutUint64(b[4:], id)
+	return b
+}
+
+func (c *tcpConn) readLoop() {
+	defer close(c.done)
+	for {
+		payload, err := c.readFrame()
+		if err != nil {
+			c.err = err
+			_ = c.Close(context.Background())
+			return
+		}
+		if len(payload) == 0 {
+			continue // keepalive / handshake confirmation
+		}
+		if len(payload) == 12 {
+			constructor := binary.LittleEndian.Uint32(payload)
+			id := binary.LittleEndian.Uint64(payload[4:])
+			switch constructor {
+			case tlTCPPing:
+				_ = c.writeFrame(tcpService(tlTCPPong, id))
+				continue
+			case tlTCPPong:
+				c.pmu.Lock()
+				if ch, ok := c.pings[id]; ok {
+					close(ch)
+					delete(c.pings, id)
+				}
+				c.pmu.Unlock()
+				continue
+			}
+		}
+		// Blocking here applies TCP backpressure to the peer.
+		select {
+		case c.in <- payload:
+		case <-c.shut:
+			return
+		}
+	}
+}
+
+func (c *tcpConn) writeFrame(payload []byte) error { return c.writeFrameBy(payload, time.Time{}) }
+
+// writeFrameBy writes one frame, by deadline when it is not zero. The
+// deadline is set and cleared under c.wmu so that concurrent writers do not
+// clear each other's. A failed write leaves the cipher stream out of step
+// with the peer, so the connection is closed.
+func (c *tcpConn) writeFrameBy(payload []byte, deadline time.Time) error {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	h := sha256.New()
+	h.Write(nonce)
+	h.Write(payload)
+	frame := make([]byte, 4, 4+32+len(payload)+32)
+	binary.LittleEndian.PutUint32(frame, uint32(32+len(payload)+32))
+	frame = append(frame, nonce...)
+	frame = append(frame, payload...)
+	frame = h.Sum(frame)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if !deadline.IsZero() {
+		if !time.Now().Before(deadline) {
+			return os.ErrDeadlineExceeded
+		}
+		_ = c.nc.SetWriteDeadline(deadline)
+		defer c.nc.SetWriteDeadline(time.Time{})
+	}
+	c.tx.XORKeyStream(frame, frame)
+	if _, err := c.nc.Write(frame); err != nil {
+		_ = c.Close(context.Background())
+		return err
+	}
+	return nil
+}
+
+// readFrame is only called from the handshake and then from readLoop.
+func (c *tcpConn) readFrame() ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return nil, err
+	}
+	c.rx.XORKeyStream(hdr[:], hdr[:])
+	size := binary.LittleEndian.Uint32(hdr[:])
+	if size < 64 || size > maxTCPFrameSize {
+		return nil, fmt.Errorf("adnl: invalid tcp frame size %d", size)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(c.br, body); err != nil {
+		return nil, err
+	}
+	c.rx.XORKeyStream(body, body)
+	sum := sha256.Sum256(body[:size-32])
+	if subtle.ConstantTimeCompare(sum[:], body[size-32:]) != 1 {
+		return nil, errors.New("adnl: tcp frame checksum mismatch")
+	}
+	return body[32 : size-32], nil
+}
+
+var (
+	_ Acceptor = (*TCPTransport)(nil)
+	_ PeerConn = (*tcpConn)(nil)
+	_ Pinger   = (*tcpConn)(nil)
+)
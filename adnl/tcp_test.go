@@ -0,0 +1,94 @@
+package adnl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+)
+
+// tcpPair returns both ends of a TCP connection over loopback.
+func tcpPair(t *testing.T) (client Conn, server PeerConn) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	id, _ := keyring.LoadIdentity("")
+	srv := NewTCPTransport(TCPConfig{Identity: id})
+	if err := srv.Listen(Address{Host: "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = srv.Close(context.Background()) })
+	cli := NewTCPTransport(TCPConfig{})
+	t.Cleanup(func() { _ = cli.Close(context.Background()) })
+	c, err := cli.Dial(ctx, srv.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := srv.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, s
+}
+
+func TestTCPConcurrentSendDeadlines(t *testing.T) {
+	client, server := tcpPair(t)
+	const senders, perSender = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perSender; j++ {
+				// Deadlines of different lengths, set and cleared concurrently.
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(1+j%3)*time.Second)
+				err := client.Send(ctx, []byte(fmt.Sprintf("%d/%d", i, j)))
+				cancel()
+				if err != nil {
+					t.Errorf("Send: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	seen := make(map[string]bool)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for len(seen) < senders*perSender {
+		msg, err := server.Recv(ctx)
+		if err != nil {
+			t.Fatalf("after %d messages: %v", len(seen), err)
+		}
+		seen[string(msg)] = true
+	}
+}
+
+func TestTCPSendExpiredDeadline(t *testing.T) {
+	client, server := tcpPair(t)
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if err := client.Send(expired, []byte("late")); err == nil {
+		t.Fatal("Send with an expired deadline succeeded")
+	}
+	// Nothing was written, so the connection stays usable and the deadline
+	// does not linger.
+	ctx, cancel2 := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel2()
+	if err := client.Send(context.Background(), []byte("on time")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != "on time" {
+		t.Fatalf("received %q", msg)
+	}
+}
@@ -0,0 +1,924 @@
+package adnl
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+const (
+	maxDatagramSize = 1500
+	// maxPartSize keeps a single part plus packet overhead below a typical MTU.
+	maxPartSize = 896
+	// maxMessageSize bounds reassembled messages.
+	maxMessageSize = 1 << 20
+	// maxPartials bounds in-flight reassemblies per peer, and
+	// maxPartialBytes the buffers they hold across all peers.
+	maxPartials     = 16
+	maxPartialBytes = 64 << 20
+	partialTTL      = 10 * time.Second
+	// channelIdle is how long a channel may go without inbound traffic before
+	// packets are sent through the handshake path again, so that a restarted
+	// peer (which no longer knows the channel) can re-establish it. Peers
+	// idle for that long in both directions are forgotten.
+	channelIdle   = 20 * time.Second
+	peerRecvQueue = 256
+	acceptQueue   = 128
+
+	// DefaultMaxUDPPeers bounds the peers a UDPTransport keeps state for
+	// when UDPConfig.MaxPeers is zero.
+	DefaultMaxUDPPeers = 1024
+)
+
+var (
+	// ErrClosed is returned by operations on a closed transport or connection.
+	ErrClosed = errors.New("adnl: closed")
+	// ErrNoPubKey is returned when dialing a datagram peer without its public key.
+	ErrNoPubKey = errors.New("adnl: peer public key is required")
+	// ErrTooManyPeers is returned by Dial when the transport keeps state for
+	// MaxPeers peers, none of them idle.
+	ErrTooManyPeers = errors.New("adnl: too many peers")
+)
+
+// UDPConfig configures a UDPTransport.
+type UDPConfig struct {
+	Identity keyring.Identity
+	// PacketConn optionally supplies an already bound socket (or an in-memory
+	// substitute). When nil, Listen or Start binds a UDP socket.
+	PacketConn net.PacketConn
+	// MaxPeers bounds the peers kept at once; zero selects
+	// DefaultMaxUDPPeers. Packets from new peers beyond it are dropped.
+	MaxPeers int
+}
+
+// UDPTransport implements Transport over UDP datagrams. Packets are addressed
+// by the receiver's short key ID; the first packets to a peer are encrypted
+// with an ECDH secret between a one-time key and the peer's identity key, after
+// which both sides switch to a per-peer channel keyed by exchanged channel keys.
+//
+// Peers without traffic for a while are forgotten and their connections
+// closed, and at most MaxPeers are kept, so that throwaway keys cannot
+// exhaust memory.
+type UDPTransport struct {
+	id       keyring.Identity
+	keyID    [32]byte
+	reinit   uint32
+	maxPeers int
+
+	partialBytes atomic.Int64 // held by reassembly buffers of all peers
+
+	mu      sync.Mutex
+	pc      net.PacketConn
+	started bool
+	closed  bool
+	peers   map[[32]byte]*udpPeer // by peer key ID
+	chans   map[[32]byte]*udpPeer // by inbound channel ID
+	accept  chan *udpPeer
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewUDPTransport creates a transport bound to the given identity.
+func NewUDPTransport(cfg UDPConfig) *UDPTransport {
+	if cfg.MaxPeers <= 0 {
+		cfg.MaxPeers = DefaultMaxUDPPeers
+	}
+	return &UDPTransport{
+		id:       cfg.Identity,
+		keyID:    KeyID(cfg.Identity.Public),
+		reinit:   uint32(time.Now().Unix()),
+		maxPeers: cfg.MaxPeers,
+		pc:       cfg.PacketConn,
+		peers:    make(map[[32]byte]*udpPeer),
+		chans:    make(map[[32]byte]*udpPeer),
+		accept:   make(chan *udpPeer, acceptQueue),
+		done:     make(chan struct{}),
+	}
+}
+
+// Listen binds the UDP socket to addr.Host:addr.Port.
+func (t *UDPTransport) Listen(addr Address) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pc != nil {
+		return errors.New("adnl: transport is already listening")
+	}
+	pc, err := net.ListenPacket("udp", net.JoinHostPort(addr.Host, strconv.Itoa(addr.Port)))
+	if err != nil {
+		return err
+	}
+	t.pc = pc
+	return nil
+}
+
+// Start begins processing inbound packets. If Listen was not called an
+// ephemeral port is bound.
+func (t *UDPTransport) Start(ctx context.Context) error {
+	if len(t.id.Private) != ed25519.PrivateKeySize {
+		return errors.New("adnl: transport identity is not set")
+	}
+	t.mu.Lock()
+	bound := t.pc != nil
+	t.mu.Unlock()
+	if !bound {
+		if err := t.Listen(Address{}); err != nil {
+			return err
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrClosed
+	}
+	if t.started {
+		return nil
+	}
+	t.started = true
+	t.wg.Add(2)
+	go t.readLoop()
+	go t.sweepLoop()
+	return nil
+}
+
+// Close stops the transport and closes every peer connection.
+func (t *UDPTransport) Close(ctx context.Context) error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.done)
+	peers := make([]*udpPeer, 0, len(t.peers))
+	for _, p := range t.peers {
+		peers = append(peers, p)
+	}
+	t.peers = make(map[[32]byte]*udpPeer)
+	t.chans = make(map[[32]byte]*udpPeer)
+	pc := t.pc
+	t.mu.Unlock()
+
+	for _, p := range peers {
+		p.shutdown()
+	}
+	var err error
+	if pc != nil {
+		err = pc.Close()
+	}
+	t.wg.Wait()
+	return err
+}
+
+// LocalAddr returns the address other peers should use to reach this transport.
+func (t *UDPTransport) LocalAddr() Address {
+	addr := AddressFromKey(t.id.Public, "", 0)
+	t.mu.Lock()
+	pc := t.pc
+	t.mu.Unlock()
+	if pc == nil {
+		return addr
+	}
+	if ua, ok := pc.LocalAddr().(*net.UDPAddr); ok {
+		addr.Host = ua.IP.String()
+		addr.Port = ua.Port
+	}
+	return addr
+}
+
+// Dial returns the connection to the peer at addr, creating it if needed.
+// No packets are exchanged until the first Send.
+func (t *UDPTransport) Dial(ctx context.Context, addr Address) (Conn, error) {
+	if len(addr.PubKey) != ed25519.PublicKeySize {
+		return nil, ErrNoPubKey
+	}
+	id := KeyID(addr.PubKey)
+	if addr.ID != "" {
+		want, err := ParseID(addr.ID)
+		if err != nil {
+			return nil, fmt.Errorf("adnl: invalid address id: %w", err)
+		}
+		if want != id {
+			return nil, errors.New("adnl: address id does not match public key")
+		}
+	}
+	if id == t.keyID {
+		return nil, errors.New("adnl: cannot dial self")
+	}
+	ua, err := net.ResolveUDPAddr("udp", net.JoinHostPort(addr.Host, strconv.Itoa(addr.Port)))
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil, ErrClosed
+	}
+	p, ok := t.peers[id]
+	var evicted []*udpPeer
+	if !ok {
+		if evicted, err = t.makeRoomLocked(time.Now()); err != nil {
+			t.mu.Unlock()
+			shutdownAll(evicted)
+			return nil, err
+		}
+		p, err = newUDPPeer(t, append(ed25519.PublicKey(nil), addr.PubKey...), ua)
+		if err != nil {
+			t.mu.Unlock()
+			shutdownAll(evicted)
+			return nil, err
+		}
+		t.peers[id] = p
+	}
+	t.mu.Unlock()
+	shutdownAll(evicted)
+	if ok {
+		p.setAddr(ua)
+	}
+	return p, nil
+}
+
+// Accept waits for a connection opened by a remote peer.
+func (t *UDPTransport) Accept(ctx context.Context) (PeerConn, error) {
+	select {
+	case p := <-t.accept:
+		return p, nil
+	case <-t.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *UDPTransport) readLoop() {
+	defer t.wg.Done()
+	buf := make([]byte, maxDatagramSize*2)
+	for {
+		n, from, err := t.pc.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-t.done:
+				return
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		t.handleDatagram(append([]byte(nil), buf[:n]...), from)
+	}
+}
+
+func (t *UDPTransport) handleDatagram(b []byte, from net.Addr) {
+	if len(b) < 64 {
+		return
+	}
+	var head [32]byte
+	copy(head[:], b[:32])
+
+	if head == t.keyID {
+		if len(b) < 96 {
+			return
+		}
+		secret, err := sharedSecret(t.id.Private, ed25519.PublicKey(b[32:64]))
+		if err != nil {
+			return
+		}
+		plain, err := open(secret, b[64:])
+		if err != nil {
+			return
+		}
+		pkt, err := decodePacket(plain)
+		if err != nil {
+			return
+		}
+		pub := pkt.from
+		if pub == nil && pkt.flags&flagFromShort != 0 {
+			// Known peers may identify themselves by short ID only.
+			pub = t.knownKey(pkt.fromShort)
+		}
+		if pub == nil || !pkt.verify(pub) {
+			return
+		}
+		p, fresh := t.peerFor(pub, from)
+		if p == nil {
+			return
+		}
+		p.handlePacket(pkt, false, from)
+		if fresh {
+			t.offer(p)
+		}
+		return
+	}
+
+	t.mu.Lock()
+	p := t.chans[head]
+	t.mu.Unlock()
+	if p == nil {
+		return
+	}
+	secret := p.inboundKey(head)
+	if secret == nil {
+		return
+	}
+	plain, err := open(secret, b[32:])
+	if err != nil {
+		return
+	}
+	pkt, err := decodePacket(plain)
+	if err != nil {
+		return
+	}
+	p.handlePacket(pkt, true, from)
+}
+
+// peerFor returns the peer for pub, registering it when unknown and there
+// is room for it.
+func (t *UDPTransport) peerFor(pub ed25519.PublicKey, from net.Addr) (*udpPeer, bool) {
+	id := KeyID(pub)
+	if id == t.keyID {
+		return nil, false
+	}
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil, false
+	}
+	if p, ok := t.peers[id]; ok {
+		t.mu.Unlock()
+		return p, false
+	}
+	if len(t.accept) == cap(t.accept) {
+		// Nobody is accepting; refuse new peers rather than queueing unboundedly.
+		t.mu.Unlock()
+		return nil, false
+	}
+	evicted, err := t.makeRoomLocked(time.Now())
+	var p *udpPeer
+	if err == nil {
+		p, err = newUDPPeer(t, append(ed25519.PublicKey(nil), pub...), from)
+	}
+	if err == nil {
+		t.peers[id] = p
+	}
+	t.mu.Unlock()
+	shutdownAll(evicted)
+	if err != nil {
+		return nil, false
+	}
+	return p, true
+}
+
+// makeRoomLocked makes sure another peer fits, forgetting idle peers when
+// the transport is full. The caller shuts the evicted peers down once t.mu
+// is released.
+func (t *UDPTransport) makeRoomLocked(now time.Time) ([]*udpPeer, error) {
+	if len(t.peers) < t.maxPeers {
+		return nil, nil
+	}
+	evicted := t.evictIdleLocked(now)
+	if len(t.peers) >= t.maxPeers {
+		return evicted, ErrTooManyPeers
+	}
+	return evicted, nil
+}
+
+// evictIdleLocked forgets the peers idle for channelIdle and returns them.
+func (t *UDPTransport) evictIdleLocked(now time.Time) []*udpPeer {
+	var evicted []*udpPeer
+	for _, p := range t.peers {
+		if p.idle(now) {
+			t.forgetLocked(p)
+			evicted = append(evicted, p)
+		}
+	}
+	return evicted
+}
+
+// sweepLoop forgets idle peers, closing their connections.
+func (t *UDPTransport) sweepLoop() {
+	defer t.wg.Done()
+	tick := time.NewTicker(channelIdle / 2)
+	defer tick.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case now := <-tick.C:
+			t.mu.Lock()
+			evicted := t.evictIdleLocked(now)
+			t.mu.Unlock()
+			shutdownAll(evicted)
+		}
+	}
+}
+
+func shutdownAll(peers []*udpPeer) {
+	for _, p := range peers {
+		p.shutdown()
+	}
+}
+
+// knownKey returns the public key of the known peer with short ID id.
+func (t *UDPTransport) knownKey(id [32]byte) ed25519.PublicKey {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.peers[id]; ok {
+		return p.pub
+	}
+	return nil
+}
+
+func (t *UDPTransport) offer(p *udpPeer) {
+	select {
+	case t.accept <- p:
+	default:
+	}
+}
+
+func (t *UDPTransport) setChannel(p *udpPeer, oldID, newID [32]byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cur, ok := t.chans[oldID]; ok && cur == p {
+		delete(t.chans, oldID)
+	}
+	if !t.closed {
+		t.chans[newID] = p
+	}
+}
+
+func (t *UDPTransport) forget(p *udpPeer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.forgetLocked(p)
+}
+
+func (t *UDPTransport) forgetLocked(p *udpPeer) {
+	if cur, ok := t.peers[p.id]; ok && cur == p {
+		delete(t.peers, p.id)
+	}
+	for id, cur := range t.chans {
+		if cur == p {
+			delete(t.chans, id)
+		}
+	}
+}
+
+func (t *UDPTransport) write(b []byte, to net.Addr) error {
+	t.mu.Lock()
+	pc, closed := t.pc, t.closed
+	t.mu.Unlock()
+	if closed || pc == nil {
+		return ErrClosed
+	}
+	_, err := pc.WriteTo(b, to)
+	return err
+}
+
+// udpPeer is the per-peer state of a UDPTransport and implements PeerConn.
+type udpPeer struct {
+	t   *UDPTransport
+	id  [32]byte
+	pub ed25519.PublicKey
+
+	mu          sync.Mutex
+	addr        net.Addr
+	sendSeqno   uint64
+	recvSeqno   uint64
+	recvMask    uint64
+	theirReinit uint32
+
+	// channel state
+	chanPriv  ed25519.PrivateKey
+	chanPub   ed25519.PublicKey
+	chanDate  uint32
+	peerChan  ed25519.PublicKey
+	outID     [32]byte
+	outKey    []byte
+	inID      [32]byte
+	inKey     []byte
+	chanReady bool // the peer is known to hold our channel key
+	lastRecv  time.Time
+	lastNop   time.Time
+	// active is the time of the last packet sent or received, in unix
+	// nanoseconds; it is read without p.mu when sweeping idle peers.
+	active atomic.Int64
+
+	partials map[[32]byte]*partial
+
+	recv      chan Message
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+type partial struct {
+	buf      []byte
+	got      map[uint32]bool
+	filled   uint32
+	deadline time.Time
+}
+
+func newUDPPeer(t *UDPTransport, pub ed25519.PublicKey, addr net.Addr) (*udpPeer, error) {
+	cpub, cpriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	p := &udpPeer{
+		t:        t,
+		id:       KeyID(pub),
+		pub:      pub,
+		addr:     addr,
+		chanPriv: cpriv,
+		chanPub:  cpub,
+		chanDate: uint32(time.Now().Unix()),
+		partials: make(map[[32]byte]*partial),
+		recv:     make(chan Message, peerRecvQueue),
+		closed:   make(chan struct{}),
+	}
+	p.touch(time.Now())
+	return p, nil
+}
+
+func (p *udpPeer) touch(now time.Time) { p.active.Store(now.UnixNano()) }
+
+// idle reports whether the peer had no traffic for channelIdle.
+func (p *udpPeer) idle(now time.Time) bool {
+	return now.Sub(time.Unix(0, p.active.Load())) >= channelIdle
+}
+
+// RemoteAddr returns the peer's current address.
+func (p *udpPeer) RemoteAddr() Address {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	addr := AddressFromKey(p.pub, "", 0)
+	if ua, ok := p.addr.(*net.UDPAddr); ok {
+		addr.Host = ua.IP.String()
+		addr.Port = ua.Port
+	} else if p.addr != nil {
+		if host, port, err := net.SplitHostPort(p.addr.String()); err == nil {
+			addr.Host = host
+			addr.Port, _ = strconv.Atoi(port)
+		}
+	}
+	return addr
+}
+
+func (p *udpPeer) setAddr(a net.Addr) {
+	p.mu.Lock()
+	p.addr = a
+	p.mu.Unlock()
+}
+
+// Send delivers msg to the peer as the ADNL message it is boxed as. A message
+// that does not fit into a single datagram is serialized into
+// adnl.message.part chunks. Delivery is best-effort.
+func (p *udpPeer) Send(ctx context.Context, msg Message) error {
+	if len(msg) > maxMessageSize {
+		return fmt.Errorf("adnl: message too large (%d > %d)", len(msg), maxMessageSize)
+	}
+	m, err := parseMessage(msg)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-p.closed:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	if len(msg) <= maxPartSize {
+		return p.sendPacket([]message{m})
+	}
+	hash := sha256.Sum256(msg)
+	for off := 0; off < len(msg); off += maxPartSize {
+		end := min(off+maxPartSize, len(msg))
+		part := message{
+			kind:      tlMessagePart,
+			hash:      hash,
+			totalSize: uint32(len(msg)),
+			offset:    uint32(off),
+			data:      msg[off:end],
+		}
+		if err := p.sendPacket([]message{part}); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recv returns the next message received from the peer.
+func (p *udpPeer) Recv(ctx context.Context) (Message, error) {
+	select {
+	case msg := <-p.recv:
+		return msg, nil
+	case <-p.closed:
+		select {
+		case msg := <-p.recv:
+			return msg, nil
+		default:
+			return nil, ErrClosed
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close forgets the peer. A later packet from it opens a new connection.
+func (p *udpPeer) Close(ctx context.Context) error {
+	p.t.forget(p)
+	p.shutdown()
+	return nil
+}
+
+func (p *udpPeer) shutdown() {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+		p.mu.Lock()
+		p.clearPartialsLocked()
+		p.mu.Unlock()
+	})
+}
+
+func (p *udpPeer) inboundKey(id [32]byte) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if id != p.inID {
+		return nil
+	}
+	return p.inKey
+}
+
+func (p *udpPeer) sendPacket(msgs []message) error {
+	p.mu.Lock()
+	p.sendSeqno++
+	pkt := newPacket(msgs)
+	pkt.seqno = p.sendSeqno
+	pkt.confirmSeqno = p.recvSeqno
+	pkt.reinitDate = p.t.reinit
+	pkt.dstReinitDate = p.theirReinit
+	viaChannel := p.chanReady && time.Since(p.lastRecv) < channelIdle
+	if !viaChannel {
+		pkt.from = p.t.id.Public
+		ctl := message{kind: tlMessageCreateChannel, key: p.chanPub, date: p.chanDate}
+		if p.peerChan != nil {
+			ctl = message{kind: tlMessageConfirmChannel, key: p.chanPub, peerKey: p.peerChan, date: p.chanDate}
+		}
+		pkt.messages = append([]message{ctl}, msgs...)
+	}
+	pkt.setFlags()
+	outID, outKey, addr := p.outID, p.outKey, p.addr
+	p.mu.Unlock()
+	p.touch(time.Now())
+
+	var datagram []byte
+	if viaChannel {
+		sealed, err := seal(outKey, pkt.encode(false))
+		if err != nil {
+			return err
+		}
+		datagram = append(outID[:], sealed...)
+	} else {
+		pkt.sign(p.t.id.Private)
+		epub, epriv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		secret, err := sharedSecret(epriv, p.pub)
+		if err != nil {
+			return err
+		}
+		sealed, err := seal(secret, pkt.encode(true))
+		if err != nil {
+			return err
+		}
+		datagram = make([]byte, 0, 64+len(sealed))
+		datagram = append(datagram, p.id[:]...)
+		datagram = append(datagram, epub...)
+		datagram = append(datagram, sealed...)
+	}
+	return p.t.write(datagram, addr)
+}
+
+func (p *udpPeer) handlePacket(pkt *packet, viaChannel bool, from net.Addr) {
+	var deliver []Message
+	needConfirm := false
+
+	p.mu.Lock()
+	if pkt.reinitDate != 0 {
+		switch {
+		case pkt.reinitDate < p.theirReinit:
+			p.mu.Unlock()
+			return // from a previous incarnation of the peer
+		case pkt.reinitDate > p.theirReinit:
+			if p.theirReinit != 0 && !viaChannel {
+				p.resetLocked()
+			}
+			p.theirReinit = pkt.reinitDate
+		}
+	}
+	if pkt.dstReinitDate != 0 && pkt.dstReinitDate < p.t.reinit {
+		// Addressed to our previous incarnation: tell the peer our new
+		// reinit date so that it resets its state for us.
+		stale := !viaChannel && time.Since(p.lastNop) > time.Second
+		if stale {
+			p.lastNop = time.Now()
+			p.addr = from
+		}
+		p.mu.Unlock()
+		if stale {
+			_ = p.sendPacket([]message{{kind: tlMessageNop}})
+		}
+		return
+	}
+	if !p.acceptSeqnoLocked(pkt.seqno) {
+		p.mu.Unlock()
+		return
+	}
+	p.addr = from
+	p.lastRecv = time.Now()
+	p.touch(p.lastRecv)
+	if viaChannel {
+		p.chanReady = true
+	}
+	for _, m := range pkt.messages {
+		switch m.kind {
+		case tlMessageCreateChannel:
+			p.setPeerChannelLocked(m.key)
+			if !p.chanReady && time.Since(p.lastNop) > time.Second {
+				p.lastNop = time.Now()
+				needConfirm = true
+			}
+		case tlMessageConfirmChannel:
+			if bytes.Equal(m.peerKey, p.chanPub) {
+				p.setPeerChannelLocked(m.key)
+				p.chanReady = true
+			}
+		case tlMessageCustom, tlMessageQuery, tlMessageAnswer:
+			var w tl.Writer
+			m.encode(&w)
+			deliver = append(deliver, Message(w.Bytes()))
+		case tlMessagePart:
+			if msg := p.addPartLocked(m); msg != nil {
+				deliver = append(deliver, msg)
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	for _, msg := range deliver {
+		select {
+		case p.recv <- msg:
+		default:
+			// Receiver is not keeping up; datagram semantics allow dropping.
+		}
+	}
+	if needConfirm {
+		_ = p.sendPacket([]message{{kind: tlMessageNop}})
+	}
+}
+
+// acceptSeqnoLocked implements a 64-packet anti-replay window.
+func (p *udpPeer) acceptSeqnoLocked(s uint64) bool {
+	if s == 0 {
+		return false
+	}
+	if s > p.recvSeqno {
+		shift := s - p.recvSeqno
+		if shift >= 64 {
+			p.recvMask = 0
+		} else {
+			p.recvMask <<= shift
+		}
+		p.recvMask |= 1
+		p.recvSeqno = s
+		return true
+	}
+	diff := p.recvSeqno - s
+	if diff >= 64 {
+		return false
+	}
+	bit := uint64(1) << diff
+	if p.recvMask&bit != 0 {
+		return false
+	}
+	p.recvMask |= bit
+	return true
+}
+
+// resetLocked drops sequence and channel state after the peer restarted.
+func (p *udpPeer) resetLocked() {
+	p.recvSeqno = 0
+	p.recvMask = 0
+	p.peerChan = nil
+	p.chanReady = false
+	p.clearPartialsLocked()
+}
+
+// clearPartialsLocked abandons every reassembly.
+func (p *udpPeer) clearPartialsLocked() {
+	for h := range p.partials {
+		p.dropPartialLocked(h)
+	}
+}
+
+// dropPartialLocked abandons a reassembly and releases its buffer.
+func (p *udpPeer) dropPartialLocked(h [32]byte) {
+	if pt, ok := p.partials[h]; ok {
+		delete(p.partials, h)
+		p.t.partialBytes.Add(-int64(len(pt.buf)))
+	}
+}
+
+// setPeerChannelLocked derives channel keys from the peer's channel key. The
+// side with the smaller key ID encrypts with the secret as-is and decrypts
+// with its byte-reversed form; the other side does the opposite.
+func (p *udpPeer) setPeerChannelLocked(key ed25519.PublicKey) {
+	if len(key) != ed25519.PublicKeySize || bytes.Equal(key, p.peerChan) {
+		return
+	}
+	secret, err := sharedSecret(p.chanPriv, key)
+	if err != nil {
+		return
+	}
+	rev := make([]byte, len(secret))
+	for i := range secret {
+		rev[len(secret)-1-i] = secret[i]
+	}
+	out, in := secret, rev
+	if bytes.Compare(p.t.keyID[:], p.id[:]) > 0 {
+		out, in = rev, secret
+	}
+	oldIn := p.inID
+	p.peerChan = append(ed25519.PublicKey(nil), key...)
+	p.outKey, p.inKey = out, in
+	p.outID = tlKeyHash(tlPubAES, out)
+	p.inID = tlKeyHash(tlPubAES, in)
+	p.chanReady = false
+	p.t.setChannel(p, oldIn, p.inID)
+}
+
+func (p *udpPeer) addPartLocked(m message) Message {
+	now := time.Now()
+	for h, pt := range p.partials {
+		if now.After(pt.deadline) {
+			p.dropPartialLocked(h)
+		}
+	}
+	if m.totalSize == 0 || m.totalSize > maxMessageSize || uint64(m.offset)+uint64(len(m.data)) > uint64(m.totalSize) {
+		return nil
+	}
+	pt, ok := p.partials[m.hash]
+	if !ok {
+		if len(p.partials) >= maxPartials {
+			return nil
+		}
+		if p.t.partialBytes.Add(int64(m.totalSize)) > maxPartialBytes {
+			p.t.partialBytes.Add(-int64(m.totalSize))
+			return nil
+		}
+		pt = &partial{buf: make([]byte, m.totalSize), got: make(map[uint32]bool), deadline: now.Add(partialTTL)}
+		p.partials[m.hash] = pt
+	}
+	if uint32(len(pt.buf)) != m.totalSize || pt.got[m.offset] {
+		return nil
+	}
+	pt.got[m.offset] = true
+	copy(pt.buf[m.offset:], m.data)
+	pt.filled += uint32(len(m.data))
+	if pt.filled < m.totalSize {
+		return nil
+	}
+	p.dropPartialLocked(m.hash)
+	if sha256.Sum256(pt.buf) != m.hash {
+		return nil
+	}
+	if _, err := parseMessage(pt.buf); err != nil {
+		return nil // parts carry a custom, query or answer message only
+	}
+	return Message(pt.buf)
+}
+
+var (
+	_ Acceptor = (*UDPTransport)(nil)
+	_ PeerConn = (*udpPeer)(nil)
+)
@@ -0,0 +1,186 @@
+package adnl
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+)
+
+func newTestTransport(t *testing.T, nw *MemNetwork, cfg UDPConfig) *UDPTransport {
+	t.Helper()
+	if cfg.PacketConn == nil {
+		pc, err := nw.ListenPacket("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.PacketConn = pc
+	}
+	if len(cfg.Identity.Private) == 0 {
+		cfg.Identity, _ = keyring.LoadIdentity("")
+	}
+	tr := NewUDPTransport(cfg)
+	if err := tr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tr.Close(context.Background()) })
+	return tr
+}
+
+func TestUDPExchange(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	nw := NewMemNetwork()
+	a := newTestTransport(t, nw, UDPConfig{})
+	b := newTestTransport(t, nw, UDPConfig{})
+
+	c, err := a.Dial(ctx, b.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := NewMessage(KindCustom, [32]byte{}, []byte("hello"))
+	big := NewMessage(KindQuery, [32]byte{1}, bytes.Repeat([]byte("0123456789"), 1000)) // sent as parts
+	for _, msg := range []Message{hello, big} {
+		if err := c.Send(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Send(ctx, []byte("unboxed")); err != ErrBadMessage {
+		t.Fatalf("Send of an unboxed payload = %v, want ErrBadMessage", err)
+	}
+	in, err := b.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := in.RemoteAddr().ID; got != a.LocalAddr().ID {
+		t.Fatalf("accepted peer %s, want %s", got, a.LocalAddr().ID)
+	}
+	for _, want := range []Message{hello, big} {
+		got, err := in.Recv(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("received %d bytes, want %d", len(got), len(want))
+		}
+	}
+
+	// The answer travels back over the channel set up by the handshake.
+	pong := NewMessage(KindAnswer, [32]byte{1}, []byte("pong"))
+	if err := in.Send(ctx, pong); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Recv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, pong) {
+		t.Fatalf("received %x, want %x", got, pong)
+	}
+}
+
+func TestUDPPeerLimit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	nw := NewMemNetwork()
+	server := newTestTransport(t, nw, UDPConfig{MaxPeers: 1})
+	node := NewNode(server)
+	received := make(chan string, 8)
+	node.SetMessageHandler(func(ctx context.Context, from Address, msg Message) {
+		m, _ := parseMessage(msg)
+		received <- string(m.data)
+	})
+	if err := node.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close(ctx)
+
+	send := func(tr *UDPTransport, msg string) {
+		t.Helper()
+		c, err := tr.Dial(ctx, server.LocalAddr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Send(ctx, NewMessage(KindCustom, [32]byte{}, []byte(msg))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf("received %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%q not received", want)
+		}
+	}
+	conns := func() int {
+		node.mu.Lock()
+		defer node.mu.Unlock()
+		return len(node.conns)
+	}
+
+	first := newTestTransport(t, nw, UDPConfig{})
+	second := newTestTransport(t, nw, UDPConfig{})
+	send(first, "first")
+	expect("first")
+
+	// The server is full and its only peer is active: the newcomer is dropped.
+	send(second, "refused")
+	select {
+	case got := <-received:
+		t.Fatalf("received %q beyond MaxPeers", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Once the first peer is idle it makes room, and its connection closes.
+	server.mu.Lock()
+	for _, p := range server.peers {
+		p.touch(time.Now().Add(-2 * channelIdle))
+	}
+	server.mu.Unlock()
+	send(second, "admitted")
+	expect("admitted")
+	deadline := time.Now().Add(time.Second)
+	for conns() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("node keeps %d connections, want 1", conns())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	server.mu.Lock()
+	n := len(server.peers)
+	server.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("transport keeps %d peers, want 1", n)
+	}
+}
+
+func TestUDPIdleSweep(t *testing.T) {
+	nw := NewMemNetwork()
+	tr := newTestTransport(t, nw, UDPConfig{})
+	other := newTestTransport(t, nw, UDPConfig{})
+	c, err := tr.Dial(context.Background(), other.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tr.mu.Lock()
+	if evicted := tr.evictIdleLocked(now); len(evicted) != 0 {
+		t.Fatalf("evicted %d fresh peers", len(evicted))
+	}
+	evicted := tr.evictIdleLocked(now.Add(channelIdle))
+	left := len(tr.peers)
+	tr.mu.Unlock()
+	shutdownAll(evicted)
+	if len(evicted) != 1 || left != 0 {
+		t.Fatalf("evicted %d peers, %d left; want 1 and 0", len(evicted), left)
+	}
+	if _, err := c.Recv(context.Background()); err != ErrClosed {
+		t.Fatalf("Recv on evicted peer = %v, want ErrClosed", err)
+	}
+}
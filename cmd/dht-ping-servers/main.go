@@ -1,7 +1,187 @@
 package main
 
-import "fmt"
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+	dhtpkg "github.com/grishinium-blockchain/grishinium-go/dht"
+	appctx "github.com/grishinium-blockchain/grishinium-go/internal/appctx"
+	cfgpkg "github.com/grishinium-blockchain/grishinium-go/internal/config"
+	logger "github.com/grishinium-blockchain/grishinium-go/internal/log"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "dht-ping-servers\n")
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  dht-ping-servers -global-config <path> [-timeout 3s] [-min-ok N] [-json]\n\n")
+	fmt.Fprintf(os.Stderr, "Exits with status 1 when fewer than -min-ok nodes respond with the descriptor in the global config.\n")
+	fmt.Fprintf(os.Stderr, "Every option can also be set in the -config file or as GRISHINIUM_<OPTION> (e.g. GRISHINIUM_GLOBAL_CONFIG); flags win over the environment, which wins over the file.\n\n")
+	flag.PrintDefaults()
+}
+
+// report is the outcome of checking one static node.
+type report struct {
+	ID     string  `json:"id"`
+	Addr   string  `json:"addr"`
+	OK     bool    `json:"ok"` // responded with the descriptor in the global config
+	RTTms  float64 `json:"rtt_ms,omitempty"`
+	Status string  `json:"status"`
+	Error  string  `json:"error,omitempty"`
+}
 
 func main() {
-	fmt.Println("dht-ping-servers: not implemented yet (Go migration scaffold)")
+	var (
+		cfg     cfgpkg.Config
+		timeout time.Duration
+		minOK   int
+		asJSON  bool
+	)
+	fs := flag.CommandLine
+	cfgpkg.BaseFlags(fs, &cfg)
+	fs.DurationVar(&timeout, "timeout", 3*time.Second, "Per-node timeout")
+	fs.IntVar(&minOK, "min-ok", 0, "Minimum number of nodes that respond with the descriptor in the global config (0: all of them)")
+	fs.BoolVar(&asJSON, "json", false, "Print the results as JSON")
+	fs.Usage = usage
+	if err := cfgpkg.Load(fs, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if cfg.Dump {
+		if err := cfgpkg.Dump(os.Stdout, fs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if cfg.Debug {
+		logger.SetDebug()
+	}
+
+	if cfg.GlobalConfig == "" {
+		usage()
+		os.Exit(2)
+	}
+	g, err := cfg.Global()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "global config error:", err)
+		os.Exit(2)
+	}
+	// Nodes with bad signatures are kept and reported as bad-config.
+	nodes := g.DHT.StaticNodes.Nodes
+	if len(nodes) == 0 {
+		fmt.Fprintln(os.Stderr, "global config lists no DHT static nodes")
+		os.Exit(2)
+	}
+	if minOK <= 0 || minOK > len(nodes) {
+		minOK = len(nodes)
+	}
+
+	root, cancel := appctx.WithSignals(context.Background())
+	defer cancel()
+
+	id, err := keyring.LoadIdentity("")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "identity error:", err)
+		os.Exit(1)
+	}
+	node := adnl.NewNode(adnl.NewUDPTransport(adnl.UDPConfig{Identity: id}))
+	rpc := adnl.NewRPC(node)
+	if err := node.Start(root); err != nil {
+		fmt.Fprintln(os.Stderr, "adnl start error:", err)
+		os.Exit(1)
+	}
+	defer node.Close(context.Background())
+	k := dhtpkg.NewKademlia(dhtpkg.Config{Identity: id, RPC: rpc, Client: true, QueryTimeout: timeout})
+	if err := k.Start(root); err != nil {
+		fmt.Fprintln(os.Stderr, "dht start error:", err)
+		os.Exit(1)
+	}
+	defer k.Close(context.Background())
+
+	reports := make([]report, len(nodes))
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reports[i] = check(root, k, n, timeout)
+		}()
+	}
+	wg.Wait()
+
+	ok := 0
+	for _, r := range reports {
+		if r.OK {
+			ok++
+		}
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(map[string]any{"nodes": reports, "ok": ok, "total": len(reports), "min_ok": minOK})
+	} else {
+		for _, r := range reports {
+			rtt := "-"
+			if r.RTTms > 0 {
+				rtt = fmt.Sprintf("%.1fms", r.RTTms)
+			}
+			line := fmt.Sprintf("%s  %-21s  %-12s  %8s", r.ID, r.Addr, r.Status, rtt)
+			if r.Error != "" {
+				line += "  " + r.Error
+			}
+			fmt.Println(line)
+		}
+		fmt.Printf("%d/%d nodes ok (minimum %d)\n", ok, len(reports), minOK)
+	}
+	if ok < minOK {
+		os.Exit(1)
+	}
+}
+
+// check pings n and compares the descriptor it announces with the one in the
+// global config. A node that answers under another key cannot decrypt our
+// queries and shows up as unreachable; a node whose announced descriptor has
+// a different key or address list is reported as a mismatch. Only nodes that
+// answer with the descriptor in the global config are OK.
+func check(ctx context.Context, k *dhtpkg.Kademlia, n *dhtpkg.Node, timeout time.Duration) report {
+	id := n.ID()
+	r := report{ID: hex.EncodeToString(id[:]), Status: "ok"}
+	if addr, ok := n.Address(); ok {
+		r.Addr = net.JoinHostPort(addr.Host, strconv.Itoa(addr.Port))
+	}
+	if err := n.Verify(); err != nil {
+		r.Status, r.Error = "bad-config", err.Error()
+		return r
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*timeout)
+	defer cancel()
+	rtt, err := k.Ping(ctx, n)
+	if err != nil {
+		r.Status, r.Error = "unreachable", err.Error()
+		return r
+	}
+	r.RTTms = float64(rtt.Microseconds()) / 1000
+	got, err := k.SignedAddressList(ctx, n)
+	switch {
+	case err != nil:
+		r.Status, r.Error = "no-addr-list", err.Error()
+	case !bytes.Equal(got.PubKey, n.PubKey):
+		r.Status, r.Error = "key-mismatch", "node announces key "+hex.EncodeToString(got.PubKey)
+	case !slices.Equal(got.AddrList.Addrs, n.AddrList.Addrs):
+		r.Status, r.Error = "addr-mismatch", fmt.Sprintf("node announces %v", got.AddrList.Addrs)
+	}
+	r.OK = r.Status == "ok"
+	return r
 }
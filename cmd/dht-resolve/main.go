@@ -1,7 +1,322 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+	dhtpkg "github.com/grishinium-blockchain/grishinium-go/dht"
+	appctx "github.com/grishinium-blockchain/grishinium-go/internal/appctx"
+	cfgpkg "github.com/grishinium-blockchain/grishinium-go/internal/config"
+	logger "github.com/grishinium-blockchain/grishinium-go/internal/log"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "dht-resolve\n")
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  dht-resolve (-global-config <path> | -bootstrap <node>) -key <hex> [-json] [-timeout 10s]\n")
+	fmt.Fprintf(os.Stderr, "  dht-resolve (-global-config <path> | -bootstrap <node>) -id <hex> -name <name> [-idx 0] [-json]\n")
+	fmt.Fprintf(os.Stderr, "  dht-resolve (-global-config <path> | -bootstrap <node>) -adnl <hex> [-json]\n\n")
+	fmt.Fprintf(os.Stderr, "A node is a base64 boxed dht.node, as printed by dht-server on start.\n")
+	fmt.Fprintf(os.Stderr, "Every option can also be set in the -config file or as GRISHINIUM_<OPTION> (e.g. GRISHINIUM_GLOBAL_CONFIG); flags win over the environment, which wins over the file.\n\n")
+	flag.PrintDefaults()
+}
 
 func main() {
-	fmt.Println("dht-resolve: not implemented yet (Go migration scaffold)")
+	var (
+		cfg       cfgpkg.Config
+		bootstrap cfgpkg.StringList
+		keyHex    string
+		idHex     string
+		name      string
+		idx       int
+		adnlHex   string
+		asJSON    bool
+		timeout   time.Duration
+	)
+	fs := flag.CommandLine
+	cfgpkg.BaseFlags(fs, &cfg)
+	fs.Var(&bootstrap, "bootstrap", "Bootstrap node, base64 boxed dht.node (repeatable)")
+	fs.StringVar(&keyHex, "key", "", "Record key hash to resolve (hex)")
+	fs.StringVar(&idHex, "id", "", "Key owner ID (hex); used with -name and -idx instead of -key")
+	fs.StringVar(&name, "name", "", "Key name, e.g. \"address\"")
+	fs.IntVar(&idx, "idx", 0, "Key index")
+	fs.StringVar(&adnlHex, "adnl", "", "Resolve the IP/port of this ADNL ID (hex) instead of a key")
+	fs.BoolVar(&asJSON, "json", false, "Print the result as JSON")
+	fs.DurationVar(&timeout, "timeout", 10*time.Second, "Timeout for joining the DHT and resolving")
+	fs.Usage = usage
+	if err := cfgpkg.Load(fs, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if cfg.Dump {
+		if err := cfgpkg.Dump(os.Stdout, fs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if cfg.Debug {
+		logger.SetDebug()
+	}
+
+	var (
+		key    [32]byte
+		target [32]byte
+		err    error
+	)
+	switch {
+	case adnlHex != "":
+		target, err = adnl.ParseID(adnlHex)
+	case keyHex != "":
+		key, err = dhtpkg.ParseKeyHash(keyHex)
+	case idHex != "" && name != "":
+		var owner [32]byte
+		if owner, err = adnl.ParseID(idHex); err == nil {
+			key = dhtpkg.RecordKey{ID: owner, Name: name, Idx: int32(idx)}.Hash()
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid key:", err)
+		os.Exit(2)
+	}
+
+	nodes, err := loadBootstrap(cfg.GlobalConfig, bootstrap)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bootstrap error:", err)
+		os.Exit(2)
+	}
+	if len(nodes) == 0 {
+		fmt.Fprintln(os.Stderr, "no bootstrap nodes: use -global-config or -bootstrap")
+		os.Exit(2)
+	}
+
+	root, cancel := appctx.WithSignals(context.Background())
+	defer cancel()
+	ctx, opCancel := context.WithTimeout(root, timeout)
+	defer opCancel()
+
+	k, closeClient, err := joinDHT(ctx, nodes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dht join error:", err)
+		os.Exit(1)
+	}
+	defer closeClient()
+
+	if adnlHex != "" {
+		addr, err := k.ResolveAddress(ctx, target)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "resolve error:", err)
+			os.Exit(1)
+		}
+		hostport := net.JoinHostPort(addr.Host, strconv.Itoa(addr.Port))
+		if asJSON {
+			printJSON(map[string]string{"id": hex.EncodeToString(target[:]), "addr": hostport})
+		} else {
+			fmt.Println(hostport)
+		}
+		return
+	}
+
+	res, err := k.FindValue(ctx, key)
+	if res != nil && len(res.Invalid) > 0 && res.Record == nil {
+		fmt.Fprintln(os.Stderr, "only invalid records found, from:", strings.Join(nodeStrings(res.Invalid), ", "))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "resolve error:", err)
+		os.Exit(1)
+	}
+	out := describe(key, res)
+	if asJSON {
+		printJSON(out)
+	} else {
+		out.print()
+	}
+}
+
+// loadBootstrap collects the verified static nodes of the global config and
+// the -bootstrap nodes.
+func loadBootstrap(path string, extra []string) ([]*dhtpkg.Node, error) {
+	var nodes []*dhtpkg.Node
+	if path != "" {
+		g, err := cfgpkg.LoadGlobal(path)
+		if err != nil {
+			return nil, err
+		}
+		if nodes, err = g.DHTNodes(); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: skipping invalid static nodes:", err)
+		}
+	}
+	for _, s := range extra {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			if b, err = hex.DecodeString(s); err != nil {
+				return nil, errors.New("node is neither base64 nor hex")
+			}
+		}
+		n, err := dhtpkg.UnmarshalNode(b)
+		if err == nil {
+			err = n.Verify()
+		}
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// joinDHT starts a client-mode DHT node with an ephemeral identity and fills
+// its routing table from the bootstrap nodes.
+func joinDHT(ctx context.Context, boot []*dhtpkg.Node) (*dhtpkg.Kademlia, func(), error) {
+	id, err := keyring.LoadIdentity("")
+	if err != nil {
+		return nil, nil, err
+	}
+	node := adnl.NewNode(adnl.NewUDPTransport(adnl.UDPConfig{Identity: id}))
+	rpc := adnl.NewRPC(node)
+	if err := node.Start(ctx); err != nil {
+		return nil, nil, err
+	}
+	k := dhtpkg.NewKademlia(dhtpkg.Config{Identity: id, RPC: rpc, Client: true, Bootstrap: boot})
+	closeAll := func() {
+		_ = k.Close(context.Background())
+		_ = node.Close(context.Background())
+	}
+	if err := k.Start(ctx); err != nil {
+		closeAll()
+		return nil, nil, err
+	}
+	if err := k.Bootstrap(ctx); err != nil {
+		closeAll()
+		return nil, nil, err
+	}
+	return k, closeAll, nil
+}
+
+// result is the printed description of a resolved record.
+type result struct {
+	Key       string   `json:"key"`
+	KeyID     string   `json:"key_id"`
+	Name      string   `json:"name"`
+	Idx       int32    `json:"idx"`
+	Rule      string   `json:"rule"`
+	Owner     string   `json:"owner,omitempty"`
+	Overlay   string   `json:"overlay,omitempty"`
+	Signature string   `json:"signature"`
+	Expires   string   `json:"expires"`
+	Value     string   `json:"value"`
+	Text      string   `json:"text,omitempty"`
+	Addrs     []string `json:"addrs,omitempty"`
+	Members   []string `json:"members,omitempty"`
+	From      []string `json:"from"`
+	Invalid   []string `json:"invalid,omitempty"`
+}
+
+func describe(key [32]byte, res *dhtpkg.ValueResult) result {
+	rec := res.Record
+	out := result{
+		Key:     hex.EncodeToString(key[:]),
+		KeyID:   hex.EncodeToString(rec.Key.ID[:]),
+		Name:    rec.Key.Name,
+		Idx:     rec.Key.Idx,
+		Rule:    rec.Rule.String(),
+		Expires: rec.Expires().UTC().Format(time.RFC3339),
+		Value:   hex.EncodeToString(rec.Value),
+		From:    nodeStrings(res.From),
+		Invalid: nodeStrings(res.Invalid),
+	}
+	// FindValue only returns records that verified.
+	switch rec.Rule {
+	case dhtpkg.RuleSignature:
+		out.Owner = hex.EncodeToString(rec.Owner)
+		out.Signature = "valid"
+	case dhtpkg.RuleAnybody:
+		out.Owner = hex.EncodeToString(rec.Owner)
+		out.Signature = "key signed by owner, value unsigned (anybody may update)"
+	case dhtpkg.RuleOverlayNodes:
+		out.Overlay = base64.StdEncoding.EncodeToString(rec.Overlay)
+		out.Signature = "member entries valid"
+		if nodes, err := rec.Nodes(); err == nil {
+			for _, n := range nodes {
+				id := n.ID()
+				out.Members = append(out.Members, fmt.Sprintf("%x (version %d)", id, n.Version))
+			}
+		}
+	}
+	if rec.Key.Name == dhtpkg.AddressName {
+		if list, err := adnl.ReadAddressList(tl.NewReader(rec.Value)); err == nil {
+			for _, a := range list.Addrs {
+				out.Addrs = append(out.Addrs, a.String())
+			}
+		}
+	}
+	if utf8.Valid(rec.Value) && out.Addrs == nil && out.Members == nil {
+		out.Text = string(rec.Value)
+	}
+	return out
+}
+
+func (r result) print() {
+	fmt.Println("key:      ", r.Key)
+	fmt.Printf("key desc:  id=%s name=%q idx=%d\n", r.KeyID, r.Name, r.Idx)
+	fmt.Println("rule:     ", r.Rule)
+	if r.Owner != "" {
+		fmt.Println("owner:    ", r.Owner)
+	}
+	if r.Overlay != "" {
+		fmt.Println("overlay:  ", r.Overlay)
+	}
+	fmt.Println("signature:", r.Signature)
+	fmt.Println("expires:  ", r.Expires)
+	fmt.Println("value:    ", r.Value)
+	if r.Text != "" {
+		fmt.Printf("text:      %q\n", r.Text)
+	}
+	for _, a := range r.Addrs {
+		fmt.Println("addr:     ", a)
+	}
+	for _, m := range r.Members {
+		fmt.Println("member:   ", m)
+	}
+	for _, f := range r.From {
+		fmt.Println("from:     ", f)
+	}
+	for _, f := range r.Invalid {
+		fmt.Println("invalid:  ", f)
+	}
+}
+
+func nodeStrings(nodes []*dhtpkg.Node) []string {
+	var out []string
+	for _, n := range nodes {
+		p := n.Peer()
+		out = append(out, p.ID+"@"+p.Addr)
+	}
+	return out
+}
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintln(os.Stderr, "json error:", err)
+		os.Exit(1)
+	}
 }
@@ -1,7 +1,267 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+	dhtpkg "github.com/grishinium-blockchain/grishinium-go/dht"
+	appctx "github.com/grishinium-blockchain/grishinium-go/internal/appctx"
+	cfgpkg "github.com/grishinium-blockchain/grishinium-go/internal/config"
+	logger "github.com/grishinium-blockchain/grishinium-go/internal/log"
+	"github.com/grishinium-blockchain/grishinium-go/internal/metrics"
+	storage "github.com/grishinium-blockchain/grishinium-go/internal/storage"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "dht-server\n")
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  dht-server -identity <path> [-listen <ip:port>] [-public-addr <ip:port>] [-global-config <path>] [-bootstrap <node>] [-db-path <dir>] [-stats-interval 1m] [-log-level <spec>] [-log-format text|json] [-log-file <path>] [-metrics-listen <host:port>] [-debug]\n\n")
+	fmt.Fprintf(os.Stderr, "A node is a base64 boxed dht.node, as printed by another dht-server on start.\n")
+	fmt.Fprintf(os.Stderr, "Every option can also be set in the -config file or as GRISHINIUM_<OPTION> (e.g. GRISHINIUM_DB_PATH); flags win over the environment, which wins over the file.\n\n")
+	flag.PrintDefaults()
+}
 
 func main() {
-	fmt.Println("dht-server: not implemented yet (Go migration scaffold)")
+	var (
+		cfg           cfgpkg.Config
+		listen        string
+		publicAddr    string
+		bootstrap     cfgpkg.StringList
+		identityPath  string
+		dbPath        string
+		statsInterval time.Duration
+		logCfg        cfgpkg.Log
+		metricsListen string
+	)
+	fs := flag.CommandLine
+	cfgpkg.BaseFlags(fs, &cfg)
+	cfgpkg.DBFlag(fs, &dbPath, "dht-db")
+	cfgpkg.LogFlags(fs, &logCfg)
+	fs.StringVar(&listen, "listen", "0.0.0.0:30303", "UDP address to serve ADNL on")
+	fs.StringVar(&publicAddr, "public-addr", "", "IP:port announced to other nodes (default: -listen when it is a routable address)")
+	fs.Var(&bootstrap, "bootstrap", "Bootstrap node, base64 boxed dht.node (repeatable)")
+	fs.StringVar(&identityPath, "identity", "", "Path to ed25519 private key file (raw), created when missing. If empty, ephemeral identity is used")
+	fs.DurationVar(&statsInterval, "stats-interval", time.Minute, "How often to log node statistics (0 disables)")
+	fs.StringVar(&metricsListen, "metrics-listen", "", "HTTP address serving Prometheus metrics at /metrics (empty disables it)")
+	fs.Usage = usage
+	if err := cfgpkg.Load(fs, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := logCfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if cfg.Dump {
+		if err := cfgpkg.Dump(os.Stdout, fs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := logger.Setup(logCfg.Options()); err != nil {
+		fmt.Fprintln(os.Stderr, "log setup error:", err)
+		os.Exit(1)
+	}
+	defer logger.Close()
+	if cfg.Debug {
+		logger.SetDebug()
+	}
+
+	root, cancel := appctx.WithSignals(context.Background())
+	defer cancel()
+
+	if metricsListen != "" {
+		stop, err := metrics.Serve(metricsListen)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "metrics error:", err)
+			os.Exit(1)
+		}
+		defer stop()
+	}
+
+	id, err := keyring.LoadIdentity(identityPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "identity load error:", err)
+		os.Exit(1)
+	}
+	if identityPath == "" {
+		fmt.Fprintln(os.Stderr, "warning: ephemeral identity; use -identity to keep the node ID across restarts")
+	}
+
+	listenAddr, err := parseListen(listen)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid -listen:", err)
+		os.Exit(2)
+	}
+	var public netip.AddrPort
+	if publicAddr != "" {
+		if public, err = netip.ParseAddrPort(publicAddr); err != nil {
+			fmt.Fprintln(os.Stderr, "invalid -public-addr:", err)
+			os.Exit(2)
+		}
+	}
+	g, err := cfg.Global()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "global config error:", err)
+		os.Exit(2)
+	}
+	var boot []*dhtpkg.Node
+	if g != nil {
+		if boot, err = g.DHTNodes(); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: skipping invalid static nodes:", err)
+		}
+	}
+	for _, s := range bootstrap {
+		n, err := parseNode(s)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid -bootstrap:", err)
+			os.Exit(2)
+		}
+		boot = append(boot, n)
+	}
+
+	if err := run(root, id, listenAddr, public, boot, dbPath, statsInterval); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, id keyring.Identity, listen adnl.Address, public netip.AddrPort, boot []*dhtpkg.Node, dbPath string, statsInterval time.Duration) error {
+	kv := newKV(storage.Config{Path: dbPath})
+	if err := kv.Open(ctx); err != nil {
+		if errors.Is(err, storage.ErrLocked) {
+			return fmt.Errorf("database %s is in use by another process", dbPath)
+		}
+		return fmt.Errorf("storage open: %w", err)
+	}
+	defer func() {
+		if err := kv.Close(context.Background()); err != nil {
+			fmt.Fprintln(os.Stderr, "storage close error:", err)
+		}
+	}()
+	if persistentStorage {
+		fmt.Println("storage:", dbPath)
+	} else {
+		fmt.Println("storage: in-memory (build with -tags pebble to persist the routing table and records)")
+	}
+
+	tr := adnl.NewUDPTransport(adnl.UDPConfig{Identity: id})
+	if err := tr.Listen(listen); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	node := adnl.NewNode(tr)
+	rpc := adnl.NewRPC(node)
+	if err := node.Start(ctx); err != nil {
+		return fmt.Errorf("adnl start: %w", err)
+	}
+	defer node.Close(context.Background())
+
+	k := dhtpkg.NewKademlia(dhtpkg.Config{
+		Identity:   id,
+		RPC:        rpc,
+		PublicAddr: public,
+		Bootstrap:  boot,
+		Store:      storage.NewNamespace(kv, "dht"),
+	})
+	if err := k.Start(ctx); err != nil {
+		return err
+	}
+	defer k.Close(context.Background())
+	self := k.SelfNode()
+	if self == nil {
+		return errors.New("no public address to announce: set -public-addr")
+	}
+
+	addr, _ := self.Address()
+	fmt.Println("id:", addr.ID)
+	fmt.Println("listening:", net.JoinHostPort(addr.Host, strconv.Itoa(addr.Port)))
+	fmt.Println("node:", base64.StdEncoding.EncodeToString(self.MarshalTL()))
+
+	if statsInterval > 0 {
+		go logStats(ctx, k, statsInterval)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// logStats logs the node statistics every interval until ctx is done.
+func logStats(ctx context.Context, k *dhtpkg.Kademlia, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	prev, last := k.Stats().Queries, time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			st := k.Stats()
+			qps := float64(st.Queries-prev) / now.Sub(last).Seconds()
+			prev, last = st.Queries, now
+			logger.For(logger.DHT).Info("dht stats",
+				"nodes", st.Nodes,
+				"buckets", bucketFill(st.Buckets),
+				"records", st.Records,
+				"own_records", st.OwnRecords,
+				"queries_per_sec", strconv.FormatFloat(qps, 'f', 2, 64))
+		}
+	}
+}
+
+// bucketFill formats the non-empty buckets as prefix-length:count pairs.
+func bucketFill(buckets [256]int) string {
+	var out []byte
+	for i, n := range buckets {
+		if n == 0 {
+			continue
+		}
+		if len(out) > 0 {
+			out = append(out, ' ')
+		}
+		out = strconv.AppendInt(out, int64(i), 10)
+		out = append(out, ':')
+		out = strconv.AppendInt(out, int64(n), 10)
+	}
+	return string(out)
+}
+
+func parseListen(s string) (adnl.Address, error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return adnl.Address{}, err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 0 || p > 65535 {
+		return adnl.Address{}, fmt.Errorf("invalid port %q", port)
+	}
+	return adnl.Address{Host: host, Port: p}, nil
+}
+
+// parseNode decodes and verifies a base64 boxed dht.node.
+func parseNode(s string) (*dhtpkg.Node, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		if b, err = hex.DecodeString(s); err != nil {
+			return nil, errors.New("node is neither base64 nor hex")
+		}
+	}
+	n, err := dhtpkg.UnmarshalNode(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.Verify(); err != nil {
+		return nil, err
+	}
+	return n, nil
 }
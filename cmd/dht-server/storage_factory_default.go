@@ -0,0 +1,16 @@
+//go:build !pebble
+
+package main
+
+import (
+	"github.com/grishinium-blockchain/grishinium-go/internal/storage"
+	memkv "github.com/grishinium-blockchain/grishinium-go/internal/storage/mem"
+)
+
+// persistentStorage reports whether newKV keeps state across restarts.
+const persistentStorage = false
+
+// newKV returns the in-memory store when built without tags. State is lost on exit.
+func newKV(cfg storage.Config) storage.KV {
+	return memkv.New(cfg)
+}
@@ -0,0 +1,16 @@
+//go:build pebble
+
+package main
+
+import (
+	"github.com/grishinium-blockchain/grishinium-go/internal/storage"
+	pebblekv "github.com/grishinium-blockchain/grishinium-go/internal/storage/pebble"
+)
+
+// persistentStorage reports whether newKV keeps state across restarts.
+const persistentStorage = true
+
+// newKV returns the Pebble store when built with -tags pebble.
+func newKV(cfg storage.Config) storage.KV {
+	return pebblekv.New(cfg)
+}
@@ -5,42 +5,67 @@ import (
     "flag"
     "fmt"
     "os"
-    "time"
 
     "github.com/grishinium-blockchain/grishinium-go/grishiniumlib"
+    cfgpkg "github.com/grishinium-blockchain/grishinium-go/internal/config"
+    logger "github.com/grishinium-blockchain/grishinium-go/internal/log"
 )
 
 func usage() {
     fmt.Fprintf(os.Stderr, "grishiniumlib-cli\n")
     fmt.Fprintf(os.Stderr, "Usage:\n")
-    fmt.Fprintf(os.Stderr, "  grishiniumlib-cli -endpoint <host:port> [-ping] [-version]\n\n")
+    fmt.Fprintf(os.Stderr, "  grishiniumlib-cli -endpoint <host:port> -server-key <pubkey> [-ping] [-version]\n")
+    fmt.Fprintf(os.Stderr, "  grishiniumlib-cli -global-config <path> [-ls-index N] [-ping] [-version]\n\n")
+    fmt.Fprintf(os.Stderr, "Every option can also be set in the -config file or as GRISHINIUM_<OPTION> (e.g. GRISHINIUM_GLOBAL_CONFIG); flags win over the environment, which wins over the file.\n\n")
     flag.PrintDefaults()
 }
 
 func main() {
     var (
-        endpoint string
-        doPing   bool
-        showVer  bool
-        timeout  time.Duration
+        cfg       cfgpkg.Config
+        serverKey string
+        lsIndex   int
+        doPing    bool
+        showVer   bool
     )
 
-    flag.StringVar(&endpoint, "endpoint", "", "GRISHINIUM endpoint in the form host:port")
-    flag.BoolVar(&doPing, "ping", false, "Perform a connectivity ping")
-    flag.BoolVar(&showVer, "version", false, "Print library version")
-    flag.DurationVar(&timeout, "timeout", 5*time.Second, "Request timeout")
-    flag.Usage = usage
-    flag.Parse()
+    fs := flag.CommandLine
+    cfgpkg.Flags(fs, &cfg)
+    fs.StringVar(&serverKey, "server-key", "", "Server ed25519 public key (base64 or hex)")
+    fs.IntVar(&lsIndex, "ls-index", 0, "Lite-server of the global config to use when -endpoint is not set")
+    fs.BoolVar(&doPing, "ping", false, "Perform a connectivity ping")
+    fs.BoolVar(&showVer, "version", false, "Print library version")
+    fs.Usage = usage
+    if err := cfgpkg.Load(fs, os.Args[1:]); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(2)
+    }
+    if cfg.Dump {
+        if err := cfgpkg.Dump(os.Stdout, fs); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+        return
+    }
+    if cfg.Debug {
+        logger.SetDebug()
+    }
 
     if !doPing && !showVer {
         usage()
         os.Exit(2)
     }
+    if err := cfg.UseLiteServer(lsIndex, &serverKey); err != nil {
+        fmt.Fprintln(os.Stderr, "global config error:", err)
+        os.Exit(2)
+    }
+    endpoint := cfg.Endpoint
 
-    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
     defer cancel()
 
-    client := grishiniumlib.NewClient(grishiniumlib.Config{Endpoint: endpoint})
+    client := grishiniumlib.NewClient(grishiniumlib.Config{Endpoint: endpoint, ServerKey: serverKey})
+    defer client.Close(context.Background())
 
     if showVer {
         ver, err := client.GetVersion(ctx)
@@ -53,7 +78,7 @@ func main() {
 
     if doPing {
         if endpoint == "" {
-            fmt.Fprintln(os.Stderr, "-endpoint is required for -ping")
+            fmt.Fprintln(os.Stderr, "-endpoint or -global-config is required for -ping")
             os.Exit(2)
         }
         if err := client.Ping(ctx); err != nil {
@@ -16,22 +16,37 @@ import (
 func usage() {
     fmt.Fprintf(os.Stderr, "lite-client\n")
     fmt.Fprintf(os.Stderr, "Usage:\n")
-    fmt.Fprintf(os.Stderr, "  lite-client -endpoint <host:port> [-ping] [-version] [-debug] [-timeout 5s]\n\n")
+    fmt.Fprintf(os.Stderr, "  lite-client -endpoint <host:port> -server-key <pubkey> [-ping] [-version] [-debug] [-timeout 5s]\n")
+    fmt.Fprintf(os.Stderr, "  lite-client -global-config <path> [-ls-index N] [-ping] [-version] [-debug] [-timeout 5s]\n\n")
     flag.PrintDefaults()
 }
 
 func main() {
     var (
         cfg cfgpkg.Config
+        serverKey string
+        lsIndex int
         doPing  bool
         showVer bool
     )
 
     cfgpkg.Flags(nil, &cfg)
+    flag.StringVar(&serverKey, "server-key", "", "Server ed25519 public key (base64 or hex)")
+    flag.IntVar(&lsIndex, "ls-index", 0, "Lite-server of the global config to use when -endpoint is not set")
     flag.BoolVar(&doPing, "ping", false, "Ping GRISHINIUM endpoint and exit")
     flag.BoolVar(&showVer, "version", false, "Print client/library version and exit")
     flag.Usage = usage
-    flag.Parse()
+    if err := cfgpkg.Load(nil, os.Args[1:]); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(2)
+    }
+    if cfg.Dump {
+        if err := cfgpkg.Dump(os.Stdout, nil); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+        return
+    }
 
     if cfg.Debug {
         logger.SetDebug()
@@ -41,6 +56,10 @@ func main() {
         usage()
         os.Exit(2)
     }
+    if err := cfg.UseLiteServer(lsIndex, &serverKey); err != nil {
+        fmt.Fprintln(os.Stderr, "global config error:", err)
+        os.Exit(2)
+    }
 
     root, cancel := appctx.WithSignals(context.Background())
     defer cancel()
@@ -51,7 +70,8 @@ func main() {
     ctx, opCancel := context.WithTimeout(root, cfg.Timeout)
     defer opCancel()
 
-    client := grishiniumlib.NewClient(grishiniumlib.Config{Endpoint: cfg.Endpoint})
+    client := grishiniumlib.NewClient(grishiniumlib.Config{Endpoint: cfg.Endpoint, ServerKey: serverKey})
+    defer client.Close(context.Background())
 
     if showVer {
         ver, err := client.GetVersion(ctx)
@@ -67,7 +87,7 @@ func main() {
 
     if doPing {
         if cfg.Endpoint == "" {
-            fmt.Fprintln(os.Stderr, "-endpoint is required for -ping")
+            fmt.Fprintln(os.Stderr, "-endpoint or -global-config is required for -ping")
             os.Exit(2)
         }
         if err := client.Ping(ctx); err != nil {
@@ -9,32 +9,64 @@ import (
     "time"
 
     appctx "github.com/grishinium-blockchain/grishinium-go/internal/appctx"
+    cfgpkg "github.com/grishinium-blockchain/grishinium-go/internal/config"
     logger "github.com/grishinium-blockchain/grishinium-go/internal/log"
 )
 
 func usage() {
     fmt.Fprintf(os.Stderr, "rldp-http-proxy\n")
     fmt.Fprintf(os.Stderr, "Usage:\n")
-    fmt.Fprintf(os.Stderr, "  rldp-http-proxy -listen :8080 -backend grishinium://host:port [-debug]\n\n")
+    fmt.Fprintf(os.Stderr, "  rldp-http-proxy -listen :8080 -backend grishinium://host:port [-debug]\n")
+    fmt.Fprintf(os.Stderr, "  rldp-http-proxy -listen :8080 -global-config <path> [-ls-index N] [-debug]\n\n")
+    fmt.Fprintf(os.Stderr, "Every option can also be set in the -config file or as GRISHINIUM_<OPTION> (e.g. GRISHINIUM_BACKEND); flags win over the environment, which wins over the file.\n\n")
     flag.PrintDefaults()
 }
 
 func main() {
     var (
+        cfg     cfgpkg.Config
         listen  string
         backend string
-        debug   bool
+        lsIndex int
     )
 
-    flag.StringVar(&listen, "listen", ":8080", "HTTP listen address")
-    flag.StringVar(&backend, "backend", "", "GRISHINIUM backend (rldp:// or grishinium:// endpoint)")
-    flag.BoolVar(&debug, "debug", false, "enable debug logging")
-    flag.Usage = usage
-    flag.Parse()
+    fs := flag.CommandLine
+    cfgpkg.BaseFlags(fs, &cfg)
+    fs.StringVar(&listen, "listen", ":8080", "HTTP listen address")
+    fs.StringVar(&backend, "backend", "", "GRISHINIUM backend (rldp:// or grishinium:// endpoint)")
+    fs.IntVar(&lsIndex, "ls-index", 0, "Lite-server of the global config to use as the backend when -backend is not set")
+    fs.Usage = usage
+    if err := cfgpkg.Load(fs, os.Args[1:]); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(2)
+    }
+    if cfg.Dump {
+        if err := cfgpkg.Dump(os.Stdout, fs); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+        return
+    }
 
-    if debug {
+    if cfg.Debug {
         logger.SetDebug()
     }
+    if backend == "" && cfg.GlobalConfig != "" {
+        g, err := cfg.Global()
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "global config error:", err)
+            os.Exit(2)
+        }
+        ls, err := g.LiteServer(lsIndex)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "global config error:", err)
+            os.Exit(2)
+        }
+        backend = "grishinium://" + ls.Addr()
+    }
+    if backend != "" {
+        fmt.Println("backend:", backend)
+    }
 
     root, cancel := appctx.WithSignals(context.Background())
     defer cancel()
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	logger "github.com/grishinium-blockchain/grishinium-go/internal/log"
+)
+
+// logLevelsAt returns the log levels of the engine whose control interface
+// listens on addr, after applying spec when it is not empty.
+func logLevelsAt(ctx context.Context, addr, spec string) (map[string]string, error) {
+	url := "http://" + addr + logger.LevelsPath
+	method, body := http.MethodGet, io.Reader(nil)
+	if spec != "" {
+		method, body = http.MethodPost, strings.NewReader(spec)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var levels map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&levels); err != nil {
+		return nil, err
+	}
+	return levels, nil
+}
+
+// printLogLevels prints one subsystem per line; "default" is the level of
+// logs outside the subsystems.
+func printLogLevels(levels map[string]string) {
+	names := make([]string, 0, len(levels))
+	for s := range levels {
+		names = append(names, s)
+	}
+	slices.Sort(names)
+	for _, s := range names {
+		name := s
+		if name == "" {
+			name = "default"
+		}
+		fmt.Printf("%-10s %s\n", name, levels[s])
+	}
+}
@@ -16,28 +16,69 @@ import (
 func usage() {
     fmt.Fprintf(os.Stderr, "validator-engine-console\n")
     fmt.Fprintf(os.Stderr, "Usage:\n")
-    fmt.Fprintf(os.Stderr, "  validator-engine-console -endpoint <host:port> [-ping] [-version] [-debug] [-timeout 5s]\n\n")
+    fmt.Fprintf(os.Stderr, "  validator-engine-console -endpoint <host:port> -server-key <pubkey> [-ping] [-version] [-debug] [-timeout 5s]\n")
+    fmt.Fprintf(os.Stderr, "  validator-engine-console -control <host:port> [-log-levels] [-set-log-level <spec>]\n\n")
     flag.PrintDefaults()
 }
 
 func main() {
     var (
         cfg cfgpkg.Config
+        serverKey string
         doPing  bool
         showVer bool
+        control   string
+        logLevels bool
+        setLevels string
     )
 
     // Bind common flags
     cfgpkg.Flags(nil, &cfg)
+    flag.StringVar(&serverKey, "server-key", "", "Server ed25519 public key (base64 or hex)")
     flag.BoolVar(&doPing, "ping", false, "Ping GRISHINIUM endpoint and exit")
     flag.BoolVar(&showVer, "version", false, "Print client/library version and exit")
+    flag.StringVar(&control, "control", "", "Control interface of the engine (its -control-listen address)")
+    flag.BoolVar(&logLevels, "log-levels", false, "Print the engine's log levels (needs -control)")
+    flag.StringVar(&setLevels, "set-log-level", "", "Change the engine's log levels, e.g. dht=debug or info,netstack=warn (needs -control)")
     flag.Usage = usage
-    flag.Parse()
+    if err := cfgpkg.Load(nil, os.Args[1:]); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(2)
+    }
+    if cfg.Dump {
+        if err := cfgpkg.Dump(os.Stdout, nil); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+        return
+    }
 
     if cfg.Debug {
         logger.SetDebug()
     }
 
+    if logLevels || setLevels != "" {
+        if control == "" {
+            fmt.Fprintln(os.Stderr, "-control is required for -log-levels and -set-log-level")
+            os.Exit(2)
+        }
+        timeout := cfg.Timeout
+        if timeout <= 0 {
+            timeout = 5 * time.Second
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), timeout)
+        levels, err := logLevelsAt(ctx, control, setLevels)
+        cancel()
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "control error:", err)
+            os.Exit(1)
+        }
+        printLogLevels(levels)
+        if !doPing && !showVer {
+            return
+        }
+    }
+
     if !doPing && !showVer {
         usage()
         os.Exit(2)
@@ -54,7 +95,8 @@ func main() {
     ctx, opCancel := context.WithTimeout(root, cfg.Timeout)
     defer opCancel()
 
-    client := grishiniumlib.NewClient(grishiniumlib.Config{Endpoint: cfg.Endpoint})
+    client := grishiniumlib.NewClient(grishiniumlib.Config{Endpoint: cfg.Endpoint, ServerKey: serverKey})
+    defer client.Close(context.Background())
 
     if showVer {
         ver, err := client.GetVersion(ctx)
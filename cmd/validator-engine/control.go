@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	logger "github.com/grishinium-blockchain/grishinium-go/internal/log"
+)
+
+// serveControl starts the control interface on addr. The returned function
+// shuts it down.
+func serveControl(addr string) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(logger.LevelsPath, logger.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}, nil
+}
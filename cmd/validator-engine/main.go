@@ -2,73 +2,152 @@ package main
 
 import (
     "context"
+    "errors"
     "flag"
     "fmt"
+    "math"
     "os"
-    "time"
 
+    dhtpkg "github.com/grishinium-blockchain/grishinium-go/dht"
     appctx "github.com/grishinium-blockchain/grishinium-go/internal/appctx"
     cfgpkg "github.com/grishinium-blockchain/grishinium-go/internal/config"
     logger "github.com/grishinium-blockchain/grishinium-go/internal/log"
+    "github.com/grishinium-blockchain/grishinium-go/internal/metrics"
     netstack "github.com/grishinium-blockchain/grishinium-go/internal/netstack"
+    storage "github.com/grishinium-blockchain/grishinium-go/internal/storage"
     "github.com/grishinium-blockchain/grishinium-go/keyring"
     overlaypkg "github.com/grishinium-blockchain/grishinium-go/overlay"
-    dhtpkg "github.com/grishinium-blockchain/grishinium-go/dht"
 )
 
 func usage() {
     fmt.Fprintf(os.Stderr, "validator-engine\n")
     fmt.Fprintf(os.Stderr, "Usage:\n")
-    fmt.Fprintf(os.Stderr, "  validator-engine -endpoint <host:port> [-listen <multiaddr>] [-bootstrap <multiaddr>] [-identity <path>] [-mdns] [-debug] [-timeout 10s]\n\n")
+    fmt.Fprintf(os.Stderr, "  validator-engine -endpoint <host:port> [-listen <multiaddr>] [-bootstrap <multiaddr>] [-identity <path>] [-global-config <path>] [-db-path <dir>] [-mdns] [-debug] [-timeout 10s] [-config <file.json>] [-dump-config] [-metrics-listen <host:port>]\n")
+    fmt.Fprintf(os.Stderr, "Every option can also be set in the -config file or as GRISHINIUM_<OPTION> (e.g. GRISHINIUM_DB_PATH); flags win over the environment, which wins over the file.\n\n")
     flag.PrintDefaults()
 }
 
 func main() {
-    var cfg cfgpkg.Config
-    var listen multiFlag
-    var bootstrap multiFlag
-    var identityPath string
-    var enableMDNS bool
-
-    cfgpkg.Flags(nil, &cfg)
-    flag.Var(&listen, "listen", "Listen multiaddr (repeatable). Example: /ip4/0.0.0.0/tcp/0")
-    flag.Var(&bootstrap, "bootstrap", "Bootstrap peer multiaddr with /p2p/<peerID> (repeatable)")
-    flag.StringVar(&identityPath, "identity", "", "Path to ed25519 private key file (raw). If empty, ephemeral identity is used")
-    flag.BoolVar(&enableMDNS, "mdns", false, "Enable LAN peer discovery via mDNS (libp2p builds)")
+    var cfg cfgpkg.Engine
+
+    // Options come from -config, then GRISHINIUM_* variables, then flags.
+    cfgpkg.EngineFlags(nil, &cfg)
     flag.Usage = usage
-    flag.Parse()
+    if err := cfgpkg.Load(nil, os.Args[1:]); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(2)
+    }
+    if err := cfg.Validate(); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(2)
+    }
+    if cfg.Dump {
+        if err := cfgpkg.Dump(os.Stdout, nil); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+        return
+    }
 
+    if err := logger.Setup(cfg.Log.Options()); err != nil {
+        fmt.Fprintln(os.Stderr, "log setup error:", err)
+        os.Exit(1)
+    }
+    defer logger.Close()
     if cfg.Debug {
         logger.SetDebug()
     }
+    log := logger.For(logger.Validator)
 
     root, cancel := appctx.WithSignals(context.Background())
     defer cancel()
 
-    if cfg.Timeout <= 0 {
-        cfg.Timeout = 10 * time.Second
+    // The control interface lets operators change log levels at runtime.
+    if cfg.ControlListen != "" {
+        stop, err := serveControl(cfg.ControlListen)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "control interface error:", err)
+            os.Exit(1)
+        }
+        defer stop()
+        log.Info("control interface listening", "addr", cfg.ControlListen)
+    }
+    if cfg.MetricsListen != "" {
+        stop, err := metrics.Serve(cfg.MetricsListen)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "metrics error:", err)
+            os.Exit(1)
+        }
+        defer stop()
+        log.Info("metrics listening", "addr", cfg.MetricsListen)
     }
-    ctx, opCancel := context.WithTimeout(root, cfg.Timeout)
-    defer opCancel()
 
     // Load or generate identity
-    id, err := keyring.LoadIdentity(identityPath)
+    id, err := keyring.LoadIdentity(cfg.Identity)
     if err != nil {
         fmt.Fprintln(os.Stderr, "identity load error:", err)
         os.Exit(1)
     }
 
-    // Build netstack config
-    nsCfg := netstack.Config{ListenAddrs: listen, Bootstrap: bootstrap, IdentityPriv: []byte(id.Private)}
+    // The global config names the network: its zero state, and the DHT
+    // nodes and lite-servers other binaries use to reach it.
+    global, err := cfg.Global()
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "global config error:", err)
+        os.Exit(1)
+    }
+    if global != nil {
+        if _, err := global.DHTNodes(); err != nil {
+            log.Warn("global config has bad DHT nodes", "err", err)
+        }
+        fmt.Println("network zero state:", global.Validator.ZeroState)
+        fmt.Printf("network: %d dht static nodes, %d lite-servers, %d hardforks\n",
+            len(global.DHT.StaticNodes.Nodes), len(global.LiteServers)+len(global.LiteServersV2), len(global.Validator.Hardforks))
+    }
+
+    // Open the state database before joining the network, so a second
+    // engine on the same directory exits without touching anything.
+    kv := newKV(storage.Config{Path: cfg.DBPath})
+    if err := kv.Open(root); err != nil {
+        if errors.Is(err, storage.ErrLocked) {
+            fmt.Fprintln(os.Stderr, "storage error: database", cfg.DBPath, "is in use by another process")
+        } else {
+            fmt.Fprintln(os.Stderr, "storage open error:", err)
+        }
+        os.Exit(1)
+    }
+    defer func() {
+        if err := kv.Close(context.Background()); err != nil {
+            log.Error("storage close failed", "err", err)
+        }
+    }()
+    if persistentStorage {
+        fmt.Println("storage:", cfg.DBPath)
+    } else {
+        fmt.Println("storage: in-memory (build with -tags pebble to persist state)")
+    }
+
+    // Build netstack config. The node lives until shutdown, so it is started
+    // with the root context rather than a per-operation timeout. DHT records
+    // it holds are kept in their own namespace of the state database.
+    // Pubsub carries overlay broadcasts, so it shares their size cap.
+    nsCfg := netstack.Config{
+        ListenAddrs:    cfg.Listen,
+        Bootstrap:      cfg.Bootstrap,
+        IdentityPriv:   []byte(id.Private),
+        Store:          storage.NewNamespace(kv, "netstack"),
+        MaxMessageSize: cfg.Overlay.MaxMessageSize,
+    }
     var ns netstack.Node = newNetstackNode(nsCfg)
-    if err := ns.Start(ctx); err != nil {
+    if err := ns.Start(root); err != nil {
         fmt.Fprintln(os.Stderr, "netstack start error:", err)
+        _ = kv.Close(context.Background())
         os.Exit(1)
     }
     defer ns.Close(context.Background())
-    if enableMDNS {
+    if cfg.MDNS {
         if err := ns.EnableMDNS(context.Background()); err != nil {
-            fmt.Fprintln(os.Stderr, "mdns enable warning:", err)
+            log.Warn("mdns not enabled", "err", err)
         }
     }
     if addr := ns.Addr(); addr != "" {
@@ -78,17 +157,38 @@ func main() {
         }
     }
 
-    // Wire adapters for overlay and DHT
-    ov := overlaypkg.NewAdapter(ns)
-    table := dhtpkg.NewAdapter(ns, dhtpkg.Peer{ID: ns.PeerID(), Addr: ns.Addr()})
-    _ = ov
-    _ = table
+    // Wire adapters for overlay and DHT; overlay members are found through the DHT.
+    // The adapter republishes our records, kept in the state database, and
+    // provider announcements.
+    table := dhtpkg.NewAdapter(ns, dhtpkg.Peer{ID: ns.PeerID(), Addr: ns.Addr()}, id, storage.NewNamespace(kv, "dht"))
+    if err := table.Start(root); err != nil {
+        log.Warn("dht records not republished", "err", err)
+    }
+    defer table.Close(context.Background())
+    ov := overlaypkg.NewAdapter(ns, table, overlaypkg.Config{Identity: id, Limits: cfg.Overlay.Limits()})
+    _ = ov.Start(root)
+    defer ov.Close(context.Background())
+
+    // Join the masterchain overlay of the network named by the global config.
+    if global != nil && len(global.Validator.ZeroState.FileHash) == 32 {
+        joinCtx, joinCancel := context.WithTimeout(root, cfg.Timeout)
+        desc := overlaypkg.ShardDescription(-1, math.MinInt64, [32]byte(global.Validator.ZeroState.FileHash))
+        if oid, err := ov.Join(joinCtx, desc); err != nil {
+            log.Warn("cannot join masterchain overlay", "err", err)
+        } else if peers, err := ov.Peers(oid); err == nil {
+            fmt.Printf("masterchain overlay %s: %d peers\n", oid, len(peers))
+        }
+        joinCancel()
+    }
 
-    // Example: subscribe to a default broadcast topic in debug mode
+    // Example: join a demo overlay and broadcast in it in debug mode
     if cfg.Debug {
-        topic := overlaypkg.Topic("grishinium.broadcast")
-        ch, err := ov.Subscribe(root, topic)
-        if err == nil {
+        joinCtx, joinCancel := context.WithTimeout(root, cfg.Timeout)
+        oid, err := ov.Join(joinCtx, []byte("grishinium.broadcast"))
+        joinCancel()
+        if err != nil {
+            log.Warn("cannot join demo overlay", "err", err)
+        } else if ch, err := ov.Subscribe(root, oid.Topic("hello")); err == nil {
             go func() {
                 for {
                     select {
@@ -96,30 +196,33 @@ func main() {
                         if !ok {
                             return
                         }
-                        fmt.Println("overlay msg:", string(msg))
+                        fmt.Printf("overlay msg from %x: %s\n", msg.SourceID(), msg.Data)
                     case <-root.Done():
                         return
                     }
                 }
             }()
             // Publish a hello message
-            _ = ov.Publish(context.Background(), topic, []byte("hello from validator-engine"))
+            _ = ov.Publish(context.Background(), oid.Topic("hello"), []byte("hello from validator-engine"))
         }
         // DHT demo: Put/Get and Provide/FindProviders
+        opCtx, opCancel := context.WithTimeout(root, cfg.Timeout)
         key := []byte("demo-key")
         val := []byte("demo-value")
-        _ = table.Put(root, key, val)
-        if got, err := table.Get(root, key); err == nil && len(got) > 0 {
+        _ = table.Put(opCtx, key, val)
+        if got, err := table.Get(opCtx, key); err == nil && len(got) > 0 {
             fmt.Println("dht get:", string(got))
         }
-        _ = table.Provide(root, key)
-        if peers, err := table.FindProviders(root, key, 5); err == nil {
+        _ = table.Provide(opCtx, key)
+        if peers, err := table.FindProviders(opCtx, key, 5); err == nil {
             fmt.Printf("dht providers: %d\n", len(peers))
         }
+        opCancel()
     }
 
-    // TODO: initialize storage (Pebble/Badger) and state
+    // TODO: initialize state on top of kv
     // TODO: initialize validator services and start event loop
+    _ = kv
 
     // Temporary output while skeleton is in place
     fmt.Println("GRISHINIUM validator-engine skeleton: OK (services not yet implemented)")
@@ -127,6 +230,6 @@ func main() {
         fmt.Println("identity:", fp)
     }
 
-    // Block until context cancellation (signals)
-    <-ctx.Done()
+    // Block until SIGINT/SIGTERM; deferred calls close the node, then the database.
+    <-root.Done()
 }
@@ -1,3 +1,5 @@
+//go:build !libp2p
+
 package main
 
 import (
@@ -2,52 +2,245 @@ package dht
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/grishinium-blockchain/grishinium-go/internal/metrics"
 	ns "github.com/grishinium-blockchain/grishinium-go/internal/netstack"
+	"github.com/grishinium-blockchain/grishinium-go/internal/storage"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
 )
 
 // Adapter bridges dht.Table к реализации поверх internal/netstack.Node.
 // Реализует только доступные операции; остальное помечено TODO.
+//
+// Values are signed Records, as in Kademlia: Put publishes a record owned by
+// id under a name, Get takes that name or any record key hash and verifies
+// what the network returns.
+// Between Start and Close, own records are republished before they expire
+// and provided keys are announced again every reprovideInterval.
 type Adapter struct {
 	node ns.Node
 	self Peer
+	id   keyring.Identity
+	own  *recordStore
+
+	mu       sync.Mutex
+	provided map[string]time.Time // key -> last announcement
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// reprovideInterval is how often provided keys are announced again; provider
+// records live 24h in the mock node and 48h in kad.
+const reprovideInterval = 12 * time.Hour
+
+// NewAdapter returns a Table over node. store, when set, persists the records
+// published through Put, which are republished after a restart; it is
+// typically a storage.Namespace reserved for them. A nil store keeps them in
+// memory only.
+func NewAdapter(node ns.Node, self Peer, id keyring.Identity, store storage.KV) *Adapter {
+	return &Adapter{node: node, self: self, id: id, own: newRecordStore(store, 0), provided: make(map[string]time.Time)}
+}
+
+// Start loads the persisted own records and begins republishing them.
+func (a *Adapter) Start(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cancel != nil {
+		return nil
+	}
+	if err := a.own.load(ctx, time.Now(), true); err != nil {
+		return fmt.Errorf("dht: load own records: %w", err)
+	}
+	loopCtx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	a.wg.Add(1)
+	go a.maintain(loopCtx)
+	return nil
+}
+
+func (a *Adapter) Close(ctx context.Context) error {
+	a.mu.Lock()
+	cancel := a.cancel
+	a.cancel = nil
+	a.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		a.wg.Wait()
+	}
+	return nil
 }
 
-func NewAdapter(node ns.Node, self Peer) *Adapter { return &Adapter{node: node, self: self} }
+func (a *Adapter) Self() Peer { return a.self }
 
-func (a *Adapter) Start(ctx context.Context) error { return nil }
-func (a *Adapter) Close(ctx context.Context) error { return nil }
-func (a *Adapter) Self() Peer                        { return a.self }
+// maintain republishes own records and provided keys until ctx is done.
+func (a *Adapter) maintain(ctx context.Context) {
+	defer a.wg.Done()
+	t := time.NewTicker(refreshInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		now := time.Now()
+		for _, rec := range a.own.list(now.Add(republishMargin)) {
+			if fresh := renew(a.id, rec, DefaultRecordTTL); fresh != nil {
+				if err := a.publish(ctx, fresh); err != nil {
+					log.Debug("dht republish failed", "name", rec.Key.Name, "err", err)
+				}
+			}
+		}
+		a.mu.Lock()
+		var due []string
+		for key, last := range a.provided {
+			if now.Sub(last) >= reprovideInterval {
+				due = append(due, key)
+			}
+		}
+		a.mu.Unlock()
+		for _, key := range due {
+			if err := a.Provide(ctx, Key(key)); err != nil {
+				log.Debug("dht reprovide failed", "key", hex.EncodeToString([]byte(key)), "err", err)
+			}
+		}
+	}
+}
 
 func (a *Adapter) FindPeer(ctx context.Context, id string) (Peer, error) {
-	addr, err := a.node.FindPeer(ctx, id)
+	start := time.Now()
+	addrs, err := a.node.FindPeer(ctx, id)
+	metrics.DHTRequest("find_peer", start, err)
 	if err != nil {
 		return Peer{}, err
 	}
-	return Peer{ID: id, Addr: addr}, nil
+	p := Peer{ID: id, Addrs: addrs}
+	if len(addrs) > 0 {
+		p.Addr = addrs[0]
+	}
+	return p, nil
 }
 
 func (a *Adapter) FindProviders(ctx context.Context, key Key, limit int) ([]Peer, error) {
+	start := time.Now()
 	addrs, err := a.node.FindProviders(ctx, key, limit)
+	metrics.DHTRequest("find_providers", start, err)
 	if err != nil {
 		return nil, err
 	}
+	metrics.ProvidersFound(len(addrs))
+	return groupPeers(addrs), nil
+}
+
+// groupPeers turns provider addresses into peers. Addresses ending in
+// /p2p/<id> are grouped by that ID; others are peers of their own.
+func groupPeers(addrs []string) []Peer {
 	peers := make([]Peer, 0, len(addrs))
+	byID := make(map[string]int)
 	for _, addr := range addrs {
-		peers = append(peers, Peer{Addr: addr})
+		i := strings.LastIndex(addr, "/p2p/")
+		if i < 0 {
+			peers = append(peers, Peer{Addr: addr, Addrs: []string{addr}})
+			continue
+		}
+		id := addr[i+len("/p2p/"):]
+		if j, ok := byID[id]; ok {
+			peers[j].Addrs = append(peers[j].Addrs, addr)
+			continue
+		}
+		byID[id] = len(peers)
+		peers = append(peers, Peer{ID: id, Addr: addr, Addrs: []string{addr}})
 	}
-	return peers, nil
+	return peers
 }
 
 func (a *Adapter) Provide(ctx context.Context, key Key) error {
-	return a.node.Provide(ctx, key)
+	start := time.Now()
+	err := a.node.Provide(ctx, key)
+	metrics.DHTRequest("provide", start, err)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.provided[string(key)] = time.Now()
+	a.mu.Unlock()
+	return nil
+}
+
+// Unprovide stops announcing key again; provider records already stored
+// expire on their own.
+func (a *Adapter) Unprovide(ctx context.Context, key Key) error {
+	a.mu.Lock()
+	delete(a.provided, string(key))
+	a.mu.Unlock()
+	return nil
 }
 
+// Get returns the value of the record stored under key: a 32-byte record key
+// hash, or the name an own record was Put under. Forged or expired records
+// are rejected.
 func (a *Adapter) Get(ctx context.Context, key Key) (Value, error) {
-	return a.node.GetValue(ctx, key)
+	rec, err := a.GetRecord(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Value, nil
+}
+
+// GetRecord returns the verified record stored under key, as for Get.
+func (a *Adapter) GetRecord(ctx context.Context, key Key) (*Record, error) {
+	h, err := tableKey(a.id.Public, key)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	raw, err := a.node.GetValue(ctx, h[:])
+	metrics.DHTRequest("get", start, err)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+	return ValidateValue(h[:], raw)
 }
 
+// Put publishes value under KeyFor(id.Public, string(key), 0) for
+// DefaultRecordTTL, signed by the adapter identity. Get reads it back with
+// the same key; keys of 32 bytes are rejected, since Get takes them for
+// hashes.
 func (a *Adapter) Put(ctx context.Context, key Key, value Value) error {
-	return a.node.PutValue(ctx, key, value)
+	if len(a.id.Private) == 0 {
+		return errors.New("dht: adapter has no identity to sign records")
+	}
+	if err := checkPutKey(key); err != nil {
+		return err
+	}
+	return a.publish(ctx, NewRecord(a.id, string(key), 0, value, DefaultRecordTTL))
+}
+
+// publish stores an own record and keeps it for republishing.
+func (a *Adapter) publish(ctx context.Context, rec *Record) error {
+	if err := a.PutRecord(ctx, rec); err != nil {
+		return err
+	}
+	return a.own.set(ctx, rec.Key.Hash(), rec)
+}
+
+// PutRecord stores a record under its own key hash.
+func (a *Adapter) PutRecord(ctx context.Context, rec *Record) error {
+	if err := rec.Verify(time.Now()); err != nil {
+		return err
+	}
+	h := rec.Key.Hash()
+	start := time.Now()
+	err := a.node.PutValue(ctx, h[:], rec.MarshalTL())
+	metrics.DHTRequest("put", start, err)
+	return err
 }
@@ -0,0 +1,110 @@
+package dht_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/grishinium-blockchain/grishinium-go/dht"
+	"github.com/grishinium-blockchain/grishinium-go/internal/netstack"
+	"github.com/grishinium-blockchain/grishinium-go/internal/netstack/mock"
+	"github.com/grishinium-blockchain/grishinium-go/internal/storage"
+	"github.com/grishinium-blockchain/grishinium-go/internal/storage/mem"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+)
+
+func TestAdapterPutGet(t *testing.T) {
+	ctx := context.Background()
+	nw := mock.NewNetwork()
+	newAdapter := func() (*dht.Adapter, keyring.Identity) {
+		id, _ := keyring.LoadIdentity("")
+		n := nw.NewNode(netstack.Config{})
+		if err := n.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = n.Close(ctx) })
+		return dht.NewAdapter(n, dht.Peer{ID: n.PeerID(), Addr: n.Addr()}, id, nil), id
+	}
+	owner, ownerID := newAdapter()
+	reader, _ := newAdapter()
+	if err := owner.Put(ctx, dht.Key("name"), dht.Value("value")); err != nil {
+		t.Fatal(err)
+	}
+	hash := dht.KeyFor(ownerID.Public, "name", 0).Hash()
+
+	tests := []struct {
+		name    string
+		table   *dht.Adapter
+		key     dht.Key
+		wantErr bool
+	}{
+		{"owner by name", owner, dht.Key("name"), false},
+		{"owner by hash", owner, hash[:], false},
+		{"other node by hash", reader, hash[:], false},
+		{"other node by name", reader, dht.Key("name"), true}, // names its own record
+		{"empty key", owner, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.table.Get(ctx, tt.key)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Get = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "value" {
+				t.Fatalf("Get = %q, want value", got)
+			}
+		})
+	}
+
+	if err := owner.Put(ctx, make(dht.Key, 32), dht.Value("value")); err == nil {
+		t.Fatal("Put accepted a key that Get reads as a hash")
+	}
+}
+
+func TestAdapterPersistsOwnRecords(t *testing.T) {
+	ctx := context.Background()
+	id, _ := keyring.LoadIdentity("")
+	store := mem.New(storage.Config{})
+	n := mock.New(netstack.Config{})
+	if err := n.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close(ctx)
+	self := dht.Peer{ID: n.PeerID(), Addr: n.Addr()}
+
+	a := dht.NewAdapter(n, self, id, store)
+	if err := a.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Put(ctx, dht.Key("name"), dht.Value("value")); err != nil {
+		t.Fatal(err)
+	}
+	_ = a.Close(ctx)
+	hash := dht.KeyFor(id.Public, "name", 0).Hash()
+	stored, err := store.Get(ctx, hash[:])
+	if err != nil || stored == nil {
+		t.Fatalf("own record not persisted: %v", err)
+	}
+
+	// A restarted adapter loads the records and drops undecodable entries.
+	if err := store.Put(ctx, bytes.Repeat([]byte{1}, 32), []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+	restarted := dht.NewAdapter(n, self, id, store)
+	if err := restarted.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close(ctx)
+	if v, _ := store.Get(ctx, bytes.Repeat([]byte{1}, 32)); v != nil {
+		t.Fatal("undecodable entry kept")
+	}
+	if v, _ := store.Get(ctx, hash[:]); !bytes.Equal(v, stored) {
+		t.Fatal("own record lost on restart")
+	}
+}
@@ -10,8 +10,9 @@ type Value []byte
 
 // Peer describes a DHT peer.
 type Peer struct {
-	ID   string
-	Addr string // multiaddr or host:port, implementation-defined
+	ID    string
+	Addr  string   // multiaddr or host:port, implementation-defined
+	Addrs []string // all known addresses; Addr is the first of them
 }
 
 // Table is the high-level DHT interface.
@@ -26,7 +27,12 @@ type Table interface {
 	FindProviders(ctx context.Context, key Key, limit int) ([]Peer, error)
 	// Provide announces that this node can provide the given key/value.
 	Provide(ctx context.Context, key Key) error
-	// Get/Put for small metadata values.
+	// Unprovide stops announcing key; announcements already made expire
+	// on their own.
+	Unprovide(ctx context.Context, key Key) error
+	// Get/Put for small metadata values. Put stores value under a name
+	// owned by this node; Get takes that name, or the 32-byte hash of any
+	// record key.
 	Get(ctx context.Context, key Key) (Value, error)
 	Put(ctx context.Context, key Key, value Value) error
 }
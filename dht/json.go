@@ -0,0 +1,65 @@
+package dht
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+)
+
+// GlobalConfig is the "dht" section of a network global config
+// (dht.config.global): the lookup parameters and the static nodes used to
+// join the network.
+type GlobalConfig struct {
+	Type        string `json:"@type,omitempty"`
+	K           int    `json:"k"`
+	A           int    `json:"a"`
+	StaticNodes struct {
+		Type  string  `json:"@type,omitempty"`
+		Nodes []*Node `json:"nodes"`
+	} `json:"static_nodes"`
+}
+
+// jsonNode is the TL-JSON form of dht.node used in global configs.
+type jsonNode struct {
+	Type string `json:"@type,omitempty"`
+	ID   struct {
+		Type string `json:"@type"`
+		Key  []byte `json:"key"`
+	} `json:"id"`
+	AddrList  adnl.AddressList `json:"addr_list"`
+	Version   int32            `json:"version"`
+	Signature []byte           `json:"signature"`
+}
+
+// MarshalJSON encodes the descriptor in the TL-JSON form of global configs.
+func (n *Node) MarshalJSON() ([]byte, error) {
+	var out jsonNode
+	out.Type = "dht.node"
+	out.ID.Type = "pub.ed25519"
+	out.ID.Key = n.PubKey
+	out.AddrList = n.AddrList
+	out.Version = n.Version
+	out.Signature = n.Signature
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes the TL-JSON form of global configs. The signature is
+// not verified.
+func (n *Node) UnmarshalJSON(b []byte) error {
+	var in jsonNode
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	if in.ID.Type != "pub.ed25519" || len(in.ID.Key) != ed25519.PublicKeySize {
+		return fmt.Errorf("dht: unsupported node id %q", in.ID.Type)
+	}
+	*n = Node{
+		PubKey:    ed25519.PublicKey(in.ID.Key),
+		AddrList:  in.AddrList,
+		Version:   in.Version,
+		Signature: in.Signature,
+	}
+	return nil
+}
@@ -0,0 +1,491 @@
+package dht
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+	logger "github.com/grishinium-blockchain/grishinium-go/internal/log"
+	"github.com/grishinium-blockchain/grishinium-go/internal/metrics"
+	"github.com/grishinium-blockchain/grishinium-go/internal/storage"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+var log = logger.For(logger.DHT)
+
+const (
+	// DefaultK is the bucket size and the number of nodes a value is stored on.
+	DefaultK = 10
+	// DefaultAlpha is the number of queries a lookup keeps in flight.
+	DefaultAlpha = 3
+	// DefaultQueryTimeout bounds a single DHT query.
+	DefaultQueryTimeout = 5 * time.Second
+	// DefaultRecordTTL is the lifetime of records published through Put.
+	DefaultRecordTTL = time.Hour
+
+	// AddressName is the record name under which nodes publish their
+	// adnl.addressList, keyed by their own ID.
+	AddressName = "address"
+
+	refreshInterval = 10 * time.Minute
+	// republishMargin is how long before expiry own records are signed
+	// again and re-stored; it spans two refreshes so one missed pass is
+	// harmless.
+	republishMargin = 2 * refreshInterval
+)
+
+var (
+	// ErrNotFound is returned when a lookup finds neither the value nor the peer.
+	ErrNotFound = errors.New("dht: not found")
+	// ErrNoPeers is returned when the routing table is empty.
+	ErrNoPeers = errors.New("dht: no known peers")
+)
+
+// Config configures a Kademlia node.
+type Config struct {
+	Identity keyring.Identity
+	// RPC carries the DHT queries. It is typically an adnl.RPC over an
+	// adnl.LocalNode over an adnl.UDPTransport; the caller starts and closes it.
+	RPC *adnl.RPC
+	// PublicAddr is the endpoint announced to other nodes. When unset, the
+	// RPC's local address is used if it is a routable IP.
+	PublicAddr netip.AddrPort
+	// Client disables serving and self-announcement: the node only queries
+	// others. A node without a usable address is always a client.
+	Client bool
+	// Bootstrap lists the nodes used to join the network.
+	Bootstrap []*Node
+	// Store, when set, persists the routing table, the records held for the
+	// network and the node's own published records, which are republished
+	// after a restart. It is typically a storage.Namespace reserved for the
+	// DHT.
+	Store storage.KV
+
+	K            int
+	Alpha        int
+	QueryTimeout time.Duration
+}
+
+// Kademlia is a native implementation of Table over ADNL. Keys are 256-bit
+// hashes of (owner ID, name, index) tuples, values are signed Records, and
+// lookups are iterative with Alpha queries in flight.
+type Kademlia struct {
+	cfg    Config
+	id     [32]byte
+	rt     *routingTable
+	self   *Node // nil in client mode
+	values *recordStore
+	own    *recordStore // records published by this node, kept for republishing
+	nodes  storage.KV   // persisted routing table; nil without Config.Store
+
+	queries atomic.Uint64 // queries served
+
+	mu      sync.Mutex
+	started bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewKademlia creates a node. It does not send anything until Start.
+func NewKademlia(cfg Config) *Kademlia {
+	if cfg.K <= 0 {
+		cfg.K = DefaultK
+	}
+	if cfg.Alpha <= 0 {
+		cfg.Alpha = DefaultAlpha
+	}
+	if cfg.QueryTimeout <= 0 {
+		cfg.QueryTimeout = DefaultQueryTimeout
+	}
+	id := adnl.KeyID(cfg.Identity.Public)
+	var values, own, nodes storage.KV
+	if cfg.Store != nil {
+		values = storage.NewNamespace(cfg.Store, "values")
+		own = storage.NewNamespace(cfg.Store, "own")
+		nodes = storage.NewNamespace(cfg.Store, "nodes")
+	}
+	return &Kademlia{
+		cfg:    cfg,
+		id:     id,
+		rt:     newRoutingTable(id, cfg.K),
+		values: newRecordStore(values, maxStoredValues),
+		own:    newRecordStore(own, 0),
+		nodes:  nodes,
+	}
+}
+
+// Start registers the query handlers, adds the bootstrap nodes and begins
+// joining the network in the background. Call Bootstrap to wait for the join.
+func (k *Kademlia) Start(ctx context.Context) error {
+	if len(k.cfg.Identity.Private) != ed25519.PrivateKeySize {
+		return errors.New("dht: identity is not set")
+	}
+	if k.cfg.RPC == nil {
+		return errors.New("dht: RPC is not set")
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.started {
+		return nil
+	}
+	now := time.Now()
+	if err := k.values.load(ctx, now, false); err != nil {
+		return fmt.Errorf("dht: load records: %w", err)
+	}
+	if err := k.own.load(ctx, now, true); err != nil {
+		return fmt.Errorf("dht: load own records: %w", err)
+	}
+	saved, err := k.loadNodes(ctx)
+	if err != nil {
+		return fmt.Errorf("dht: load routing table: %w", err)
+	}
+	k.started = true
+
+	if !k.cfg.Client {
+		if addr, ok := k.publicAddr(); ok {
+			k.self = NewNode(k.cfg.Identity.Private, []netip.AddrPort{addr}, int32(time.Now().Unix()))
+		}
+	}
+	if k.self != nil {
+		for _, c := range queryConstructors {
+			k.cfg.RPC.Handle(c, k.serve)
+		}
+	}
+	for _, n := range append(saved, k.cfg.Bootstrap...) {
+		if n.Verify() == nil {
+			k.rt.add(n, false)
+		}
+	}
+
+	log.Info("dht started", "id", hex.EncodeToString(k.id[:]), "client", k.self == nil,
+		"saved_nodes", len(saved), "bootstrap_nodes", len(k.cfg.Bootstrap), "records", k.values.count())
+
+	loopCtx, cancel := context.WithCancel(context.Background())
+	k.cancel = cancel
+	k.wg.Add(1)
+	go k.maintain(loopCtx)
+	return nil
+}
+
+// Close stops background work and unregisters the query handlers. The RPC is
+// left open.
+func (k *Kademlia) Close(ctx context.Context) error {
+	k.mu.Lock()
+	if !k.started {
+		k.mu.Unlock()
+		return nil
+	}
+	k.started = false
+	cancel := k.cancel
+	k.mu.Unlock()
+	cancel()
+	k.wg.Wait()
+	if k.self != nil {
+		for _, c := range queryConstructors {
+			k.cfg.RPC.Handle(c, nil)
+		}
+	}
+	return k.saveNodes(ctx)
+}
+
+// Self returns this node as a Peer.
+func (k *Kademlia) Self() Peer {
+	if k.self != nil {
+		return k.self.Peer()
+	}
+	return Peer{ID: hex.EncodeToString(k.id[:])}
+}
+
+// SelfNode returns the signed descriptor this node announces, or nil in
+// client mode.
+func (k *Kademlia) SelfNode() *Node { return k.self }
+
+// Bootstrap looks up the node's own ID, which fills the routing table with
+// the nodes closest to it.
+func (k *Kademlia) Bootstrap(ctx context.Context) error {
+	_, err := k.FindNodes(ctx, k.id)
+	return err
+}
+
+// maintain joins the network, publishes the node's address and periodically
+// refreshes the routing table, drops expired records and republishes own
+// records that are about to expire.
+func (k *Kademlia) maintain(ctx context.Context) {
+	defer k.wg.Done()
+	t := time.NewTicker(refreshInterval)
+	defer t.Stop()
+	for {
+		if err := k.Bootstrap(ctx); err != nil && ctx.Err() == nil {
+			log.Debug("dht bootstrap failed", "err", err)
+		}
+		if k.self != nil {
+			rec := NewRecord(k.cfg.Identity, AddressName, 0, k.addressListValue(), DefaultRecordTTL)
+			if _, err := k.Store(ctx, rec); err != nil && ctx.Err() == nil {
+				log.Debug("dht address record not stored", "err", err)
+			}
+		}
+		k.values.expire(ctx, time.Now())
+		k.republish(ctx)
+		if err := k.saveNodes(ctx); err != nil {
+			log.Warn("dht routing table not saved", "err", err)
+		}
+		st := k.Stats()
+		metrics.SetDHTTable(st.Nodes, st.Records)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// loadNodes returns the routing table saved by saveNodes.
+func (k *Kademlia) loadNodes(ctx context.Context) ([]*Node, error) {
+	if k.nodes == nil {
+		return nil, nil
+	}
+	it, err := k.nodes.NewIterator(ctx, storage.IterOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var out []*Node
+	for it.Next() {
+		if n, err := UnmarshalNode(it.Value()); err == nil {
+			out = append(out, n)
+		}
+	}
+	return out, it.Err()
+}
+
+// saveNodes replaces the saved routing table with the active nodes, so that a
+// restarted node can rejoin without its bootstrap nodes.
+func (k *Kademlia) saveNodes(ctx context.Context) error {
+	if k.nodes == nil {
+		return nil
+	}
+	b := k.nodes.NewBatch()
+	defer b.Close()
+	it, err := k.nodes.NewIterator(ctx, storage.IterOptions{})
+	if err != nil {
+		return err
+	}
+	for it.Next() {
+		_ = b.Delete(it.Key())
+	}
+	err = it.Err()
+	it.Close()
+	if err != nil {
+		return err
+	}
+	for _, n := range k.rt.nodes() {
+		id := n.ID()
+		_ = b.Put(id[:], n.MarshalTL())
+	}
+	return b.Commit(ctx, storage.WriteOptions{})
+}
+
+// Stats is a point-in-time summary of a node's state.
+type Stats struct {
+	// Buckets holds the number of active nodes per bucket, indexed by the
+	// length of the prefix shared with the node's own ID.
+	Buckets [256]int
+	// Nodes is the total number of active nodes in the routing table.
+	Nodes int
+	// Records is the number of records held for the network.
+	Records int
+	// OwnRecords is the number of records this node publishes.
+	OwnRecords int
+	// Queries is the number of queries served since the node was created.
+	Queries uint64
+}
+
+// Stats returns the current routing table fill, record counts and the number
+// of queries served.
+func (k *Kademlia) Stats() Stats {
+	st := Stats{
+		Buckets:    k.rt.fill(),
+		Records:    k.values.count(),
+		OwnRecords: k.own.count(),
+		Queries:    k.queries.Load(),
+	}
+	for _, n := range st.Buckets {
+		st.Nodes += n
+	}
+	return st
+}
+
+func (k *Kademlia) publicAddr() (netip.AddrPort, bool) {
+	if k.cfg.PublicAddr.IsValid() {
+		return k.cfg.PublicAddr, true
+	}
+	la := k.cfg.RPC.LocalAddr()
+	ip, err := netip.ParseAddr(la.Host)
+	if err != nil || ip.IsUnspecified() || la.Port == 0 {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(ip.Unmap(), uint16(la.Port)), true
+}
+
+func (k *Kademlia) addressListValue() []byte {
+	var w tl.Writer
+	k.self.AddrList.Write(&w)
+	return w.Bytes()
+}
+
+// FindPeer resolves an ADNL ID (hex) to its endpoints.
+func (k *Kademlia) FindPeer(ctx context.Context, id string) (Peer, error) {
+	target, err := adnl.ParseID(id)
+	if err != nil {
+		return Peer{}, fmt.Errorf("dht: invalid peer id: %w", err)
+	}
+	addr, err := k.ResolveAddress(ctx, target)
+	if err != nil {
+		return Peer{}, err
+	}
+	hostport := net.JoinHostPort(addr.Host, strconv.Itoa(addr.Port))
+	return Peer{ID: id, Addr: hostport, Addrs: []string{hostport}}, nil
+}
+
+// ResolveAddress returns the ADNL address of the node with the given ID. DHT
+// nodes are found directly; other ADNL nodes through their address record,
+// which must be signed by the node (RuleSignature).
+func (k *Kademlia) ResolveAddress(ctx context.Context, id [32]byte) (adnl.Address, error) {
+	if k.self != nil && id == k.id {
+		addr, _ := k.self.Address()
+		return addr, nil
+	}
+	if n := k.rt.get(id); n != nil {
+		if addr, ok := n.Address(); ok {
+			return addr, nil
+		}
+	}
+	if nodes, err := k.FindNodes(ctx, id); err == nil && len(nodes) > 0 && nodes[0].ID() == id {
+		if addr, ok := nodes[0].Address(); ok {
+			return addr, nil
+		}
+	}
+	res, err := k.FindValue(ctx, RecordKey{ID: id, Name: AddressName}.Hash())
+	if err != nil {
+		return adnl.Address{}, err
+	}
+	if res.Record.Rule != RuleSignature {
+		return adnl.Address{}, fmt.Errorf("dht: address record under rule %v is not signed by its owner", res.Record.Rule)
+	}
+	list, err := adnl.ReadAddressList(tl.NewReader(res.Record.Value))
+	if err != nil {
+		return adnl.Address{}, fmt.Errorf("dht: bad address record: %w", err)
+	}
+	addr, ok := list.Address(res.Record.Owner)
+	if !ok {
+		return adnl.Address{}, ErrNotFound
+	}
+	return addr, nil
+}
+
+// FindProviders returns the members of the overlay named key, see Provide.
+// Member addresses are resolved on a best-effort basis; members that cannot
+// be resolved are returned with their ID only.
+func (k *Kademlia) FindProviders(ctx context.Context, key Key, limit int) ([]Peer, error) {
+	res, err := k.FindValue(ctx, RecordKey{ID: OverlayID(key), Name: OverlayNodesName}.Hash())
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := res.Record.Nodes()
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(nodes) > limit {
+		nodes = nodes[:limit]
+	}
+	peers := make([]Peer, 0, len(nodes))
+	for _, n := range nodes {
+		id := n.ID()
+		p := Peer{ID: hex.EncodeToString(id[:])}
+		if addr, err := k.ResolveAddress(ctx, id); err == nil {
+			p.Addr = net.JoinHostPort(addr.Host, strconv.Itoa(addr.Port))
+			p.Addrs = []string{p.Addr}
+		}
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+// Provide announces this node as a member of the overlay named key by
+// merging a signed member entry into the overlay's nodes record.
+func (k *Kademlia) Provide(ctx context.Context, key Key) error {
+	if len(key) == 0 {
+		return errors.New("dht: empty provider key")
+	}
+	member := NewOverlayNode(k.cfg.Identity.Private, OverlayID(key), int32(time.Now().Unix()))
+	return k.publish(ctx, NewOverlayNodesRecord(key, []*OverlayNode{member}, DefaultRecordTTL))
+}
+
+// Unprovide stops republishing this node's membership of the overlay named
+// key. The entry already stored in the overlay's nodes record expires with it.
+func (k *Kademlia) Unprovide(ctx context.Context, key Key) error {
+	k.own.remove(ctx, RecordKey{ID: OverlayID(key), Name: OverlayNodesName}.Hash())
+	return nil
+}
+
+// Get returns the value of the record stored under key: a 32-byte record key
+// hash (see RecordKey.Hash), or the name an own record was Put under.
+func (k *Kademlia) Get(ctx context.Context, key Key) (Value, error) {
+	h, err := tableKey(k.cfg.Identity.Public, key)
+	if err != nil {
+		return nil, err
+	}
+	res, err := k.FindValue(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	return res.Record.Value, nil
+}
+
+// Put publishes value under KeyFor(own key, string(key), 0) for
+// DefaultRecordTTL. It can be read back with Get using the same key, and by
+// other nodes using that record key's hash. Keys of 32 bytes are rejected,
+// since Get takes them for hashes.
+func (k *Kademlia) Put(ctx context.Context, key Key, value Value) error {
+	if err := checkPutKey(key); err != nil {
+		return err
+	}
+	return k.publish(ctx, NewRecord(k.cfg.Identity, string(key), 0, value, DefaultRecordTTL))
+}
+
+// publish stores an own record and keeps republishing it until the node is
+// closed. With Config.Store set, republishing resumes after a restart.
+func (k *Kademlia) publish(ctx context.Context, rec *Record) error {
+	if err := rec.Verify(time.Now()); err != nil {
+		return err
+	}
+	if err := k.own.set(ctx, rec.Key.Hash(), rec); err != nil {
+		return err
+	}
+	_, err := k.Store(ctx, rec)
+	return err
+}
+
+// republish signs own records that expire within republishMargin again and
+// stores them.
+func (k *Kademlia) republish(ctx context.Context) {
+	for _, rec := range k.own.list(time.Now().Add(republishMargin)) {
+		if fresh := renew(k.cfg.Identity, rec, DefaultRecordTTL); fresh != nil {
+			if err := k.publish(ctx, fresh); err != nil {
+				log.Debug("dht republish failed", "name", rec.Key.Name, "err", err)
+			}
+		}
+	}
+}
+
+var _ Table = (*Kademlia)(nil)
@@ -0,0 +1,245 @@
+package dht
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+)
+
+// newTestKademlia returns a DHT node on nw, joining through bootstrap once
+// started.
+func newTestKademlia(t *testing.T, nw *adnl.MemNetwork, seed byte, k int, bootstrap ...*Node) *Kademlia {
+	t.Helper()
+	ctx := context.Background()
+	pc, err := nw.ListenPacket("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := testIdentity(seed)
+	node := adnl.NewNode(adnl.NewUDPTransport(adnl.UDPConfig{Identity: id, PacketConn: pc}))
+	rpc := adnl.NewRPC(node)
+	if err := node.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = node.Close(ctx) })
+	return NewKademlia(Config{
+		Identity:     id,
+		RPC:          rpc,
+		PublicAddr:   netip.MustParseAddrPort(pc.LocalAddr().String()),
+		Bootstrap:    bootstrap,
+		K:            k,
+		QueryTimeout: 500 * time.Millisecond,
+	})
+}
+
+// newTestDHT starts a DHT node on nw that joins through bootstrap.
+func newTestDHT(t *testing.T, nw *adnl.MemNetwork, seed byte, k int, bootstrap ...*Node) *Kademlia {
+	t.Helper()
+	kad := newTestKademlia(t, nw, seed, k, bootstrap...)
+	if err := kad.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = kad.Close(context.Background()) })
+	return kad
+}
+
+// newTestNetwork starts n DHT nodes that bootstrap through the first one.
+func newTestNetwork(t *testing.T, n, k int) []*Kademlia {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	nw := adnl.NewMemNetwork()
+	nodes := []*Kademlia{newTestDHT(t, nw, 1, k)}
+	for i := 1; i < n; i++ {
+		nodes = append(nodes, newTestDHT(t, nw, byte(i+1), k, nodes[0].SelfNode()))
+	}
+	// The first node learns of the others from their queries; a second pass
+	// lets early nodes learn of the ones that joined later.
+	for pass := range 2 {
+		for _, kad := range nodes[1-pass:] {
+			if err := kad.Bootstrap(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return nodes
+}
+
+// closestIDs returns the IDs of the k nodes closest to target, skipping skip.
+func closestIDs(nodes []*Kademlia, target [32]byte, k int, skip *Kademlia) [][32]byte {
+	var all []*Node
+	for _, n := range nodes {
+		if n != skip {
+			all = append(all, n.SelfNode())
+		}
+	}
+	sortByDistance(target, all)
+	ids := make([][32]byte, 0, k)
+	for _, n := range all[:min(k, len(all))] {
+		ids = append(ids, n.ID())
+	}
+	return ids
+}
+
+func nodeIDs(nodes []*Node) [][32]byte {
+	ids := make([][32]byte, len(nodes))
+	for i, n := range nodes {
+		ids[i] = n.ID()
+	}
+	return ids
+}
+
+func TestBootstrap(t *testing.T) {
+	nodes := newTestNetwork(t, 8, DefaultK)
+	for i, kad := range nodes {
+		known := kad.rt.nodes()
+		if len(known) != len(nodes)-1 {
+			t.Errorf("node %d knows %d nodes, want %d", i, len(known), len(nodes)-1)
+		}
+		for _, n := range known {
+			if n.ID() == kad.id {
+				t.Errorf("node %d routes to itself", i)
+			}
+		}
+	}
+}
+
+func TestFindNodes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	const k = 3
+	nodes := newTestNetwork(t, 10, k)
+	for _, target := range [][32]byte{{}, {0xff}, nodes[5].id, KeyFor(testIdentity(99).Public, "x", 0).Hash()} {
+		from := nodes[len(nodes)-1]
+		got, err := from.FindNodes(ctx, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := closestIDs(nodes, target, k, from); !slices.Equal(nodeIDs(got), want) {
+			t.Errorf("FindNodes(%x) = %x, want %x", target[:2], nodeIDs(got), want)
+		}
+	}
+}
+
+func TestStoreAndFindValue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	const k = 3
+	nodes := newTestNetwork(t, 10, k)
+	owner := testIdentity(100)
+	rec := NewRecord(owner, "name", 0, []byte("value"), time.Hour)
+	key := rec.Key.Hash()
+	origin := nodes[0]
+
+	stored, err := origin.Store(ctx, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != k {
+		t.Fatalf("stored on %d nodes, want %d", stored, k)
+	}
+	// The record lands on the K nodes closest to its key, and the origin
+	// keeps a copy.
+	holders := closestIDs(nodes, key, k, origin)
+	for i, kad := range nodes {
+		want := kad == origin || slices.Contains(holders, kad.id)
+		if got := kad.values.get(key, time.Now()) != nil; got != want {
+			t.Errorf("node %d holds the record = %v, want %v", i, got, want)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		key     [32]byte
+		wantErr error
+	}{
+		{"stored", key, nil},
+		{"missing", KeyFor(owner.Public, "other", 0).Hash(), ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, kad := range nodes {
+				res, err := kad.FindValue(ctx, tt.key)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("node %d: FindValue = %v, want %v", i, err, tt.wantErr)
+				}
+				if err == nil && string(res.Record.Value) != "value" {
+					t.Fatalf("node %d: value %q", i, res.Record.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestBucketEviction(t *testing.T) {
+	self := testIdentity(1)
+	selfID := adnl.KeyID(self.Public)
+	// Collect nodes that share no leading bit with self: one bucket.
+	var same []*Node
+	for seed := byte(2); len(same) < 3; seed++ {
+		n := NewNode(testIdentity(seed).Private, []netip.AddrPort{netip.MustParseAddrPort("10.0.0.1:1")}, 1)
+		if commonPrefixLen(selfID, n.ID()) == 0 {
+			same = append(same, n)
+		}
+	}
+	rt := newRoutingTable(selfID, 2)
+	for _, n := range same {
+		rt.add(n, true)
+	}
+	if got := rt.fill()[0]; got != 2 {
+		t.Fatalf("bucket holds %d nodes, want 2", got)
+	}
+	if rt.get(same[2].ID()) != nil {
+		t.Fatal("node beyond k became active")
+	}
+
+	for i := 1; i < maxNodeFailures; i++ {
+		rt.fail(same[0].ID())
+	}
+	if rt.get(same[0].ID()) == nil {
+		t.Fatalf("node evicted after %d failures", maxNodeFailures-1)
+	}
+	// Answering resets the failure count.
+	rt.add(same[0], true)
+	rt.fail(same[0].ID())
+	if rt.get(same[0].ID()) == nil {
+		t.Fatal("failures survived an answer")
+	}
+	for range maxNodeFailures - 1 {
+		rt.fail(same[0].ID())
+	}
+	if rt.get(same[0].ID()) != nil {
+		t.Fatalf("node kept after %d failures", maxNodeFailures)
+	}
+	if rt.get(same[2].ID()) == nil {
+		t.Fatal("replacement not promoted")
+	}
+}
+
+func TestEvictUnreachableNode(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// Not started, so that no background lookup queries the node as well.
+	a := newTestKademlia(t, adnl.NewMemNetwork(), 1, DefaultK)
+	a.cfg.QueryTimeout = 100 * time.Millisecond
+
+	// A node whose address nobody listens on never answers.
+	gone := NewNode(testIdentity(2).Private, []netip.AddrPort{netip.MustParseAddrPort("10.9.9.9:1")}, 1)
+	a.rt.add(gone, true)
+	for i := range maxNodeFailures {
+		if a.rt.get(gone.ID()) == nil {
+			t.Fatalf("evicted after %d failed pings", i)
+		}
+		if _, err := a.Ping(ctx, gone); err == nil {
+			t.Fatal("ping of an unreachable node succeeded")
+		}
+	}
+	if a.rt.get(gone.ID()) != nil {
+		t.Fatalf("unreachable node kept after %d failed pings", maxNodeFailures)
+	}
+}
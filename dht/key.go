@@ -0,0 +1,126 @@
+package dht
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/bits"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+// maxNameLen bounds RecordKey.Name.
+const maxNameLen = 127
+
+// RecordKey names a DHT record: the owner's 256-bit ID, a name and an index.
+// Records are stored at the SHA-256 of its TL form, see Hash.
+type RecordKey struct {
+	ID   [32]byte
+	Name string
+	Idx  int32
+}
+
+// KeyFor returns the key of a record owned by pub.
+func KeyFor(pub ed25519.PublicKey, name string, idx int32) RecordKey {
+	return RecordKey{ID: adnl.KeyID(pub), Name: name, Idx: idx}
+}
+
+// tableKey returns the record key hash a Table.Get key stands for. A 32-byte
+// key is a record key hash (see RecordKey.Hash); any other key is the name
+// of a record owned by owner, as published by Table.Put.
+func tableKey(owner ed25519.PublicKey, key Key) ([32]byte, error) {
+	if len(key) == 32 {
+		return [32]byte(key), nil
+	}
+	if len(key) == 0 || len(key) > maxNameLen {
+		return [32]byte{}, errors.New("dht: invalid key length")
+	}
+	if len(owner) != ed25519.PublicKeySize {
+		return [32]byte{}, errors.New("dht: no own key to name records by")
+	}
+	return KeyFor(owner, string(key), 0).Hash(), nil
+}
+
+// checkPutKey checks a Table.Put key: a record name that Table.Get does not
+// read as a record key hash.
+func checkPutKey(key Key) error {
+	if len(key) == 0 || len(key) > maxNameLen {
+		return errors.New("dht: invalid key length")
+	}
+	if len(key) == 32 {
+		return errors.New("dht: 32-byte keys read back as record key hashes; use a name of another length")
+	}
+	return nil
+}
+
+// Hash returns the 256-bit DHT key the record is stored under.
+func (k RecordKey) Hash() [32]byte {
+	var w tl.Writer
+	k.write(&w)
+	return sha256.Sum256(w.Bytes())
+}
+
+// write appends the boxed dht.key form.
+func (k RecordKey) write(w *tl.Writer) {
+	w.WriteUint32(tlKey)
+	k.writeBare(w)
+}
+
+// writeBare appends the bare dht.key form, as embedded in key descriptions.
+func (k RecordKey) writeBare(w *tl.Writer) {
+	w.WriteRaw(k.ID[:])
+	w.WriteString(k.Name)
+	w.WriteInt32(k.Idx)
+}
+
+func readRecordKey(r *tl.Reader) (RecordKey, error) {
+	var k RecordKey
+	k.ID = r.Int256()
+	k.Name = r.String()
+	k.Idx = r.Int32()
+	if err := r.Err(); err != nil {
+		return k, err
+	}
+	if len(k.Name) == 0 || len(k.Name) > maxNameLen {
+		return k, errors.New("dht: invalid key name length")
+	}
+	return k, nil
+}
+
+// ParseKeyHash decodes a hex-encoded 256-bit DHT key.
+func ParseKeyHash(s string) ([32]byte, error) {
+	var h [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return h, err
+	}
+	if len(b) != len(h) {
+		return h, errors.New("dht: key must be 32 bytes")
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+// commonPrefixLen returns the number of leading bits shared by a and b
+// (256 when equal).
+func commonPrefixLen(a, b [32]byte) int {
+	for i := range a {
+		if x := a[i] ^ b[i]; x != 0 {
+			return i*8 + bits.LeadingZeros8(x)
+		}
+	}
+	return 256
+}
+
+// closer reports whether a is strictly closer to target than b.
+func closer(target, a, b [32]byte) bool {
+	for i := range target {
+		da, db := a[i]^target[i], b[i]^target[i]
+		if da != db {
+			return da < db
+		}
+	}
+	return false
+}
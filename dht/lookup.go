@@ -0,0 +1,376 @@
+package dht
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/internal/metrics"
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+// ValueResult is the outcome of FindValue.
+type ValueResult struct {
+	Record *Record
+	// From lists the nodes that returned a valid copy of Record.
+	From []*Node
+	// Invalid lists the nodes that returned a record that failed
+	// verification: forged, expired or stored under another key.
+	Invalid []*Node
+}
+
+// candidate is a node under consideration during a lookup.
+type candidate struct {
+	node    *Node
+	id      [32]byte
+	queried bool
+	failed  bool
+}
+
+// lookup is the state of one iterative lookup.
+type lookup struct {
+	k      *Kademlia
+	target [32]byte
+	value  bool // dht.findValue instead of dht.findNode
+
+	mu      sync.Mutex
+	cands   []*candidate // ordered by distance to target
+	seen    map[[32]byte]bool
+	result  *ValueResult
+	invalid []*Node
+}
+
+type lookupAnswer struct {
+	c       *candidate
+	nodes   []*Node
+	record  *Record
+	err     error
+	invalid bool // the node answered with a record that failed verification
+}
+
+// FindNodes returns up to K nodes closest to target, found by an iterative
+// lookup.
+func (k *Kademlia) FindNodes(ctx context.Context, target [32]byte) ([]*Node, error) {
+	l, err := k.newLookup(target, false)
+	if err != nil {
+		return nil, err
+	}
+	l.run(ctx)
+	return l.closest(), ctx.Err()
+}
+
+// FindValue looks up the record stored under key. Local copies are returned
+// without network traffic, except for overlay member lists, which are merged
+// with the copies found on the network. When only invalid copies are found,
+// the error is ErrNotFound and the result lists the nodes that sent them.
+func (k *Kademlia) FindValue(ctx context.Context, key [32]byte) (*ValueResult, error) {
+	local := k.values.get(key, time.Now())
+	if local != nil && local.Rule != RuleOverlayNodes {
+		return &ValueResult{Record: local}, nil
+	}
+	l, err := k.newLookup(key, true)
+	if err != nil {
+		if local != nil {
+			return &ValueResult{Record: local}, nil
+		}
+		return nil, err
+	}
+	l.run(ctx)
+	if l.result != nil {
+		l.result.Invalid = l.invalid
+	}
+	switch {
+	case l.result != nil && local != nil:
+		l.result.Record = merge(l.result.Record, local, time.Now())
+	case local != nil:
+		return &ValueResult{Record: local}, nil
+	case l.result == nil:
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if len(l.invalid) > 0 {
+			return &ValueResult{Invalid: l.invalid}, ErrNotFound
+		}
+		return nil, ErrNotFound
+	}
+	return l.result, nil
+}
+
+// Store verifies rec, keeps a local copy and stores it on the K nodes closest
+// to its key. It returns the number of remote nodes that accepted it.
+func (k *Kademlia) Store(ctx context.Context, rec *Record) (int, error) {
+	if err := rec.Verify(time.Now()); err != nil {
+		return 0, err
+	}
+	key := rec.Key.Hash()
+	if err := k.values.put(ctx, key, rec); err != nil && !errors.Is(err, errStoreFull) {
+		return 0, err
+	}
+	nodes, err := k.FindNodes(ctx, key)
+	if err != nil && len(nodes) == 0 {
+		return 0, err
+	}
+	var w tl.Writer
+	w.WriteUint32(tlStore)
+	rec.write(&w)
+	q := w.Bytes()
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		stored int
+	)
+	for _, n := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			answer, err := k.query(ctx, n, q)
+			if err != nil {
+				return
+			}
+			if tl.NewReader(answer).Uint32() == tlStored {
+				mu.Lock()
+				stored++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if stored == 0 && len(nodes) > 0 {
+		return 0, errors.New("dht: no node accepted the record")
+	}
+	return stored, nil
+}
+
+// Ping sends dht.ping to the node and returns the round-trip time.
+func (k *Kademlia) Ping(ctx context.Context, n *Node) (time.Duration, error) {
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return 0, err
+	}
+	var w tl.Writer
+	w.WriteUint32(tlPing)
+	w.WriteRaw(nonce[:])
+	start := time.Now()
+	answer, err := k.query(ctx, n, w.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	r := tl.NewReader(answer)
+	if r.Uint32() != tlPong || r.Uint64() != binary.LittleEndian.Uint64(nonce[:]) || r.Err() != nil {
+		return 0, errors.New("dht: bad pong")
+	}
+	return rtt, nil
+}
+
+// SignedAddressList asks n for the descriptor it currently announces
+// (dht.getSignedAddressList) and verifies its signature.
+func (k *Kademlia) SignedAddressList(ctx context.Context, n *Node) (*Node, error) {
+	var w tl.Writer
+	w.WriteUint32(tlGetSignedAddressList)
+	answer, err := k.query(ctx, n, w.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	got, err := UnmarshalNode(answer)
+	if err != nil {
+		return nil, err
+	}
+	if err := got.Verify(); err != nil {
+		return nil, err
+	}
+	return got, nil
+}
+
+// query sends q to n, prefixed with this node's announcement unless it runs
+// as a client, and updates the routing table with the outcome.
+func (k *Kademlia) query(ctx context.Context, n *Node, q []byte) ([]byte, error) {
+	addr, ok := n.Address()
+	if !ok {
+		return nil, errors.New("dht: node has no address")
+	}
+	if k.self != nil {
+		var w tl.Writer
+		w.WriteUint32(tlQuery)
+		k.self.write(&w)
+		w.WriteRaw(q)
+		q = w.Bytes()
+	}
+	qctx, cancel := context.WithTimeout(ctx, k.cfg.QueryTimeout)
+	defer cancel()
+	start := time.Now()
+	answer, err := k.cfg.RPC.Query(qctx, addr, q)
+	metrics.DHTQuery(time.Since(start), err)
+	if err != nil {
+		if ctx.Err() == nil {
+			k.rt.fail(n.ID())
+		}
+		return nil, err
+	}
+	k.rt.add(n, true)
+	return answer, nil
+}
+
+func (k *Kademlia) newLookup(target [32]byte, value bool) (*lookup, error) {
+	start := k.rt.closest(target, k.cfg.K)
+	if len(start) == 0 {
+		return nil, ErrNoPeers
+	}
+	l := &lookup{k: k, target: target, value: value, seen: map[[32]byte]bool{k.id: true}}
+	l.merge(start)
+	return l, nil
+}
+
+// merge adds new nodes to the candidate list, keeping it ordered.
+func (l *lookup) merge(nodes []*Node) {
+	for _, n := range nodes {
+		id := n.ID()
+		if l.seen[id] {
+			continue
+		}
+		l.seen[id] = true
+		c := &candidate{node: n, id: id}
+		i := len(l.cands)
+		for i > 0 && closer(l.target, id, l.cands[i-1].id) {
+			i--
+		}
+		l.cands = append(l.cands, nil)
+		copy(l.cands[i+1:], l.cands[i:])
+		l.cands[i] = c
+	}
+}
+
+// next returns up to n unqueried candidates among the K closest live ones.
+func (l *lookup) next(n int) []*candidate {
+	var out []*candidate
+	live := 0
+	for _, c := range l.cands {
+		if c.failed {
+			continue
+		}
+		if live++; live > l.k.cfg.K {
+			break
+		}
+		if !c.queried && len(out) < n {
+			c.queried = true
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// closest returns the K closest candidates that answered.
+func (l *lookup) closest() []*Node {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []*Node
+	for _, c := range l.cands {
+		if c.queried && !c.failed {
+			out = append(out, c.node)
+			if len(out) == l.k.cfg.K {
+				break
+			}
+		}
+	}
+	return out
+}
+
+// run drives the lookup until the K closest candidates have been queried, a
+// value is found, or ctx is done.
+func (l *lookup) run(ctx context.Context) {
+	answers := make(chan lookupAnswer, l.k.cfg.Alpha)
+	inflight := 0
+	for {
+		l.mu.Lock()
+		var batch []*candidate
+		if l.result == nil {
+			batch = l.next(l.k.cfg.Alpha - inflight)
+		}
+		l.mu.Unlock()
+		for _, c := range batch {
+			inflight++
+			go func() { answers <- l.ask(ctx, c) }()
+		}
+		if inflight == 0 {
+			return
+		}
+		a := <-answers
+		inflight--
+		l.mu.Lock()
+		switch {
+		case a.invalid:
+			l.invalid = append(l.invalid, a.c.node)
+			a.c.failed = true
+		case a.err != nil:
+			a.c.failed = true
+		case a.record != nil:
+			l.addResult(a.c.node, a.record)
+		default:
+			l.merge(a.nodes)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// addResult keeps the record the update rules prefer, see merge, and the
+// nodes that returned it. Overlay member lists from different nodes are
+// merged.
+func (l *lookup) addResult(from *Node, rec *Record) {
+	if l.result == nil {
+		l.result = &ValueResult{Record: rec, From: []*Node{from}}
+		return
+	}
+	cur := l.result.Record
+	if rec.Rule == cur.Rule && rec.Rule != RuleOverlayNodes && rec.TTL == cur.TTL {
+		l.result.From = append(l.result.From, from)
+		return
+	}
+	switch kept := merge(cur, rec, time.Now()); kept {
+	case cur:
+	case rec:
+		l.result = &ValueResult{Record: rec, From: []*Node{from}}
+	default:
+		l.result.Record = kept
+		l.result.From = append(l.result.From, from)
+	}
+}
+
+func (l *lookup) ask(ctx context.Context, c *candidate) lookupAnswer {
+	var w tl.Writer
+	if l.value {
+		w.WriteUint32(tlFindValue)
+	} else {
+		w.WriteUint32(tlFindNode)
+	}
+	w.WriteRaw(l.target[:])
+	w.WriteInt32(int32(l.k.cfg.K))
+	answer, err := l.k.query(ctx, c.node, w.Bytes())
+	if err != nil {
+		return lookupAnswer{c: c, err: err}
+	}
+	r := tl.NewReader(answer)
+	switch cons := r.Uint32(); cons {
+	case tlNodes, tlValueNotFound:
+		nodes, err := readNodes(r)
+		return lookupAnswer{c: c, nodes: nodes, err: err}
+	case tlValueFound:
+		if r.Uint32() != tlValue {
+			return lookupAnswer{c: c, err: errors.New("dht: bad valueFound answer")}
+		}
+		rec, err := readRecord(r)
+		if err == nil {
+			err = rec.VerifyKey(l.target, time.Now())
+		}
+		if err != nil {
+			return lookupAnswer{c: c, err: err, invalid: true}
+		}
+		return lookupAnswer{c: c, record: rec}
+	default:
+		return lookupAnswer{c: c, err: fmt.Errorf("dht: unexpected answer %08x", cons)}
+	}
+}
@@ -0,0 +1,186 @@
+package dht
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+// maxNodesPerAnswer bounds the nodes accepted from, and sent in, one answer.
+const maxNodesPerAnswer = 20
+
+// Node is a signed DHT node descriptor (dht.node): the node's public key and
+// the ADNL endpoints it listens on, signed by that key. Descriptors can be
+// relayed by third parties because the signature covers the address list.
+type Node struct {
+	PubKey    ed25519.PublicKey
+	AddrList  adnl.AddressList
+	Version   int32
+	Signature []byte
+}
+
+// ID returns the node's 256-bit ID, its ADNL short key ID.
+func (n *Node) ID() [32]byte { return adnl.KeyID(n.PubKey) }
+
+// Address returns the ADNL address used to query the node.
+func (n *Node) Address() (adnl.Address, bool) { return n.AddrList.Address(n.PubKey) }
+
+// Peer converts the descriptor into a dht.Peer.
+func (n *Node) Peer() Peer {
+	id := n.ID()
+	p := Peer{ID: hex.EncodeToString(id[:])}
+	for _, a := range n.AddrList.Addrs {
+		p.Addrs = append(p.Addrs, a.String())
+	}
+	if len(p.Addrs) > 0 {
+		p.Addr = p.Addrs[0]
+	}
+	return p
+}
+
+// Sign sets Signature using priv, which must belong to PubKey.
+func (n *Node) Sign(priv ed25519.PrivateKey) {
+	n.Signature = ed25519.Sign(priv, n.signedPayload())
+}
+
+// Verify checks the descriptor signature.
+func (n *Node) Verify() error {
+	if len(n.PubKey) != ed25519.PublicKeySize {
+		return errors.New("dht: node has no valid public key")
+	}
+	if !ed25519.Verify(n.PubKey, n.signedPayload(), n.Signature) {
+		return errors.New("dht: bad node signature")
+	}
+	return nil
+}
+
+func (n *Node) signedPayload() []byte {
+	c := *n
+	c.Signature = nil
+	var w tl.Writer
+	w.WriteUint32(tlNode)
+	c.write(&w)
+	return w.Bytes()
+}
+
+// write appends the bare dht.node form.
+func (n *Node) write(w *tl.Writer) {
+	w.WriteUint32(tlPubEd25519)
+	w.WriteRaw(n.PubKey)
+	n.AddrList.Write(w)
+	w.WriteInt32(n.Version)
+	w.WriteBytes(n.Signature)
+}
+
+// MarshalTL returns the boxed dht.node form, as found in global configs.
+func (n *Node) MarshalTL() []byte {
+	var w tl.Writer
+	w.WriteUint32(tlNode)
+	n.write(&w)
+	return w.Bytes()
+}
+
+// UnmarshalNode decodes a boxed dht.node. The signature is not verified.
+func UnmarshalNode(b []byte) (*Node, error) {
+	r := tl.NewReader(b)
+	if c := r.Uint32(); c != tlNode {
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+		return nil, fmt.Errorf("dht: unexpected constructor %08x for dht.node", c)
+	}
+	n, err := readNode(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("dht: trailing bytes after dht.node")
+	}
+	return n, nil
+}
+
+func readNode(r *tl.Reader) (*Node, error) {
+	pub, err := readPublicKey(r)
+	if err != nil {
+		return nil, err
+	}
+	n := &Node{PubKey: pub}
+	if n.AddrList, err = adnl.ReadAddressList(r); err != nil {
+		return nil, err
+	}
+	n.Version = r.Int32()
+	n.Signature = r.Bytes()
+	return n, r.Err()
+}
+
+func readPublicKey(r *tl.Reader) (ed25519.PublicKey, error) {
+	if c := r.Uint32(); c != tlPubEd25519 {
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+		return nil, fmt.Errorf("dht: unsupported public key type %08x", c)
+	}
+	pub := r.Raw(ed25519.PublicKeySize)
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	return ed25519.PublicKey(append([]byte(nil), pub...)), nil
+}
+
+func writeNodes(w *tl.Writer, nodes []*Node) {
+	w.WriteUint32(uint32(len(nodes)))
+	for _, n := range nodes {
+		n.write(w)
+	}
+}
+
+// readNodes decodes a bare dht.nodes and drops descriptors with bad
+// signatures.
+func readNodes(r *tl.Reader) ([]*Node, error) {
+	cnt := r.Uint32()
+	if cnt > maxNodesPerAnswer {
+		return nil, errors.New("dht: too many nodes in answer")
+	}
+	out := make([]*Node, 0, cnt)
+	for i := uint32(0); i < cnt; i++ {
+		n, err := readNode(r)
+		if err != nil {
+			return nil, err
+		}
+		if n.Verify() == nil {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+// NewNode returns a descriptor for the given key and endpoints, signed with
+// priv. version is usually the current unix time, so that newer descriptors
+// replace older ones.
+func NewNode(priv ed25519.PrivateKey, addrs []netip.AddrPort, version int32) *Node {
+	n := &Node{
+		PubKey:   priv.Public().(ed25519.PublicKey),
+		AddrList: adnl.AddressList{Addrs: addrs, Version: version, ReinitDate: version},
+		Version:  version,
+	}
+	n.Sign(priv)
+	return n
+}
+
+// parseAddrPort parses a host:port pair with a literal IP.
+func parseAddrPort(host string, port int) (netip.AddrPort, error) {
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	if port <= 0 || port > 0xffff {
+		return netip.AddrPort{}, errors.New("dht: invalid port " + strconv.Itoa(port))
+	}
+	return netip.AddrPortFrom(ip, uint16(port)), nil
+}
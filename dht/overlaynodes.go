@@ -0,0 +1,133 @@
+package dht
+
+import (
+	"cmp"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+// MaxOverlayNodes bounds the member list kept in one overlay nodes record;
+// merging keeps the most recently announced members.
+const MaxOverlayNodes = 25
+
+// OverlayNode announces that a node is a member of an overlay (overlay.node).
+// It is signed by the member, so lists of them can be merged by anyone.
+type OverlayNode struct {
+	PubKey    ed25519.PublicKey
+	Overlay   [32]byte
+	Version   int32
+	Signature []byte
+}
+
+// NewOverlayNode returns a member entry for the overlay signed with priv.
+// version is usually the current unix time.
+func NewOverlayNode(priv ed25519.PrivateKey, overlay [32]byte, version int32) *OverlayNode {
+	n := &OverlayNode{PubKey: priv.Public().(ed25519.PublicKey), Overlay: overlay, Version: version}
+	n.Signature = ed25519.Sign(priv, n.signedPayload())
+	return n
+}
+
+// ID returns the member's ADNL ID.
+func (n *OverlayNode) ID() [32]byte { return adnl.KeyID(n.PubKey) }
+
+// Verify checks the member's signature.
+func (n *OverlayNode) Verify() error {
+	if len(n.PubKey) != ed25519.PublicKeySize {
+		return errors.New("dht: overlay node has no valid public key")
+	}
+	if !ed25519.Verify(n.PubKey, n.signedPayload(), n.Signature) {
+		return errors.New("dht: bad overlay node signature")
+	}
+	return nil
+}
+
+// signedPayload is the boxed overlay.node.toSign.
+func (n *OverlayNode) signedPayload() []byte {
+	id := n.ID()
+	var w tl.Writer
+	w.WriteUint32(tlOverlayNodeToSign)
+	w.WriteRaw(id[:])
+	w.WriteRaw(n.Overlay[:])
+	w.WriteInt32(n.Version)
+	return w.Bytes()
+}
+
+func marshalOverlayNodes(nodes []*OverlayNode) []byte {
+	var w tl.Writer
+	w.WriteUint32(tlOverlayNodes)
+	w.WriteUint32(uint32(len(nodes)))
+	for _, n := range nodes {
+		w.WriteUint32(tlPubEd25519)
+		w.WriteRaw(n.PubKey)
+		w.WriteRaw(n.Overlay[:])
+		w.WriteInt32(n.Version)
+		w.WriteBytes(n.Signature)
+	}
+	return w.Bytes()
+}
+
+func unmarshalOverlayNodes(b []byte) ([]*OverlayNode, error) {
+	r := tl.NewReader(b)
+	if c := r.Uint32(); c != tlOverlayNodes {
+		return nil, fmt.Errorf("dht: unexpected constructor %08x for overlay nodes", c)
+	}
+	cnt := r.Uint32()
+	if cnt > MaxOverlayNodes {
+		return nil, errors.New("dht: too many overlay nodes")
+	}
+	out := make([]*OverlayNode, 0, cnt)
+	for i := uint32(0); i < cnt; i++ {
+		pub, err := readPublicKey(r)
+		if err != nil {
+			return nil, err
+		}
+		n := &OverlayNode{PubKey: pub, Overlay: r.Int256(), Version: r.Int32()}
+		n.Signature = append([]byte(nil), r.Bytes()...)
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+		out = append(out, n)
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("dht: trailing bytes after overlay nodes")
+	}
+	return out, nil
+}
+
+// mergeOverlayNodes unions the member lists of two verified records of the
+// same overlay. For each member the latest version wins; when the list is
+// full the oldest announcements are dropped.
+func mergeOverlayNodes(old, rec *Record) *Record {
+	a, _ := unmarshalOverlayNodes(old.Value)
+	b, _ := unmarshalOverlayNodes(rec.Value)
+	byID := make(map[[32]byte]*OverlayNode, len(a)+len(b))
+	for _, n := range append(a, b...) {
+		id := n.ID()
+		if cur, ok := byID[id]; !ok || n.Version > cur.Version {
+			byID[id] = n
+		}
+	}
+	nodes := make([]*OverlayNode, 0, len(byID))
+	for _, n := range byID {
+		nodes = append(nodes, n)
+	}
+	slices.SortFunc(nodes, func(x, y *OverlayNode) int {
+		if c := cmp.Compare(y.Version, x.Version); c != 0 {
+			return c
+		}
+		ix, iy := x.ID(), y.ID()
+		return slices.Compare(ix[:], iy[:])
+	})
+	if len(nodes) > MaxOverlayNodes {
+		nodes = nodes[:MaxOverlayNodes]
+	}
+	out := *rec
+	out.TTL = max(old.TTL, rec.TTL)
+	out.Value = marshalOverlayNodes(nodes)
+	return &out
+}
@@ -0,0 +1,426 @@
+package dht
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+const (
+	// MaxValueSize bounds the value carried by a record.
+	MaxValueSize = 4096
+	// MaxRecordTTL bounds how far in the future a record may expire.
+	MaxRecordTTL = 24 * time.Hour
+	// OverlayNodesName is the record name of overlay member lists.
+	OverlayNodesName = "nodes"
+)
+
+var (
+	// ErrBadSignature is returned for records whose signatures do not verify.
+	ErrBadSignature = errors.New("dht: bad record signature")
+	// ErrExpired is returned for records past their TTL.
+	ErrExpired = errors.New("dht: record expired")
+	// ErrKeyMismatch is returned when a record is presented under a key
+	// other than its own.
+	ErrKeyMismatch = errors.New("dht: record does not match key")
+)
+
+// UpdateRule decides who may write a key and how a stored record is replaced.
+type UpdateRule int
+
+const (
+	// RuleSignature records are signed by the key owner; a record replaces
+	// the stored one only if it expires later, and always replaces a
+	// RuleAnybody record under the same key.
+	RuleSignature UpdateRule = iota
+	// RuleAnybody records carry the owner's signature of the key description
+	// only; anyone may replace the stored record with one that expires no
+	// earlier.
+	RuleAnybody
+	// RuleOverlayNodes records hold overlay member lists under a key owned by
+	// an overlay name. Each member entry is signed by the member, and updates
+	// are merged into the stored list instead of replacing it.
+	RuleOverlayNodes
+)
+
+func (u UpdateRule) String() string {
+	switch u {
+	case RuleSignature:
+		return "signature"
+	case RuleAnybody:
+		return "anybody"
+	case RuleOverlayNodes:
+		return "overlay-nodes"
+	}
+	return fmt.Sprintf("UpdateRule(%d)", int(u))
+}
+
+// Record is a DHT value (dht.value): a key description naming the key, its
+// owner and update rule, the value, an expiry time and a signature. Under
+// RuleSignature the owner signs both the key description and the record;
+// under RuleAnybody only the key description.
+type Record struct {
+	Key  RecordKey
+	Rule UpdateRule
+	// Owner is the ed25519 key the record key belongs to. Records under
+	// RuleOverlayNodes are owned by an overlay name instead, see Overlay.
+	Owner ed25519.PublicKey
+	// Overlay is the overlay name (pub.overlay) owning a RuleOverlayNodes key.
+	Overlay      []byte
+	KeySignature []byte
+	Value        []byte
+	TTL          int32 // unix time at which the record expires
+	Signature    []byte
+}
+
+// NewRecord returns a record under KeyFor(id.Public, name, idx) signed by id
+// and valid for ttl.
+func NewRecord(id keyring.Identity, name string, idx int32, value []byte, ttl time.Duration) *Record {
+	r := &Record{
+		Key:   KeyFor(id.Public, name, idx),
+		Owner: id.Public,
+		Value: value,
+		TTL:   int32(time.Now().Add(ttl).Unix()),
+	}
+	r.Sign(id.Private)
+	return r
+}
+
+// NewAnybodyRecord returns a record under KeyFor(id.Public, name, idx) that
+// any node may overwrite. id signs the key description only.
+func NewAnybodyRecord(id keyring.Identity, name string, idx int32, value []byte, ttl time.Duration) *Record {
+	r := &Record{
+		Key:   KeyFor(id.Public, name, idx),
+		Rule:  RuleAnybody,
+		Owner: id.Public,
+		Value: value,
+		TTL:   int32(time.Now().Add(ttl).Unix()),
+	}
+	r.KeySignature = ed25519.Sign(id.Private, r.keyDescriptionPayload())
+	return r
+}
+
+// NewOverlayNodesRecord returns the member list record of the overlay with
+// the given name.
+func NewOverlayNodesRecord(overlay []byte, nodes []*OverlayNode, ttl time.Duration) *Record {
+	return &Record{
+		Key:     RecordKey{ID: OverlayID(overlay), Name: OverlayNodesName},
+		Rule:    RuleOverlayNodes,
+		Overlay: append([]byte(nil), overlay...),
+		Value:   marshalOverlayNodes(nodes),
+		TTL:     int32(time.Now().Add(ttl).Unix()),
+	}
+}
+
+// renew returns a copy of an own record valid for ttl from now, signed again
+// by id, or nil when id cannot renew it. For overlay member lists only id's
+// own member entry is renewed; the other members announce themselves.
+func renew(id keyring.Identity, rec *Record, ttl time.Duration) *Record {
+	switch rec.Rule {
+	case RuleSignature:
+		if !bytes.Equal(rec.Owner, id.Public) {
+			return nil
+		}
+		return NewRecord(id, rec.Key.Name, rec.Key.Idx, rec.Value, ttl)
+	case RuleAnybody:
+		// The owner's key signature does not cover the TTL and carries over.
+		c := *rec
+		c.TTL = int32(time.Now().Add(ttl).Unix())
+		return &c
+	case RuleOverlayNodes:
+		member := NewOverlayNode(id.Private, rec.Key.ID, int32(time.Now().Unix()))
+		return NewOverlayNodesRecord(rec.Overlay, []*OverlayNode{member}, ttl)
+	}
+	return nil
+}
+
+// Sign signs the key description and then the record with priv.
+func (r *Record) Sign(priv ed25519.PrivateKey) {
+	r.KeySignature = ed25519.Sign(priv, r.keyDescriptionPayload())
+	r.Signature = ed25519.Sign(priv, r.valuePayload())
+}
+
+// Expires returns the expiry time.
+func (r *Record) Expires() time.Time { return time.Unix(int64(r.TTL), 0) }
+
+// ownerID returns the 256-bit ID of the key owner.
+func (r *Record) ownerID() [32]byte {
+	if r.Rule == RuleOverlayNodes {
+		return OverlayID(r.Overlay)
+	}
+	return adnl.KeyID(r.Owner)
+}
+
+// Verify checks that the record is well formed, owned by the key it names,
+// satisfies its update rule and has not expired at now.
+func (r *Record) Verify(now time.Time) error {
+	switch r.Rule {
+	case RuleSignature, RuleAnybody:
+		if len(r.Owner) != ed25519.PublicKeySize {
+			return errors.New("dht: record has no valid owner key")
+		}
+	case RuleOverlayNodes:
+		if len(r.Overlay) == 0 {
+			return errors.New("dht: overlay record has no overlay name")
+		}
+	default:
+		return fmt.Errorf("dht: unknown update rule %v", r.Rule)
+	}
+	if r.ownerID() != r.Key.ID {
+		return errors.New("dht: record key id does not match owner")
+	}
+	if len(r.Value) > MaxValueSize {
+		return fmt.Errorf("dht: record value exceeds %d bytes", MaxValueSize)
+	}
+	if exp := r.Expires(); !exp.After(now) {
+		return ErrExpired
+	} else if exp.Sub(now) > MaxRecordTTL {
+		return errors.New("dht: record ttl is too far in the future")
+	}
+	switch r.Rule {
+	case RuleSignature:
+		if !ed25519.Verify(r.Owner, r.keyDescriptionPayload(), r.KeySignature) ||
+			!ed25519.Verify(r.Owner, r.valuePayload(), r.Signature) {
+			return ErrBadSignature
+		}
+	case RuleAnybody:
+		if len(r.Signature) != 0 {
+			return errors.New("dht: anybody record value must not be signed")
+		}
+		if !ed25519.Verify(r.Owner, r.keyDescriptionPayload(), r.KeySignature) {
+			return ErrBadSignature
+		}
+	case RuleOverlayNodes:
+		if len(r.KeySignature) != 0 || len(r.Signature) != 0 {
+			return errors.New("dht: overlay record must not be signed")
+		}
+		if r.Key.Name != OverlayNodesName || r.Key.Idx != 0 {
+			return errors.New("dht: overlay record has an invalid key")
+		}
+		nodes, err := unmarshalOverlayNodes(r.Value)
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			if n.Overlay != r.Key.ID {
+				return errors.New("dht: overlay node belongs to another overlay")
+			}
+			if err := n.Verify(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// VerifyKey verifies the record and checks that it is stored under key.
+func (r *Record) VerifyKey(key [32]byte, now time.Time) error {
+	if r.Key.Hash() != key {
+		return ErrKeyMismatch
+	}
+	return r.Verify(now)
+}
+
+// Nodes decodes the member list of a RuleOverlayNodes record.
+func (r *Record) Nodes() ([]*OverlayNode, error) {
+	if r.Rule != RuleOverlayNodes {
+		return nil, errors.New("dht: not an overlay nodes record")
+	}
+	return unmarshalOverlayNodes(r.Value)
+}
+
+// merge applies the update rule of a stored record old to an incoming,
+// verified record rec and returns the record to keep. A record signed by the
+// owner always replaces a RuleAnybody record of the same owner; otherwise a
+// record under a different rule or owner never replaces a live one.
+func merge(old, rec *Record, now time.Time) *Record {
+	if old == nil || !old.Expires().After(now) {
+		return rec
+	}
+	if old.Rule == RuleAnybody && rec.Rule == RuleSignature && bytes.Equal(old.Owner, rec.Owner) {
+		return rec
+	}
+	if old.Rule != rec.Rule || !bytes.Equal(old.Owner, rec.Owner) || !bytes.Equal(old.Overlay, rec.Overlay) {
+		return old
+	}
+	switch rec.Rule {
+	case RuleAnybody:
+		if rec.TTL >= old.TTL {
+			return rec
+		}
+	case RuleOverlayNodes:
+		return mergeOverlayNodes(old, rec)
+	default:
+		if rec.TTL > old.TTL {
+			return rec
+		}
+	}
+	return old
+}
+
+// keyDescriptionPayload is the boxed dht.keyDescription with an empty signature.
+func (r *Record) keyDescriptionPayload() []byte {
+	var w tl.Writer
+	w.WriteUint32(tlKeyDescription)
+	r.writeKeyDescription(&w, nil)
+	return w.Bytes()
+}
+
+// valuePayload is the boxed dht.value with an empty value signature.
+func (r *Record) valuePayload() []byte {
+	c := *r
+	c.Signature = nil
+	return c.MarshalTL()
+}
+
+func (r *Record) writeKeyDescription(w *tl.Writer, sig []byte) {
+	r.Key.writeBare(w)
+	if r.Rule == RuleOverlayNodes {
+		w.WriteUint32(tlPubOverlay)
+		w.WriteBytes(r.Overlay)
+	} else {
+		w.WriteUint32(tlPubEd25519)
+		w.WriteRaw(r.Owner)
+	}
+	switch r.Rule {
+	case RuleAnybody:
+		w.WriteUint32(tlUpdateRuleAnybody)
+	case RuleOverlayNodes:
+		w.WriteUint32(tlUpdateRuleOverlayNodes)
+	default:
+		w.WriteUint32(tlUpdateRuleSignature)
+	}
+	w.WriteBytes(sig)
+}
+
+// write appends the bare dht.value form.
+func (r *Record) write(w *tl.Writer) {
+	r.writeKeyDescription(w, r.KeySignature)
+	w.WriteBytes(r.Value)
+	w.WriteInt32(r.TTL)
+	w.WriteBytes(r.Signature)
+}
+
+// MarshalTL returns the boxed dht.value form.
+func (r *Record) MarshalTL() []byte {
+	var w tl.Writer
+	w.WriteUint32(tlValue)
+	r.write(&w)
+	return w.Bytes()
+}
+
+// UnmarshalRecord decodes a boxed dht.value. The record is not verified.
+func UnmarshalRecord(b []byte) (*Record, error) {
+	r := tl.NewReader(b)
+	if c := r.Uint32(); c != tlValue {
+		return nil, fmt.Errorf("dht: unexpected constructor %08x for value", c)
+	}
+	rec, err := readRecord(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("dht: trailing bytes after value")
+	}
+	return rec, nil
+}
+
+func readRecord(r *tl.Reader) (*Record, error) {
+	rec := &Record{}
+	var err error
+	if rec.Key, err = readRecordKey(r); err != nil {
+		return nil, err
+	}
+	var overlay bool
+	switch c := r.Uint32(); c {
+	case tlPubEd25519:
+		rec.Owner = ed25519.PublicKey(append([]byte(nil), r.Raw(ed25519.PublicKeySize)...))
+	case tlPubOverlay:
+		rec.Overlay = append([]byte(nil), r.Bytes()...)
+		overlay = true
+	default:
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+		return nil, fmt.Errorf("dht: unsupported public key type %08x", c)
+	}
+	switch c := r.Uint32(); c {
+	case tlUpdateRuleSignature:
+		rec.Rule = RuleSignature
+	case tlUpdateRuleAnybody:
+		rec.Rule = RuleAnybody
+	case tlUpdateRuleOverlayNodes:
+		rec.Rule = RuleOverlayNodes
+	default:
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+		return nil, fmt.Errorf("dht: unsupported update rule %08x", c)
+	}
+	if overlay != (rec.Rule == RuleOverlayNodes) {
+		return nil, errors.New("dht: update rule does not match key owner type")
+	}
+	rec.KeySignature = r.Bytes()
+	rec.Value = r.Bytes()
+	rec.TTL = r.Int32()
+	rec.Signature = r.Bytes()
+	return rec, r.Err()
+}
+
+// ValidateValue decodes a boxed record and checks that it is valid and stored
+// under key. Storage backends other than Kademlia use it to reject forged
+// values.
+func ValidateValue(key, value []byte) (*Record, error) {
+	if len(key) != 32 {
+		return nil, errors.New("dht: key must be a 32-byte record key hash")
+	}
+	rec, err := UnmarshalRecord(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := rec.VerifyKey([32]byte(key), time.Now()); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// MergeValue validates value for key and applies the update rules against
+// the currently stored value old (nil when none). It returns the value to
+// store.
+func MergeValue(key, old, value []byte) ([]byte, error) {
+	rec, err := ValidateValue(key, value)
+	if err != nil {
+		return nil, err
+	}
+	if old == nil {
+		return value, nil
+	}
+	prev, err := ValidateValue(key, old)
+	if err != nil {
+		return value, nil
+	}
+	switch kept := merge(prev, rec, time.Now()); kept {
+	case prev:
+		return old, nil
+	case rec:
+		return value, nil
+	default:
+		return kept.MarshalTL(), nil
+	}
+}
+
+// OverlayID returns the 256-bit ID of the overlay with the given name: the
+// hash of its pub.overlay key.
+func OverlayID(name []byte) [32]byte {
+	var w tl.Writer
+	w.WriteUint32(tlPubOverlay)
+	w.WriteBytes(name)
+	return sha256.Sum256(w.Bytes())
+}
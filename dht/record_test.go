@@ -0,0 +1,206 @@
+package dht
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+)
+
+func testIdentity(seed byte) keyring.Identity {
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+	return keyring.Identity{Private: priv, Public: priv.Public().(ed25519.PublicKey)}
+}
+
+// squat returns an anybody record under the owner's key that the owner never
+// signed, as a node without the owner's private key would build it.
+func squat(owner ed25519.PublicKey, name string, value []byte, ttl time.Duration) *Record {
+	return &Record{
+		Key:   KeyFor(owner, name, 0),
+		Rule:  RuleAnybody,
+		Owner: owner,
+		Value: value,
+		TTL:   int32(time.Now().Add(ttl).Unix()),
+	}
+}
+
+// errAny stands for any verification error in test tables.
+var errAny = errors.New("any error")
+
+func TestRecordVerify(t *testing.T) {
+	owner, other := testIdentity(1), testIdentity(2)
+	overlay := []byte("overlay")
+	member := NewOverlayNode(other.Private, OverlayID(overlay), 1)
+	tests := []struct {
+		name string
+		rec  func() *Record
+		want error // nil for valid records; errAny for any error
+	}{
+		{"signed", func() *Record { return NewRecord(owner, "name", 0, []byte("v"), time.Hour) }, nil},
+		{"anybody", func() *Record { return NewAnybodyRecord(owner, "name", 0, []byte("v"), time.Hour) }, nil},
+		{"overlay nodes", func() *Record { return NewOverlayNodesRecord(overlay, []*OverlayNode{member}, time.Hour) }, nil},
+		{"anybody without key signature", func() *Record { return squat(owner.Public, "name", []byte("v"), time.Hour) }, ErrBadSignature},
+		{"anybody key signed by another key", func() *Record {
+			r := squat(owner.Public, "name", []byte("v"), time.Hour)
+			r.KeySignature = ed25519.Sign(other.Private, r.keyDescriptionPayload())
+			return r
+		}, ErrBadSignature},
+		{"anybody with value signature", func() *Record {
+			r := NewAnybodyRecord(owner, "name", 0, []byte("v"), time.Hour)
+			r.Signature = ed25519.Sign(owner.Private, r.valuePayload())
+			return r
+		}, errAny},
+		{"signed value tampered", func() *Record {
+			r := NewRecord(owner, "name", 0, []byte("v"), time.Hour)
+			r.Value = []byte("w")
+			return r
+		}, ErrBadSignature},
+		{"signed by another key", func() *Record {
+			r := NewRecord(owner, "name", 0, []byte("v"), time.Hour)
+			r.Sign(other.Private)
+			return r
+		}, ErrBadSignature},
+		{"owner does not match key", func() *Record {
+			r := NewRecord(owner, "name", 0, []byte("v"), time.Hour)
+			r.Owner = other.Public
+			r.Sign(other.Private)
+			return r
+		}, errAny},
+		{"expired", func() *Record { return NewRecord(owner, "name", 0, []byte("v"), -time.Minute) }, ErrExpired},
+		{"ttl too far", func() *Record { return NewRecord(owner, "name", 0, []byte("v"), 2*MaxRecordTTL) }, errAny},
+		{"value too large", func() *Record { return NewRecord(owner, "name", 0, make([]byte, MaxValueSize+1), time.Hour) }, errAny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := tt.rec()
+			// Verify the decoded form, as received from the network.
+			dec, err := UnmarshalRecord(rec.MarshalTL())
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = dec.Verify(time.Now())
+			switch {
+			case tt.want == nil && err != nil:
+				t.Fatalf("Verify = %v, want nil", err)
+			case tt.want == errAny && err == nil:
+				t.Fatal("Verify accepted a bad record")
+			case tt.want != nil && tt.want != errAny && !errors.Is(err, tt.want):
+				t.Fatalf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordMerge(t *testing.T) {
+	owner, a, b := testIdentity(1), testIdentity(2), testIdentity(3)
+	overlay := []byte("overlay")
+	memberA := NewOverlayNode(a.Private, OverlayID(overlay), 1)
+	memberB := NewOverlayNode(b.Private, OverlayID(overlay), 1)
+	signed := func(value string, ttl time.Duration) *Record {
+		return NewRecord(owner, "name", 0, []byte(value), ttl)
+	}
+	anybody := func(value string, ttl time.Duration) *Record {
+		return NewAnybodyRecord(owner, "name", 0, []byte(value), ttl)
+	}
+	tests := []struct {
+		name      string
+		old, rec  *Record
+		wantValue string // value of the kept record; empty for merged lists
+		wantNodes int
+	}{
+		{"no stored record", nil, signed("new", time.Hour), "new", 0},
+		{"signed, later ttl", signed("old", time.Hour), signed("new", 2*time.Hour), "new", 0},
+		{"signed, earlier ttl", signed("old", 2*time.Hour), signed("new", time.Hour), "old", 0},
+		{"anybody, later ttl", anybody("old", time.Hour), anybody("new", 2*time.Hour), "new", 0},
+		{"anybody, earlier ttl", anybody("old", 2*time.Hour), anybody("new", time.Hour), "old", 0},
+		{"signed replaces anybody", anybody("old", 2*time.Hour), signed("new", time.Hour), "new", 0},
+		{"anybody never replaces signed", signed("old", time.Hour), anybody("new", 2*time.Hour), "old", 0},
+		{"expired stored record", signed("old", -time.Minute), anybody("new", time.Hour), "new", 0},
+		{"overlay lists merge",
+			NewOverlayNodesRecord(overlay, []*OverlayNode{memberA}, time.Hour),
+			NewOverlayNodesRecord(overlay, []*OverlayNode{memberB}, time.Hour), "", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept := merge(tt.old, tt.rec, time.Now())
+			if tt.wantNodes > 0 {
+				nodes, err := kept.Nodes()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(nodes) != tt.wantNodes {
+					t.Fatalf("merged list has %d members, want %d", len(nodes), tt.wantNodes)
+				}
+				return
+			}
+			if string(kept.Value) != tt.wantValue {
+				t.Fatalf("kept %q, want %q", kept.Value, tt.wantValue)
+			}
+		})
+	}
+}
+
+// TestRecordSquatting checks that a node without the owner's key can neither
+// store an anybody record under the owner's key nor keep one there once the
+// owner publishes a signed record.
+func TestRecordSquatting(t *testing.T) {
+	owner := testIdentity(1)
+	key := KeyFor(owner.Public, AddressName, 0).Hash()
+	ownerSigned := NewRecord(owner, AddressName, 0, []byte("owner"), time.Hour).MarshalTL()
+	ownerAnybody := NewAnybodyRecord(owner, AddressName, 0, []byte("anybody"), 2*time.Hour).MarshalTL()
+	forged := squat(owner.Public, AddressName, []byte("squatter"), 2*time.Hour).MarshalTL()
+
+	tests := []struct {
+		name    string
+		old     []byte
+		value   []byte
+		want    []byte
+		wantErr bool
+	}{
+		{"forged anybody on empty key", nil, forged, nil, true},
+		{"forged anybody over signed", ownerSigned, forged, nil, true},
+		{"forged anybody over anybody", ownerAnybody, forged, nil, true},
+		{"anybody over signed", ownerSigned, ownerAnybody, ownerSigned, false},
+		{"signed over anybody", ownerAnybody, ownerSigned, ownerSigned, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergeValue(key[:], tt.old, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("MergeValue accepted a forged record")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatal("MergeValue kept the wrong record")
+			}
+		})
+	}
+
+	// A lookup that sees both prefers the owner's signed record, whichever
+	// node answers first.
+	for _, order := range [][]string{{"anybody", "signed"}, {"signed", "anybody"}} {
+		l := &lookup{}
+		for _, which := range order {
+			v := ownerAnybody
+			if which == "signed" {
+				v = ownerSigned
+			}
+			rec, err := UnmarshalRecord(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			l.addResult(&Node{}, rec)
+		}
+		if l.result.Record.Rule != RuleSignature {
+			t.Fatalf("lookup seeing %v keeps the %v record", order, l.result.Record.Rule)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package dht
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxNodeFailures is the number of consecutive failed queries after which a
+// node is evicted from its bucket.
+const maxNodeFailures = 3
+
+// routingTable is a Kademlia routing table: bucket i holds up to k nodes whose
+// IDs share exactly i leading bits with self. Each bucket also keeps up to k
+// replacement candidates that take over when an active node is evicted.
+type routingTable struct {
+	self [32]byte
+	k    int
+
+	mu      sync.Mutex
+	buckets [256]bucket
+}
+
+type bucket struct {
+	active []*routeEntry // least recently seen first
+	backup []*routeEntry // oldest first
+}
+
+type routeEntry struct {
+	id       [32]byte
+	node     *Node
+	lastSeen time.Time
+	fails    int
+}
+
+func newRoutingTable(self [32]byte, k int) *routingTable {
+	return &routingTable{self: self, k: k}
+}
+
+// add records a node. seen marks a node that just answered us or announced
+// itself; such nodes move to the tail of their bucket, while merely heard-of
+// nodes only fill free slots or the replacement cache.
+func (t *routingTable) add(n *Node, seen bool) {
+	id := n.ID()
+	cpl := commonPrefixLen(t.self, id)
+	if cpl == 256 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.buckets[cpl]
+	now := time.Now()
+
+	if i := indexOf(b.active, id); i >= 0 {
+		e := b.active[i]
+		if n.Version >= e.node.Version {
+			e.node = n
+		}
+		if seen {
+			e.lastSeen, e.fails = now, 0
+			b.active = append(slices.Delete(b.active, i, i+1), e)
+		}
+		return
+	}
+	if i := indexOf(b.backup, id); i >= 0 {
+		e := b.backup[i]
+		if n.Version >= e.node.Version {
+			e.node = n
+		}
+		if !seen {
+			return
+		}
+		e.lastSeen = now
+		b.backup = slices.Delete(b.backup, i, i+1)
+		if len(b.active) < t.k {
+			b.active = append(b.active, e)
+		} else {
+			b.backup = append(b.backup, e)
+		}
+		return
+	}
+	e := &routeEntry{id: id, node: n}
+	if seen {
+		e.lastSeen = now
+	}
+	if len(b.active) < t.k {
+		b.active = append(b.active, e)
+		return
+	}
+	if len(b.backup) >= t.k {
+		b.backup = b.backup[1:]
+	}
+	b.backup = append(b.backup, e)
+}
+
+// fail records a failed query to the node and evicts it after repeated
+// failures, promoting the most recently seen replacement.
+func (t *routingTable) fail(id [32]byte) {
+	cpl := commonPrefixLen(t.self, id)
+	if cpl == 256 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.buckets[cpl]
+	i := indexOf(b.active, id)
+	if i < 0 {
+		if j := indexOf(b.backup, id); j >= 0 {
+			b.backup = slices.Delete(b.backup, j, j+1)
+		}
+		return
+	}
+	e := b.active[i]
+	if e.fails++; e.fails < maxNodeFailures {
+		return
+	}
+	b.active = slices.Delete(b.active, i, i+1)
+	if n := len(b.backup); n > 0 {
+		b.active = append(b.active, b.backup[n-1])
+		b.backup = b.backup[:n-1]
+	}
+}
+
+// get returns the active node with the given ID.
+func (t *routingTable) get(id [32]byte) *Node {
+	cpl := commonPrefixLen(t.self, id)
+	if cpl == 256 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if i := indexOf(t.buckets[cpl].active, id); i >= 0 {
+		return t.buckets[cpl].active[i].node
+	}
+	return nil
+}
+
+// closest returns up to n active nodes ordered by distance to target.
+func (t *routingTable) closest(target [32]byte, n int) []*Node {
+	t.mu.Lock()
+	all := make([]*Node, 0, t.k*4)
+	for i := range t.buckets {
+		for _, e := range t.buckets[i].active {
+			all = append(all, e.node)
+		}
+	}
+	t.mu.Unlock()
+	sortByDistance(target, all)
+	if len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+// nodes returns every active node.
+func (t *routingTable) nodes() []*Node {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []*Node
+	for i := range t.buckets {
+		for _, e := range t.buckets[i].active {
+			out = append(out, e.node)
+		}
+	}
+	return out
+}
+
+// fill returns the number of active nodes per bucket.
+func (t *routingTable) fill() [256]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out [256]int
+	for i := range t.buckets {
+		out[i] = len(t.buckets[i].active)
+	}
+	return out
+}
+
+func indexOf(entries []*routeEntry, id [32]byte) int {
+	return slices.IndexFunc(entries, func(e *routeEntry) bool { return e.id == id })
+}
+
+func sortByDistance(target [32]byte, nodes []*Node) {
+	slices.SortFunc(nodes, func(a, b *Node) int {
+		ia, ib := a.ID(), b.ID()
+		switch {
+		case closer(target, ia, ib):
+			return -1
+		case closer(target, ib, ia):
+			return 1
+		}
+		return 0
+	})
+}
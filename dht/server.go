@@ -0,0 +1,115 @@
+package dht
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+	"github.com/grishinium-blockchain/grishinium-go/internal/metrics"
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+// queryConstructors are the queries a serving node registers with the RPC.
+var queryConstructors = []uint32{tlQuery, tlPing, tlFindNode, tlFindValue, tlStore, tlGetSignedAddressList}
+
+// serve answers DHT queries. A dht.query prefix announces the sender, which
+// is added to the routing table when its descriptor checks out.
+func (k *Kademlia) serve(ctx context.Context, from adnl.Address, q []byte) ([]byte, error) {
+	k.queries.Add(1)
+	r := tl.NewReader(q)
+	cons := r.Uint32()
+	if cons == tlQuery {
+		n, err := readNode(r)
+		if err != nil {
+			return nil, err
+		}
+		if n.Verify() == nil && bytes.Equal(n.PubKey, from.PubKey) {
+			k.rt.add(n, true)
+		}
+		cons = r.Uint32()
+	}
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+
+	metrics.DHTServed(queryName(cons))
+
+	var w tl.Writer
+	switch cons {
+	case tlPing:
+		nonce := r.Uint64()
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+		w.WriteUint32(tlPong)
+		w.WriteUint64(nonce)
+	case tlFindNode:
+		key, n := r.Int256(), r.Int32()
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+		w.WriteUint32(tlNodes)
+		writeNodes(&w, k.rt.closest(key, answerSize(n)))
+	case tlFindValue:
+		key, n := r.Int256(), r.Int32()
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+		if rec := k.values.get(key, time.Now()); rec != nil {
+			w.WriteUint32(tlValueFound)
+			w.WriteUint32(tlValue)
+			rec.write(&w)
+		} else {
+			w.WriteUint32(tlValueNotFound)
+			writeNodes(&w, k.rt.closest(key, answerSize(n)))
+		}
+	case tlStore:
+		rec, err := readRecord(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := rec.Verify(time.Now()); err != nil {
+			return nil, err
+		}
+		if err := k.values.put(ctx, rec.Key.Hash(), rec); err != nil {
+			log.Debug("dht store rejected", "from", net.JoinHostPort(from.Host, strconv.Itoa(from.Port)), "err", err)
+			return nil, err
+		}
+		w.WriteUint32(tlStored)
+	case tlGetSignedAddressList:
+		w.WriteUint32(tlNode)
+		k.self.write(&w)
+	default:
+		return nil, fmt.Errorf("dht: unknown query %08x", cons)
+	}
+	return w.Bytes(), nil
+}
+
+// queryName names a query constructor in metrics.
+func queryName(cons uint32) string {
+	switch cons {
+	case tlPing:
+		return "ping"
+	case tlFindNode:
+		return "find_node"
+	case tlFindValue:
+		return "find_value"
+	case tlStore:
+		return "store"
+	case tlGetSignedAddressList:
+		return "get_signed_address_list"
+	default:
+		return "unknown"
+	}
+}
+
+func answerSize(n int32) int {
+	if n <= 0 || n > maxNodesPerAnswer {
+		return maxNodesPerAnswer
+	}
+	return int(n)
+}
@@ -0,0 +1,167 @@
+package dht
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/internal/storage"
+)
+
+// maxStoredValues bounds the records a node keeps for others.
+const maxStoredValues = 1 << 16
+
+var errStoreFull = errors.New("dht: value store is full")
+
+// recordStore keeps records by key hash. When kv is set every change is
+// written through to it, so the records survive a restart.
+type recordStore struct {
+	mu      sync.Mutex
+	records map[[32]byte]*Record
+	kv      storage.KV // nil for a memory-only store
+	limit   int        // 0 means unbounded
+}
+
+func newRecordStore(kv storage.KV, limit int) *recordStore {
+	return &recordStore{records: make(map[[32]byte]*Record), kv: kv, limit: limit}
+}
+
+// load reads the persisted records. Entries that do not decode, or do not
+// verify at now, are deleted; with keepExpired set, records that are only
+// expired are kept.
+func (s *recordStore) load(ctx context.Context, now time.Time, keepExpired bool) error {
+	if s.kv == nil {
+		return nil
+	}
+	it, err := s.kv.NewIterator(ctx, storage.IterOptions{})
+	if err != nil {
+		return err
+	}
+	var stale [][]byte
+	s.mu.Lock()
+	for it.Next() {
+		rec, err := UnmarshalRecord(it.Value())
+		if err == nil && len(it.Key()) == 32 {
+			err = rec.VerifyKey([32]byte(it.Key()), now)
+			if errors.Is(err, ErrExpired) && keepExpired {
+				err = nil
+			}
+		}
+		if err != nil {
+			stale = append(stale, append([]byte(nil), it.Key()...))
+			continue
+		}
+		s.records[[32]byte(it.Key())] = rec
+	}
+	s.mu.Unlock()
+	if err := it.Err(); err != nil {
+		it.Close()
+		return err
+	}
+	if err := it.Close(); err != nil {
+		return err
+	}
+	for _, key := range stale {
+		if err := s.kv.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// get returns the record under key unless it has expired.
+func (s *recordStore) get(key [32]byte, now time.Time) *Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[key]
+	if !ok {
+		return nil
+	}
+	if !rec.Expires().After(now) {
+		s.removeLocked(context.Background(), key)
+		return nil
+	}
+	return rec
+}
+
+// put stores a verified record, applying the update rule of the record
+// already held under key.
+func (s *recordStore) put(ctx context.Context, key [32]byte, rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.records[key]
+	if !ok && s.limit > 0 && len(s.records) >= s.limit {
+		return errStoreFull
+	}
+	kept := merge(old, rec, time.Now())
+	if ok && kept == old {
+		return nil
+	}
+	return s.setLocked(ctx, key, kept)
+}
+
+// set stores rec under key, replacing whatever is held there.
+func (s *recordStore) set(ctx context.Context, key [32]byte, rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.setLocked(ctx, key, rec)
+}
+
+func (s *recordStore) setLocked(ctx context.Context, key [32]byte, rec *Record) error {
+	if s.kv != nil {
+		if err := s.kv.Put(ctx, key[:], rec.MarshalTL()); err != nil {
+			return err
+		}
+	}
+	s.records[key] = rec
+	return nil
+}
+
+// remove forgets the record under key.
+func (s *recordStore) remove(ctx context.Context, key [32]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(ctx, key)
+}
+
+func (s *recordStore) removeLocked(ctx context.Context, key [32]byte) {
+	delete(s.records, key)
+	if s.kv != nil {
+		_ = s.kv.Delete(ctx, key[:])
+	}
+}
+
+// expire drops the records that have expired at now and returns how many.
+func (s *recordStore) expire(ctx context.Context, now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key, rec := range s.records {
+		if !rec.Expires().After(now) {
+			s.removeLocked(ctx, key)
+			n++
+		}
+	}
+	return n
+}
+
+// list returns the records that expire before deadline.
+func (s *recordStore) list(deadline time.Time) []*Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*Record
+	for _, rec := range s.records {
+		if rec.Expires().Before(deadline) {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+// count returns the number of records held, expired ones included.
+func (s *recordStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.records)
+}
@@ -0,0 +1,35 @@
+package dht
+
+// TL constructors of the DHT protocol. IDs are the CRC32 of the schema line,
+// so they match other implementations of the same schema.
+const (
+	tlPubEd25519 uint32 = 0x4813b4c6 // pub.ed25519 key:int256 = PublicKey
+	tlPubOverlay uint32 = 0x34ba45cb // pub.overlay name:bytes = PublicKey
+
+	tlNode  uint32 = 0x84533248 // dht.node id:PublicKey addr_list:adnl.addressList version:int signature:bytes = dht.Node
+	tlNodes uint32 = 0x7974a0be // dht.nodes nodes:vector dht.node = dht.Nodes
+
+	tlKey            uint32 = 0xf667de8f // dht.key id:int256 name:bytes idx:int = dht.Key
+	tlKeyDescription uint32 = 0x281d4e05 // dht.keyDescription key:dht.key id:PublicKey update_rule:dht.UpdateRule signature:bytes = dht.KeyDescription
+	tlValue          uint32 = 0x90ad27cb // dht.value key:dht.keyDescription value:bytes ttl:int signature:bytes = dht.Value
+
+	tlUpdateRuleSignature    uint32 = 0xcc9f31f7 // dht.updateRule.signature = dht.UpdateRule
+	tlUpdateRuleAnybody      uint32 = 0x61578e14 // dht.updateRule.anybody = dht.UpdateRule
+	tlUpdateRuleOverlayNodes uint32 = 0x26779383 // dht.updateRule.overlayNodes = dht.UpdateRule
+
+	tlOverlayNode       uint32 = 0xb86b8a83 // overlay.node id:PublicKey overlay:int256 version:int signature:bytes = overlay.Node
+	tlOverlayNodes      uint32 = 0xe487290e // overlay.nodes nodes:vector overlay.node = overlay.Nodes
+	tlOverlayNodeToSign uint32 = 0x03d8a8e1 // overlay.node.toSign id:adnl.id.short overlay:int256 version:int = overlay.node.ToSign
+
+	tlPong          uint32 = 0x5a8aef81 // dht.pong random_id:long = dht.Pong
+	tlValueFound    uint32 = 0xe40cf774 // dht.valueFound value:dht.Value = dht.ValueResult
+	tlValueNotFound uint32 = 0xa2620568 // dht.valueNotFound nodes:dht.nodes = dht.ValueResult
+	tlStored        uint32 = 0x7026fb08 // dht.stored = dht.Stored
+
+	tlPing                 uint32 = 0xcbeb3f18 // dht.ping random_id:long = dht.Pong
+	tlStore                uint32 = 0x34934212 // dht.store value:dht.value = dht.Stored
+	tlFindNode             uint32 = 0x6ce2ce6b // dht.findNode key:int256 k:int = dht.Nodes
+	tlFindValue            uint32 = 0xae4b6011 // dht.findValue key:int256 k:int = dht.ValueResult
+	tlGetSignedAddressList uint32 = 0xa97948ed // dht.getSignedAddressList = dht.Node
+	tlQuery                uint32 = 0x7d530769 // dht.query node:dht.node = True (prefix announcing the sender)
+)
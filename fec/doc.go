@@ -1,3 +1,7 @@
-package fec
-
 // Package fec provides forward error correction primitives.
+//
+// The code is a systematic Reed-Solomon code over GF(2^8) with Cauchy repair
+// symbols, sent as fec.reedSolomon (0x067f213e). It is not raptorQ
+// (fec.raptorQ), which the reference nodes use: objects encoded here are only
+// decoded by nodes of this implementation, and raptorQ objects not at all.
+package fec
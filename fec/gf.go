@@ -0,0 +1,56 @@
+package fec
+
+// Arithmetic in GF(2^8) with the polynomial x^8+x^4+x^3+x^2+1 (0x11d).
+
+var (
+	gfExp [510]byte
+	gfLog [256]byte
+	// gfMul[a][b] is a*b; rows are used as lookup tables in mulAdd.
+	gfMul [256][256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfExp[i+255] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			gfMul[a][b] = gfExp[int(gfLog[a])+int(gfLog[b])]
+		}
+	}
+}
+
+// gfInv returns the multiplicative inverse of a, which must not be zero.
+func gfInv(a byte) byte { return gfExp[255-int(gfLog[a])] }
+
+// mulAdd sets dst[i] ^= f*src[i].
+func mulAdd(dst, src []byte, f byte) {
+	switch f {
+	case 0:
+		return
+	case 1:
+		for i, b := range src {
+			dst[i] ^= b
+		}
+		return
+	}
+	t := &gfMul[f]
+	for i, b := range src {
+		dst[i] ^= t[b]
+	}
+}
+
+// mulSlice sets s[i] = f*s[i].
+func mulSlice(s []byte, f byte) {
+	t := &gfMul[f]
+	for i, b := range s {
+		s[i] = t[b]
+	}
+}
@@ -0,0 +1,222 @@
+package fec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxSymbols bounds the source plus repair symbols of one object; symbol IDs
+// range over [0, MaxSymbols).
+const MaxSymbols = 256
+
+var (
+	// ErrBadParams is returned for parameters that do not describe an
+	// encodable object.
+	ErrBadParams = errors.New("fec: bad parameters")
+	// ErrBadSymbol is returned for symbols with an out-of-range ID or the
+	// wrong size.
+	ErrBadSymbol = errors.New("fec: bad symbol")
+	// ErrIncomplete is returned by Decoder.Data before enough symbols arrived.
+	ErrIncomplete = errors.New("fec: not enough symbols")
+)
+
+// Params describes how an object is split into symbols. It travels with
+// every symbol, so a receiver can start decoding from any of them.
+type Params struct {
+	DataSize     int
+	SymbolSize   int
+	SymbolsCount int // source symbols; any SymbolsCount distinct symbols rebuild the object
+}
+
+// NewParams returns the parameters of an object of dataSize bytes split into
+// symbols of symbolSize bytes.
+func NewParams(dataSize, symbolSize int) (Params, error) {
+	if symbolSize <= 0 {
+		return Params{}, fmt.Errorf("%w: symbol size %d", ErrBadParams, symbolSize)
+	}
+	p := Params{DataSize: dataSize, SymbolSize: symbolSize, SymbolsCount: (dataSize + symbolSize - 1) / symbolSize}
+	return p, p.Validate()
+}
+
+// Validate checks that p describes an object that fits in MaxSymbols
+// source symbols.
+func (p Params) Validate() error {
+	switch {
+	case p.DataSize <= 0 || p.SymbolSize <= 0:
+		return fmt.Errorf("%w: empty object or symbols", ErrBadParams)
+	case p.SymbolsCount != (p.DataSize+p.SymbolSize-1)/p.SymbolSize:
+		return fmt.Errorf("%w: %d symbols for %d bytes", ErrBadParams, p.SymbolsCount, p.DataSize)
+	case p.SymbolsCount > MaxSymbols:
+		return fmt.Errorf("%w: %d source symbols, at most %d", ErrBadParams, p.SymbolsCount, MaxSymbols)
+	}
+	return nil
+}
+
+// Repair returns how many repair symbols are left for p.
+func (p Params) Repair() int { return MaxSymbols - p.SymbolsCount }
+
+// coef is the coefficient of source symbol c in symbol id. Source symbols
+// (id < k) are sent as is; repair symbols are rows of the Cauchy matrix
+// 1/(id ^ c), which keeps every k×k selection of symbols invertible.
+func coef(id, c, k int) byte {
+	if id < k {
+		if id == c {
+			return 1
+		}
+		return 0
+	}
+	return gfInv(byte(id ^ c))
+}
+
+// Encoder produces the symbols of an object with a systematic Reed-Solomon
+// code over GF(2^8): symbols 0..SymbolsCount-1 are the object itself, the
+// others are repair symbols.
+type Encoder struct {
+	p   Params
+	src [][]byte
+}
+
+// NewEncoder splits data into symbols of symbolSize bytes, padding the last
+// one with zeros.
+func NewEncoder(data []byte, symbolSize int) (*Encoder, error) {
+	p, err := NewParams(len(data), symbolSize)
+	if err != nil {
+		return nil, err
+	}
+	e := &Encoder{p: p, src: make([][]byte, p.SymbolsCount)}
+	for i := range e.src {
+		s := make([]byte, symbolSize)
+		copy(s, data[i*symbolSize:])
+		e.src[i] = s
+	}
+	return e, nil
+}
+
+// Params returns the parameters receivers need to decode.
+func (e *Encoder) Params() Params { return e.p }
+
+// Symbol returns symbol id, which must be below MaxSymbols.
+func (e *Encoder) Symbol(id int) ([]byte, error) {
+	k := e.p.SymbolsCount
+	if id < 0 || id >= MaxSymbols {
+		return nil, fmt.Errorf("%w: id %d", ErrBadSymbol, id)
+	}
+	if id < k {
+		return append([]byte(nil), e.src[id]...), nil
+	}
+	out := make([]byte, e.p.SymbolSize)
+	for c, s := range e.src {
+		mulAdd(out, s, coef(id, c, k))
+	}
+	return out, nil
+}
+
+// Decoder rebuilds an object from any SymbolsCount distinct symbols.
+type Decoder struct {
+	p    Params
+	syms map[int][]byte
+	data []byte
+}
+
+// NewDecoder returns a decoder for the object described by p.
+func NewDecoder(p Params) (*Decoder, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &Decoder{p: p, syms: make(map[int][]byte, p.SymbolsCount)}, nil
+}
+
+// Add feeds symbol id and reports whether the object can be rebuilt.
+// Duplicate symbols are ignored.
+func (d *Decoder) Add(id int, sym []byte) (bool, error) {
+	if d.data != nil {
+		return true, nil
+	}
+	if id < 0 || id >= MaxSymbols || len(sym) != d.p.SymbolSize {
+		return false, fmt.Errorf("%w: id %d, %d bytes", ErrBadSymbol, id, len(sym))
+	}
+	if _, ok := d.syms[id]; ok {
+		return false, nil
+	}
+	d.syms[id] = append([]byte(nil), sym...)
+	if len(d.syms) < d.p.SymbolsCount {
+		return false, nil
+	}
+	d.decode()
+	return true, nil
+}
+
+// Received returns the number of distinct symbols fed so far.
+func (d *Decoder) Received() int { return len(d.syms) }
+
+// Done reports whether the object has been rebuilt.
+func (d *Decoder) Done() bool { return d.data != nil }
+
+// Data returns the rebuilt object.
+func (d *Decoder) Data() ([]byte, error) {
+	if d.data == nil {
+		return nil, ErrIncomplete
+	}
+	return d.data, nil
+}
+
+// decode solves for the missing source symbols once k symbols are known.
+func (d *Decoder) decode() {
+	k, size := d.p.SymbolsCount, d.p.SymbolSize
+	var missing, repair []int
+	for c := 0; c < k; c++ {
+		if _, ok := d.syms[c]; !ok {
+			missing = append(missing, c)
+		}
+	}
+	for id := range d.syms {
+		if id >= k && len(repair) < len(missing) {
+			repair = append(repair, id)
+		}
+	}
+	// Each repair symbol, less the known source symbols, is a combination of
+	// the missing ones: a[i] · missing = b[i].
+	n := len(missing)
+	a := make([][]byte, n)
+	b := make([][]byte, n)
+	for i, id := range repair {
+		a[i] = make([]byte, n)
+		for j, c := range missing {
+			a[i][j] = coef(id, c, k)
+		}
+		b[i] = d.syms[id]
+		for c := 0; c < k; c++ {
+			if s, ok := d.syms[c]; ok {
+				mulAdd(b[i], s, coef(id, c, k))
+			}
+		}
+	}
+	// Gauss-Jordan elimination; Cauchy submatrices are never singular.
+	for col := 0; col < n; col++ {
+		p := col
+		for a[p][col] == 0 {
+			p++
+		}
+		a[col], a[p] = a[p], a[col]
+		b[col], b[p] = b[p], b[col]
+		if f := gfInv(a[col][col]); f != 1 {
+			mulSlice(a[col], f)
+			mulSlice(b[col], f)
+		}
+		for r := 0; r < n; r++ {
+			if f := a[r][col]; r != col && f != 0 {
+				mulAdd(a[r], a[col], f)
+				mulAdd(b[r], b[col], f)
+			}
+		}
+	}
+	for i, c := range missing {
+		d.syms[c] = b[i]
+	}
+	data := make([]byte, 0, k*size)
+	for c := 0; c < k; c++ {
+		data = append(data, d.syms[c]...)
+	}
+	d.data = data[:d.p.DataSize]
+	d.syms = nil
+}
@@ -0,0 +1,120 @@
+package fec
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		symbolSize int
+		lost       []int // source symbols that never arrive
+		repair     int   // first repair symbol sent in their place
+	}{
+		{"no loss", 1000, 100, nil, 0},
+		{"padded last symbol lost", 1050, 100, []int{10}, 200},
+		{"every other symbol lost", 1000, 100, []int{0, 2, 4, 6, 8}, 10},
+		{"all source symbols lost", 1000, 100, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 240},
+		{"single symbol", 10, 100, []int{0}, 1},
+		{"last repair symbol", (MaxSymbols - 1) * 4, 4, []int{100}, MaxSymbols - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, tt.size)
+			rand.New(rand.NewSource(int64(tt.size))).Read(data)
+			enc, err := NewEncoder(data, tt.symbolSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := enc.Params()
+			lost := make(map[int]bool)
+			for _, id := range tt.lost {
+				lost[id] = true
+			}
+			var ids []int
+			for id := 0; id < p.SymbolsCount; id++ {
+				if !lost[id] {
+					ids = append(ids, id)
+				}
+			}
+			for id := tt.repair; len(ids) < p.SymbolsCount; id++ {
+				ids = append(ids, id)
+			}
+
+			dec, err := NewDecoder(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, id := range ids {
+				sym, err := enc.Symbol(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				done, err := dec.Add(id, sym)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if last := i == len(ids)-1; done != last {
+					t.Fatalf("symbol %d of %d: done = %v", i+1, len(ids), done)
+				}
+				if done {
+					break
+				}
+				if _, err := dec.Add(id, sym); err != nil || dec.Received() != i+1 {
+					t.Fatalf("duplicate symbol %d: %v, %d received", id, err, dec.Received())
+				}
+			}
+			got, err := dec.Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("decoded object differs")
+			}
+		})
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	enc, err := NewEncoder(make([]byte, 1000), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := NewDecoder(enc.Params())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sym, _ := enc.Symbol(0)
+	if _, err := dec.Add(0, sym); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dec.Data(); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Data with 1 of 10 symbols = %v", err)
+	}
+	for _, tt := range []struct {
+		name string
+		id   int
+		sym  []byte
+	}{
+		{"negative id", -1, sym},
+		{"id out of range", MaxSymbols, sym},
+		{"short symbol", 1, sym[:50]},
+	} {
+		if _, err := dec.Add(tt.id, tt.sym); !errors.Is(err, ErrBadSymbol) {
+			t.Errorf("%s: Add = %v, want ErrBadSymbol", tt.name, err)
+		}
+	}
+	if _, err := enc.Symbol(MaxSymbols); !errors.Is(err, ErrBadSymbol) {
+		t.Errorf("Symbol(MaxSymbols) = %v, want ErrBadSymbol", err)
+	}
+	if _, err := NewEncoder(make([]byte, MaxSymbols+1), 1); !errors.Is(err, ErrBadParams) {
+		t.Errorf("NewEncoder with too many symbols = %v, want ErrBadParams", err)
+	}
+	if _, err := NewDecoder(Params{DataSize: 1000, SymbolSize: 100, SymbolsCount: 9}); !errors.Is(err, ErrBadParams) {
+		t.Errorf("NewDecoder with inconsistent params = %v, want ErrBadParams", err)
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"errors"
 	"net"
-	"time"
+	"strconv"
+	"sync"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
 	iv "github.com/grishinium-blockchain/grishinium-go/internal/version"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
 )
 
 // Client defines the high-level GRISHINIUM client interface.
@@ -16,45 +20,93 @@ type Client interface {
 
 	// GetVersion returns the node/library version information.
 	GetVersion(ctx context.Context) (string, error)
+
+	// Close terminates the session with the endpoint, if one is open.
+	Close(ctx context.Context) error
 }
 
 // Config holds minimal client configuration.
 type Config struct {
-	Endpoint string // e.g. host:port
-	APIKey   string // optional
+	Endpoint  string // e.g. host:port
+	ServerKey string // lite-server ed25519 public key, base64 or hex
+	APIKey    string // optional
 }
 
 // NewClient creates a new GRISHINIUM client instance.
-// Currently returns a stub implementation.
+// The client opens an ADNL-over-TCP session to the endpoint on first use.
 func NewClient(cfg Config) Client {
-	return &stubClient{cfg: cfg}
+	return &liteClient{cfg: cfg}
 }
 
-type stubClient struct {
+type liteClient struct {
 	cfg Config
+
+	mu   sync.Mutex
+	tr   *adnl.TCPTransport
+	conn adnl.Conn
 }
 
-func (c *stubClient) Ping(ctx context.Context) error {
+// session returns the open ADNL session, performing the handshake if needed.
+func (c *liteClient) session(ctx context.Context) (adnl.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		return c.conn, nil
+	}
 	if c.cfg.Endpoint == "" {
-		return errors.New("endpoint is empty")
-	}
-	d := &net.Dialer{}
-	// derive timeout from context if set, otherwise use a small default
-	timeout := 3 * time.Second
-	if deadline, ok := ctx.Deadline(); ok {
-		timeout = time.Until(deadline)
-		if timeout <= 0 {
-			timeout = 3 * time.Second
-		}
-	}
-	conn, err := d.DialContext(context.WithTimeout(ctx, timeout), "tcp", c.cfg.Endpoint)
+		return nil, errors.New("endpoint is empty")
+	}
+	if c.cfg.ServerKey == "" {
+		return nil, errors.New("server key is empty")
+	}
+	key, err := keyring.ParsePublicKey(c.cfg.ServerKey)
+	if err != nil {
+		return nil, err
+	}
+	host, portStr, err := net.SplitHostPort(c.cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+	tr := adnl.NewTCPTransport(adnl.TCPConfig{})
+	conn, err := tr.Dial(ctx, adnl.AddressFromKey(key, host, port))
+	if err != nil {
+		return nil, err
+	}
+	c.tr, c.conn = tr, conn
+	return conn, nil
+}
+
+func (c *liteClient) Ping(ctx context.Context) error {
+	conn, err := c.session(ctx)
 	if err != nil {
 		return err
 	}
-	_ = conn.Close()
+	p, ok := conn.(adnl.Pinger)
+	if !ok {
+		return errors.New("session does not support ping")
+	}
+	if _, err := p.Ping(ctx); err != nil {
+		_ = c.Close(ctx)
+		return err
+	}
 	return nil
 }
 
-func (c *stubClient) GetVersion(ctx context.Context) (string, error) {
+func (c *liteClient) GetVersion(ctx context.Context) (string, error) {
 	return "grishiniumlib " + iv.Version, nil
 }
+
+func (c *liteClient) Close(ctx context.Context) error {
+	c.mu.Lock()
+	tr := c.tr
+	c.tr, c.conn = nil, nil
+	c.mu.Unlock()
+	if tr == nil {
+		return nil
+	}
+	return tr.Close(ctx)
+}
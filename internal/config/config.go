@@ -1,15 +1,21 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"net"
 	"time"
 )
 
 // Config is a base configuration used across binaries.
 type Config struct {
-	Endpoint string        // network endpoint in form host:port
-	Timeout  time.Duration // default request timeout
-	Debug    bool          // enable debug logging
+	Endpoint     string        // network endpoint in form host:port
+	Timeout      time.Duration // default request timeout
+	Debug        bool          // enable debug logging
+	GlobalConfig string        // path to the network global config (JSON)
+	File         string        // path to the config file read by Load
+	Dump         bool          // print the effective config and exit
 }
 
 // Flags binds common flags into the provided FlagSet (or flag.CommandLine when nil).
@@ -19,5 +25,70 @@ func Flags(fs *flag.FlagSet, cfg *Config) {
 	}
 	fs.StringVar(&cfg.Endpoint, "endpoint", "", "GRISHINIUM endpoint in form host:port")
 	fs.DurationVar(&cfg.Timeout, "timeout", 10*time.Second, "default request timeout")
+	BaseFlags(fs, cfg)
+}
+
+// BaseFlags binds the flags shared by every binary, Flags without -endpoint
+// and -timeout, into the provided FlagSet (or flag.CommandLine when nil).
+// Binaries that reach the network only through the global config or their
+// own peers use it instead of Flags.
+func BaseFlags(fs *flag.FlagSet, cfg *Config) {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
 	fs.BoolVar(&cfg.Debug, "debug", false, "enable debug logging")
+	fs.StringVar(&cfg.GlobalConfig, "global-config", "", "path to the network global config (JSON)")
+	fs.StringVar(&cfg.File, configFlag, "", "path to a JSON config file; environment ("+EnvPrefix+"*) and flags override it")
+	fs.BoolVar(&cfg.Dump, dumpFlag, false, "print the effective config as JSON and exit")
+}
+
+// Validate checks the common options.
+func (c *Config) Validate() error {
+	if c.Endpoint != "" {
+		if _, _, err := net.SplitHostPort(c.Endpoint); err != nil {
+			return fmt.Errorf("config: endpoint: %w", err)
+		}
+	}
+	if c.Timeout <= 0 {
+		return errors.New("config: timeout must be positive")
+	}
+	return nil
+}
+
+// Global loads the global config named by GlobalConfig, or returns nil when
+// none was given.
+func (c *Config) Global() (*Global, error) {
+	if c.GlobalConfig == "" {
+		return nil, nil
+	}
+	return LoadGlobal(c.GlobalConfig)
+}
+
+// UseLiteServer sets Endpoint and *serverKey to the lite-server with the
+// given index in the global config, unless an endpoint was given explicitly
+// or there is no global config.
+func (c *Config) UseLiteServer(index int, serverKey *string) error {
+	if c.Endpoint != "" || c.GlobalConfig == "" {
+		return nil
+	}
+	g, err := c.Global()
+	if err != nil {
+		return err
+	}
+	ls, err := g.LiteServer(index)
+	if err != nil {
+		return err
+	}
+	c.Endpoint = ls.Addr()
+	*serverKey = ls.ID.String()
+	return nil
+}
+
+// DBFlag binds -db-path, the directory of a binary's database, into the
+// provided FlagSet (or flag.CommandLine when nil).
+func DBFlag(fs *flag.FlagSet, path *string, def string) {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	fs.StringVar(path, "db-path", def, "Directory of the state database (pebble builds; default builds keep state in memory)")
 }
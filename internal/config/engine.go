@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Engine is the configuration of validator-engine.
+type Engine struct {
+	Config
+	Listen    StringList // listen multiaddrs
+	Bootstrap StringList // bootstrap peer multiaddrs with /p2p/<peerID>
+	Identity  string     // path to the raw ed25519 private key; empty means ephemeral
+	DBPath    string     // directory of the state database
+	MDNS      bool       // LAN peer discovery
+	Log       Log
+	Overlay   Overlay
+	// ControlListen is the loopback HTTP address of the control interface,
+	// which serves and changes log levels at runtime; empty disables it.
+	ControlListen string
+	// MetricsListen is the HTTP address serving Prometheus metrics at
+	// /metrics; empty disables it.
+	MetricsListen string
+}
+
+// EngineFlags binds the common flags and validator-engine's own into the
+// provided FlagSet (or flag.CommandLine when nil).
+func EngineFlags(fs *flag.FlagSet, cfg *Engine) {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	Flags(fs, &cfg.Config)
+	fs.Var(&cfg.Listen, "listen", "Listen multiaddr (repeatable). Example: /ip4/0.0.0.0/tcp/0")
+	fs.Var(&cfg.Bootstrap, "bootstrap", "Bootstrap peer multiaddr with /p2p/<peerID> (repeatable)")
+	fs.StringVar(&cfg.Identity, "identity", "", "Path to ed25519 private key file (raw). If empty, ephemeral identity is used")
+	DBFlag(fs, &cfg.DBPath, "grishinium-db")
+	fs.BoolVar(&cfg.MDNS, "mdns", false, "Enable LAN peer discovery via mDNS (libp2p builds)")
+	fs.StringVar(&cfg.ControlListen, "control-listen", "", "Loopback HTTP address of the control interface, e.g. 127.0.0.1:5555 (empty disables it)")
+	fs.StringVar(&cfg.MetricsListen, "metrics-listen", "", "HTTP address serving Prometheus metrics at /metrics, e.g. 127.0.0.1:9100 (empty disables it)")
+	LogFlags(fs, &cfg.Log)
+	OverlayFlags(fs, &cfg.Overlay)
+}
+
+// Validate checks the engine options.
+func (c *Engine) Validate() error {
+	if err := c.Config.Validate(); err != nil {
+		return err
+	}
+	for _, a := range c.Listen {
+		if !strings.HasPrefix(a, "/") {
+			return fmt.Errorf("config: listen %q is not a multiaddr", a)
+		}
+	}
+	for _, a := range c.Bootstrap {
+		if !strings.HasPrefix(a, "/") || !strings.Contains(a, "/p2p/") {
+			return fmt.Errorf("config: bootstrap %q is not a multiaddr with /p2p/<peerID>", a)
+		}
+	}
+	if c.DBPath == "" {
+		return errors.New("config: db-path is empty")
+	}
+	if c.ControlListen != "" {
+		host, _, err := net.SplitHostPort(c.ControlListen)
+		if err != nil {
+			return fmt.Errorf("config: control-listen: %w", err)
+		}
+		// The control interface is unauthenticated: anyone who reaches it
+		// can change the log levels.
+		if ip, err := netip.ParseAddr(host); host != "localhost" && (err != nil || !ip.IsLoopback()) {
+			return fmt.Errorf("config: control-listen %q is not a loopback address", c.ControlListen)
+		}
+	}
+	if c.MetricsListen != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsListen); err != nil {
+			return fmt.Errorf("config: metrics-listen: %w", err)
+		}
+	}
+	if err := c.Overlay.Validate(); err != nil {
+		return err
+	}
+	return c.Log.Validate()
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestEngineControlListen(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"", false},
+		{"127.0.0.1:5555", false},
+		{"[::1]:5555", false},
+		{"localhost:5555", false},
+		{":5555", true},
+		{"0.0.0.0:5555", true},
+		{"10.0.0.1:5555", true},
+		{"example.com:5555", true},
+		{"127.0.0.1", true},
+	}
+	for _, tt := range tests {
+		var c Engine
+		EngineFlags(flag.NewFlagSet("test", flag.ContinueOnError), &c) // defaults
+		c.ControlListen = tt.addr
+		if err := c.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("control-listen %q: Validate = %v, want error %v", tt.addr, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+
+	"github.com/grishinium-blockchain/grishinium-go/dht"
+)
+
+// Global is the network global config (config.global): the DHT static nodes
+// used to join the network, the public lite-servers and the validator's
+// reference blocks. Field names follow the TL-JSON form of the C++ tools, so
+// their global config files load unchanged.
+type Global struct {
+	Type          string           `json:"@type,omitempty"`
+	DHT           dht.GlobalConfig `json:"dht"`
+	LiteServers   []LiteServer     `json:"liteservers"`
+	LiteServersV2 []LiteServerV2   `json:"liteservers_v2,omitempty"`
+	Validator     ValidatorConfig  `json:"validator"`
+}
+
+// LiteServer is a lite-server endpoint (liteserver.desc).
+type LiteServer struct {
+	IP   int32     `json:"ip"` // IPv4, big-endian, as a signed integer
+	Port int32     `json:"port"`
+	ID   PublicKey `json:"id"`
+}
+
+// Addr returns the lite-server address in host:port form.
+func (l LiteServer) Addr() string {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(l.IP))
+	return net.JoinHostPort(netip.AddrFrom4(b).String(), strconv.Itoa(int(l.Port)))
+}
+
+// LiteServerV2 is a lite-server that only serves some shards
+// (liteserver.descV2).
+type LiteServerV2 struct {
+	LiteServer
+	Slices []LiteServerSlice `json:"slices"`
+}
+
+// LiteServerSlice is the part of the chain a LiteServerV2 serves: either a
+// set of shards (liteserver.descV2.sliceSimple) or a range of shard states
+// (liteserver.descV2.sliceTimed).
+type LiteServerSlice struct {
+	Type       string      `json:"@type"`
+	Shards     []ShardInfo `json:"shards,omitempty"`
+	ShardsFrom []ShardInfo `json:"shards_from,omitempty"`
+	ShardsTo   []ShardInfo `json:"shards_to,omitempty"`
+}
+
+// ShardInfo is a shard and the last block of it a slice covers
+// (liteserver.descV2.shardInfo).
+type ShardInfo struct {
+	ShardID struct {
+		Workchain int32 `json:"workchain"`
+		Shard     Int64 `json:"shard"`
+	} `json:"shard_id"`
+	Seqno int32 `json:"seqno"`
+	Utime int32 `json:"utime"`
+	LT    Int64 `json:"lt"`
+}
+
+// ValidatorConfig holds the blocks a node starts syncing from
+// (validator.config.global).
+type ValidatorConfig struct {
+	Type      string    `json:"@type,omitempty"`
+	ZeroState BlockID   `json:"zero_state"`
+	InitBlock *BlockID  `json:"init_block,omitempty"`
+	Hardforks []BlockID `json:"hardforks,omitempty"`
+}
+
+// BlockID identifies a block (tonNode.blockIdExt).
+type BlockID struct {
+	Workchain int32  `json:"workchain"`
+	Shard     Int64  `json:"shard"`
+	Seqno     int32  `json:"seqno"`
+	RootHash  []byte `json:"root_hash"`
+	FileHash  []byte `json:"file_hash"`
+}
+
+func (b BlockID) String() string {
+	return fmt.Sprintf("(%d,%016x,%d):%X:%X", b.Workchain, uint64(b.Shard), b.Seqno, b.RootHash, b.FileHash)
+}
+
+func (b BlockID) validate() error {
+	if len(b.RootHash) != 32 || len(b.FileHash) != 32 {
+		return errors.New("block id hashes must be 32 bytes")
+	}
+	return nil
+}
+
+// PublicKey is a TL-JSON public key; only pub.ed25519 is supported.
+type PublicKey struct {
+	Type string `json:"@type"`
+	Key  []byte `json:"key"`
+}
+
+// Ed25519 returns the key, or an error for other key types.
+func (k PublicKey) Ed25519() (ed25519.PublicKey, error) {
+	if k.Type != "pub.ed25519" || len(k.Key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("unsupported public key %q", k.Type)
+	}
+	return ed25519.PublicKey(k.Key), nil
+}
+
+// String returns the key in base64, as accepted by -server-key.
+func (k PublicKey) String() string { return base64.StdEncoding.EncodeToString(k.Key) }
+
+// Int64 is a TL long. TL-JSON writes longs as strings, but hand-written
+// configs often use plain numbers; both are accepted.
+type Int64 int64
+
+func (v *Int64) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		b = []byte(s)
+	}
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid long %s", b)
+	}
+	*v = Int64(n)
+	return nil
+}
+
+// LoadGlobal reads and validates the global config at path.
+func LoadGlobal(path string) (*Global, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	g, err := ParseGlobal(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return g, nil
+}
+
+// ParseGlobal decodes and validates a global config.
+func ParseGlobal(b []byte) (*Global, error) {
+	var g Global
+	if err := json.Unmarshal(b, &g); err != nil {
+		return nil, err
+	}
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Validate checks the lite-server keys and ports and the validator block
+// IDs. DHT node signatures are checked by DHTNodes.
+func (g *Global) Validate() error {
+	check := func(i int, l LiteServer) error {
+		if _, err := l.ID.Ed25519(); err != nil {
+			return fmt.Errorf("liteserver %d: %w", i, err)
+		}
+		if l.Port <= 0 || l.Port > 0xffff {
+			return fmt.Errorf("liteserver %d: invalid port %d", i, l.Port)
+		}
+		return nil
+	}
+	for i, l := range g.LiteServers {
+		if err := check(i, l); err != nil {
+			return err
+		}
+	}
+	for i, l := range g.LiteServersV2 {
+		if err := check(i, l.LiteServer); err != nil {
+			return fmt.Errorf("v2 %w", err)
+		}
+	}
+	v := g.Validator
+	if v.ZeroState.RootHash != nil || v.ZeroState.FileHash != nil {
+		if err := v.ZeroState.validate(); err != nil {
+			return fmt.Errorf("zero_state: %w", err)
+		}
+	}
+	if v.InitBlock != nil {
+		if err := v.InitBlock.validate(); err != nil {
+			return fmt.Errorf("init_block: %w", err)
+		}
+	}
+	for i, h := range v.Hardforks {
+		if err := h.validate(); err != nil {
+			return fmt.Errorf("hardfork %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// DHTNodes returns the DHT static nodes whose signatures verify, and an error
+// describing the first one that does not.
+func (g *Global) DHTNodes() ([]*dht.Node, error) {
+	var (
+		out   []*dht.Node
+		first error
+	)
+	for _, n := range g.DHT.StaticNodes.Nodes {
+		if err := n.Verify(); err != nil {
+			if first == nil {
+				id := n.ID()
+				first = fmt.Errorf("dht static node %x: %w", id, err)
+			}
+			continue
+		}
+		out = append(out, n)
+	}
+	return out, first
+}
+
+// LiteServer returns the lite-server with the given index; the v2 entries
+// follow the plain ones.
+func (g *Global) LiteServer(index int) (LiteServer, error) {
+	n := len(g.LiteServers) + len(g.LiteServersV2)
+	if n == 0 {
+		return LiteServer{}, errors.New("global config lists no lite-servers")
+	}
+	if index < 0 || index >= n {
+		return LiteServer{}, fmt.Errorf("lite-server index %d out of range [0, %d)", index, n)
+	}
+	if index < len(g.LiteServers) {
+		return g.LiteServers[index], nil
+	}
+	return g.LiteServersV2[index-len(g.LiteServers)].LiteServer, nil
+}
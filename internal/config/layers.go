@@ -0,0 +1,203 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of environment variables that set options.
+const EnvPrefix = "GRISHINIUM_"
+
+// Options come from three layers, each overriding the one before:
+//
+//  1. a JSON config file named by -config or GRISHINIUM_CONFIG, an object
+//     keyed by flag name: {"listen": ["/ip4/0.0.0.0/tcp/0"], "mdns": true};
+//  2. environment variables, GRISHINIUM_ followed by the flag name in upper
+//     case with dashes replaced by underscores: GRISHINIUM_DB_PATH;
+//  3. command-line flags.
+//
+// Options set in none of them keep their flag defaults. Every option is a
+// flag, so the three layers share one set of names.
+
+// Flags that select what Load and Dump do rather than configure the binary.
+const (
+	configFlag = "config"
+	dumpFlag   = "dump-config"
+)
+
+// StringList is a repeatable string flag. In a config file it is a JSON
+// array and in the environment a comma-separated list.
+type StringList []string
+
+func (l *StringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *StringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// Load parses args into fs and fills every flag not given on the command line
+// from the environment or, failing that, from the config file. Unknown keys
+// in the file are errors, so typos do not go unnoticed.
+func Load(fs *flag.FlagSet, args []string) error {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	var path string
+	if f := fs.Lookup(configFlag); f != nil {
+		if v, ok := os.LookupEnv(EnvName(configFlag)); ok && !given[configFlag] {
+			if err := f.Value.Set(v); err != nil {
+				return err
+			}
+		}
+		path = f.Value.String()
+	}
+	file, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	for name := range file {
+		if name == configFlag || name == dumpFlag || fs.Lookup(name) == nil {
+			return fmt.Errorf("config: %s: unknown option %q", path, name)
+		}
+	}
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] || f.Name == configFlag {
+			return
+		}
+		if v, ok := os.LookupEnv(EnvName(f.Name)); ok {
+			if err := setEnv(f, v); err != nil {
+				errs = append(errs, fmt.Errorf("config: %s: %w", EnvName(f.Name), err))
+			}
+			return
+		}
+		if raw, ok := file[f.Name]; ok {
+			if err := setJSON(f, raw); err != nil {
+				errs = append(errs, fmt.Errorf("config: %s: option %q: %w", path, f.Name, err))
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// EnvName returns the environment variable that sets the named flag.
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Dump writes the effective value of every flag in fs as a config file that
+// Load accepts.
+func Dump(w io.Writer, fs *flag.FlagSet) error {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	out := make(map[string]any)
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == configFlag || f.Name == dumpFlag {
+			return
+		}
+		switch v := f.Value.(type) {
+		case *StringList:
+			out[f.Name] = append([]string{}, *v...)
+		case flag.Getter:
+			if d, ok := v.Get().(time.Duration); ok {
+				out[f.Name] = d.String()
+			} else {
+				out[f.Name] = v.Get()
+			}
+		default:
+			out[f.Name] = v.String()
+		}
+	})
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// readFile returns the options in the config file at path, or none when path
+// is empty.
+func readFile(path string) (map[string]json.RawMessage, error) {
+	if path == "" {
+		return nil, nil
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return nil, fmt.Errorf("config: %s: YAML is not supported, use JSON", path)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	var file map[string]json.RawMessage
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("config: %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// setEnv sets f from an environment variable; lists are comma-separated.
+func setEnv(f *flag.Flag, v string) error {
+	if _, ok := f.Value.(*StringList); !ok {
+		return f.Value.Set(v)
+	}
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			if err := f.Value.Set(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setJSON sets f from a config file value: a string, number or boolean, or
+// an array of strings for a list.
+func setJSON(f *flag.Flag, raw json.RawMessage) error {
+	if _, ok := f.Value.(*StringList); ok {
+		var list []string
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return errors.New("want an array of strings")
+		}
+		for _, s := range list {
+			if err := f.Value.Set(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case string:
+		return f.Value.Set(v)
+	case float64, bool:
+		return f.Value.Set(string(raw))
+	default:
+		return errors.New("want a string, number or boolean")
+	}
+}
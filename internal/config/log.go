@@ -0,0 +1,53 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	logger "github.com/grishinium-blockchain/grishinium-go/internal/log"
+)
+
+// Log configures log output of long-running binaries.
+type Log struct {
+	Level      string // level spec, e.g. "info,dht=debug"
+	Format     string // text or json
+	File       string // log file; empty means stderr
+	MaxSizeMB  int    // rotate the log file at this size; 0 never rotates
+	MaxBackups int    // rotated log files to keep
+}
+
+// LogFlags binds the log flags into the provided FlagSet (or flag.CommandLine when nil).
+func LogFlags(fs *flag.FlagSet, cfg *Log) {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	fs.StringVar(&cfg.Level, "log-level", "info", "log levels: a level for every subsystem and/or subsystem=level, e.g. info,dht=debug (subsystems: netstack, dht, overlay, validator)")
+	fs.StringVar(&cfg.Format, "log-format", "text", "log format: text or json")
+	fs.StringVar(&cfg.File, "log-file", "", "write logs to this file instead of stderr")
+	fs.IntVar(&cfg.MaxSizeMB, "log-max-size", 100, "rotate the log file when it reaches this many MB (0 never rotates)")
+	fs.IntVar(&cfg.MaxBackups, "log-max-backups", 5, "rotated log files to keep")
+}
+
+// Validate checks the log options.
+func (c *Log) Validate() error {
+	if c.Format != "text" && c.Format != "json" {
+		return fmt.Errorf("config: log-format %q is not text or json", c.Format)
+	}
+	if _, err := logger.ParseLevels(c.Level); err != nil {
+		return fmt.Errorf("config: log-level: %w", err)
+	}
+	if c.MaxSizeMB < 0 || c.MaxBackups < 0 {
+		return errors.New("config: log-max-size and log-max-backups must not be negative")
+	}
+	return nil
+}
+
+// Options returns the logger options for c.
+func (c *Log) Options() logger.Options {
+	o := logger.Options{Format: c.Format, Levels: c.Level, File: c.File, MaxBackups: c.MaxBackups}
+	if c.File != "" {
+		o.MaxSize = int64(c.MaxSizeMB) << 20
+	}
+	return o
+}
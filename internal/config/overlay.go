@@ -0,0 +1,53 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	overlaypkg "github.com/grishinium-blockchain/grishinium-go/overlay"
+)
+
+// Overlay configures the flood protection of overlay traffic.
+type Overlay struct {
+	PeerRate       float64       // messages per second accepted from one peer; negative disables
+	OverlayRate    float64       // messages per second accepted in one overlay; negative disables
+	MaxMessageSize int           // largest broadcast message, also the pubsub message cap
+	BanDuration    time.Duration // how long misbehaving peers are ignored
+}
+
+// OverlayFlags binds the overlay flags into the provided FlagSet (or flag.CommandLine when nil).
+func OverlayFlags(fs *flag.FlagSet, cfg *Overlay) {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	fs.Float64Var(&cfg.PeerRate, "overlay-peer-rate", overlaypkg.DefaultPeerRate, "overlay messages and queries per second accepted from one peer (negative disables the limit)")
+	fs.Float64Var(&cfg.OverlayRate, "overlay-rate", overlaypkg.DefaultOverlayRate, "overlay messages and queries per second accepted in one overlay (negative disables the limit)")
+	fs.IntVar(&cfg.MaxMessageSize, "overlay-max-message-size", overlaypkg.DefaultMaxMessageSize, "largest overlay broadcast message in bytes")
+	fs.DurationVar(&cfg.BanDuration, "overlay-ban-duration", overlaypkg.DefaultBanDuration, "how long peers sending invalid or excessive overlay traffic are ignored")
+}
+
+// Validate checks the overlay options.
+func (c *Overlay) Validate() error {
+	if c.PeerRate == 0 || c.OverlayRate == 0 {
+		return errors.New("config: overlay-peer-rate and overlay-rate must not be zero")
+	}
+	if c.MaxMessageSize < overlaypkg.MinMessageSize {
+		return fmt.Errorf("config: overlay-max-message-size must be at least %d", overlaypkg.MinMessageSize)
+	}
+	if c.BanDuration <= 0 {
+		return errors.New("config: overlay-ban-duration must be positive")
+	}
+	return nil
+}
+
+// Limits returns the overlay limits for c.
+func (c *Overlay) Limits() overlaypkg.Limits {
+	return overlaypkg.Limits{
+		PeerRate:       c.PeerRate,
+		OverlayRate:    c.OverlayRate,
+		MaxMessageSize: c.MaxMessageSize,
+		BanDuration:    c.BanDuration,
+	}
+}
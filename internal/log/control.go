@@ -0,0 +1,44 @@
+package log
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// LevelsPath is where the control interface serves Handler.
+const LevelsPath = "/log/levels"
+
+// Handler serves the log levels for the control interface. GET returns them
+// as a JSON object of subsystem to level ("" is the level of Logger); POST
+// applies the level spec in the body, e.g. "dht=debug", and returns the new
+// levels.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodPut:
+			body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := SetLevels(string(body)); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			Logger.Info("log levels changed", "spec", strings.TrimSpace(string(body)), "remote", r.RemoteAddr)
+		default:
+			w.Header().Set("Allow", "GET, POST, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		out := make(map[string]string)
+		for s, l := range Levels() {
+			out[s] = strings.ToLower(l.String())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	})
+}
@@ -0,0 +1,60 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	keepLevels(t)
+	if err := SetLevels("info"); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(Handler())
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantDHT    string // level of dht in the answer; empty when there is none
+	}{
+		{"get", http.MethodGet, "", http.StatusOK, "info"},
+		{"post", http.MethodPost, "dht=debug", http.StatusOK, "debug"},
+		{"put", http.MethodPut, "dht=warn", http.StatusOK, "warn"},
+		{"bad spec", http.MethodPost, "dht=loud", http.StatusBadRequest, ""},
+		{"unknown subsystem", http.MethodPost, "nosuch=debug", http.StatusBadRequest, ""},
+		{"unchanged after errors", http.MethodGet, "", http.StatusOK, "warn"},
+		{"delete", http.MethodDelete, "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+LevelsPath, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantDHT == "" {
+				return
+			}
+			var levels map[string]string
+			if err := json.NewDecoder(resp.Body).Decode(&levels); err != nil {
+				t.Fatal(err)
+			}
+			if levels[DHT] != tt.wantDHT || levels[""] != "info" {
+				t.Fatalf("levels %v, want dht=%s and info", levels, tt.wantDHT)
+			}
+		})
+	}
+}
@@ -1,17 +1,283 @@
 package log
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log"
 	"log/slog"
+	"math"
 	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
+// Subsystems with their own loggers. Each has a level that can be set
+// independently, at start with a level spec and at runtime through Handler.
+const (
+	Netstack  = "netstack"
+	DHT       = "dht"
+	Overlay   = "overlay"
+	Validator = "validator"
+)
+
+// Logger is the process-wide logger of code outside the subsystems.
+var Logger = For("")
+
+// Options configure the log output.
+type Options struct {
+	Format     string // "text" (default) or "json"
+	Levels     string // level spec, e.g. "info,dht=debug"; empty keeps the levels
+	File       string // log file; empty means stderr
+	MaxSize    int64  // rotate the file when it would grow past this many bytes; 0 never rotates
+	MaxBackups int    // rotated files to keep as File.1 ... File.N
+}
+
+// output is where records of every subsystem go. Filtering is done by the
+// subsystem handlers, so the output handler accepts every level.
+type output struct {
+	h      slog.Handler
+	closer io.Closer
+}
+
 var (
-	Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	current atomic.Pointer[output]
+
+	mu     sync.Mutex
+	levels = make(map[string]*slog.LevelVar) // "" is the level of Logger
 )
 
-// SetDebug enables verbose logging.
-func SetDebug() {
-	Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+func init() {
+	current.Store(&output{h: newHandler("text", os.Stderr)})
+	for _, s := range []string{"", Netstack, DHT, Overlay, Validator} {
+		levelVar(s)
+	}
+}
+
+func newHandler(format string, w io.Writer) slog.Handler {
+	opts := &slog.HandlerOptions{Level: slog.Level(math.MinInt)}
+	if format == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// Setup switches the output of every logger, including those already
+// returned by For, and applies the level spec. It closes the log file of the
+// previous Setup.
+func Setup(o Options) error {
+	switch o.Format {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("log: unknown format %q", o.Format)
+	}
+	spec, err := checkLevels(o.Levels)
+	if err != nil {
+		return err
+	}
+	out := &output{}
+	var w io.Writer = os.Stderr
+	if o.File != "" {
+		f, err := openRotating(o.File, o.MaxSize, o.MaxBackups)
+		if err != nil {
+			return err
+		}
+		w, out.closer = f, f
+	}
+	out.h = newHandler(o.Format, w)
+	applyLevels(spec)
+	log.SetOutput(w)
+	if old := current.Swap(out); old.closer != nil {
+		return old.closer.Close()
+	}
+	return nil
+}
+
+// Close flushes and closes the log file, sending further output to stderr.
+func Close() error {
 	log.SetOutput(os.Stderr)
+	if old := current.Swap(&output{h: newHandler("text", os.Stderr)}); old.closer != nil {
+		return old.closer.Close()
+	}
+	return nil
+}
+
+// SetDebug enables verbose logging in every subsystem.
+func SetDebug() {
+	_ = SetLevel("", slog.LevelDebug)
+}
+
+// For returns the logger of a subsystem. Its records carry a subsystem
+// attribute and are filtered by the subsystem's level.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&handler{sub: subsystem, level: levelVar(subsystem)})
+}
+
+func levelVar(subsystem string) *slog.LevelVar {
+	mu.Lock()
+	defer mu.Unlock()
+	v, ok := levels[subsystem]
+	if !ok {
+		v = new(slog.LevelVar)
+		if root, ok := levels[""]; ok {
+			v.Set(root.Level())
+		}
+		levels[subsystem] = v
+	}
+	return v
+}
+
+// SetLevel sets the level of a subsystem. The empty subsystem sets the level
+// of every logger.
+func SetLevel(subsystem string, level slog.Level) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if subsystem == "" {
+		for _, v := range levels {
+			v.Set(level)
+		}
+		return nil
+	}
+	v, ok := levels[subsystem]
+	if !ok {
+		return fmt.Errorf("log: unknown subsystem %q", subsystem)
+	}
+	v.Set(level)
+	return nil
+}
+
+// Levels returns the level of every subsystem; "" is the level of Logger.
+func Levels() map[string]slog.Level {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make(map[string]slog.Level, len(levels))
+	for s, v := range levels {
+		out[s] = v.Level()
+	}
+	return out
+}
+
+// SetLevels applies a level spec (see ParseLevels). Nothing changes when the
+// spec is malformed or names an unknown subsystem.
+func SetLevels(spec string) error {
+	settings, err := checkLevels(spec)
+	if err != nil {
+		return err
+	}
+	applyLevels(settings)
+	return nil
+}
+
+func checkLevels(spec string) ([]LevelSetting, error) {
+	settings, err := ParseLevels(spec)
+	if err != nil {
+		return nil, err
+	}
+	known := Levels()
+	for _, l := range settings {
+		if _, ok := known[l.Subsystem]; !ok {
+			return nil, fmt.Errorf("log: unknown subsystem %q", l.Subsystem)
+		}
+	}
+	return settings, nil
+}
+
+func applyLevels(settings []LevelSetting) {
+	for _, l := range settings {
+		_ = SetLevel(l.Subsystem, l.Level)
+	}
+}
+
+// LevelSetting is one entry of a level spec.
+type LevelSetting struct {
+	Subsystem string // empty for every subsystem
+	Level     slog.Level
+}
+
+// ParseLevels parses a level spec: comma-separated entries that are either a
+// level for every subsystem or subsystem=level, e.g. "info,dht=debug".
+// Entries apply in order, so a bare level should come first.
+func ParseLevels(spec string) ([]LevelSetting, error) {
+	var out []LevelSetting
+	for _, e := range strings.Split(spec, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		var s LevelSetting
+		name, lvl, ok := strings.Cut(e, "=")
+		if ok {
+			s.Subsystem = strings.TrimSpace(name)
+			if s.Subsystem == "" {
+				return nil, fmt.Errorf("log: bad level entry %q", e)
+			}
+		} else {
+			lvl = name
+		}
+		if err := s.Level.UnmarshalText([]byte(strings.TrimSpace(lvl))); err != nil {
+			return nil, fmt.Errorf("log: bad level entry %q: %w", e, err)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// handler filters records by the subsystem level and passes them to the
+// current output.
+type handler struct {
+	sub   string
+	level *slog.LevelVar
+	wrap  []func(slog.Handler) slog.Handler // WithAttrs and WithGroup, in order
+
+	cache atomic.Pointer[built]
+}
+
+// built is a handler's chain on top of one output.
+type built struct {
+	out *output
+	h   slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	return h.resolve().Handle(ctx, r)
+}
+
+func (h *handler) resolve() slog.Handler {
+	out := current.Load()
+	if b := h.cache.Load(); b != nil && b.out == out {
+		return b.h
+	}
+	hh := out.h
+	if h.sub != "" {
+		hh = hh.WithAttrs([]slog.Attr{slog.String("subsystem", h.sub)})
+	}
+	for _, w := range h.wrap {
+		hh = w(hh)
+	}
+	h.cache.Store(&built{out: out, h: hh})
+	return hh
+}
+
+func (h *handler) with(w func(slog.Handler) slog.Handler) *handler {
+	return &handler{sub: h.sub, level: h.level, wrap: append(slices.Clip(h.wrap), w)}
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(func(hh slog.Handler) slog.Handler { return hh.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(func(hh slog.Handler) slog.Handler { return hh.WithGroup(name) })
 }
@@ -0,0 +1,141 @@
+package log
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// keepLevels restores the levels of every subsystem when t ends.
+func keepLevels(t *testing.T) {
+	t.Helper()
+	saved := Levels()
+	t.Cleanup(func() {
+		for s, l := range saved {
+			_ = SetLevel(s, l)
+		}
+	})
+}
+
+func TestParseLevels(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []LevelSetting
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"debug", []LevelSetting{{"", slog.LevelDebug}}, false},
+		{"info, dht=debug ,overlay=WARN", []LevelSetting{{"", slog.LevelInfo}, {DHT, slog.LevelDebug}, {Overlay, slog.LevelWarn}}, false},
+		{"dht=debug+2", []LevelSetting{{DHT, slog.LevelDebug + 2}}, false},
+		{"=debug", nil, true},
+		{"dht=loud", nil, true},
+		{"loud", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevels(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLevels(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseLevels(%q) = %v, want %v", tt.spec, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParseLevels(%q)[%d] = %v, want %v", tt.spec, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestSetLevels(t *testing.T) {
+	keepLevels(t)
+	if err := SetLevels("warn,dht=debug"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]slog.Level{"": slog.LevelWarn, DHT: slog.LevelDebug, Overlay: slog.LevelWarn, Netstack: slog.LevelWarn}
+	check := func() {
+		t.Helper()
+		got := Levels()
+		for s, l := range want {
+			if got[s] != l {
+				t.Errorf("level of %q = %v, want %v", s, got[s], l)
+			}
+		}
+	}
+	check()
+	// A spec naming an unknown subsystem changes nothing, not even the
+	// entries before it.
+	if err := SetLevels("error,nosuch=debug"); err == nil {
+		t.Fatal("unknown subsystem accepted")
+	}
+	check()
+
+	if !For(DHT).Enabled(t.Context(), slog.LevelDebug) {
+		t.Error("dht debug disabled")
+	}
+	if For(Overlay).Enabled(t.Context(), slog.LevelInfo) {
+		t.Error("overlay info enabled at warn")
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	keepLevels(t)
+	path := filepath.Join(t.TempDir(), "engine.log")
+	if err := Setup(Options{Format: "json", Levels: "info,dht=debug", File: path}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = Close() })
+	// A logger obtained before Setup switches output as well.
+	For(DHT).With("peer", "p1").Debug("lookup", "nodes", 3)
+	For(Overlay).Debug("filtered")
+	Logger.Info("plain")
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []map[string]any
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var m map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		lines = append(lines, m)
+	}
+	want := []map[string]any{
+		{"level": "DEBUG", "msg": "lookup", "subsystem": "dht", "peer": "p1", "nodes": 3.0},
+		{"level": "INFO", "msg": "plain"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("%d lines logged, want %d: %v", len(lines), len(want), lines)
+	}
+	for i, w := range want {
+		for k, v := range w {
+			if lines[i][k] != v {
+				t.Errorf("line %d: %s = %v, want %v", i, k, lines[i][k], v)
+			}
+		}
+	}
+	if _, ok := lines[1]["subsystem"]; ok {
+		t.Error("Logger records carry a subsystem")
+	}
+}
+
+func TestSetupRejectsBadOptions(t *testing.T) {
+	keepLevels(t)
+	for _, o := range []Options{{Format: "xml"}, {Levels: "dht=loud"}, {Levels: "nosuch=info"}} {
+		if err := Setup(o); err == nil {
+			t.Errorf("Setup(%+v) accepted", o)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile is a log file that is renamed to path.1 when it would grow
+// past maxSize, shifting older files up to path.<backups>.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	f       *os.File
+	size    int64
+}
+
+func openRotating(path string, maxSize int64, backups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, backups: max(backups, 0)}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("log: %w", err)
+	}
+	r.f, r.size = f, st.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate closes the file, shifts the backups and starts an empty file.
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+	r.f = nil
+	if r.backups == 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("log: %w", err)
+		}
+	} else {
+		for i := r.backups; i > 1; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", r.path, i-1), fmt.Sprintf("%s.%d", r.path, i))
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return fmt.Errorf("log: %w", err)
+		}
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
@@ -0,0 +1,74 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		backups int
+		writes  []string
+		want    map[string]string // file suffix -> contents
+	}{
+		{"no rotation below the limit", 2, []string{"aaaa\n", "bbbb\n"}, map[string]string{"": "aaaa\nbbbb\n"}},
+		{"rotates past the limit", 2, []string{"aaaaaaaa\n", "bbbbbbbb\n"}, map[string]string{"": "bbbbbbbb\n", ".1": "aaaaaaaa\n"}},
+		{"shifts backups and drops the oldest", 2, []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"},
+			map[string]string{"": "dddddddd\n", ".1": "cccccccc\n", ".2": "bbbbbbbb\n", ".3": ""}},
+		{"no backups truncates", 0, []string{"aaaaaaaa\n", "bbbbbbbb\n"}, map[string]string{"": "bbbbbbbb\n", ".1": ""}},
+		{"oversized write goes to an empty file", 1, []string{"a\n", "0123456789abcdef\n"}, map[string]string{"": "0123456789abcdef\n", ".1": "a\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "log")
+			r, err := openRotating(path, 12, tt.backups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.writes {
+				if _, err := r.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+			for suffix, want := range tt.want {
+				got, err := os.ReadFile(path + suffix)
+				if want == "" {
+					if !os.IsNotExist(err) {
+						t.Errorf("log%s exists", suffix)
+					}
+					continue
+				}
+				if err != nil || string(got) != want {
+					t.Errorf("log%s = %q, %v; want %q", suffix, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	if err := os.WriteFile(path, []byte("existing\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The size of an existing file counts toward the limit.
+	r, err := openRotating(path, 12, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte("next\n")); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if got, _ := os.ReadFile(path + ".1"); string(got) != "existing\n" {
+		t.Fatalf("log.1 = %q, want the existing contents", got)
+	}
+	if _, err := r.Write([]byte("late\n")); err != os.ErrClosed {
+		t.Fatalf("Write after Close = %v, want os.ErrClosed", err)
+	}
+}
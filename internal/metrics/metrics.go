@@ -0,0 +1,211 @@
+// Package metrics holds the Prometheus metrics of the node and the hooks the
+// netstack, DHT and overlay code report through.
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "grishinium"
+
+// Registry holds every metric of the process, including the Go runtime and
+// process collectors.
+var Registry = prometheus.NewRegistry()
+
+// Message directions of the pubsub and overlay counters.
+const (
+	Sent     = "sent"
+	Received = "received"
+)
+
+var (
+	netstackPeers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "netstack", Name: "peers",
+		Help: "Peers the node is connected to.",
+	})
+	pubsubMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "netstack", Name: "pubsub_messages_total",
+		Help: "Pubsub messages by topic and direction.",
+	}, []string{"topic", "direction"})
+	pubsubBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "netstack", Name: "pubsub_bytes_total",
+		Help: "Pubsub payload bytes by topic and direction.",
+	}, []string{"topic", "direction"})
+	pubsubDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "netstack", Name: "pubsub_dropped_total",
+		Help: "Pubsub messages dropped because a subscriber fell behind, by topic.",
+	}, []string{"topic"})
+
+	dhtRequests = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "dht", Name: "request_duration_seconds",
+		Help:    "Duration of DHT operations (get, put, provide, find_peer, find_providers) by result.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"op", "result"})
+	dhtProvidersFound = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "dht", Name: "providers_found",
+		Help:    "Providers returned by successful provider lookups.",
+		Buckets: []float64{0, 1, 2, 5, 10, 20, 50},
+	})
+	dhtQueries = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "dht", Name: "query_duration_seconds",
+		Help:    "Round-trip time of queries this node sent to other Kademlia nodes, by result.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"result"})
+	dhtServed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "dht", Name: "served_queries_total",
+		Help: "Queries answered for other Kademlia nodes, by query type.",
+	}, []string{"query"})
+	dhtNodes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "dht", Name: "routing_table_nodes",
+		Help: "Nodes in the Kademlia routing table.",
+	})
+	dhtRecords = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "dht", Name: "stored_records",
+		Help: "Records stored for other nodes.",
+	})
+
+	overlaySubscriptions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "overlay", Name: "subscriptions",
+		Help: "Active overlay subscriptions.",
+	})
+	overlayPeers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "overlay", Name: "peers",
+		Help: "Members kept in the peer sample of each joined overlay.",
+	}, []string{"overlay"})
+	overlayMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "overlay", Name: "messages_total",
+		Help: "Overlay broadcasts by overlay (empty for unscoped topics) and direction.",
+	}, []string{"overlay", "direction"})
+	overlayPublishErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "overlay", Name: "publish_errors_total",
+		Help: "Overlay broadcasts that could not be published, by overlay (empty for unscoped topics).",
+	}, []string{"overlay"})
+	overlayQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "overlay", Name: "queries_total",
+		Help: "Queries and messages to overlay members, by direction and result.",
+	}, []string{"direction", "result"})
+	overlayDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "overlay", Name: "dropped_messages_total",
+		Help: "Received broadcasts dropped, by overlay (empty for unscoped topics) and reason.",
+	}, []string{"overlay", "reason"})
+	overlayBanned = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "overlay", Name: "banned_peers_total",
+		Help: "Peers banned for invalid or excessive overlay traffic.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		netstackPeers, pubsubMessages, pubsubBytes, pubsubDropped,
+		dhtRequests, dhtProvidersFound, dhtQueries, dhtServed, dhtNodes, dhtRecords,
+		overlaySubscriptions, overlayPeers, overlayMessages, overlayPublishErrors, overlayQueries, overlayDropped, overlayBanned,
+	)
+}
+
+// SetPeers reports the number of connected peers.
+func SetPeers(n int) { netstackPeers.Set(float64(n)) }
+
+// PubsubMessage counts a pubsub message of size bytes.
+func PubsubMessage(topic, direction string, size int) {
+	pubsubMessages.WithLabelValues(topic, direction).Inc()
+	pubsubBytes.WithLabelValues(topic, direction).Add(float64(size))
+}
+
+// PubsubDropped counts a message a slow subscriber missed.
+func PubsubDropped(topic string) { pubsubDropped.WithLabelValues(topic).Inc() }
+
+// DHTRequest records the duration of a DHT operation that started at start.
+func DHTRequest(op string, start time.Time, err error) {
+	dhtRequests.WithLabelValues(op, result(err)).Observe(time.Since(start).Seconds())
+}
+
+// ProvidersFound records the size of a provider lookup answer.
+func ProvidersFound(n int) { dhtProvidersFound.Observe(float64(n)) }
+
+// DHTQuery records the round-trip time of a query sent to another node.
+func DHTQuery(rtt time.Duration, err error) {
+	dhtQueries.WithLabelValues(result(err)).Observe(rtt.Seconds())
+}
+
+// DHTServed counts a query answered for another node.
+func DHTServed(query string) { dhtServed.WithLabelValues(query).Inc() }
+
+// SetDHTTable reports the routing table and record store sizes.
+func SetDHTTable(nodes, records int) {
+	dhtNodes.Set(float64(nodes))
+	dhtRecords.Set(float64(records))
+}
+
+// OverlaySubscribed adjusts the subscription gauge by delta.
+func OverlaySubscribed(delta int) { overlaySubscriptions.Add(float64(delta)) }
+
+// SetOverlayPeers reports the member sample size of a joined overlay.
+func SetOverlayPeers(overlay string, n int) { overlayPeers.WithLabelValues(overlay).Set(float64(n)) }
+
+// ForgetOverlay drops the per-overlay series of an overlay that was left.
+func ForgetOverlay(overlay string) {
+	overlayPeers.DeleteLabelValues(overlay)
+	overlayPublishErrors.DeleteLabelValues(overlay)
+	overlayMessages.DeletePartialMatch(prometheus.Labels{"overlay": overlay})
+	overlayDropped.DeletePartialMatch(prometheus.Labels{"overlay": overlay})
+}
+
+// OverlayMessage counts a broadcast of an overlay. Topics are not labels:
+// there is no bound on their number.
+func OverlayMessage(overlay, direction string) {
+	overlayMessages.WithLabelValues(overlay, direction).Inc()
+}
+
+// OverlayPublishError counts a broadcast that failed.
+func OverlayPublishError(overlay string) { overlayPublishErrors.WithLabelValues(overlay).Inc() }
+
+// OverlayQuery counts a query or message sent to, or answered for, an
+// overlay member.
+func OverlayQuery(direction string, err error) {
+	overlayQueries.WithLabelValues(direction, result(err)).Inc()
+}
+
+// OverlayDropped counts a received broadcast that was refused.
+func OverlayDropped(overlay, reason string) { overlayDropped.WithLabelValues(overlay, reason).Inc() }
+
+// OverlayPeerBanned counts a peer banned by the overlay's flood protection.
+func OverlayPeerBanned() { overlayBanned.Inc() }
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// Handler serves Registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Serve starts an HTTP server on addr that exposes Handler at /metrics. The
+// returned function shuts it down.
+func Serve(addr string) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}, nil
+}
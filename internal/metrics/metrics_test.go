@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// value returns the value of the series of the named metric with exactly the
+// given labels: a counter or gauge value, or a histogram's sample count.
+func value(t *testing.T, name string, labels map[string]string) (float64, bool) {
+	t.Helper()
+	families, err := Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	series:
+		for _, m := range f.GetMetric() {
+			if len(m.GetLabel()) != len(labels) {
+				continue
+			}
+			for _, l := range m.GetLabel() {
+				if v, ok := labels[l.GetName()]; !ok || v != l.GetValue() {
+					continue series
+				}
+			}
+			switch {
+			case m.GetCounter() != nil:
+				return m.GetCounter().GetValue(), true
+			case m.GetGauge() != nil:
+				return m.GetGauge().GetValue(), true
+			case m.GetHistogram() != nil:
+				return float64(m.GetHistogram().GetSampleCount()), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestHooks(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		name   string
+		hook   func()
+		metric string
+		labels map[string]string
+		delta  float64
+	}{
+		{"pubsub message", func() { PubsubMessage("t", Sent, 10) }, "grishinium_netstack_pubsub_messages_total", map[string]string{"topic": "t", "direction": "sent"}, 1},
+		{"pubsub bytes", func() { PubsubMessage("t", Received, 10) }, "grishinium_netstack_pubsub_bytes_total", map[string]string{"topic": "t", "direction": "received"}, 10},
+		{"pubsub dropped", func() { PubsubDropped("t") }, "grishinium_netstack_pubsub_dropped_total", map[string]string{"topic": "t"}, 1},
+		{"dht request", func() { DHTRequest("get", time.Now(), nil) }, "grishinium_dht_request_duration_seconds", map[string]string{"op": "get", "result": "ok"}, 1},
+		{"dht request error", func() { DHTRequest("put", time.Now(), failed) }, "grishinium_dht_request_duration_seconds", map[string]string{"op": "put", "result": "error"}, 1},
+		{"providers found", func() { ProvidersFound(2) }, "grishinium_dht_providers_found", nil, 1},
+		{"dht query", func() { DHTQuery(time.Millisecond, failed) }, "grishinium_dht_query_duration_seconds", map[string]string{"result": "error"}, 1},
+		{"dht served", func() { DHTServed("ping") }, "grishinium_dht_served_queries_total", map[string]string{"query": "ping"}, 1},
+		{"overlay subscribed", func() { OverlaySubscribed(2) }, "grishinium_overlay_subscriptions", nil, 2},
+		{"overlay message", func() { OverlayMessage("o", Received) }, "grishinium_overlay_messages_total", map[string]string{"overlay": "o", "direction": "received"}, 1},
+		{"overlay publish error", func() { OverlayPublishError("o") }, "grishinium_overlay_publish_errors_total", map[string]string{"overlay": "o"}, 1},
+		{"overlay query", func() { OverlayQuery(Sent, nil) }, "grishinium_overlay_queries_total", map[string]string{"direction": "sent", "result": "ok"}, 1},
+		{"overlay dropped", func() { OverlayDropped("o", "rate") }, "grishinium_overlay_dropped_messages_total", map[string]string{"overlay": "o", "reason": "rate"}, 1},
+		{"peer banned", OverlayPeerBanned, "grishinium_overlay_banned_peers_total", nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, _ := value(t, tt.metric, tt.labels)
+			tt.hook()
+			after, ok := value(t, tt.metric, tt.labels)
+			if !ok {
+				t.Fatalf("%s%v not registered", tt.metric, tt.labels)
+			}
+			if after-before != tt.delta {
+				t.Fatalf("%s%v grew by %v, want %v", tt.metric, tt.labels, after-before, tt.delta)
+			}
+		})
+	}
+}
+
+func TestGauges(t *testing.T) {
+	SetPeers(3)
+	SetDHTTable(4, 5)
+	SetOverlayPeers("o", 7)
+	tests := []struct {
+		metric string
+		labels map[string]string
+		want   float64
+	}{
+		{"grishinium_netstack_peers", nil, 3},
+		{"grishinium_dht_routing_table_nodes", nil, 4},
+		{"grishinium_dht_stored_records", nil, 5},
+		{"grishinium_overlay_peers", map[string]string{"overlay": "o"}, 7},
+	}
+	for _, tt := range tests {
+		if got, _ := value(t, tt.metric, tt.labels); got != tt.want {
+			t.Errorf("%s%v = %v, want %v", tt.metric, tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestForgetOverlay(t *testing.T) {
+	for _, o := range []string{"gone", "kept"} {
+		SetOverlayPeers(o, 1)
+		OverlayMessage(o, Sent)
+		OverlayPublishError(o)
+		OverlayDropped(o, "rate")
+	}
+	ForgetOverlay("gone")
+	series := []struct {
+		metric string
+		labels func(o string) map[string]string
+	}{
+		{"grishinium_overlay_peers", func(o string) map[string]string { return map[string]string{"overlay": o} }},
+		{"grishinium_overlay_messages_total", func(o string) map[string]string { return map[string]string{"overlay": o, "direction": "sent"} }},
+		{"grishinium_overlay_publish_errors_total", func(o string) map[string]string { return map[string]string{"overlay": o} }},
+		{"grishinium_overlay_dropped_messages_total", func(o string) map[string]string { return map[string]string{"overlay": o, "reason": "rate"} }},
+	}
+	for _, s := range series {
+		if _, ok := value(t, s.metric, s.labels("gone")); ok {
+			t.Errorf("%s of a left overlay kept", s.metric)
+		}
+		if _, ok := value(t, s.metric, s.labels("kept")); !ok {
+			t.Errorf("%s of a joined overlay dropped", s.metric)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	DHTServed("find_node")
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, want := range []string{`grishinium_dht_served_queries_total{query="find_node"}`, "go_goroutines", "process_"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("exposition lacks %s", want)
+		}
+	}
+}
@@ -2,8 +2,48 @@ package netstack
 
 import (
 	"context"
+	"errors"
+
+	"github.com/grishinium-blockchain/grishinium-go/internal/storage"
+)
+
+// ErrPeerNotFound is returned by FindPeer when the peer cannot be located.
+var ErrPeerNotFound = errors.New("netstack: peer not found")
+
+var (
+	// ErrNoHandler is returned by Query and Send when the remote node has no
+	// handler for the protocol.
+	ErrNoHandler = errors.New("netstack: no handler for protocol")
+	// ErrRemote wraps the error a remote handler answered a query with.
+	ErrRemote = errors.New("netstack: remote error")
+	// ErrTooLarge is returned for requests and answers above MaxQuerySize,
+	// and for pubsub messages above Config.MaxMessageSize.
+	ErrTooLarge = errors.New("netstack: message too large")
+	// ErrIgnore is wrapped by validator errors that drop a message without
+	// holding it against the peer that relayed it, such as rate limits.
+	ErrIgnore = errors.New("netstack: message ignored")
+)
+
+const (
+	// MaxQuerySize bounds the requests and answers exchanged by Query and Send.
+	MaxQuerySize = 32 << 20
+	// DefaultMaxMessageSize is the pubsub message cap when
+	// Config.MaxMessageSize is zero.
+	DefaultMaxMessageSize = 1 << 20
 )
 
+// Handler answers a request sent to this node with Query or Send; for Send
+// the answer is discarded. from is the sender's address, usable as the
+// target of Query and Send.
+type Handler func(ctx context.Context, from string, req []byte) ([]byte, error)
+
+// Validator checks a pubsub message before it is delivered to subscribers
+// or, with libp2p, relayed to other peers. from is the address of the peer
+// the message came from, or of this node for its own messages. An error
+// drops the message; unless it wraps ErrIgnore, the sending peer is also
+// penalised by backends that score peers.
+type Validator func(from string, data []byte) error
+
 // Node is a high-level GRISHINIUM networking node abstraction.
 // It is intended to be backed by a professional-grade stack (libp2p: transport, Kad-DHT, PubSub).
 // This interface allows swapping implementations for tests.
@@ -23,12 +63,35 @@ type Node interface {
 	// Publish broadcasts data to a topic within the overlay network.
 	Publish(ctx context.Context, topic string, data []byte) error
 	// Subscribe subscribes to a topic and returns a receive-only channel with messages.
+	// A topic may have several subscriptions; the channel is closed when ctx is done
+	// or the topic is unsubscribed.
 	Subscribe(ctx context.Context, topic string) (<-chan []byte, error)
-	// Unsubscribe closes a previously created subscription.
+	// Unsubscribe cancels every subscription previously created for the topic.
 	Unsubscribe(ctx context.Context, topic string) error
+	// SetValidator sets the validator of every message received on topic; a
+	// nil v removes it.
+	SetValidator(topic string, v Validator)
+
+	// FindPeer locates a peer by ID using DHT and returns all of its known
+	// addresses. It returns an error wrapping ErrPeerNotFound when the lookup fails.
+	FindPeer(ctx context.Context, id string) ([]string, error)
 
-	// FindPeer locates a peer by ID using DHT.
-	FindPeer(ctx context.Context, id string) (string, error)
+	// Connect dials the peer at addr, as returned by FindPeer or FindProviders,
+	// so that pubsub can reach it. It returns an error wrapping ErrPeerNotFound
+	// when nobody answers at addr.
+	Connect(ctx context.Context, addr string) error
+
+	// SetHandler registers h for requests on protocol; a nil h removes the
+	// handler.
+	SetHandler(protocol string, h Handler)
+	// Query sends req to the peer at addr, as returned by FindPeer or
+	// FindProviders, and returns the answer of its handler for protocol.
+	Query(ctx context.Context, addr, protocol string, req []byte) ([]byte, error)
+	// Send sends a one-way message to the peer at addr.
+	Send(ctx context.Context, addr, protocol string, msg []byte) error
+	// Disconnect closes the connections to the peer at addr. The peer may
+	// connect again; callers that want it gone keep ignoring it.
+	Disconnect(ctx context.Context, addr string) error
 
 	// DHT provider/value operations
 	Provide(ctx context.Context, key []byte) error
@@ -43,4 +106,18 @@ type Config struct {
 	Bootstrap   []string // bootstrap peers (multiaddrs)
     // IdentityPriv is an optional ed25519 private key in raw form; when empty, an ephemeral identity may be used.
     IdentityPriv []byte
+    // Store optionally persists DHT value and provider records across
+    // restarts. The node does not open or close it. The mock node ignores it.
+    Store storage.KV
+    // MaxMessageSize caps published and received pubsub messages; zero
+    // selects DefaultMaxMessageSize.
+    MaxMessageSize int
+}
+
+// MessageLimit returns MaxMessageSize, or DefaultMaxMessageSize when it is zero.
+func (c Config) MessageLimit() int {
+	if c.MaxMessageSize > 0 {
+		return c.MaxMessageSize
+	}
+	return DefaultMaxMessageSize
 }
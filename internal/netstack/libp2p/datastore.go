@@ -0,0 +1,105 @@
+//go:build libp2p
+
+package libp2p
+
+import (
+	"context"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+
+	"github.com/grishinium-blockchain/grishinium-go/internal/storage"
+)
+
+// kvDatastore exposes a storage.KV as the datastore kad keeps its value and
+// provider records in, so that they survive a restart. Datastore keys are
+// stored as their string form. Empty values cannot be told apart from
+// missing ones; kad never writes them.
+type kvDatastore struct {
+	kv storage.KV
+}
+
+var _ ds.Batching = (*kvDatastore)(nil)
+
+func (d *kvDatastore) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	v, err := d.kv.Get(ctx, key.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, ds.ErrNotFound
+	}
+	return v, nil
+}
+
+func (d *kvDatastore) Has(ctx context.Context, key ds.Key) (bool, error) {
+	v, err := d.kv.Get(ctx, key.Bytes())
+	return v != nil, err
+}
+
+func (d *kvDatastore) GetSize(ctx context.Context, key ds.Key) (int, error) {
+	v, err := d.Get(ctx, key)
+	if err != nil {
+		return -1, err
+	}
+	return len(v), nil
+}
+
+func (d *kvDatastore) Put(ctx context.Context, key ds.Key, value []byte) error {
+	return d.kv.Put(ctx, key.Bytes(), value)
+}
+
+func (d *kvDatastore) Delete(ctx context.Context, key ds.Key) error {
+	return d.kv.Delete(ctx, key.Bytes())
+}
+
+// Query scans the keys under the query prefix and applies filters, orders
+// and limits in memory.
+func (d *kvDatastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	var prefix []byte
+	if q.Prefix != "" {
+		prefix = ds.NewKey(q.Prefix).Bytes()
+	}
+	it, err := d.kv.NewIterator(ctx, storage.IterOptions{Prefix: prefix})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var entries []dsq.Entry
+	for it.Next() {
+		e := dsq.Entry{Key: string(it.Key()), Size: len(it.Value())}
+		if !q.KeysOnly {
+			e.Value = append([]byte(nil), it.Value()...)
+		}
+		entries = append(entries, e)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return dsq.NaiveQueryApply(q, dsq.ResultsWithEntries(q, entries)), nil
+}
+
+func (d *kvDatastore) Sync(ctx context.Context, prefix ds.Key) error { return nil }
+
+func (d *kvDatastore) Close() error { return nil }
+
+func (d *kvDatastore) Batch(ctx context.Context) (ds.Batch, error) {
+	return &kvDatastoreBatch{b: d.kv.NewBatch()}, nil
+}
+
+type kvDatastoreBatch struct {
+	b storage.Batch
+}
+
+func (b *kvDatastoreBatch) Put(ctx context.Context, key ds.Key, value []byte) error {
+	return b.b.Put(key.Bytes(), value)
+}
+
+func (b *kvDatastoreBatch) Delete(ctx context.Context, key ds.Key) error {
+	return b.b.Delete(key.Bytes())
+}
+
+func (b *kvDatastoreBatch) Commit(ctx context.Context) error {
+	defer b.b.Close()
+	return b.b.Commit(ctx, storage.WriteOptions{})
+}
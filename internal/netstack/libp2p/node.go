@@ -4,14 +4,17 @@ package libp2p
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"encoding/hex"
-	"time"
+	"sync"
 
 	libp2p "github.com/libp2p/go-libp2p"
 	crypto "github.com/libp2p/go-libp2p/core/crypto"
 	host "github.com/libp2p/go-libp2p/core/host"
+	network "github.com/libp2p/go-libp2p/core/network"
 	peer "github.com/libp2p/go-libp2p/core/peer"
+	routing "github.com/libp2p/go-libp2p/core/routing"
 	kad "github.com/libp2p/go-libp2p-kad-dht"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	mdns "github.com/libp2p/go-libp2p/p2p/discovery/mdns"
@@ -19,15 +22,26 @@ import (
 	cid "github.com/ipfs/go-cid"
 	mh "github.com/multiformats/go-multihash"
 
+	grdht "github.com/grishinium-blockchain/grishinium-go/dht"
 	"github.com/grishinium-blockchain/grishinium-go/internal/netstack"
+	logger "github.com/grishinium-blockchain/grishinium-go/internal/log"
+	"github.com/grishinium-blockchain/grishinium-go/internal/metrics"
 )
 
+var log = logger.For(logger.Netstack)
+
 // Node is a libp2p-backed implementation of netstack.Node.
 type Node struct {
 	cfg    netstack.Config
 	Host   host.Host
 	DHT    *kad.IpfsDHT
 	PubSub *pubsub.PubSub
+
+	topics *topicRegistry
+
+	hmu        sync.Mutex
+	handlers   map[string]netstack.Handler   // by protocol name, see query.go
+	validators map[string]netstack.Validator // by topic
 }
 
 // PeerID returns the string representation of the local host ID.
@@ -38,7 +52,14 @@ func (n *Node) PeerID() string {
     return n.Host.ID().String()
 }
 
-func New(cfg netstack.Config) *Node { return &Node{cfg: cfg} }
+func New(cfg netstack.Config) *Node {
+	return &Node{
+		cfg:        cfg,
+		topics:     newTopicRegistry(),
+		handlers:   make(map[string]netstack.Handler),
+		validators: make(map[string]netstack.Validator),
+	}
+}
 
 func (n *Node) Start(ctx context.Context) error {
 	// Build listen addrs
@@ -66,10 +87,30 @@ func (n *Node) Start(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	n.hmu.Lock()
 	n.Host = h
+	for name, hd := range n.handlers {
+		n.installHandler(name, hd)
+	}
+	n.hmu.Unlock()
+	// Keep the peer gauge in step with connections.
+	countPeers := func(nw network.Network, _ network.Conn) { metrics.SetPeers(len(nw.Peers())) }
+	h.Network().Notify(&network.NotifyBundle{ConnectedF: countPeers, DisconnectedF: countPeers})
 
 	// Create DHT
-	dht, err := kad.New(ctx, h, kad.Mode(kad.ModeAuto))
+	dhtOpts := []kad.Option{
+		kad.Mode(kad.ModeAuto),
+		// Our own protocol prefix: kad only accepts the IPFS validators
+		// under the default /ipfs one.
+		kad.ProtocolPrefix("/" + dhtNamespace),
+		kad.NamespacedValidator(dhtNamespace, recordValidator{}),
+		// Records carry their own TTL, bounded by MaxRecordTTL.
+		kad.MaxRecordAge(grdht.MaxRecordTTL),
+	}
+	if n.cfg.Store != nil {
+		dhtOpts = append(dhtOpts, kad.Datastore(&kvDatastore{kv: n.cfg.Store}))
+	}
+	dht, err := kad.New(ctx, h, dhtOpts...)
 	if err != nil {
 		return err
 	}
@@ -80,16 +121,40 @@ func (n *Node) Start(ctx context.Context) error {
 	for _, b := range n.cfg.Bootstrap {
 		addr, err := ma.NewMultiaddr(b)
 		if err == nil {
-			_ = n.connectAddr(ctx, addr)
+			err = n.connectAddr(ctx, addr)
+		}
+		if err != nil {
+			log.Warn("bootstrap peer not connected", "addr", b, "err", err)
 		}
 	}
 
-	// PubSub
-	ps, err := pubsub.NewGossipSub(ctx, h)
+	// PubSub; larger messages are neither published nor accepted.
+	ps, err := pubsub.NewGossipSub(ctx, h, pubsub.WithMaxMessageSize(n.cfg.MessageLimit()))
 	if err != nil {
 		return err
 	}
+	n.hmu.Lock()
 	n.PubSub = ps
+	for topic, v := range n.validators {
+		n.installValidator(topic, v)
+	}
+	n.hmu.Unlock()
+	log.Info("libp2p node started", "peer", h.ID().String(), "addrs", h.Addrs())
+	return nil
+}
+
+// Connect dials the peer at addr, a multiaddr ending in /p2p/<id>.
+func (n *Node) Connect(ctx context.Context, addr string) error {
+	if n.Host == nil {
+		return fmt.Errorf("host not initialized")
+	}
+	m, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return fmt.Errorf("invalid peer addr %q: %w", addr, err)
+	}
+	if err := n.connectAddr(ctx, m); err != nil {
+		return fmt.Errorf("%w: %s: %v", netstack.ErrPeerNotFound, addr, err)
+	}
 	return nil
 }
 
@@ -102,6 +167,7 @@ func (n *Node) connectAddr(ctx context.Context, addr ma.Multiaddr) error {
 }
 
 func (n *Node) Close(ctx context.Context) error {
+	n.topics.close()
 	if n.DHT != nil {
 		_ = n.DHT.Close()
 	}
@@ -126,40 +192,41 @@ func (n *Node) Publish(ctx context.Context, topic string, data []byte) error {
 	if n.PubSub == nil {
 		return fmt.Errorf("pubsub not initialized")
 	}
-	t, err := n.PubSub.Join(topic)
+	t, err := n.topics.join(n.PubSub, topic)
 	if err != nil {
 		return err
 	}
-	defer t.Close()
-	return t.Publish(ctx, data)
+	if err := t.Publish(ctx, data); err != nil {
+		return err
+	}
+	metrics.PubsubMessage(topic, metrics.Sent, len(data))
+	return nil
 }
 
+// Subscribe opens a subscription on topic. Several subscriptions per topic may
+// be active at once; each receives every message. The channel is closed when
+// ctx is done or Unsubscribe is called for the topic.
 func (n *Node) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
 	if n.PubSub == nil {
 		return nil, fmt.Errorf("pubsub not initialized")
 	}
-	t, err := n.PubSub.Join(topic)
+	s, sctx, err := n.topics.subscribe(ctx, n.PubSub, topic)
 	if err != nil {
 		return nil, err
 	}
-	sub, err := t.Subscribe()
-	if err != nil {
-		_ = t.Close()
-		return nil, err
-	}
 	out := make(chan []byte)
 	go func() {
 		defer close(out)
-		defer sub.Cancel()
-		defer t.Close()
+		defer n.topics.release(topic, s)
 		for {
-			msg, err := sub.Next(ctx)
+			msg, err := s.sub.Next(sctx)
 			if err != nil {
 				return
 			}
+			metrics.PubsubMessage(topic, metrics.Received, len(msg.Data))
 			select {
 			case out <- append([]byte(nil), msg.Data...):
-			case <-ctx.Done():
+			case <-sctx.Done():
 				return
 			}
 		}
@@ -167,17 +234,83 @@ func (n *Node) Subscribe(ctx context.Context, topic string) (<-chan []byte, erro
 	return out, nil
 }
 
+// SetValidator sets the validator of messages on topic; a nil v removes it.
+// Gossipsub runs it before delivering or relaying a message, so refused
+// messages go no further than this node. Validators set before Start are
+// registered when pubsub starts.
+func (n *Node) SetValidator(topic string, v netstack.Validator) {
+	n.hmu.Lock()
+	defer n.hmu.Unlock()
+	if v == nil {
+		delete(n.validators, topic)
+	} else {
+		n.validators[topic] = v
+	}
+	if n.PubSub != nil {
+		n.installValidator(topic, v)
+	}
+}
+
+// installValidator registers v with pubsub; n.hmu must be held.
+func (n *Node) installValidator(topic string, v netstack.Validator) {
+	// Unregistering fails when there is nothing to replace.
+	_ = n.PubSub.UnregisterTopicValidator(topic)
+	if v == nil {
+		return
+	}
+	err := n.PubSub.RegisterTopicValidator(topic, func(ctx context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		switch err := v(from.String(), msg.Data); {
+		case err == nil:
+			return pubsub.ValidationAccept
+		case errors.Is(err, netstack.ErrIgnore):
+			return pubsub.ValidationIgnore
+		default:
+			return pubsub.ValidationReject
+		}
+	})
+	if err != nil {
+		log.Warn("topic validator not registered", "topic", topic, "err", err)
+	}
+}
+
+// Unsubscribe cancels all subscriptions on topic.
 func (n *Node) Unsubscribe(ctx context.Context, topic string) error {
-	// No-op: Subscribe manages its own lifecycle per call.
+	n.topics.unsubscribe(topic)
 	return nil
 }
 
-func (n *Node) FindPeer(ctx context.Context, id string) (string, error) {
-    if n.DHT == nil {
-        return "", fmt.Errorf("dht not initialized")
-    }
-    // Placeholder: a real implementation converts id to peer.ID and queries DHT.
-    return "libp2p://peer/" + id, nil
+// FindPeer resolves id through a Kad-DHT lookup and returns every known address
+// of the peer as a dialable multiaddr ending in /p2p/<id>.
+func (n *Node) FindPeer(ctx context.Context, id string) ([]string, error) {
+	if n.DHT == nil {
+		return nil, fmt.Errorf("dht not initialized")
+	}
+	pid, err := peer.Decode(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer id %q: %w", id, err)
+	}
+	info := peer.AddrInfo{ID: pid, Addrs: n.Host.Addrs()}
+	if pid != n.Host.ID() {
+		info, err = n.DHT.FindPeer(ctx, pid)
+		if err != nil {
+			if errors.Is(err, routing.ErrNotFound) {
+				return nil, fmt.Errorf("%w: %s", netstack.ErrPeerNotFound, id)
+			}
+			return nil, err
+		}
+	}
+	addrs, err := peer.AddrInfoToP2pAddrs(&info)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%w: %s has no known addresses", netstack.ErrPeerNotFound, id)
+	}
+	out := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		out = append(out, a.String())
+	}
+	return out, nil
 }
 
 // peerInfoFromAddr parses a multiaddr with /p2p/peerID into a PeerInfo.
@@ -195,18 +328,18 @@ func (n *Node) EnableMDNS(ctx context.Context) error {
     if n.Host == nil {
         return fmt.Errorf("host not initialized")
     }
-    service, err := mdns.NewMdnsService(ctx, n.Host, time.Second*10, "grishinium-mdns")
-    if err != nil {
-        return err
-    }
-    service.RegisterNotifee(mdnsNotifee{h: n.Host})
-    return nil
+    service := mdns.NewMdnsService(n.Host, "grishinium-mdns", mdnsNotifee{h: n.Host})
+    return service.Start()
 }
 
 type mdnsNotifee struct{ h host.Host }
 
 func (m mdnsNotifee) HandlePeerFound(pi peer.AddrInfo) {
-    _ = m.h.Connect(context.Background(), pi)
+    if err := m.h.Connect(context.Background(), pi); err != nil {
+        log.Debug("mdns peer not connected", "peer", pi.ID.String(), "err", err)
+        return
+    }
+    log.Debug("mdns peer connected", "peer", pi.ID.String())
 }
 
 // --- DHT helpers and methods ---
@@ -220,7 +353,7 @@ func keyToCid(key []byte) (cid.Cid, error) {
 }
 
 func keyToDHTPath(key []byte) string {
-    return "/grishinium/" + hex.EncodeToString(key)
+    return "/" + dhtNamespace + "/" + hex.EncodeToString(key)
 }
 
 // Provide announces this node as a provider for the given key via provider records.
@@ -244,28 +377,47 @@ func (n *Node) FindProviders(ctx context.Context, key []byte, limit int) ([]stri
     if err != nil {
         return nil, err
     }
-    out := make([]string, 0, limit)
+    // Every address ends in /p2p/<id>, as from FindPeer; limit counts
+    // providers, not addresses.
+    var out []string
+    providers := 0
     ch := n.DHT.FindProvidersAsync(ctx, c, limit)
     for info := range ch {
+        if len(info.Addrs) == 0 {
+            continue
+        }
         for _, a := range info.Addrs {
-            out = append(out, a.String())
+            out = append(out, a.String()+"/p2p/"+info.ID.String())
         }
-        if limit > 0 && len(out) >= limit {
+        if providers++; limit > 0 && providers >= limit {
             break
         }
     }
-    if limit > 0 && len(out) > limit {
-        out = out[:limit]
+    if out == nil {
+        out = []string{}
     }
     return out, nil
 }
 
-// PutValue stores small metadata value under a namespaced key in DHT.
+// PutValue stores a signed dht.Record under its namespaced key hash in DHT.
+// Records that do not verify are rejected before anything is sent. Overlay
+// member lists are merged with the stored list first, see dht.MergeValue.
 func (n *Node) PutValue(ctx context.Context, key, value []byte) error {
     if n.DHT == nil {
         return fmt.Errorf("dht not initialized")
     }
     k := keyToDHTPath(key)
+    rec, err := grdht.ValidateValue(key, value)
+    if err != nil {
+        return err
+    }
+    if rec.Rule == grdht.RuleOverlayNodes {
+        if old, err := n.DHT.GetValue(ctx, k); err == nil {
+            if merged, err := grdht.MergeValue(key, old, value); err == nil {
+                value = merged
+            }
+        }
+    }
     return n.DHT.PutValue(ctx, k, value)
 }
 
@@ -0,0 +1,220 @@
+//go:build libp2p
+
+package libp2p
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	network "github.com/libp2p/go-libp2p/core/network"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+	peerstore "github.com/libp2p/go-libp2p/core/peerstore"
+	protocol "github.com/libp2p/go-libp2p/core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+	msmux "github.com/multiformats/go-multistream"
+
+	"github.com/grishinium-blockchain/grishinium-go/internal/netstack"
+)
+
+// Query and Send open one stream per request on the protocol
+// /grishinium/<name>/1.0.0. The request is a frame (kind byte, uvarint
+// length, payload); queries are answered with a frame whose first byte is a
+// status and whose payload is the answer or the handler's error text.
+
+// queryTimeout bounds how long a handler may take to answer a remote request.
+const queryTimeout = time.Minute
+
+const (
+	frameQuery   byte = 0
+	frameMessage byte = 1
+
+	statusOK    byte = 0
+	statusError byte = 1
+)
+
+func protocolID(name string) protocol.ID { return protocol.ID("/grishinium/" + name + "/1.0.0") }
+
+// SetHandler registers h for requests on protocol; a nil h removes it.
+// Handlers set before Start are installed when the host starts.
+func (n *Node) SetHandler(name string, h netstack.Handler) {
+	n.hmu.Lock()
+	defer n.hmu.Unlock()
+	if h == nil {
+		delete(n.handlers, name)
+	} else {
+		n.handlers[name] = h
+	}
+	if n.Host != nil {
+		n.installHandler(name, h)
+	}
+}
+
+// installHandler sets the stream handler of name; n.hmu must be held.
+func (n *Node) installHandler(name string, h netstack.Handler) {
+	if h == nil {
+		n.Host.RemoveStreamHandler(protocolID(name))
+		return
+	}
+	n.Host.SetStreamHandler(protocolID(name), func(s network.Stream) { serveStream(s, h) })
+}
+
+func serveStream(s network.Stream, h netstack.Handler) {
+	defer s.Close()
+	_ = s.SetReadDeadline(time.Now().Add(queryTimeout))
+	kind, req, err := readFrame(bufio.NewReader(s))
+	if err != nil || (kind != frameQuery && kind != frameMessage) {
+		log.Debug("bad request", "peer", s.Conn().RemotePeer().String(), "protocol", string(s.Protocol()), "err", err)
+		_ = s.Reset()
+		return
+	}
+	from := s.Conn().RemoteMultiaddr().String() + "/p2p/" + s.Conn().RemotePeer().String()
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	resp, err := h(ctx, from, req)
+	if kind == frameMessage {
+		return
+	}
+	status := statusOK
+	if err != nil {
+		status, resp = statusError, []byte(err.Error())
+	} else if len(resp) > netstack.MaxQuerySize {
+		status, resp = statusError, []byte(netstack.ErrTooLarge.Error())
+	}
+	_ = s.SetWriteDeadline(time.Now().Add(queryTimeout))
+	if err := writeFrame(s, status, resp); err != nil {
+		_ = s.Reset()
+	}
+}
+
+// Query sends req to the peer at addr, a multiaddr ending in /p2p/<id> or a
+// bare peer ID, and waits for the answer.
+func (n *Node) Query(ctx context.Context, addr, name string, req []byte) ([]byte, error) {
+	s, err := n.request(ctx, addr, name, frameQuery, req)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	stop := context.AfterFunc(ctx, func() { _ = s.Reset() })
+	defer stop()
+	status, resp, err := readFrame(bufio.NewReader(s))
+	if err != nil {
+		_ = s.Reset()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if status != statusOK {
+		return nil, fmt.Errorf("%w: %s", netstack.ErrRemote, resp)
+	}
+	return resp, nil
+}
+
+// Send sends a one-way message to the peer at addr.
+func (n *Node) Send(ctx context.Context, addr, name string, msg []byte) error {
+	s, err := n.request(ctx, addr, name, frameMessage, msg)
+	if err != nil {
+		return err
+	}
+	return s.Close()
+}
+
+// request opens a stream to addr and writes one request frame.
+func (n *Node) request(ctx context.Context, addr, name string, kind byte, data []byte) (network.Stream, error) {
+	if n.Host == nil {
+		return nil, fmt.Errorf("host not initialized")
+	}
+	if len(data) > netstack.MaxQuerySize {
+		return nil, fmt.Errorf("%w: %d byte request", netstack.ErrTooLarge, len(data))
+	}
+	pid, err := n.resolve(addr)
+	if err != nil {
+		return nil, err
+	}
+	s, err := n.Host.NewStream(ctx, pid, protocolID(name))
+	if err != nil {
+		if errors.Is(err, msmux.ErrNotSupported[protocol.ID]{}) {
+			return nil, fmt.Errorf("%w: %s at %s", netstack.ErrNoHandler, name, addr)
+		}
+		return nil, fmt.Errorf("%w: %s: %v", netstack.ErrPeerNotFound, addr, err)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = s.Reset() })
+	defer stop()
+	if err := writeFrame(s, kind, data); err != nil {
+		_ = s.Reset()
+		return nil, err
+	}
+	if err := s.CloseWrite(); err != nil {
+		_ = s.Reset()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Disconnect closes every connection to the peer at addr, a multiaddr ending
+// in /p2p/<id> or a bare peer ID.
+func (n *Node) Disconnect(ctx context.Context, addr string) error {
+	if n.Host == nil {
+		return fmt.Errorf("host not initialized")
+	}
+	pid, err := n.resolve(addr)
+	if err != nil {
+		return err
+	}
+	return n.Host.Network().ClosePeer(pid)
+}
+
+// resolve returns the peer ID of addr and remembers its address, if any.
+func (n *Node) resolve(addr string) (peer.ID, error) {
+	if !strings.HasPrefix(addr, "/") {
+		pid, err := peer.Decode(addr)
+		if err != nil {
+			return "", fmt.Errorf("invalid peer id %q: %w", addr, err)
+		}
+		return pid, nil
+	}
+	m, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid peer addr %q: %w", addr, err)
+	}
+	pi, err := peerInfoFromAddr(m)
+	if err != nil {
+		return "", fmt.Errorf("invalid peer addr %q: %w", addr, err)
+	}
+	n.Host.Peerstore().AddAddrs(pi.ID, pi.Addrs, peerstore.TempAddrTTL)
+	return pi.ID, nil
+}
+
+func writeFrame(w io.Writer, kind byte, data []byte) error {
+	buf := make([]byte, 0, 1+binary.MaxVarintLen64+len(data))
+	buf = append(buf, kind)
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	buf = append(buf, data...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if size > netstack.MaxQuerySize {
+		return 0, nil, fmt.Errorf("%w: %d byte frame", netstack.ErrTooLarge, size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return kind, data, nil
+}
@@ -0,0 +1,78 @@
+//go:build libp2p
+
+package libp2p
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/grishinium-blockchain/grishinium-go/dht"
+)
+
+// dhtNamespace is the record namespace used by keyToDHTPath.
+const dhtNamespace = "grishinium"
+
+// recordValidator makes the Kademlia DHT accept only signed dht.Records stored
+// under their own key hash. It satisfies go-libp2p-record's Validator.
+type recordValidator struct{}
+
+func parseDHTPath(key string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(key, "/"+dhtNamespace+"/")
+	if !ok {
+		return nil, errors.New("libp2p: record key outside the grishinium namespace")
+	}
+	return hex.DecodeString(rest)
+}
+
+// Validate rejects malformed, forged and expired records.
+func (recordValidator) Validate(key string, value []byte) error {
+	k, err := parseDHTPath(key)
+	if err != nil {
+		return err
+	}
+	_, err = dht.ValidateValue(k, value)
+	return err
+}
+
+// Select keeps the record the DHT update rules prefer, see dht.MergeValue:
+// the owner's signed record over an anybody record, then the one that lives
+// longer. Select can only pick one of values, so overlay member lists are
+// merged by PutValue instead; of two lists that would merge, the longer wins.
+func (recordValidator) Select(key string, values [][]byte) (int, error) {
+	k, err := parseDHTPath(key)
+	if err != nil {
+		return 0, err
+	}
+	best := -1
+	for i, v := range values {
+		if _, err := dht.ValidateValue(k, v); err != nil {
+			continue
+		}
+		if best < 0 {
+			best = i
+			continue
+		}
+		kept, err := dht.MergeValue(k, values[best], v)
+		switch {
+		case err != nil, bytes.Equal(kept, values[best]):
+		case bytes.Equal(kept, v), memberCount(v) > memberCount(values[best]):
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0, errors.New("libp2p: no valid record")
+	}
+	return best, nil
+}
+
+// memberCount returns the number of members in an overlay nodes record.
+func memberCount(value []byte) int {
+	rec, err := dht.UnmarshalRecord(value)
+	if err != nil {
+		return 0
+	}
+	nodes, _ := rec.Nodes()
+	return len(nodes)
+}
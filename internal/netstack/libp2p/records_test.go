@@ -0,0 +1,59 @@
+//go:build libp2p
+
+package libp2p
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/dht"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+)
+
+func testIdentity(seed byte) keyring.Identity {
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+	return keyring.Identity{Private: priv, Public: priv.Public().(ed25519.PublicKey)}
+}
+
+func TestRecordValidatorSelect(t *testing.T) {
+	owner, a, b := testIdentity(1), testIdentity(2), testIdentity(3)
+	name := dht.KeyFor(owner.Public, "name", 0).Hash()
+	signed := dht.NewRecord(owner, "name", 0, []byte("signed"), time.Hour).MarshalTL()
+	later := dht.NewRecord(owner, "name", 0, []byte("later"), 2*time.Hour).MarshalTL()
+	anybody := dht.NewAnybodyRecord(owner, "name", 0, []byte("anybody"), 3*time.Hour).MarshalTL()
+
+	overlay := []byte("overlay")
+	oid := dht.OverlayID(overlay)
+	nodes := dht.RecordKey{ID: oid, Name: dht.OverlayNodesName}.Hash()
+	one := dht.NewOverlayNodesRecord(overlay, []*dht.OverlayNode{dht.NewOverlayNode(a.Private, oid, 1)}, time.Hour).MarshalTL()
+	two := dht.NewOverlayNodesRecord(overlay, []*dht.OverlayNode{
+		dht.NewOverlayNode(a.Private, oid, 1), dht.NewOverlayNode(b.Private, oid, 1),
+	}, time.Hour).MarshalTL()
+
+	tests := []struct {
+		name   string
+		key    [32]byte
+		values [][]byte
+		want   int
+	}{
+		{"later signed record", name, [][]byte{signed, later}, 1},
+		{"signed beats longer anybody", name, [][]byte{anybody, signed}, 1},
+		{"anybody never beats signed", name, [][]byte{signed, anybody}, 0},
+		{"invalid values skipped", name, [][]byte{[]byte("junk"), signed}, 1},
+		{"longer member list", nodes, [][]byte{one, two}, 1},
+		{"longer member list first", nodes, [][]byte{two, one}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := recordValidator{}.Select(keyToDHTPath(tt.key[:]), tt.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("Select = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+//go:build libp2p
+
+package libp2p
+
+import (
+	"context"
+	"sync"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// topicRegistry caches joined pubsub topics and tracks the local subscriptions
+// on each, so that publishing does not re-join a topic per message and
+// Unsubscribe can cancel every subscription of a topic.
+type topicRegistry struct {
+	mu     sync.Mutex
+	topics map[string]*topicState
+}
+
+type topicState struct {
+	topic *pubsub.Topic
+	subs  map[*subscription]struct{}
+}
+
+type subscription struct {
+	sub    *pubsub.Subscription
+	cancel context.CancelFunc
+}
+
+func newTopicRegistry() *topicRegistry {
+	return &topicRegistry{topics: make(map[string]*topicState)}
+}
+
+// join returns the cached handle for name, joining the topic on first use.
+func (r *topicRegistry) join(ps *pubsub.PubSub, name string) (*pubsub.Topic, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.joinLocked(ps, name)
+}
+
+func (r *topicRegistry) joinLocked(ps *pubsub.PubSub, name string) (*pubsub.Topic, error) {
+	if ts, ok := r.topics[name]; ok {
+		return ts.topic, nil
+	}
+	t, err := ps.Join(name)
+	if err != nil {
+		return nil, err
+	}
+	r.topics[name] = &topicState{topic: t, subs: make(map[*subscription]struct{})}
+	return t, nil
+}
+
+// subscribe opens a new subscription on name. The returned context is
+// cancelled by Unsubscribe, by closing the registry or when parent is done.
+func (r *topicRegistry) subscribe(parent context.Context, ps *pubsub.PubSub, name string) (*subscription, context.Context, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, err := r.joinLocked(ps, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	sub, err := t.Subscribe()
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithCancel(parent)
+	s := &subscription{sub: sub, cancel: cancel}
+	r.topics[name].subs[s] = struct{}{}
+	return s, ctx, nil
+}
+
+// release forgets a finished subscription.
+func (r *topicRegistry) release(name string, s *subscription) {
+	s.cancel()
+	s.sub.Cancel()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ts, ok := r.topics[name]; ok {
+		delete(ts.subs, s)
+	}
+}
+
+// unsubscribe cancels every subscription on name. The topic handle stays
+// cached for publishing.
+func (r *topicRegistry) unsubscribe(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ts, ok := r.topics[name]
+	if !ok {
+		return
+	}
+	for s := range ts.subs {
+		s.cancel()
+		s.sub.Cancel()
+		delete(ts.subs, s)
+	}
+}
+
+// close cancels all subscriptions and closes every topic handle.
+func (r *topicRegistry) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, ts := range r.topics {
+		for s := range ts.subs {
+			s.cancel()
+			s.sub.Cancel()
+		}
+		_ = ts.topic.Close()
+		delete(r.topics, name)
+	}
+}
@@ -0,0 +1,151 @@
+//go:build libp2p
+
+package libp2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+
+	"github.com/grishinium-blockchain/grishinium-go/internal/netstack"
+)
+
+func newTestPubSub(t *testing.T) *pubsub.PubSub {
+	t.Helper()
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close() })
+	ps, err := pubsub.NewGossipSub(context.Background(), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ps
+}
+
+func TestTopicRegistryReuse(t *testing.T) {
+	ps := newTestPubSub(t)
+	r := newTopicRegistry()
+	defer r.close()
+
+	first, err := r.join(ps, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pubsub refuses a second Join of the same topic, so publishing twice
+	// only works through the cached handle.
+	again, err := r.join(ps, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first {
+		t.Fatal("second join returned a new topic handle")
+	}
+	s, _, err := r.subscribe(context.Background(), ps, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.sub.Topic() != "a" || len(r.topics) != 1 {
+		t.Fatalf("subscribe joined anew: %d topics cached", len(r.topics))
+	}
+	if err := first.Publish(context.Background(), []byte("msg")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTopicRegistryUnsubscribe(t *testing.T) {
+	ps := newTestPubSub(t)
+	r := newTopicRegistry()
+	defer r.close()
+
+	subscribe := func(name string) context.Context {
+		t.Helper()
+		_, ctx, err := r.subscribe(context.Background(), ps, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ctx
+	}
+	a1, a2, b := subscribe("a"), subscribe("a"), subscribe("b")
+	topic := r.topics["a"].topic
+
+	r.unsubscribe("a")
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		cancelled bool
+	}{
+		{"first on a", a1, true},
+		{"second on a", a2, true},
+		{"other topic", b, false},
+	}
+	for _, tt := range tests {
+		if got := tt.ctx.Err() != nil; got != tt.cancelled {
+			t.Errorf("%s: cancelled = %v, want %v", tt.name, got, tt.cancelled)
+		}
+	}
+	if n := len(r.topics["a"].subs); n != 0 {
+		t.Errorf("%d subscriptions left on a", n)
+	}
+	if again, _ := r.join(ps, "a"); again != topic {
+		t.Error("unsubscribe dropped the cached topic handle")
+	}
+
+	r.close()
+	if b.Err() == nil {
+		t.Error("close left a subscription running")
+	}
+	if len(r.topics) != 0 {
+		t.Errorf("close left %d topics", len(r.topics))
+	}
+}
+
+func TestNodeUnsubscribeClosesSubscriptions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	n := New(netstack.Config{ListenAddrs: []string{"/ip4/127.0.0.1/tcp/0"}})
+	if err := n.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close(context.Background())
+
+	var chans []<-chan []byte
+	for range 2 {
+		ch, err := n.Subscribe(context.Background(), "overlay")
+		if err != nil {
+			t.Fatal(err)
+		}
+		chans = append(chans, ch)
+	}
+	if err := n.Unsubscribe(ctx, "overlay"); err != nil {
+		t.Fatal(err)
+	}
+	for i, ch := range chans {
+		select {
+		case _, ok := <-ch:
+			if ok {
+				t.Fatalf("subscription %d delivered a message after Unsubscribe", i)
+			}
+		case <-ctx.Done():
+			t.Fatalf("subscription %d not closed by Unsubscribe", i)
+		}
+	}
+	// The subscriptions are released once their goroutines see the cancellation.
+	deadline := time.Now().Add(time.Second)
+	for {
+		n.topics.mu.Lock()
+		left := len(n.topics.topics["overlay"].subs)
+		n.topics.mu.Unlock()
+		if left == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscriptions still registered", left)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,137 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/internal/netstack"
+)
+
+// Network is an in-process hub that connects mock Nodes. Pubsub messages, DHT
+// provider/value records and peer lookups travel between the started nodes of
+// one Network, subject to the configured latency, loss and partitions.
+type Network struct {
+	mu     sync.RWMutex
+	nodes  []*Node
+	byID   map[string]*Node
+	group  map[string]int // peer ID -> partition group; 0 when not partitioned
+	delay  time.Duration
+	jitter time.Duration
+	loss   float64
+}
+
+// NewNetwork creates an empty network.
+func NewNetwork() *Network {
+	return &Network{byID: make(map[string]*Node), group: make(map[string]int)}
+}
+
+// NewNode creates a node attached to the network. Every node gets a distinct
+// address (mock://node-N) and peer ID (mock-peer-N).
+func (nw *Network) NewNode(cfg netstack.Config) *Node {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	seq := len(nw.nodes) + 1
+	n := newNode(cfg, nw, fmt.Sprintf("mock://node-%d", seq), fmt.Sprintf("mock-peer-%d", seq))
+	nw.nodes = append(nw.nodes, n)
+	nw.byID[n.id] = n
+	return n
+}
+
+// SetLatency delays every message and DHT operation that crosses the network
+// by d plus a uniformly random extra in [0, jitter).
+func (nw *Network) SetLatency(d, jitter time.Duration) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.delay, nw.jitter = d, jitter
+}
+
+// SetLoss sets the probability in [0, 1] that a message or DHT request to a
+// remote node is dropped.
+func (nw *Network) SetLoss(p float64) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.loss = min(max(p, 0), 1)
+}
+
+// Partition splits the network: nodes listed in the same group (by peer ID)
+// reach each other, and nodes not listed at all form one more group.
+func (nw *Network) Partition(groups ...[]string) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.group = make(map[string]int)
+	for i, g := range groups {
+		for _, id := range g {
+			nw.group[id] = i + 1
+		}
+	}
+}
+
+// Heal removes all partitions.
+func (nw *Network) Heal() {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.group = make(map[string]int)
+}
+
+// peers returns the started nodes reachable from n, excluding n itself.
+func (nw *Network) peers(n *Node) []*Node {
+	nw.mu.RLock()
+	defer nw.mu.RUnlock()
+	g := nw.group[n.id]
+	out := make([]*Node, 0, len(nw.nodes))
+	for _, p := range nw.nodes {
+		if p != n && nw.group[p.id] == g && p.isAlive() {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// lookup returns the node with the given peer ID if it is reachable from n.
+func (nw *Network) lookup(n *Node, id string) *Node {
+	nw.mu.RLock()
+	defer nw.mu.RUnlock()
+	p, ok := nw.byID[id]
+	if !ok || p == n || nw.group[p.id] != nw.group[n.id] || !p.isAlive() {
+		return nil
+	}
+	return p
+}
+
+// dropped reports whether a single remote delivery is lost.
+func (nw *Network) dropped() bool {
+	nw.mu.RLock()
+	loss := nw.loss
+	nw.mu.RUnlock()
+	return loss > 0 && rand.Float64() < loss
+}
+
+// latency returns the delay for one remote delivery.
+func (nw *Network) latency() time.Duration {
+	nw.mu.RLock()
+	defer nw.mu.RUnlock()
+	d := nw.delay
+	if nw.jitter > 0 {
+		d += rand.N(nw.jitter)
+	}
+	return d
+}
+
+// wait simulates one network round trip for DHT operations.
+func (nw *Network) wait(ctx context.Context) error {
+	d := nw.latency()
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
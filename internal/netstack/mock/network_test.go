@@ -0,0 +1,207 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/dht"
+	"github.com/grishinium-blockchain/grishinium-go/internal/netstack"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+)
+
+// startNodes starts n nodes on nw, each subscribed to topic.
+func startNodes(t *testing.T, nw *Network, n int, topic string) ([]*Node, []<-chan []byte) {
+	t.Helper()
+	ctx := context.Background()
+	nodes := make([]*Node, n)
+	subs := make([]<-chan []byte, n)
+	for i := range nodes {
+		nodes[i] = nw.NewNode(netstack.Config{})
+		if err := nodes[i].Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = nodes[i].Close(ctx) })
+		sub, err := nodes[i].Subscribe(ctx, topic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs[i] = sub
+	}
+	return nodes, subs
+}
+
+// received reports whether sub delivers want within wait.
+func received(sub <-chan []byte, want []byte, wait time.Duration) bool {
+	select {
+	case got := <-sub:
+		return bytes.Equal(got, want)
+	case <-time.After(wait):
+		return false
+	}
+}
+
+func TestNetworkPartition(t *testing.T) {
+	ctx := context.Background()
+	nw := NewNetwork()
+	nodes, subs := startNodes(t, nw, 4, "topic")
+	// 0 and 1 in one group, 2 alone, 3 unlisted: three groups.
+	nw.Partition([]string{nodes[0].PeerID(), nodes[1].PeerID()}, []string{nodes[2].PeerID()})
+
+	split := [4][4]bool{
+		{true, true, false, false},
+		{true, true, false, false},
+		{false, false, true, false},
+		{false, false, false, true},
+	}
+	var healed [4][4]bool
+	for i := range healed {
+		for j := range healed[i] {
+			healed[i][j] = true
+		}
+	}
+	tests := []struct {
+		name  string
+		reach [4][4]bool
+		heal  bool
+	}{
+		{"split", split, false},
+		{"healed", healed, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.heal {
+				nw.Heal()
+			}
+			for i, from := range nodes {
+				msg := []byte(tt.name + string(rune('0'+i)))
+				if err := from.Publish(ctx, "topic", msg); err != nil {
+					t.Fatal(err)
+				}
+				for j, to := range nodes {
+					want := tt.reach[i][j]
+					wait := time.Second
+					if !want {
+						wait = 50 * time.Millisecond
+					}
+					if got := received(subs[j], msg, wait); got != want {
+						t.Errorf("message %d -> %d delivered = %v, want %v", i, j, got, want)
+					}
+					if i == j {
+						continue
+					}
+					_, err := from.FindPeer(ctx, to.PeerID())
+					if got := err == nil; got != want {
+						t.Errorf("FindPeer %d -> %d: %v", i, j, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNetworkLoss(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		loss      float64
+		delivered bool
+	}{
+		{"no loss", 0, true},
+		{"total loss", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nw := NewNetwork()
+			nodes, subs := startNodes(t, nw, 3, "topic")
+			nw.SetLoss(tt.loss)
+
+			msg := []byte("msg")
+			if err := nodes[0].Publish(ctx, "topic", msg); err != nil {
+				t.Fatal(err)
+			}
+			if !received(subs[0], msg, time.Second) {
+				t.Error("own subscriber missed the message")
+			}
+			for i := 1; i < len(nodes); i++ {
+				wait := time.Second
+				if !tt.delivered {
+					wait = 50 * time.Millisecond
+				}
+				if got := received(subs[i], msg, wait); got != tt.delivered {
+					t.Errorf("node %d received = %v, want %v", i, got, tt.delivered)
+				}
+			}
+
+			key := []byte("key")
+			if err := nodes[0].Provide(ctx, key); err != nil {
+				t.Fatal(err)
+			}
+			got, err := nodes[1].FindProviders(ctx, key, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found := slices.Contains(got, nodes[0].Addr()); found != tt.delivered {
+				t.Errorf("provider found = %v, want %v", found, tt.delivered)
+			}
+			_, err = nodes[1].FindPeer(ctx, nodes[2].PeerID())
+			if found := err == nil; found != tt.delivered {
+				t.Errorf("FindPeer: %v", err)
+			}
+		})
+	}
+}
+
+func TestNetworkDHT(t *testing.T) {
+	ctx := context.Background()
+	nw := NewNetwork()
+	nodes, _ := startNodes(t, nw, 3, "topic")
+	owner, _ := keyring.LoadIdentity("")
+	rec := dht.NewRecord(owner, "name", 0, []byte("value"), time.Hour).MarshalTL()
+	hash := dht.KeyFor(owner.Public, "name", 0).Hash()
+	forged := dht.NewRecord(owner, "name", 0, []byte("value"), time.Hour).MarshalTL()
+	forged[len(forged)-8] ^= 1 // in the signature
+	forgedHash := dht.KeyFor(owner.Public, "forged", 0).Hash()
+
+	if err := nodes[0].Provide(ctx, []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes[0].PutValue(ctx, hash[:], rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes[0].PutValue(ctx, forgedHash[:], forged); err == nil {
+		t.Fatal("forged record stored")
+	}
+
+	for _, from := range nodes[1:] {
+		t.Run(from.PeerID(), func(t *testing.T) {
+			providers, err := from.FindProviders(ctx, []byte("key"), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(providers, []string{nodes[0].Addr()}) {
+				t.Errorf("FindProviders = %v, want [%s]", providers, nodes[0].Addr())
+			}
+			got, err := from.GetValue(ctx, hash[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, rec) {
+				t.Errorf("GetValue returned %d bytes, want the stored record", len(got))
+			}
+			if got, _ := from.GetValue(ctx, forgedHash[:]); got != nil {
+				t.Error("GetValue returned a forged record")
+			}
+			addrs, err := from.FindPeer(ctx, nodes[0].PeerID())
+			if err != nil || !slices.Equal(addrs, []string{nodes[0].Addr()}) {
+				t.Errorf("FindPeer = %v, %v", addrs, err)
+			}
+			if _, err := from.FindPeer(ctx, "unknown"); !errors.Is(err, netstack.ErrPeerNotFound) {
+				t.Errorf("FindPeer of an unknown peer = %v, want ErrPeerNotFound", err)
+			}
+		})
+	}
+}
@@ -3,89 +3,283 @@ package mock
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/grishinium-blockchain/grishinium-go/dht"
+	logger "github.com/grishinium-blockchain/grishinium-go/internal/log"
+	"github.com/grishinium-blockchain/grishinium-go/internal/metrics"
 	"github.com/grishinium-blockchain/grishinium-go/internal/netstack"
 )
 
+var log = logger.For(logger.Netstack)
+
 // Node is a simple in-memory implementation of netstack.Node for bootstrap/testing.
+// Nodes created by New are isolated; nodes created by Network.NewNode talk to
+// the other started nodes of the same Network.
+// DHT values and provider records live in memory only: Config.Store is
+// ignored.
 type Node struct {
 	cfg   netstack.Config
+	net   *Network
 	mu    sync.RWMutex
 	alive bool
 	addr  string
-	subs  map[string]chan []byte
-	// dht-like state
-	providers map[string][]string   // key -> list of provider addresses
-	values    map[string][]byte     // key -> value
+	id    string
+	subs  map[string]map[*subscription]struct{}
+	// handlers answer Query and Send, by protocol
+	handlers map[string]netstack.Handler
+	// validators check received pubsub messages, by topic
+	validators map[string]netstack.Validator
+	// dht-like state; entries are dropped once they expire
+	providers map[string]map[string]time.Time // key -> provider address -> expiry
+	values    map[string]storedValue          // key -> record
+}
+
+// providerTTL is how long a provider announcement is kept, as kad keeps
+// provider records for a limited time; providers are expected to announce
+// themselves again before it runs out.
+const providerTTL = 24 * time.Hour
+
+// storedValue is a verified dht.Record and its expiry time.
+type storedValue struct {
+	data    []byte
+	expires time.Time
 }
 
 // EnableMDNS is a no-op in the mock implementation.
 func (n *Node) EnableMDNS(ctx context.Context) error { return nil }
 
-// Provide announces this node as a provider for the given key.
+// Provide announces this node as a provider for the given key on every
+// reachable node.
 func (n *Node) Provide(ctx context.Context, key []byte) error {
-    n.mu.Lock()
-    defer n.mu.Unlock()
-    k := string(key)
-    list := n.providers[k]
-    // avoid duplicates
-    for _, a := range list {
-        if a == n.addr {
-            return nil
-        }
-    }
-    n.providers[k] = append(list, n.addr)
-    return nil
-}
-
-// FindProviders returns up to limit providers for the given key.
+	n.addProvider(key, n.addr)
+	peers := n.net.peers(n)
+	if len(peers) == 0 {
+		return nil
+	}
+	if err := n.net.wait(ctx); err != nil {
+		return err
+	}
+	for _, p := range peers {
+		if !n.net.dropped() {
+			p.addProvider(key, n.addr)
+		}
+	}
+	return nil
+}
+
+func (n *Node) addProvider(key []byte, addr string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	now := time.Now()
+	n.expireLocked(now)
+	k := string(key)
+	set, ok := n.providers[k]
+	if !ok {
+		set = make(map[string]time.Time)
+		n.providers[k] = set
+	}
+	set[addr] = now.Add(providerTTL)
+}
+
+// localProviders returns the unexpired providers of key, oldest
+// announcement first.
+func (n *Node) localProviders(key []byte) []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	now := time.Now()
+	set := n.providers[string(key)]
+	out := make([]string, 0, len(set))
+	for a, exp := range set {
+		if exp.After(now) {
+			out = append(out, a)
+		}
+	}
+	slices.SortFunc(out, func(a, b string) int {
+		if c := set[a].Compare(set[b]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	return out
+}
+
+// expireLocked drops expired values and provider announcements.
+func (n *Node) expireLocked(now time.Time) {
+	for k, set := range n.providers {
+		for a, exp := range set {
+			if !exp.After(now) {
+				delete(set, a)
+			}
+		}
+		if len(set) == 0 {
+			delete(n.providers, k)
+		}
+	}
+	for k, v := range n.values {
+		if !v.expires.After(now) {
+			delete(n.values, k)
+		}
+	}
+}
+
+// FindProviders returns up to limit providers for the given key, merging the
+// records held by this node and every reachable node.
 func (n *Node) FindProviders(ctx context.Context, key []byte, limit int) ([]string, error) {
-    n.mu.RLock()
-    defer n.mu.RUnlock()
-    list := n.providers[string(key)]
-    if limit <= 0 || limit > len(list) {
-        limit = len(list)
-    }
-    out := make([]string, 0, limit)
-    for i := 0; i < limit; i++ {
-        out = append(out, list[i])
-    }
-    return out, nil
-}
-
-// PutValue stores a small value for the given key.
+	seen := make(map[string]bool)
+	var out []string
+	collect := func(list []string) bool {
+		for _, a := range list {
+			if !seen[a] {
+				seen[a] = true
+				out = append(out, a)
+			}
+			if limit > 0 && len(out) >= limit {
+				return true
+			}
+		}
+		return false
+	}
+	if collect(n.localProviders(key)) {
+		return out, nil
+	}
+	peers := n.net.peers(n)
+	if len(peers) > 0 {
+		if err := n.net.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range peers {
+		if n.net.dropped() {
+			continue
+		}
+		if collect(p.localProviders(key)) {
+			break
+		}
+	}
+	if out == nil {
+		out = []string{}
+	}
+	return out, nil
+}
+
+// PutValue stores a signed dht.Record for the given key hash on this node and
+// every reachable node. Each node applies the record's update rule against
+// the value it already holds; forged records are rejected.
 func (n *Node) PutValue(ctx context.Context, key, value []byte) error {
-    n.mu.Lock()
-    defer n.mu.Unlock()
-    n.values[string(key)] = append([]byte(nil), value...)
-    return nil
+	if err := n.storeValue(key, value); err != nil {
+		return err
+	}
+	peers := n.net.peers(n)
+	if len(peers) == 0 {
+		return nil
+	}
+	if err := n.net.wait(ctx); err != nil {
+		return err
+	}
+	for _, p := range peers {
+		if !n.net.dropped() {
+			_ = p.storeValue(key, value)
+		}
+	}
+	return nil
+}
+
+func (n *Node) storeValue(key, value []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.expireLocked(time.Now())
+	v, err := dht.MergeValue(key, n.values[string(key)].data, value)
+	if err != nil {
+		return err
+	}
+	rec, err := dht.UnmarshalRecord(v)
+	if err != nil {
+		return err
+	}
+	n.values[string(key)] = storedValue{data: append([]byte(nil), v...), expires: rec.Expires()}
+	return nil
+}
+
+// localValue returns the record held under key unless it has expired.
+func (n *Node) localValue(key []byte) ([]byte, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	v, ok := n.values[string(key)]
+	if !ok {
+		return nil, false
+	}
+	if !v.expires.After(time.Now()) {
+		delete(n.values, string(key))
+		return nil, false
+	}
+	return append([]byte(nil), v.data...), true
 }
 
-// GetValue retrieves a previously stored value for the key.
+// GetValue retrieves a previously stored record for the key hash, asking
+// reachable nodes when it is not held locally.
 func (n *Node) GetValue(ctx context.Context, key []byte) ([]byte, error) {
-    n.mu.RLock()
-    defer n.mu.RUnlock()
-    v, ok := n.values[string(key)]
-    if !ok {
-        return nil, nil
-    }
-    out := make([]byte, len(v))
-    copy(out, v)
-    return out, nil
+	if v, ok := n.localValue(key); ok {
+		return v, nil
+	}
+	peers := n.net.peers(n)
+	if len(peers) == 0 {
+		return nil, nil
+	}
+	if err := n.net.wait(ctx); err != nil {
+		return nil, err
+	}
+	for _, p := range peers {
+		if n.net.dropped() {
+			continue
+		}
+		if v, ok := p.localValue(key); ok {
+			return v, nil
+		}
+	}
+	return nil, nil
 }
 
+// New creates an isolated node with a fixed address and peer ID.
 func New(cfg netstack.Config) *Node {
-	return &Node{cfg: cfg, addr: "mock://local", subs: make(map[string]chan []byte), providers: make(map[string][]string), values: make(map[string][]byte)}
+	return newNode(cfg, NewNetwork(), "mock://local", "mock-peer")
+}
+
+func newNode(cfg netstack.Config, nw *Network, addr, id string) *Node {
+	return &Node{
+		cfg:        cfg,
+		net:        nw,
+		addr:       addr,
+		id:         id,
+		subs:       make(map[string]map[*subscription]struct{}),
+		handlers:   make(map[string]netstack.Handler),
+		validators: make(map[string]netstack.Validator),
+		providers:  make(map[string]map[string]time.Time),
+		values:     make(map[string]storedValue),
+	}
+}
+
+func (n *Node) isAlive() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.alive
 }
 
 func (n *Node) Start(ctx context.Context) error {
 	n.mu.Lock()
-	defer n.mu.Unlock()
 	if n.alive {
+		n.mu.Unlock()
 		return nil
 	}
 	n.alive = true
+	n.mu.Unlock()
+	log.Debug("mock node started", "addr", n.addr, "peer", n.id)
+	// peers locks the other nodes, so it runs without n.mu held.
+	metrics.SetPeers(len(n.net.peers(n)))
 	return nil
 }
 
@@ -95,59 +289,137 @@ func (n *Node) Close(ctx context.Context) error {
 	if !n.alive {
 		return nil
 	}
-	for topic, ch := range n.subs {
-		close(ch)
+	for topic, set := range n.subs {
+		for s := range set {
+			s.stop()
+		}
 		delete(n.subs, topic)
 	}
 	n.alive = false
+	metrics.SetPeers(0)
 	return nil
 }
 
 // Addr returns a mock address string.
 func (n *Node) Addr() string { return n.addr }
 
-// PeerID returns a fixed mock peer ID.
-func (n *Node) PeerID() string { return "mock-peer" }
+// PeerID returns the mock peer ID.
+func (n *Node) PeerID() string { return n.id }
+
+// subscription is one Subscribe call; several may exist per topic.
+type subscription struct {
+	ch   chan []byte
+	done chan struct{}
+	once sync.Once
+}
 
+func (s *subscription) stop() { s.once.Do(func() { close(s.done) }) }
 
+// Publish delivers data to the node's own subscribers and to the subscribers
+// of every reachable node. Remote deliveries are subject to network loss and
+// latency; delayed deliveries happen asynchronously. Messages that this
+// node's validator refuses are not sent; those refused by a remote validator
+// are dropped silently.
 func (n *Node) Publish(ctx context.Context, topic string, data []byte) error {
+	if limit := n.cfg.MessageLimit(); len(data) > limit {
+		return fmt.Errorf("%w: %d byte message, limit %d", netstack.ErrTooLarge, len(data), limit)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := n.deliver(n.addr, topic, data); err != nil {
+		return err
+	}
+	for _, p := range n.net.peers(n) {
+		if n.net.dropped() {
+			continue
+		}
+		if d := n.net.latency(); d > 0 {
+			msg := append([]byte(nil), data...)
+			time.AfterFunc(d, func() { _ = p.deliver(n.addr, topic, msg) })
+			continue
+		}
+		_ = p.deliver(n.addr, topic, data)
+	}
+	metrics.PubsubMessage(topic, metrics.Sent, len(data))
+	return nil
+}
+
+// deliver validates data, received from the node at from, and hands it to
+// every local subscription of topic. Subscriptions that fell behind miss
+// the message rather than blocking the sender.
+func (n *Node) deliver(from, topic string, data []byte) error {
+	if limit := n.cfg.MessageLimit(); len(data) > limit {
+		return fmt.Errorf("%w: %d byte message, limit %d", netstack.ErrTooLarge, len(data), limit)
+	}
 	n.mu.RLock()
-	ch, ok := n.subs[topic]
+	v := n.validators[topic]
+	subs := make([]*subscription, 0, len(n.subs[topic]))
+	for s := range n.subs[topic] {
+		subs = append(subs, s)
+	}
 	n.mu.RUnlock()
-	if !ok {
-		return errors.New("no subscribers")
+	if v != nil {
+		if err := v(from, data); err != nil {
+			return err
+		}
 	}
-	select {
-	case ch <- append([]byte(nil), data...):
-		return nil
-	case <-ctx.Done():
-		return ctx.Err()
+	for _, s := range subs {
+		select {
+		case s.ch <- append([]byte(nil), data...):
+		case <-s.done:
+		default:
+			metrics.PubsubDropped(topic)
+			log.Debug("subscriber too slow; message dropped", "topic", topic)
+		}
 	}
+	return nil
 }
 
-func (n *Node) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+// SetValidator sets the validator of messages received on topic; a nil v
+// removes it.
+func (n *Node) SetValidator(topic string, v netstack.Validator) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
-	if _, ok := n.subs[topic]; ok {
-		return nil, errors.New("already subscribed")
+	if v == nil {
+		delete(n.validators, topic)
+		return
+	}
+	n.validators[topic] = v
+}
+
+// Subscribe opens a subscription on topic. Several subscriptions per topic may
+// be active at once; each receives every message. The channel is closed when
+// ctx is done or Unsubscribe is called for the topic.
+func (n *Node) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	s := &subscription{ch: make(chan []byte, 1024), done: make(chan struct{})}
+	n.mu.Lock()
+	set, ok := n.subs[topic]
+	if !ok {
+		set = make(map[*subscription]struct{})
+		n.subs[topic] = set
 	}
-	ch := make(chan []byte, 1024)
-	n.subs[topic] = ch
+	set[s] = struct{}{}
+	n.mu.Unlock()
+
 	out := make(chan []byte)
 	go func() {
 		defer close(out)
+		defer n.release(topic, s)
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case msg, ok := <-ch:
-				if !ok {
-					return
-				}
+			case <-s.done:
+				return
+			case msg := <-s.ch:
 				select {
 				case out <- msg:
+					metrics.PubsubMessage(topic, metrics.Received, len(msg))
 				case <-ctx.Done():
 					return
+				case <-s.done:
+					return
 				}
 			}
 		}
@@ -155,18 +427,58 @@ func (n *Node) Subscribe(ctx context.Context, topic string) (<-chan []byte, erro
 	return out, nil
 }
 
+func (n *Node) release(topic string, s *subscription) {
+	s.stop()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if set, ok := n.subs[topic]; ok {
+		delete(set, s)
+		if len(set) == 0 {
+			delete(n.subs, topic)
+		}
+	}
+}
+
+// Unsubscribe cancels all subscriptions on topic.
 func (n *Node) Unsubscribe(ctx context.Context, topic string) error {
 	n.mu.Lock()
 	defer n.mu.Unlock()
-	ch, ok := n.subs[topic]
-	if !ok {
-		return nil
+	for s := range n.subs[topic] {
+		s.stop()
 	}
-	close(ch)
 	delete(n.subs, topic)
 	return nil
 }
 
-func (n *Node) FindPeer(ctx context.Context, id string) (string, error) {
-	return "mock://peer/" + id, nil
+// Connect succeeds when a reachable node of the same network has addr; mock
+// nodes need no connection setup. A trailing /p2p/<id> is ignored.
+func (n *Node) Connect(ctx context.Context, addr string) error {
+	addr, _, _ = strings.Cut(addr, "/p2p/")
+	if err := n.net.wait(ctx); err != nil {
+		return err
+	}
+	for _, p := range n.net.peers(n) {
+		if p.addr == addr {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", netstack.ErrPeerNotFound, addr)
+}
+
+// FindPeer resolves the node itself and any reachable node of the same
+// network; other IDs are reported as not found, as a failed DHT lookup would.
+func (n *Node) FindPeer(ctx context.Context, id string) ([]string, error) {
+	if id == "" {
+		return nil, errors.New("empty peer id")
+	}
+	if id == n.id {
+		return []string{n.addr}, nil
+	}
+	if err := n.net.wait(ctx); err != nil {
+		return nil, err
+	}
+	if p := n.net.lookup(n, id); p != nil && !n.net.dropped() {
+		return []string{p.addr}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", netstack.ErrPeerNotFound, id)
 }
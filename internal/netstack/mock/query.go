@@ -0,0 +1,95 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/grishinium-blockchain/grishinium-go/internal/netstack"
+)
+
+// SetHandler registers h for requests on protocol; a nil h removes it.
+func (n *Node) SetHandler(protocol string, h netstack.Handler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if h == nil {
+		delete(n.handlers, protocol)
+		return
+	}
+	n.handlers[protocol] = h
+}
+
+func (n *Node) handler(protocol string) netstack.Handler {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.handlers[protocol]
+}
+
+// Query calls the handler of the reachable node at addr (or with peer ID
+// addr) and returns its answer. The request and the answer each cross the
+// network once, with its latency and loss.
+func (n *Node) Query(ctx context.Context, addr, protocol string, req []byte) ([]byte, error) {
+	h, err := n.remoteHandler(ctx, addr, protocol, req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h(ctx, n.addr, append([]byte(nil), req...))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", netstack.ErrRemote, err)
+	}
+	if len(resp) > netstack.MaxQuerySize {
+		return nil, fmt.Errorf("%w: %d byte answer", netstack.ErrTooLarge, len(resp))
+	}
+	if err := n.net.wait(ctx); err != nil {
+		return nil, err
+	}
+	if n.net.dropped() {
+		return nil, fmt.Errorf("mock: answer from %s lost", addr)
+	}
+	return append([]byte(nil), resp...), nil
+}
+
+// Send hands msg to the handler of the node at addr, which runs it in the
+// background as if the message had been received over the network.
+func (n *Node) Send(ctx context.Context, addr, protocol string, msg []byte) error {
+	h, err := n.remoteHandler(ctx, addr, protocol, msg)
+	if err != nil {
+		return err
+	}
+	msg = append([]byte(nil), msg...)
+	go func() { _, _ = h(context.WithoutCancel(ctx), n.addr, msg) }()
+	return nil
+}
+
+// remoteHandler delivers a request of len(req) bytes to the node at addr
+// and returns its handler for protocol.
+func (n *Node) remoteHandler(ctx context.Context, addr, protocol string, req []byte) (netstack.Handler, error) {
+	if len(req) > netstack.MaxQuerySize {
+		return nil, fmt.Errorf("%w: %d byte request", netstack.ErrTooLarge, len(req))
+	}
+	target, _, _ := strings.Cut(addr, "/p2p/")
+	if err := n.net.wait(ctx); err != nil {
+		return nil, err
+	}
+	var p *Node
+	for _, q := range n.net.peers(n) {
+		if q.addr == target || q.id == target {
+			p = q
+			break
+		}
+	}
+	if p == nil {
+		return nil, fmt.Errorf("%w: %s", netstack.ErrPeerNotFound, addr)
+	}
+	if n.net.dropped() {
+		return nil, fmt.Errorf("mock: request to %s lost", addr)
+	}
+	h := p.handler(protocol)
+	if h == nil {
+		return nil, fmt.Errorf("%w: %s at %s", netstack.ErrNoHandler, protocol, addr)
+	}
+	return h, nil
+}
+
+// Disconnect is a no-op: mock nodes keep no connections.
+func (n *Node) Disconnect(ctx context.Context, addr string) error { return nil }
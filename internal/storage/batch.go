@@ -0,0 +1,32 @@
+package storage
+
+import "context"
+
+// WriteOptions controls how a write is committed.
+type WriteOptions struct {
+	// Sync makes the write durable before Commit returns. Without it a crash
+	// may lose recently committed writes, but never applies part of a batch.
+	Sync bool
+}
+
+// Batch collects writes that are applied atomically by Commit: after a crash
+// either all of them are visible or none. Put and Delete copy their arguments.
+// A batch must not be used after Commit or Close.
+type Batch interface {
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	// Len returns the number of queued operations.
+	Len() int
+	Commit(ctx context.Context, opts WriteOptions) error
+	// Close discards the batch. It is safe to call after Commit.
+	Close() error
+}
+
+// Snapshot is a read-only, point-in-time view of a KV. Writes made after the
+// snapshot was taken are not visible through it. Snapshots hold resources
+// until closed.
+type Snapshot interface {
+	Get(ctx context.Context, key []byte) ([]byte, error)
+	NewIterator(ctx context.Context, opts IterOptions) (Iterator, error)
+	Close() error
+}
@@ -0,0 +1,57 @@
+package storage
+
+import "bytes"
+
+// IterOptions selects the range of an iteration. LowerBound is inclusive and
+// UpperBound exclusive; nil means unbounded. Prefix further restricts the range
+// to keys starting with it.
+type IterOptions struct {
+	Prefix     []byte
+	LowerBound []byte
+	UpperBound []byte
+	Reverse    bool
+}
+
+// Iterator walks an ordered key range. Call Next before reading the first
+// entry. Key and Value are only valid until the next call to Next or Seek and
+// must not be modified.
+type Iterator interface {
+	// Next advances to the next entry and reports whether one exists.
+	Next() bool
+	// Seek repositions the iterator so that the following Next returns the
+	// first key >= key (the last key <= key when iterating in reverse).
+	Seek(key []byte)
+	Key() []byte
+	Value() []byte
+	Err() error
+	Close() error
+}
+
+// Bounds folds Prefix into LowerBound/UpperBound and returns the effective
+// [lower, upper) range.
+func (o IterOptions) Bounds() (lower, upper []byte) {
+	lower, upper = o.LowerBound, o.UpperBound
+	if len(o.Prefix) == 0 {
+		return lower, upper
+	}
+	if lower == nil || bytes.Compare(o.Prefix, lower) > 0 {
+		lower = o.Prefix
+	}
+	if end := PrefixEnd(o.Prefix); end != nil && (upper == nil || bytes.Compare(end, upper) < 0) {
+		upper = end
+	}
+	return lower, upper
+}
+
+// PrefixEnd returns the smallest key greater than every key with the given
+// prefix, or nil when no such key exists (the prefix is all 0xff).
+func PrefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
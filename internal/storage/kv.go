@@ -1,6 +1,16 @@
 package storage
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrReadOnly is returned by writes to a store opened with Config.ReadOnly.
+	ErrReadOnly = errors.New("storage: store is read-only")
+	// ErrLocked is returned by Open when another process holds the store.
+	ErrLocked = errors.New("storage: store is locked by another process")
+)
 
 // KV is a minimal key-value storage interface suitable for validator state.
 type KV interface {
@@ -9,10 +19,25 @@ type KV interface {
 	Get(ctx context.Context, key []byte) ([]byte, error)
 	Put(ctx context.Context, key, value []byte) error
 	Delete(ctx context.Context, key []byte) error
+
+	// NewIterator returns an iterator over the keys selected by opts, in
+	// ascending key order (descending when opts.Reverse is set).
+	NewIterator(ctx context.Context, opts IterOptions) (Iterator, error)
+
+	// NewBatch returns an empty write batch.
+	NewBatch() Batch
+	// NewSnapshot captures the current state of the store.
+	NewSnapshot(ctx context.Context) (Snapshot, error)
 }
 
 // Config describes storage configuration.
 type Config struct {
 	Path string
+	// ReadOnly rejects every write with ErrReadOnly. Pebble additionally
+	// opens the database read-only, so it can be inspected while the owning
+	// process is stopped.
 	ReadOnly bool
+	// Sync makes every Put and Delete durable before it returns. Batches
+	// choose per commit through WriteOptions.
+	Sync bool
 }
@@ -0,0 +1,113 @@
+package mem
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/grishinium-blockchain/grishinium-go/internal/storage"
+)
+
+var iterKeys = []string{"a", "ab", "abc", "b", "ba", "c", "\xff", "\xff\xff"}
+
+// newStore returns an in-memory store holding iterKeys.
+func newStore(t *testing.T) storage.KV {
+	t.Helper()
+	kv := New(storage.Config{})
+	for _, k := range iterKeys {
+		if err := kv.Put(context.Background(), []byte(k), []byte("v"+k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return kv
+}
+
+// keys drains it and returns the keys it visited.
+func keys(t *testing.T, it storage.Iterator) []string {
+	t.Helper()
+	var out []string
+	for it.Next() {
+		if string(it.Value()) != "v"+string(it.Key()) {
+			t.Fatalf("key %q has value %q", it.Key(), it.Value())
+		}
+		out = append(out, string(it.Key()))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestIteratorBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		opts storage.IterOptions
+		want string // visited keys, space separated
+	}{
+		{"all", storage.IterOptions{}, "a ab abc b ba c \xff \xff\xff"},
+		{"all reverse", storage.IterOptions{Reverse: true}, "\xff\xff \xff c ba b abc ab a"},
+		{"lower inclusive, upper exclusive", storage.IterOptions{LowerBound: []byte("ab"), UpperBound: []byte("ba")}, "ab abc b"},
+		{"bounds reverse", storage.IterOptions{LowerBound: []byte("ab"), UpperBound: []byte("ba"), Reverse: true}, "b abc ab"},
+		{"bounds between keys", storage.IterOptions{LowerBound: []byte("aa"), UpperBound: []byte("bb")}, "ab abc b ba"},
+		{"lower only", storage.IterOptions{LowerBound: []byte("c")}, "c \xff \xff\xff"},
+		{"upper only reverse", storage.IterOptions{UpperBound: []byte("b"), Reverse: true}, "abc ab a"},
+		{"empty range", storage.IterOptions{LowerBound: []byte("c"), UpperBound: []byte("b")}, ""},
+		{"prefix", storage.IterOptions{Prefix: []byte("a")}, "a ab abc"},
+		{"prefix reverse", storage.IterOptions{Prefix: []byte("a"), Reverse: true}, "abc ab a"},
+		{"prefix within bounds", storage.IterOptions{Prefix: []byte("a"), LowerBound: []byte("ab"), UpperBound: []byte("abc")}, "ab"},
+		{"bounds within prefix", storage.IterOptions{Prefix: []byte("ab"), LowerBound: []byte("a"), UpperBound: []byte("c")}, "ab abc"},
+		{"prefix without keys", storage.IterOptions{Prefix: []byte("d")}, ""},
+		{"all-0xff prefix", storage.IterOptions{Prefix: []byte("\xff")}, "\xff \xff\xff"},
+		{"all-0xff prefix reverse", storage.IterOptions{Prefix: []byte("\xff"), Reverse: true}, "\xff\xff \xff"},
+	}
+	ctx := context.Background()
+	kv := newStore(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := kv.NewIterator(ctx, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer it.Close()
+			if got := strings.Join(keys(t, it), " "); got != tt.want {
+				t.Fatalf("visited %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIteratorSeek(t *testing.T) {
+	bounded := storage.IterOptions{LowerBound: []byte("ab"), UpperBound: []byte("c")}
+	reverse := bounded
+	reverse.Reverse = true
+	tests := []struct {
+		name string
+		opts storage.IterOptions
+		seek string
+		want string // keys visited after the seek
+	}{
+		{"to a key", bounded, "b", "b ba"},
+		{"between keys", bounded, "abd", "b ba"},
+		{"below the range", bounded, "a", "ab abc b ba"},
+		{"past the range", bounded, "d", ""},
+		{"reverse to a key", reverse, "b", "b abc ab"},
+		{"reverse between keys", reverse, "abd", "abc ab"},
+		{"reverse past the range", reverse, "d", "ba b abc ab"},
+		{"reverse below the range", reverse, "a", ""},
+	}
+	ctx := context.Background()
+	kv := newStore(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := kv.NewIterator(ctx, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer it.Close()
+			it.Seek([]byte(tt.seek))
+			if got := strings.Join(keys(t, it), " "); got != tt.want {
+				t.Fatalf("visited %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,46 +1,313 @@
 package mem
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"slices"
 	"sync"
 
 	"github.com/grishinium-blockchain/grishinium-go/internal/storage"
 )
 
 // KV is an in-memory implementation of storage.KV for development and tests.
+// Entries are kept sorted by key so that range iteration is ordered.
+//
+// Iterators and snapshots share the entry slice instead of copying it. The
+// first write while any of them is open copies the slice and starts a new
+// generation; later writes modify the copy in place until another reader
+// opens (copy-on-write).
 type KV struct {
-	cfg storage.Config
-	mu  sync.RWMutex
-	m   map[string][]byte
+	cfg     storage.Config
+	mu      sync.RWMutex
+	entries []entry
+	gen     uint64 // bumped each time entries is replaced by a copy
+	readers int    // open iterators and snapshots on generation gen
 }
 
-func New(cfg storage.Config) *KV { return &KV{cfg: cfg, m: make(map[string][]byte)} }
+type entry struct {
+	key   []byte
+	value []byte
+}
+
+func New(cfg storage.Config) *KV { return &KV{cfg: cfg} }
 
-func (kv *KV) Open(ctx context.Context) error { return nil }
+func (kv *KV) Open(ctx context.Context) error  { return nil }
 func (kv *KV) Close(ctx context.Context) error { return nil }
 
+// search returns the position of key and whether it is present.
+func search(entries []entry, key []byte) (int, bool) {
+	return slices.BinarySearchFunc(entries, key, func(e entry, k []byte) int { return bytes.Compare(e.key, k) })
+}
+
 func (kv *KV) Get(ctx context.Context, key []byte) ([]byte, error) {
 	kv.mu.RLock()
 	defer kv.mu.RUnlock()
-	v, ok := kv.m[string(key)]
+	i, ok := search(kv.entries, key)
 	if !ok {
 		return nil, nil
 	}
+	v := kv.entries[i].value
 	out := make([]byte, len(v))
 	copy(out, v)
 	return out, nil
 }
 
 func (kv *KV) Put(ctx context.Context, key, value []byte) error {
+	if kv.cfg.ReadOnly {
+		return storage.ErrReadOnly
+	}
 	kv.mu.Lock()
 	defer kv.mu.Unlock()
-	kv.m[string(key)] = append([]byte(nil), value...)
+	kv.own()
+	kv.put(append([]byte(nil), key...), append([]byte(nil), value...))
 	return nil
 }
 
 func (kv *KV) Delete(ctx context.Context, key []byte) error {
+	if kv.cfg.ReadOnly {
+		return storage.ErrReadOnly
+	}
 	kv.mu.Lock()
 	defer kv.mu.Unlock()
-	delete(kv.m, string(key))
+	kv.own()
+	kv.delete(key)
 	return nil
 }
+
+// own copies the entries before a write if an open iterator or snapshot
+// references them. Callers hold kv.mu for writing.
+func (kv *KV) own() {
+	if kv.readers > 0 {
+		kv.entries = slices.Clone(kv.entries)
+		kv.gen++
+		kv.readers = 0
+	}
+}
+
+// put stores an entry that the KV takes ownership of.
+func (kv *KV) put(key, value []byte) {
+	e := entry{key: key, value: value}
+	i, ok := search(kv.entries, key)
+	if ok {
+		kv.entries[i] = e
+		return
+	}
+	kv.entries = slices.Insert(kv.entries, i, e)
+}
+
+func (kv *KV) delete(key []byte) {
+	if i, ok := search(kv.entries, key); ok {
+		kv.entries = slices.Delete(kv.entries, i, i+1)
+	}
+}
+
+// share returns the current entries and their generation for read-only use
+// by an iterator or snapshot, and the function that ends that use. Writes
+// copy the entries first until it is called.
+func (kv *KV) share() ([]entry, uint64, func()) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	return kv.entries, kv.gen, kv.retainLocked(kv.gen)
+}
+
+// retainLocked registers a reader of generation gen and returns its release.
+// Readers of an older generation hold a copy no write touches any more.
+func (kv *KV) retainLocked(gen uint64) func() {
+	if gen == kv.gen {
+		kv.readers++
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			kv.mu.Lock()
+			defer kv.mu.Unlock()
+			if gen == kv.gen {
+				kv.readers--
+			}
+		})
+	}
+}
+
+// NewIterator iterates over the entries as of call time, so concurrent writes
+// do not affect it.
+func (kv *KV) NewIterator(ctx context.Context, opts storage.IterOptions) (storage.Iterator, error) {
+	entries, _, release := kv.share()
+	return newIterator(entries, opts, release), nil
+}
+
+// NewBatch returns a batch that is applied under a single write lock.
+func (kv *KV) NewBatch() storage.Batch { return &batch{kv: kv} }
+
+// NewSnapshot returns a view of the entries as of call time.
+func (kv *KV) NewSnapshot(ctx context.Context) (storage.Snapshot, error) {
+	entries, gen, release := kv.share()
+	return &snapshot{kv: kv, entries: entries, gen: gen, release: release}, nil
+}
+
+func newIterator(entries []entry, opts storage.IterOptions, release func()) *iterator {
+	lower, upper := opts.Bounds()
+	lo, hi := 0, len(entries)
+	if lower != nil {
+		lo, _ = search(entries, lower)
+	}
+	if upper != nil {
+		hi, _ = search(entries, upper)
+	}
+	it := &iterator{reverse: opts.Reverse, pos: -1, release: release}
+	if lo < hi {
+		it.entries = entries[lo:hi:hi]
+	}
+	return it
+}
+
+type iterator struct {
+	entries []entry // selected range, ascending
+	reverse bool
+	pos     int
+	started bool
+	release func()
+}
+
+func (it *iterator) Next() bool {
+	switch {
+	case !it.started:
+		it.started = true
+		if it.reverse {
+			it.pos = len(it.entries) - 1
+		} else {
+			it.pos = 0
+		}
+	case it.reverse:
+		it.pos--
+	default:
+		it.pos++
+	}
+	return it.valid()
+}
+
+func (it *iterator) Seek(key []byte) {
+	it.started = true
+	i, found := search(it.entries, key)
+	if it.reverse {
+		if found {
+			i++
+		}
+		// Next moves to i-1: the last key <= key.
+		it.pos = i
+		return
+	}
+	// Next moves to i: the first key >= key.
+	it.pos = i - 1
+}
+
+func (it *iterator) valid() bool { return it.pos >= 0 && it.pos < len(it.entries) }
+
+func (it *iterator) Key() []byte {
+	if !it.valid() {
+		return nil
+	}
+	return it.entries[it.pos].key
+}
+
+func (it *iterator) Value() []byte {
+	if !it.valid() {
+		return nil
+	}
+	return it.entries[it.pos].value
+}
+
+func (it *iterator) Err() error { return nil }
+
+func (it *iterator) Close() error {
+	it.entries = nil
+	it.release()
+	return nil
+}
+
+type batchOp struct {
+	key, value []byte
+	del        bool
+}
+
+type batch struct {
+	kv  *KV
+	ops []batchOp
+}
+
+func (b *batch) Put(key, value []byte) error {
+	b.ops = append(b.ops, batchOp{key: append([]byte(nil), key...), value: append([]byte(nil), value...)})
+	return nil
+}
+
+func (b *batch) Delete(key []byte) error {
+	b.ops = append(b.ops, batchOp{key: append([]byte(nil), key...), del: true})
+	return nil
+}
+
+func (b *batch) Len() int { return len(b.ops) }
+
+// Commit applies the operations in order. Readers never observe a partially
+// applied batch; opts.Sync has no effect in memory.
+func (b *batch) Commit(ctx context.Context, opts storage.WriteOptions) error {
+	if b.kv == nil {
+		return errBatchDone
+	}
+	kv := b.kv
+	if kv.cfg.ReadOnly {
+		return storage.ErrReadOnly
+	}
+	kv.mu.Lock()
+	kv.own()
+	for _, op := range b.ops {
+		if op.del {
+			kv.delete(op.key)
+		} else {
+			kv.put(op.key, op.value)
+		}
+	}
+	kv.mu.Unlock()
+	b.kv, b.ops = nil, nil
+	return nil
+}
+
+func (b *batch) Close() error {
+	b.kv, b.ops = nil, nil
+	return nil
+}
+
+var errBatchDone = errors.New("mem: batch already committed or closed")
+
+// snapshot reads from an entry slice that the KV does not modify while the
+// snapshot is open.
+type snapshot struct {
+	kv      *KV
+	entries []entry
+	gen     uint64
+	release func()
+}
+
+func (s *snapshot) Get(ctx context.Context, key []byte) ([]byte, error) {
+	i, ok := search(s.entries, key)
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte(nil), s.entries[i].value...), nil
+}
+
+// NewIterator iterates over the snapshot. The iterator keeps the entries
+// from being modified even after the snapshot is closed.
+func (s *snapshot) NewIterator(ctx context.Context, opts storage.IterOptions) (storage.Iterator, error) {
+	s.kv.mu.Lock()
+	release := s.kv.retainLocked(s.gen)
+	s.kv.mu.Unlock()
+	return newIterator(s.entries, opts, release), nil
+}
+
+func (s *snapshot) Close() error {
+	s.entries = nil
+	s.release()
+	return nil
+}
+
+var _ storage.KV = (*KV)(nil)
@@ -0,0 +1,159 @@
+package mem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grishinium-blockchain/grishinium-go/internal/storage"
+)
+
+func TestBatchAtomic(t *testing.T) {
+	ctx := context.Background()
+	kv := New(storage.Config{})
+
+	// Every batch moves "a" and "b" to the same value together; a reader
+	// must never see them differ.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var torn error
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			s, _ := kv.NewSnapshot(ctx)
+			a, _ := s.Get(ctx, []byte("a"))
+			b, _ := s.Get(ctx, []byte("b"))
+			s.Close()
+			if string(a) != string(b) {
+				torn = fmt.Errorf("a = %q, b = %q", a, b)
+				return
+			}
+		}
+	}()
+	for i := range 200 {
+		b := kv.NewBatch()
+		v := []byte(fmt.Sprint(i))
+		_ = b.Put([]byte("a"), v)
+		_ = b.Put([]byte("b"), v)
+		if err := b.Commit(ctx, storage.WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	if torn != nil {
+		t.Fatalf("partially applied batch observed: %v", torn)
+	}
+
+	// Operations apply in order, and a batch commits once.
+	b := kv.NewBatch()
+	_ = b.Put([]byte("c"), []byte("1"))
+	_ = b.Delete([]byte("c"))
+	_ = b.Delete([]byte("a"))
+	_ = b.Put([]byte("a"), []byte("2"))
+	if err := b.Commit(ctx, storage.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit(ctx, storage.WriteOptions{}); !errors.Is(err, errBatchDone) {
+		t.Fatalf("second Commit = %v, want errBatchDone", err)
+	}
+	for key, want := range map[string]string{"a": "2", "b": "199", "c": ""} {
+		if got, _ := kv.Get(ctx, []byte(key)); string(got) != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		write func(storage.KV) error
+	}{
+		{"put", func(kv storage.KV) error { return kv.Put(ctx, []byte("b"), []byte("changed")) }},
+		{"insert", func(kv storage.KV) error { return kv.Put(ctx, []byte("aa"), []byte("vaa")) }},
+		{"delete", func(kv storage.KV) error { return kv.Delete(ctx, []byte("abc")) }},
+		{"batch", func(kv storage.KV) error {
+			b := kv.NewBatch()
+			_ = b.Delete([]byte("a"))
+			_ = b.Put([]byte("d"), []byte("vd"))
+			return b.Commit(ctx, storage.WriteOptions{})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kv := newStore(t)
+			s, err := kv.NewSnapshot(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if err := tt.write(kv); err != nil {
+				t.Fatal(err)
+			}
+			for _, k := range iterKeys {
+				if got, _ := s.Get(ctx, []byte(k)); string(got) != "v"+k {
+					t.Errorf("snapshot %q = %q, want %q", k, got, "v"+k)
+				}
+			}
+			it, _ := s.NewIterator(ctx, storage.IterOptions{})
+			defer it.Close()
+			if got := strings.Join(keys(t, it), " "); got != strings.Join(iterKeys, " ") {
+				t.Errorf("snapshot iterates %q", got)
+			}
+		})
+	}
+}
+
+func TestIteratorCopyOnWrite(t *testing.T) {
+	ctx := context.Background()
+	kv := newStore(t).(*KV)
+	it, _ := kv.NewIterator(ctx, storage.IterOptions{})
+	s, _ := kv.NewSnapshot(ctx)
+	gen := kv.gen
+
+	// The first write copies the entries; the following ones reuse the copy.
+	for i := range 100 {
+		if err := kv.Put(ctx, []byte(fmt.Sprintf("k%03d", i)), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = kv.Delete(ctx, []byte("a"))
+	if kv.gen != gen+1 {
+		t.Fatalf("%d copies for 101 writes after one iterator and snapshot, want 1", kv.gen-gen)
+	}
+	if got := strings.Join(keys(t, it), " "); got != strings.Join(iterKeys, " ") {
+		t.Fatalf("open iterator sees writes: %q", got)
+	}
+
+	// An iterator of a snapshot pins the entries after the snapshot closes;
+	// readers of an older generation do not.
+	old, _ := s.NewIterator(ctx, storage.IterOptions{})
+	s.Close()
+	it.Close()
+	cur, _ := kv.NewIterator(ctx, storage.IterOptions{})
+	_ = kv.Put(ctx, []byte("after"), []byte("v"))
+	if kv.gen != gen+2 {
+		t.Fatalf("write with an open iterator did not copy")
+	}
+	if got := strings.Join(keys(t, old), " "); got != strings.Join(iterKeys, " ") {
+		t.Fatalf("snapshot iterator sees writes: %q", got)
+	}
+	old.Close()
+	cur.Close()
+
+	// Once every reader is closed, writes modify the entries in place.
+	_ = kv.Put(ctx, []byte("again"), []byte("v"))
+	if kv.gen != gen+2 || kv.readers != 0 {
+		t.Fatalf("write without readers copied: generation %d, %d readers", kv.gen-gen, kv.readers)
+	}
+}
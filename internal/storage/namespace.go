@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+)
+
+// Namespace is an isolated keyspace inside another KV, in the spirit of a
+// column family or bucket. Keys are stored under a prefix derived from the
+// namespace name; callers only ever see their own keys, and iteration never
+// leaves the namespace. Namespaces nest: a Namespace over a Namespace works.
+//
+// Open and Close are no-ops: the parent KV owns the underlying store and must
+// be opened before, and closed after, its namespaces are used.
+type Namespace struct {
+	kv     KV
+	prefix []byte
+}
+
+// NewNamespace returns the namespace called name in kv. Distinct names never
+// share keys, even when one name is a prefix of another.
+func NewNamespace(kv KV, name string) *Namespace {
+	// A length prefix keeps "block" and "blocks" apart.
+	prefix := binary.AppendUvarint(nil, uint64(len(name)))
+	prefix = append(prefix, name...)
+	return &Namespace{kv: kv, prefix: prefix}
+}
+
+// Prefix returns the raw prefix of the namespace's keys in the parent KV.
+func (ns *Namespace) Prefix() []byte { return append([]byte(nil), ns.prefix...) }
+
+func (ns *Namespace) Open(ctx context.Context) error  { return nil }
+func (ns *Namespace) Close(ctx context.Context) error { return nil }
+
+func (ns *Namespace) Get(ctx context.Context, key []byte) ([]byte, error) {
+	return ns.kv.Get(ctx, ns.key(key))
+}
+
+func (ns *Namespace) Put(ctx context.Context, key, value []byte) error {
+	return ns.kv.Put(ctx, ns.key(key), value)
+}
+
+func (ns *Namespace) Delete(ctx context.Context, key []byte) error {
+	return ns.kv.Delete(ctx, ns.key(key))
+}
+
+func (ns *Namespace) NewIterator(ctx context.Context, opts IterOptions) (Iterator, error) {
+	it, err := ns.kv.NewIterator(ctx, ns.iterOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return &nsIterator{it: it, n: len(ns.prefix), ns: ns}, nil
+}
+
+func (ns *Namespace) NewBatch() Batch {
+	return &nsBatch{b: ns.kv.NewBatch(), ns: ns}
+}
+
+func (ns *Namespace) NewSnapshot(ctx context.Context) (Snapshot, error) {
+	s, err := ns.kv.NewSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &nsSnapshot{s: s, ns: ns}, nil
+}
+
+// key returns key qualified with the namespace prefix.
+func (ns *Namespace) key(key []byte) []byte {
+	out := make([]byte, 0, len(ns.prefix)+len(key))
+	return append(append(out, ns.prefix...), key...)
+}
+
+// iterOptions translates opts into the parent keyspace.
+func (ns *Namespace) iterOptions(opts IterOptions) IterOptions {
+	out := IterOptions{Prefix: ns.key(opts.Prefix), Reverse: opts.Reverse}
+	if opts.LowerBound != nil {
+		out.LowerBound = ns.key(opts.LowerBound)
+	}
+	if opts.UpperBound != nil {
+		out.UpperBound = ns.key(opts.UpperBound)
+	}
+	return out
+}
+
+type nsIterator struct {
+	it Iterator
+	n  int
+	ns *Namespace
+}
+
+func (i *nsIterator) Next() bool      { return i.it.Next() }
+func (i *nsIterator) Seek(key []byte) { i.it.Seek(i.ns.key(key)) }
+func (i *nsIterator) Value() []byte   { return i.it.Value() }
+func (i *nsIterator) Err() error      { return i.it.Err() }
+func (i *nsIterator) Close() error    { return i.it.Close() }
+
+func (i *nsIterator) Key() []byte {
+	k := i.it.Key()
+	if len(k) < i.n {
+		return nil
+	}
+	return k[i.n:]
+}
+
+type nsBatch struct {
+	b  Batch
+	ns *Namespace
+}
+
+func (b *nsBatch) Put(key, value []byte) error { return b.b.Put(b.ns.key(key), value) }
+func (b *nsBatch) Delete(key []byte) error     { return b.b.Delete(b.ns.key(key)) }
+func (b *nsBatch) Len() int                    { return b.b.Len() }
+func (b *nsBatch) Close() error                { return b.b.Close() }
+
+func (b *nsBatch) Commit(ctx context.Context, opts WriteOptions) error {
+	return b.b.Commit(ctx, opts)
+}
+
+type nsSnapshot struct {
+	s  Snapshot
+	ns *Namespace
+}
+
+func (s *nsSnapshot) Get(ctx context.Context, key []byte) ([]byte, error) {
+	return s.s.Get(ctx, s.ns.key(key))
+}
+
+func (s *nsSnapshot) NewIterator(ctx context.Context, opts IterOptions) (Iterator, error) {
+	it, err := s.s.NewIterator(ctx, s.ns.iterOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return &nsIterator{it: it, n: len(s.ns.prefix), ns: s.ns}, nil
+}
+
+func (s *nsSnapshot) Close() error { return s.s.Close() }
+
+var _ KV = (*Namespace)(nil)
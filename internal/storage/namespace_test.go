@@ -0,0 +1,130 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/grishinium-blockchain/grishinium-go/internal/storage"
+	"github.com/grishinium-blockchain/grishinium-go/internal/storage/mem"
+)
+
+// drain returns the keys and values it visits, as key=value strings.
+func drain(t *testing.T, it storage.Iterator) []string {
+	t.Helper()
+	defer it.Close()
+	var out []string
+	for it.Next() {
+		out = append(out, string(it.Key())+"="+string(it.Value()))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestNamespaceIsolation(t *testing.T) {
+	ctx := context.Background()
+	root := mem.New(storage.Config{})
+	a := storage.NewNamespace(root, "a")
+	spaces := []struct {
+		name string
+		kv   storage.KV
+	}{
+		{"a", a},
+		{"ab", storage.NewNamespace(root, "ab")},
+		{"a/b", storage.NewNamespace(a, "b")},
+		{"empty name", storage.NewNamespace(root, "")},
+	}
+	for _, s := range spaces {
+		for _, k := range []string{"k1", "k2"} {
+			if err := s.kv.Put(ctx, []byte(k), []byte(s.name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// A key in "a" that spells the prefix of "ab" stays in "a".
+	if err := a.Put(ctx, []byte("\x02abk1"), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	b := a.NewBatch()
+	_ = b.Delete([]byte("k2"))
+	if err := b.Commit(ctx, storage.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		kv   storage.KV
+		want []string
+	}{
+		// A nested namespace is a range of its parent's keys.
+		{"a", a, []string{"\x01bk1=a/b", "\x01bk2=a/b", "\x02abk1=a", "k1=a"}},
+		{"ab", spaces[1].kv, []string{"k1=ab", "k2=ab"}},
+		{"a/b", spaces[2].kv, []string{"k1=a/b", "k2=a/b"}},
+		{"empty name", spaces[3].kv, []string{"k1=empty name", "k2=empty name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := tt.kv.NewIterator(ctx, storage.IterOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := drain(t, it); !slices.Equal(got, tt.want) {
+				t.Errorf("iterates %q, want %q", got, tt.want)
+			}
+			snap, err := tt.kv.NewSnapshot(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer snap.Close()
+			it, err = snap.NewIterator(ctx, storage.IterOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := drain(t, it); !slices.Equal(got, tt.want) {
+				t.Errorf("snapshot iterates %q, want %q", got, tt.want)
+			}
+			if got, _ := tt.kv.Get(ctx, []byte("k1")); string(got) != tt.name {
+				t.Errorf("k1 = %q, want %q", got, tt.name)
+			}
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	ro := mem.New(storage.Config{ReadOnly: true})
+	for _, s := range []struct {
+		name string
+		kv   storage.KV
+	}{
+		{"kv", ro},
+		{"namespace", storage.NewNamespace(ro, "ns")},
+	} {
+		t.Run(s.name, func(t *testing.T) {
+			tests := []struct {
+				name  string
+				write func() error
+			}{
+				{"put", func() error { return s.kv.Put(ctx, []byte("k"), []byte("v")) }},
+				{"delete", func() error { return s.kv.Delete(ctx, []byte("k")) }},
+				{"batch", func() error {
+					b := s.kv.NewBatch()
+					defer b.Close()
+					_ = b.Put([]byte("k"), []byte("v"))
+					return b.Commit(ctx, storage.WriteOptions{})
+				}},
+			}
+			for _, tt := range tests {
+				if err := tt.write(); !errors.Is(err, storage.ErrReadOnly) {
+					t.Errorf("%s = %v, want ErrReadOnly", tt.name, err)
+				}
+			}
+			if v, err := s.kv.Get(ctx, []byte("k")); err != nil || v != nil {
+				t.Errorf("Get = %q, %v after refused writes", v, err)
+			}
+		})
+	}
+}
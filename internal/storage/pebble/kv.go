@@ -4,27 +4,47 @@ package pebble
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
 	"github.com/grishinium-blockchain/grishinium-go/internal/storage"
 )
 
 // KV is a Pebble-backed implementation of storage.KV.
 type KV struct {
-	cfg storage.Config
-	db  *pebble.DB
+	cfg  storage.Config
+	db   *pebble.DB
+	lock *pebble.Lock
 }
 
 func New(cfg storage.Config) *KV { return &KV{cfg: cfg} }
 
+// Open opens the database, creating it unless ReadOnly is set. The directory
+// lock is taken even for read-only access; Open fails with storage.ErrLocked
+// while another process has the database open.
 func (kv *KV) Open(ctx context.Context) error {
 	path := filepath.Clean(kv.cfg.Path)
-	db, err := pebble.Open(path, &pebble.Options{})
+	if !kv.cfg.ReadOnly {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			return err
+		}
+	} else if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	lock, err := pebble.LockDirectory(path, vfs.Default)
 	if err != nil {
+		return fmt.Errorf("%w: %s: %v", storage.ErrLocked, path, err)
+	}
+	db, err := pebble.Open(path, &pebble.Options{ReadOnly: kv.cfg.ReadOnly, Lock: lock})
+	if err != nil {
+		_ = lock.Close()
 		return err
 	}
-	kv.db = db
+	kv.db, kv.lock = db, lock
 	return nil
 }
 
@@ -32,7 +52,12 @@ func (kv *KV) Close(ctx context.Context) error {
 	if kv.db == nil {
 		return nil
 	}
-	return kv.db.Close()
+	err := kv.db.Close()
+	if lerr := kv.lock.Close(); err == nil {
+		err = lerr
+	}
+	kv.db, kv.lock = nil, nil
+	return err
 }
 
 func (kv *KV) Get(ctx context.Context, key []byte) ([]byte, error) {
@@ -53,15 +78,197 @@ func (kv *KV) Get(ctx context.Context, key []byte) ([]byte, error) {
 }
 
 func (kv *KV) Put(ctx context.Context, key, value []byte) error {
+	if kv.cfg.ReadOnly {
+		return storage.ErrReadOnly
+	}
 	if kv.db == nil {
 		return nil
 	}
-	return kv.db.Set(key, value, pebble.NoSync)
+	return kv.db.Set(key, value, kv.writeOptions())
 }
 
 func (kv *KV) Delete(ctx context.Context, key []byte) error {
+	if kv.cfg.ReadOnly {
+		return storage.ErrReadOnly
+	}
 	if kv.db == nil {
 		return nil
 	}
-	return kv.db.Delete(key, pebble.NoSync)
+	return kv.db.Delete(key, kv.writeOptions())
+}
+
+// writeOptions returns the durability for single-key writes, chosen by
+// storage.Config.Sync.
+func (kv *KV) writeOptions() *pebble.WriteOptions {
+	if kv.cfg.Sync {
+		return pebble.Sync
+	}
+	return pebble.NoSync
+}
+
+var errNotOpen = errors.New("pebble: database is not open")
+
+func (kv *KV) NewIterator(ctx context.Context, opts storage.IterOptions) (storage.Iterator, error) {
+	if kv.db == nil {
+		return nil, errNotOpen
+	}
+	return newIterator(kv.db.NewIter, opts)
+}
+
+// NewBatch returns a pebble batch. Committing it before Open fails.
+func (kv *KV) NewBatch() storage.Batch {
+	if kv.db == nil {
+		return &batch{}
+	}
+	return &batch{b: kv.db.NewBatch(), readOnly: kv.cfg.ReadOnly}
+}
+
+func (kv *KV) NewSnapshot(ctx context.Context) (storage.Snapshot, error) {
+	if kv.db == nil {
+		return nil, errNotOpen
+	}
+	return &snapshot{s: kv.db.NewSnapshot()}, nil
 }
+
+func newIterator(open func(*pebble.IterOptions) (*pebble.Iterator, error), opts storage.IterOptions) (storage.Iterator, error) {
+	lower, upper := opts.Bounds()
+	it, err := open(&pebble.IterOptions{LowerBound: lower, UpperBound: upper})
+	if err != nil {
+		return nil, err
+	}
+	return &iterator{it: it, reverse: opts.Reverse}, nil
+}
+
+// batch wraps a pebble.Batch. b is nil when the batch was created before Open
+// or has been committed or closed.
+type batch struct {
+	b        *pebble.Batch
+	readOnly bool
+}
+
+var errBatchDone = errors.New("pebble: batch already committed or closed")
+
+func (b *batch) Put(key, value []byte) error {
+	if b.b == nil {
+		return errBatchDone
+	}
+	return b.b.Set(key, value, nil)
+}
+
+func (b *batch) Delete(key []byte) error {
+	if b.b == nil {
+		return errBatchDone
+	}
+	return b.b.Delete(key, nil)
+}
+
+func (b *batch) Len() int {
+	if b.b == nil {
+		return 0
+	}
+	return int(b.b.Count())
+}
+
+func (b *batch) Commit(ctx context.Context, opts storage.WriteOptions) error {
+	if b.b == nil {
+		return errBatchDone
+	}
+	if b.readOnly {
+		return storage.ErrReadOnly
+	}
+	wo := pebble.NoSync
+	if opts.Sync {
+		wo = pebble.Sync
+	}
+	err := b.b.Commit(wo)
+	_ = b.b.Close()
+	b.b = nil
+	return err
+}
+
+func (b *batch) Close() error {
+	if b.b == nil {
+		return nil
+	}
+	err := b.b.Close()
+	b.b = nil
+	return err
+}
+
+type snapshot struct {
+	s *pebble.Snapshot
+}
+
+func (s *snapshot) Get(ctx context.Context, key []byte) ([]byte, error) {
+	v, closer, err := s.s.Get(key)
+	if err != nil {
+		if err == pebble.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer closer.Close()
+	return append([]byte(nil), v...), nil
+}
+
+func (s *snapshot) NewIterator(ctx context.Context, opts storage.IterOptions) (storage.Iterator, error) {
+	return newIterator(s.s.NewIter, opts)
+}
+
+func (s *snapshot) Close() error { return s.s.Close() }
+
+// iterator adapts a pebble.Iterator to the Next-first storage.Iterator style.
+type iterator struct {
+	it      *pebble.Iterator
+	reverse bool
+	started bool
+	// positioned is set by Seek: the next Next returns the current entry.
+	positioned bool
+}
+
+func (i *iterator) Next() bool {
+	switch {
+	case i.positioned:
+		i.positioned = false
+		return i.it.Valid()
+	case !i.started:
+		i.started = true
+		if i.reverse {
+			return i.it.Last()
+		}
+		return i.it.First()
+	case i.reverse:
+		return i.it.Prev()
+	default:
+		return i.it.Next()
+	}
+}
+
+func (i *iterator) Seek(key []byte) {
+	i.started, i.positioned = true, true
+	if i.reverse {
+		// The last key <= key is the last key < key+"\x00".
+		i.it.SeekLT(append(append([]byte(nil), key...), 0))
+		return
+	}
+	i.it.SeekGE(key)
+}
+
+func (i *iterator) Key() []byte {
+	if !i.it.Valid() {
+		return nil
+	}
+	return i.it.Key()
+}
+
+func (i *iterator) Value() []byte {
+	if !i.it.Valid() {
+		return nil
+	}
+	return i.it.Value()
+}
+
+func (i *iterator) Err() error   { return i.it.Error() }
+func (i *iterator) Close() error { return i.it.Close() }
+
+var _ storage.KV = (*KV)(nil)
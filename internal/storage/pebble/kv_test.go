@@ -0,0 +1,56 @@
+//go:build pebble
+
+package pebble
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/grishinium-blockchain/grishinium-go/internal/storage"
+)
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	rw := New(storage.Config{Path: dir})
+	if err := rw.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Put(ctx, []byte("k"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	ro := New(storage.Config{Path: dir, ReadOnly: true})
+	if err := ro.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close(ctx)
+	tests := []struct {
+		name  string
+		write func() error
+	}{
+		{"put", func() error { return ro.Put(ctx, []byte("k"), []byte("w")) }},
+		{"delete", func() error { return ro.Delete(ctx, []byte("k")) }},
+		{"batch", func() error {
+			b := ro.NewBatch()
+			defer b.Close()
+			_ = b.Put([]byte("k"), []byte("w"))
+			return b.Commit(ctx, storage.WriteOptions{})
+		}},
+	}
+	for _, tt := range tests {
+		if err := tt.write(); !errors.Is(err, storage.ErrReadOnly) {
+			t.Errorf("%s = %v, want ErrReadOnly", tt.name, err)
+		}
+	}
+	if v, err := ro.Get(ctx, []byte("k")); err != nil || string(v) != "v" {
+		t.Fatalf("Get = %q, %v; want v", v, err)
+	}
+	if err := New(storage.Config{Path: dir + "/missing", ReadOnly: true}).Open(ctx); err == nil {
+		t.Fatal("read-only Open created a missing database")
+	}
+}
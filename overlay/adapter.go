@@ -2,40 +2,546 @@ package overlay
 
 import (
 	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
 
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+	"github.com/grishinium-blockchain/grishinium-go/dht"
+	logger "github.com/grishinium-blockchain/grishinium-go/internal/log"
+	"github.com/grishinium-blockchain/grishinium-go/internal/metrics"
 	ns "github.com/grishinium-blockchain/grishinium-go/internal/netstack"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
 )
 
+var log = logger.For(logger.Overlay)
+
+const (
+	// DefaultMaxPeers bounds the member sample kept per overlay.
+	DefaultMaxPeers = 16
+	// DefaultRefreshInterval is how often members are looked up again.
+	DefaultRefreshInterval = 5 * time.Minute
+	// lookupLimit bounds the members asked for in one lookup.
+	lookupLimit = 64
+)
+
+// Config configures an Adapter. Zero values select the defaults.
+type Config struct {
+	MaxPeers        int
+	RefreshInterval time.Duration
+	// Identity signs the broadcasts this node sends in private overlays. An
+	// ephemeral key is generated when it is empty.
+	Identity keyring.Identity
+	// Limits configures the flood protection of received traffic.
+	Limits Limits
+}
+
 // Adapter bridges overlay.Manager to a netstack.Node implementation.
-// Lifecycle (Start/Close) is managed by the underlying node, so Adapter methods are no-ops.
+//
+// Membership is announced and discovered through the DHT table: Join
+// provides the overlay description, so members find each other with
+// FindProviders, and keeps a bounded random sample of them. Between Start
+// and Close the samples are refreshed every RefreshInterval.
+//
+// Every broadcast is a signed overlay.broadcast envelope, or a set of signed
+// overlay.broadcastFec parts for large payloads. In private overlays the
+// adapter also drops, and counts, broadcasts whose sender is not a member.
+// Private overlays authenticate their members but do not hide traffic from
+// other subscribers of the topic.
+//
+// Received broadcasts, queries and messages are subject to cfg.Limits:
+// traffic above the peer and overlay rates or size caps is dropped, and
+// peers that keep sending invalid or excessive traffic are disconnected and
+// ignored for a while. Broadcasts are checked by a netstack validator, so
+// the libp2p backend does not relay what this node refuses.
 type Adapter struct {
-	node ns.Node
+	node   ns.Node
+	table  dht.Table
+	cfg    Config
+	limits *limiter
+
+	mu       sync.Mutex
+	overlays map[ID]*membership
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
 }
 
-func NewAdapter(node ns.Node) *Adapter { return &Adapter{node: node} }
+// membership is the state of one joined overlay.
+type membership struct {
+	description []byte
+	peers       []dht.Peer
+	topics      map[Topic]struct{} // subscribed scoped topics
+	private     *Members           // nil for public overlays
+	handler     Handler            // answers queries and messages; may be nil
+}
 
-func (a *Adapter) Start(ctx context.Context) error { return nil }
-func (a *Adapter) Close(ctx context.Context) error { return nil }
+func NewAdapter(node ns.Node, table dht.Table, cfg Config) *Adapter {
+	if len(cfg.Identity.Private) == 0 {
+		// LoadIdentity only fails reading a file, which it is not asked to.
+		cfg.Identity, _ = keyring.LoadIdentity("")
+	}
+	if cfg.MaxPeers <= 0 {
+		cfg.MaxPeers = DefaultMaxPeers
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = DefaultRefreshInterval
+	}
+	cfg.Limits = cfg.Limits.withDefaults()
+	return &Adapter{node: node, table: table, cfg: cfg, limits: newLimiter(cfg.Limits), overlays: make(map[ID]*membership)}
+}
 
-func (a *Adapter) Publish(ctx context.Context, topic Topic, data []byte) error {
-	return a.node.Publish(ctx, string(topic), data)
+func (a *Adapter) Start(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cancel != nil {
+		return nil
+	}
+	loopCtx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	a.node.SetHandler(queryProtocol, a.serve)
+	a.wg.Add(1)
+	go a.maintain(loopCtx)
+	return nil
 }
 
-func (a *Adapter) Subscribe(ctx context.Context, topic Topic) (<-chan []byte, error) {
-	return a.node.Subscribe(ctx, string(topic))
+// Close stops refreshing members and answering queries. Joined overlays
+// stay joined.
+func (a *Adapter) Close(ctx context.Context) error {
+	a.mu.Lock()
+	cancel := a.cancel
+	a.cancel = nil
+	a.mu.Unlock()
+	if cancel != nil {
+		a.node.SetHandler(queryProtocol, nil)
+		cancel()
+		a.wg.Wait()
+	}
+	return nil
 }
 
-func (a *Adapter) Unsubscribe(ctx context.Context, topic Topic) error {
-	return a.node.Unsubscribe(ctx, string(topic))
+func (a *Adapter) maintain(ctx context.Context) {
+	defer a.wg.Done()
+	t := time.NewTicker(a.cfg.RefreshInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		a.mu.Lock()
+		ids := make([]ID, 0, len(a.overlays))
+		for id := range a.overlays {
+			ids = append(ids, id)
+		}
+		a.mu.Unlock()
+		for _, id := range ids {
+			a.refresh(ctx, id)
+		}
+	}
 }
 
-func (a *Adapter) Join(ctx context.Context, overlayID string) error {
-	// Mapping overlays to topics can be done via naming convention.
-	// Here we treat overlayID as a topic namespace; no extra action required.
-	return nil
+// Join announces membership of the overlay and looks up its members. Joining
+// an overlay twice is a no-op.
+func (a *Adapter) Join(ctx context.Context, description []byte) (ID, error) {
+	return a.join(ctx, description, nil)
 }
 
-func (a *Adapter) Leave(ctx context.Context, overlayID string) error {
-	// Same as Join; no persistent membership in this adapter.
+// JoinPrivate joins the overlay as a private one: only broadcasts sent by
+// members are delivered. This node must be a member itself. Calling it again
+// for a joined private overlay replaces the member rules.
+func (a *Adapter) JoinPrivate(ctx context.Context, description []byte, members Members) (ID, error) {
+	if len(members.Keys) == 0 && len(members.Authorities) == 0 {
+		return ID{}, errors.New("overlay: private overlay without members")
+	}
+	id := IDOf(description)
+	if err := members.Admit(id, a.cfg.Identity.Public, members.Certificate, 0, time.Now()); err != nil {
+		return ID{}, fmt.Errorf("overlay: cannot join private overlay %s: %w", id, err)
+	}
+	return a.join(ctx, description, members.clone())
+}
+
+func (a *Adapter) join(ctx context.Context, description []byte, private *Members) (ID, error) {
+	if len(description) == 0 {
+		return ID{}, errors.New("overlay: empty description")
+	}
+	id := IDOf(description)
+	a.mu.Lock()
+	if m, ok := a.overlays[id]; ok {
+		defer a.mu.Unlock()
+		switch {
+		case private == nil:
+			return id, nil
+		case m.private == nil:
+			return ID{}, fmt.Errorf("overlay: %s is joined as a public overlay", id)
+		}
+		m.private = private
+		return id, nil
+	}
+	m := &membership{description: append([]byte(nil), description...), topics: make(map[Topic]struct{}), private: private}
+	a.overlays[id] = m
+	a.mu.Unlock()
+
+	if err := a.table.Provide(ctx, dht.Key(m.description)); err != nil {
+		a.mu.Lock()
+		delete(a.overlays, id)
+		a.mu.Unlock()
+		return ID{}, fmt.Errorf("overlay: announce membership: %w", err)
+	}
+	n := a.refresh(ctx, id)
+	log.Info("overlay joined", "overlay", id.String(), "peers", n, "private", private != nil)
+	return id, nil
+}
+
+// Leave stops announcing membership, closes the overlay's subscriptions and
+// forgets its members.
+func (a *Adapter) Leave(ctx context.Context, id ID) error {
+	a.mu.Lock()
+	m, ok := a.overlays[id]
+	delete(a.overlays, id)
+	a.mu.Unlock()
+	if !ok {
+		return ErrNotJoined
+	}
+	var errs []error
+	for topic := range m.topics {
+		a.node.SetValidator(string(topic), nil)
+		errs = append(errs, a.node.Unsubscribe(ctx, string(topic)))
+	}
+	errs = append(errs, a.table.Unprovide(ctx, dht.Key(m.description)))
+	metrics.ForgetOverlay(id.String())
+	log.Info("overlay left", "overlay", id.String())
+	return errors.Join(errs...)
+}
+
+// Peers returns the member sample of a joined overlay.
+func (a *Adapter) Peers(id ID) ([]dht.Peer, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	m, ok := a.overlays[id]
+	if !ok {
+		return nil, ErrNotJoined
+	}
+	return append([]dht.Peer(nil), m.peers...), nil
+}
+
+// refresh looks up the members of a joined overlay and updates its sample,
+// returning the sample size. Members that stay listed are kept; free slots
+// are filled with random newcomers this node can connect to.
+func (a *Adapter) refresh(ctx context.Context, id ID) int {
+	a.mu.Lock()
+	m, ok := a.overlays[id]
+	if !ok {
+		a.mu.Unlock()
+		return 0
+	}
+	desc, current := m.description, m.peers
+	a.mu.Unlock()
+
+	found, err := a.table.FindProviders(ctx, dht.Key(desc), lookupLimit)
+	if err != nil {
+		log.Debug("overlay member lookup failed", "overlay", id.String(), "err", err)
+		return len(current)
+	}
+	self := a.table.Self()
+	listed := make(map[string]dht.Peer, len(found))
+	for _, p := range found {
+		if k := peerKey(p); k != "" && !isSelf(p, self) {
+			listed[k] = p
+		}
+	}
+	var next []dht.Peer
+	for _, p := range current {
+		if fresh, ok := listed[peerKey(p)]; ok {
+			next = append(next, fresh)
+			delete(listed, peerKey(p))
+		}
+	}
+	var candidates []dht.Peer
+	for _, p := range listed {
+		candidates = append(candidates, p)
+	}
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	for _, p := range candidates {
+		if len(next) >= a.cfg.MaxPeers {
+			break
+		}
+		if p.Addr != "" {
+			if err := a.node.Connect(ctx, p.Addr); err != nil {
+				log.Debug("overlay member unreachable", "overlay", id.String(), "peer", peerKey(p), "err", err)
+				continue
+			}
+		}
+		next = append(next, p)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.overlays[id] != m {
+		return 0
+	}
+	m.peers = next
+	metrics.SetOverlayPeers(id.String(), len(next))
+	return len(next)
+}
+
+// peerKey identifies a peer by ID, or by address when the DHT has no ID.
+func peerKey(p dht.Peer) string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.Addr
+}
+
+// isSelf reports whether p is this node, by ID or, when either side has
+// none, by address.
+func isSelf(p, self dht.Peer) bool {
+	if p.ID != "" && self.ID != "" {
+		return p.ID == self.ID
+	}
+	return p.Addr != "" && p.Addr == self.Addr
+}
+
+// joined returns the membership a scoped topic belongs to. Unscoped topics
+// are open to everyone and return nil.
+func (a *Adapter) joined(topic Topic) (*membership, error) {
+	id, ok := overlayOf(topic)
+	if !ok {
+		return nil, nil
+	}
+	m, ok := a.overlays[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotJoined, id)
+	}
+	return m, nil
+}
+
+// Publish signs data with the node's identity and broadcasts it on topic.
+// Payloads above MaxSimpleBroadcastSize are sent as FEC parts.
+func (a *Adapter) Publish(ctx context.Context, topic Topic, data []byte) error {
+	a.mu.Lock()
+	m, err := a.joined(topic)
+	var private *Members
+	if m != nil {
+		private = m.private
+	}
+	a.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var cert *Certificate
+	if private != nil {
+		id, _ := overlayOf(topic)
+		if err := private.Admit(id, a.cfg.Identity.Public, private.Certificate, len(data), now); err != nil {
+			return err
+		}
+		cert = private.Certificate
+	}
+	msgs, err := sealBroadcasts(a.cfg.Identity, cert, data, now)
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		if err := a.node.Publish(ctx, string(topic), msg); err != nil {
+			metrics.OverlayPublishError(metricLabel(topic))
+			return err
+		}
+	}
+	metrics.OverlayMessage(metricLabel(topic), metrics.Sent)
 	return nil
 }
+
+// Subscribe delivers the broadcasts received on topic once each. Unsigned,
+// stale, duplicate and rate-limited messages are dropped and counted, as are
+// broadcasts from non-members in private overlays.
+func (a *Adapter) Subscribe(ctx context.Context, topic Topic) (<-chan Broadcast, error) {
+	a.mu.Lock()
+	m, err := a.joined(topic)
+	if m != nil {
+		m.topics[topic] = struct{}{}
+	}
+	a.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	label := metricLabel(topic)
+	a.node.SetValidator(string(topic), a.validator(topic, label, m))
+	ch, err := a.node.Subscribe(ctx, string(topic))
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("overlay subscribed", "topic", string(topic))
+	r := newReceiver(topic)
+	r.abandoned = func(src ed25519.PublicKey, now time.Time) { a.penaliseSource(label, src, now) }
+	// The node closes ch when the subscription ends.
+	metrics.OverlaySubscribed(1)
+	out := make(chan Broadcast)
+	go func() {
+		defer close(out)
+		defer metrics.OverlaySubscribed(-1)
+		for msg := range ch {
+			b, err := r.receive(msg, time.Now())
+			if err != nil {
+				metrics.OverlayDropped(label, dropReason(err))
+				log.Debug("overlay broadcast dropped", "topic", string(topic), "err", err)
+				continue
+			}
+			if b == nil {
+				continue
+			}
+			metrics.OverlayMessage(label, metrics.Received)
+			select {
+			case out <- *b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// validator returns the netstack validator of topic, which drops, counts
+// and holds against the sending peer the messages validate refuses.
+func (a *Adapter) validator(topic Topic, label string, m *membership) ns.Validator {
+	scope := label
+	if scope == "" {
+		scope = string(topic)
+	}
+	admit := a.admitter(topic, m)
+	return func(from string, data []byte) error {
+		now := time.Now()
+		err := a.validate(from, scope, data, admit, now)
+		if err != nil {
+			metrics.OverlayDropped(label, dropReason(err))
+			log.Debug("overlay broadcast dropped", "topic", string(topic), "peer", from, "err", err)
+			a.penalise(from, err, now)
+		}
+		return err
+	}
+}
+
+// validate checks a message received from a peer on an overlay topic: the
+// limits of the peer and of the overlay scope, then the broadcast's
+// signature, date and sender. This node's own messages skip the limits.
+func (a *Adapter) validate(from, scope string, data []byte, admit func(*envelope, time.Time) error, now time.Time) error {
+	if !a.isLocal(from) {
+		if err := a.limits.allow(peerKey(fromPeer(from)), scope, now); err != nil {
+			return err
+		}
+		if len(data) > a.cfg.Limits.MaxMessageSize {
+			return fmt.Errorf("%w: %d byte broadcast", ns.ErrTooLarge, len(data))
+		}
+	}
+	e, err := unmarshalEnvelope(data)
+	if err != nil {
+		return err
+	}
+	if err := e.checkDate(now); err != nil {
+		return err
+	}
+	if err := e.verify(); err != nil {
+		return err
+	}
+	if a.limits.banned(sourceKey(e.src), now) {
+		return ErrBanned
+	}
+	return admit(e, now)
+}
+
+// admitter returns the membership check of topic: everyone may broadcast
+// except in private overlays. The rules are looked up on every broadcast, as
+// JoinPrivate may replace them.
+func (a *Adapter) admitter(topic Topic, m *membership) func(*envelope, time.Time) error {
+	id, _ := overlayOf(topic)
+	return func(e *envelope, now time.Time) error {
+		if m == nil {
+			return nil
+		}
+		a.mu.Lock()
+		private := m.private
+		a.mu.Unlock()
+		if private == nil {
+			return nil
+		}
+		return private.Admit(id, e.src, e.cert, e.size(), now)
+	}
+}
+
+// penalise holds refused traffic against the peer at from. Once its score
+// reaches the ban threshold, the peer is disconnected and ignored.
+func (a *Adapter) penalise(from string, err error, now time.Time) {
+	p := penalty(err)
+	if p == 0 || a.isLocal(from) || !a.limits.penalise(peerKey(fromPeer(from)), p, now) {
+		return
+	}
+	metrics.OverlayPeerBanned()
+	log.Warn("overlay peer banned", "peer", from, "for", a.cfg.Limits.BanDuration, "err", err)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := a.node.Disconnect(ctx, from); err != nil {
+			log.Debug("cannot disconnect banned peer", "peer", from, "err", err)
+		}
+	}()
+}
+
+// penaliseSource holds an abandoned FEC broadcast against its source. Once
+// the source's score reaches the ban threshold, its broadcasts are ignored.
+func (a *Adapter) penaliseSource(label string, src ed25519.PublicKey, now time.Time) {
+	metrics.OverlayDropped(label, "fec_abandoned")
+	if src.Equal(a.cfg.Identity.Public) || !a.limits.penalise(sourceKey(src), penaltyAbandoned, now) {
+		return
+	}
+	metrics.OverlayPeerBanned()
+	log.Warn("overlay broadcast source banned", "source", fmt.Sprintf("%x", adnl.KeyID(src)), "for", a.cfg.Limits.BanDuration)
+}
+
+// isLocal reports whether from is this node's own address or peer ID.
+func (a *Adapter) isLocal(from string) bool {
+	if from == a.node.Addr() {
+		return true
+	}
+	id := a.node.PeerID()
+	return id != "" && peerKey(fromPeer(from)) == id
+}
+
+// dropReason labels the dropped broadcasts metric.
+func dropReason(err error) string {
+	switch {
+	case errors.Is(err, ErrNotMember):
+		return "not_member"
+	case errors.Is(err, ErrTooLarge):
+		return "too_large"
+	case errors.Is(err, ErrBadCertificate), errors.Is(err, ErrCertificateExpired):
+		return "bad_certificate"
+	case errors.Is(err, ErrStale):
+		return "stale"
+	case errors.Is(err, ErrDuplicate):
+		return "duplicate"
+	case errors.Is(err, ErrBanned):
+		return "banned"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ns.ErrTooLarge):
+		return "oversized"
+	default:
+		return "malformed"
+	}
+}
+
+func (a *Adapter) Unsubscribe(ctx context.Context, topic Topic) error {
+	a.mu.Lock()
+	if m, _ := a.joined(topic); m != nil {
+		delete(m.topics, topic)
+	}
+	a.mu.Unlock()
+	a.node.SetValidator(string(topic), nil)
+	log.Debug("overlay unsubscribed", "topic", string(topic))
+	return a.node.Unsubscribe(ctx, string(topic))
+}
+
+var _ Manager = (*Adapter)(nil)
@@ -0,0 +1,157 @@
+package overlay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/internal/netstack/mock"
+)
+
+func TestJoinPeerSample(t *testing.T) {
+	ctx := context.Background()
+	nw := mock.NewNetwork()
+	desc := []byte("overlay")
+	id := IDOf(desc)
+
+	// Members join; one of them goes away again, but its announcement
+	// stays listed until it expires.
+	live := make(map[string]bool)
+	var gone string
+	for i := 0; i < 7; i++ {
+		a := newTestAdapter(t, nw, testIdentity(byte(i+1)))
+		if _, err := a.Join(ctx, desc); err != nil {
+			t.Fatal(err)
+		}
+		if i == 6 {
+			gone = a.node.Addr()
+			if err := a.node.Close(ctx); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		live[a.node.Addr()] = true
+	}
+
+	const maxPeers = 3
+	sampled := make(map[string]bool)
+	for i := 0; i < 8; i++ {
+		a := newTestAdapterWith(t, nw, Config{Identity: testIdentity(byte(20 + i)), MaxPeers: maxPeers})
+		if _, err := a.Join(ctx, desc); err != nil {
+			t.Fatal(err)
+		}
+		peers, err := a.Peers(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(peers) != maxPeers {
+			t.Fatalf("observer %d keeps %d peers, want %d", i, len(peers), maxPeers)
+		}
+		seen := make(map[string]bool)
+		for _, p := range peers {
+			switch {
+			case p.Addr == a.node.Addr():
+				t.Fatalf("observer %d samples itself", i)
+			case p.Addr == gone:
+				t.Fatalf("observer %d samples an unreachable member", i)
+			case !live[p.Addr]:
+				t.Fatalf("observer %d samples %s, not a member", i, p.Addr)
+			case seen[p.Addr]:
+				t.Fatalf("observer %d samples %s twice", i, p.Addr)
+			}
+			seen[p.Addr] = true
+			sampled[p.Addr] = true
+		}
+
+		// Members that stay listed are kept on refresh.
+		if n := a.refresh(ctx, id); n != maxPeers {
+			t.Fatalf("observer %d keeps %d peers after refresh, want %d", i, n, maxPeers)
+		}
+		again, _ := a.Peers(id)
+		for _, p := range again {
+			if !seen[p.Addr] {
+				t.Fatalf("observer %d replaced a listed member on refresh", i)
+			}
+		}
+		live[a.node.Addr()] = true
+	}
+	// Samples are random: the observers do not all pick the same members.
+	if len(sampled) <= maxPeers {
+		t.Fatalf("%d observers sampled only %d distinct peers", 8, len(sampled))
+	}
+}
+
+func TestLeave(t *testing.T) {
+	ctx := context.Background()
+	nw := mock.NewNetwork()
+	desc := []byte("overlay")
+	id := IDOf(desc)
+
+	member := newTestAdapter(t, nw, testIdentity(1))
+	a := newTestAdapter(t, nw, testIdentity(2))
+	for _, x := range []*Adapter{member, a} {
+		if _, err := x.Join(ctx, desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var scoped []<-chan Broadcast
+	for _, name := range []string{"blocks", "votes"} {
+		ch, err := a.Subscribe(ctx, id.Topic(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scoped = append(scoped, ch)
+	}
+	unscoped, err := a.Subscribe(ctx, Topic("global"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Leave(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	for i, ch := range scoped {
+		select {
+		case _, ok := <-ch:
+			if ok {
+				t.Fatalf("subscription %d delivered after Leave", i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("subscription %d not closed by Leave", i)
+		}
+	}
+	if _, err := a.Peers(id); !errors.Is(err, ErrNotJoined) {
+		t.Fatalf("Peers after Leave = %v, want ErrNotJoined", err)
+	}
+	if _, err := a.Subscribe(ctx, id.Topic("blocks")); !errors.Is(err, ErrNotJoined) {
+		t.Fatalf("Subscribe after Leave = %v, want ErrNotJoined", err)
+	}
+	if err := a.Publish(ctx, id.Topic("blocks"), []byte("late")); !errors.Is(err, ErrNotJoined) {
+		t.Fatalf("Publish after Leave = %v, want ErrNotJoined", err)
+	}
+	if err := a.Leave(ctx, id); !errors.Is(err, ErrNotJoined) {
+		t.Fatalf("second Leave = %v, want ErrNotJoined", err)
+	}
+
+	// Subscriptions outside the overlay are left alone.
+	if err := member.Publish(ctx, Topic("global"), []byte("still here")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case b, ok := <-unscoped:
+		if !ok || string(b.Data) != "still here" {
+			t.Fatalf("unscoped subscription: %q, %v", b.Data, ok)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("unscoped subscription closed by Leave")
+	}
+
+	// Joining again restores the overlay.
+	if _, err := a.Join(ctx, desc); err != nil {
+		t.Fatal(err)
+	}
+	if peers, err := a.Peers(id); err != nil || len(peers) != 1 || peers[0].Addr != member.node.Addr() {
+		t.Fatalf("Peers after rejoining = %v, %v", peers, err)
+	}
+}
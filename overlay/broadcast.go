@@ -0,0 +1,470 @@
+package overlay
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+	"github.com/grishinium-blockchain/grishinium-go/fec"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+const (
+	// MaxSimpleBroadcastSize is the largest payload sent as one broadcast;
+	// larger payloads are FEC-encoded into parts.
+	MaxSimpleBroadcastSize = 768
+	// MaxFECBroadcastSize bounds FEC-encoded payloads.
+	MaxFECBroadcastSize = 16 << 20
+
+	// fecSymbolSize is the smallest FEC part; parts grow for large payloads
+	// so that half of the symbols are left for repair.
+	fecSymbolSize       = 768
+	maxFECSourceSymbols = fec.MaxSymbols / 2
+	// fecRepairDiv sets the repair parts sent: one per fecRepairDiv source
+	// parts, plus one, so that some parts may be lost on the way.
+	fecRepairDiv = 4
+	// maxFECInFlight bounds the FEC broadcasts being reassembled at once by
+	// one subscription, and maxFECPerSource those of one source. Beyond
+	// either, the least complete reassembly is abandoned.
+	maxFECInFlight  = 16
+	maxFECPerSource = 4
+
+	// seenTTL is how long broadcast hashes are remembered after the later of
+	// their arrival and their date. Broadcasts dated further than seenTTL in
+	// the past are refused, so a replay is either still remembered or stale.
+	seenTTL = 2 * time.Minute
+	// maxClockSkew is how far in the future a broadcast may be dated.
+	maxClockSkew = 20 * time.Second
+	// sweepInterval is how often expired hashes and reassemblies are dropped.
+	sweepInterval = 10 * time.Second
+)
+
+var (
+	// ErrBadBroadcast is returned for broadcasts that cannot be decoded or
+	// whose signatures do not verify.
+	ErrBadBroadcast = errors.New("overlay: bad broadcast")
+	// ErrStale is returned for broadcasts dated outside the accepted window.
+	ErrStale = errors.New("overlay: broadcast date out of range")
+	// ErrDuplicate is returned for broadcasts that were already delivered.
+	ErrDuplicate = errors.New("overlay: duplicate broadcast")
+)
+
+// Broadcast is a message received on an overlay topic, with the signed
+// metadata of its sender.
+type Broadcast struct {
+	Topic  Topic
+	Source ed25519.PublicKey
+	// Hash identifies the broadcast (overlay.broadcast.id or
+	// overlay.broadcastFec.id); receivers deliver each hash once.
+	Hash [32]byte
+	Date time.Time
+	// FEC is set when the payload was reassembled from FEC parts.
+	FEC  bool
+	Data []byte
+}
+
+// SourceID returns the sender's ADNL ID.
+func (b *Broadcast) SourceID() [32]byte { return adnl.KeyID(b.Source) }
+
+// envelope is a signed overlay.broadcast, or one part of an
+// overlay.broadcastFec when fec is set.
+type envelope struct {
+	src   ed25519.PublicKey
+	cert  *Certificate
+	flags int32
+	data  []byte
+	date  int32
+	sig   []byte
+
+	fec      *fec.Params
+	dataHash [32]byte
+	seqno    int32
+}
+
+// sealBroadcasts returns the messages that carry data: one signed broadcast,
+// or signed FEC parts when data exceeds MaxSimpleBroadcastSize.
+func sealBroadcasts(id keyring.Identity, cert *Certificate, data []byte, now time.Time) ([][]byte, error) {
+	date := int32(now.Unix())
+	if len(data) <= MaxSimpleBroadcastSize {
+		e := &envelope{src: id.Public, cert: cert, data: data, date: date}
+		e.sign(id.Private)
+		return [][]byte{e.marshal()}, nil
+	}
+	if len(data) > MaxFECBroadcastSize {
+		return nil, fmt.Errorf("overlay: %d byte broadcast exceeds %d", len(data), MaxFECBroadcastSize)
+	}
+	size := max(fecSymbolSize, (len(data)+maxFECSourceSymbols-1)/maxFECSourceSymbols)
+	enc, err := fec.NewEncoder(data, size)
+	if err != nil {
+		return nil, err
+	}
+	p := enc.Params()
+	parts := p.SymbolsCount + p.SymbolsCount/fecRepairDiv + 1
+	out := make([][]byte, 0, parts)
+	for seqno := 0; seqno < parts; seqno++ {
+		sym, err := enc.Symbol(seqno)
+		if err != nil {
+			return nil, err
+		}
+		e := &envelope{src: id.Public, cert: cert, data: sym, date: date, fec: &p, dataHash: sha256.Sum256(data), seqno: int32(seqno)}
+		e.sign(id.Private)
+		out = append(out, e.marshal())
+	}
+	return out, nil
+}
+
+// id returns the broadcast hash, shared by all parts of a FEC broadcast.
+func (e *envelope) id() [32]byte {
+	src := adnl.KeyID(e.src)
+	var w tl.Writer
+	if e.fec == nil {
+		dataHash := sha256.Sum256(e.data)
+		w.WriteUint32(tlBroadcastID)
+		w.WriteRaw(src[:])
+		w.WriteRaw(dataHash[:])
+		w.WriteInt32(e.flags)
+		return sha256.Sum256(w.Bytes())
+	}
+	var t tl.Writer
+	writeFECType(&t, *e.fec)
+	typ := sha256.Sum256(t.Bytes())
+	w.WriteUint32(tlBroadcastFECID)
+	w.WriteRaw(src[:])
+	w.WriteRaw(typ[:])
+	w.WriteRaw(e.dataHash[:])
+	w.WriteInt32(int32(e.fec.DataSize))
+	w.WriteInt32(e.flags)
+	return sha256.Sum256(w.Bytes())
+}
+
+// signedPayload is the boxed overlay.broadcast.toSign. For FEC parts it
+// covers the hash of overlay.broadcastFec.partId, so each part is signed.
+func (e *envelope) signedPayload() []byte {
+	hash := e.id()
+	if e.fec != nil {
+		partHash := sha256.Sum256(e.data)
+		var w tl.Writer
+		w.WriteUint32(tlBroadcastFECPartID)
+		w.WriteRaw(hash[:])
+		w.WriteRaw(partHash[:])
+		w.WriteInt32(e.seqno)
+		hash = sha256.Sum256(w.Bytes())
+	}
+	var w tl.Writer
+	w.WriteUint32(tlBroadcastToSign)
+	w.WriteRaw(hash[:])
+	w.WriteInt32(e.date)
+	return w.Bytes()
+}
+
+func (e *envelope) sign(priv ed25519.PrivateKey) { e.sig = ed25519.Sign(priv, e.signedPayload()) }
+
+func (e *envelope) verify() error {
+	if !ed25519.Verify(e.src, e.signedPayload(), e.sig) {
+		return fmt.Errorf("%w: signature does not verify", ErrBadBroadcast)
+	}
+	return nil
+}
+
+// size returns the size of the payload the envelope carries all or part of.
+func (e *envelope) size() int {
+	if e.fec != nil {
+		return e.fec.DataSize
+	}
+	return len(e.data)
+}
+
+func (e *envelope) marshal() []byte {
+	var w tl.Writer
+	if e.fec == nil {
+		w.WriteUint32(tlBroadcast)
+	} else {
+		w.WriteUint32(tlBroadcastFEC)
+	}
+	w.WriteUint32(tlPubEd25519)
+	w.WriteRaw(e.src)
+	writeCertificate(&w, e.cert)
+	if e.fec == nil {
+		w.WriteInt32(e.flags)
+		w.WriteBytes(e.data)
+	} else {
+		w.WriteRaw(e.dataHash[:])
+		w.WriteInt32(int32(e.fec.DataSize))
+		w.WriteInt32(e.flags)
+		w.WriteBytes(e.data)
+		w.WriteInt32(e.seqno)
+		writeFECType(&w, *e.fec)
+	}
+	w.WriteInt32(e.date)
+	w.WriteBytes(e.sig)
+	return w.Bytes()
+}
+
+// unmarshalEnvelope decodes a broadcast or FEC part. The signature is not
+// verified.
+func unmarshalEnvelope(msg []byte) (*envelope, error) {
+	r := tl.NewReader(msg)
+	c := r.Uint32()
+	if c != tlBroadcast && c != tlBroadcastFEC {
+		if r.Err() != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadBroadcast, r.Err())
+		}
+		return nil, fmt.Errorf("%w: unexpected constructor %08x", ErrBadBroadcast, c)
+	}
+	src, err := readPublicKey(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadBroadcast, err)
+	}
+	e := &envelope{src: src}
+	if e.cert, err = readCertificate(r); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadBroadcast, err)
+	}
+	if c == tlBroadcast {
+		e.flags = r.Int32()
+		e.data = r.Bytes()
+	} else {
+		e.dataHash = r.Int256()
+		dataSize := r.Int32()
+		e.flags = r.Int32()
+		e.data = r.Bytes()
+		e.seqno = r.Int32()
+		p, err := readFECType(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.Validate(); err != nil || p.DataSize != int(dataSize) || p.DataSize > MaxFECBroadcastSize {
+			return nil, fmt.Errorf("%w: bad FEC parameters", ErrBadBroadcast)
+		}
+		if len(e.data) != p.SymbolSize || e.seqno < 0 || e.seqno >= fec.MaxSymbols {
+			return nil, fmt.Errorf("%w: bad FEC part", ErrBadBroadcast)
+		}
+		e.fec = &p
+	}
+	e.date = r.Int32()
+	e.sig = r.Bytes()
+	if r.Err() != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadBroadcast, r.Err())
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%w: trailing bytes", ErrBadBroadcast)
+	}
+	return e, nil
+}
+
+// checkDate refuses broadcasts dated outside the window receivers remember.
+func (e *envelope) checkDate(now time.Time) error { return checkDate(e.date, now) }
+
+// checkDate refuses dates further than seenTTL in the past or maxClockSkew
+// in the future.
+func checkDate(unix int32, now time.Time) error {
+	if date := time.Unix(int64(unix), 0); date.Before(now.Add(-seenTTL)) || date.After(now.Add(maxClockSkew)) {
+		return ErrStale
+	}
+	return nil
+}
+
+// forgetAt returns when the hash of a broadcast received at now may be
+// forgotten: once checkDate refuses its date, which has a resolution of one
+// second.
+func (e *envelope) forgetAt(now time.Time) time.Time {
+	if date := time.Unix(int64(e.date), 0); date.After(now) {
+		now = date
+	}
+	return now.Add(seenTTL + time.Second)
+}
+
+func writeFECType(w *tl.Writer, p fec.Params) {
+	w.WriteUint32(tlFECReedSolomon)
+	w.WriteInt32(int32(p.DataSize))
+	w.WriteInt32(int32(p.SymbolSize))
+	w.WriteInt32(int32(p.SymbolsCount))
+}
+
+func readFECType(r *tl.Reader) (fec.Params, error) {
+	if c := r.Uint32(); c != tlFECReedSolomon {
+		if r.Err() != nil {
+			return fec.Params{}, fmt.Errorf("%w: %v", ErrBadBroadcast, r.Err())
+		}
+		return fec.Params{}, fmt.Errorf("%w: unsupported FEC type %08x", ErrBadBroadcast, c)
+	}
+	p := fec.Params{DataSize: int(r.Int32()), SymbolSize: int(r.Int32()), SymbolsCount: int(r.Int32())}
+	return p, r.Err()
+}
+
+// receiver deduplicates the broadcasts of one subscription and reassembles
+// FEC broadcasts, whose parts may come from different peers. Signatures,
+// dates and membership are checked beforehand by the topic's validator (see
+// Adapter.validate).
+type receiver struct {
+	topic     Topic
+	seen      map[[32]byte]time.Time // broadcast hash -> forget time
+	fec       map[[32]byte]*assembly
+	sources   map[[32]byte]int // source ID -> reassemblies in flight
+	nextSweep time.Time
+	// abandoned, when set, is called with the source of every reassembly
+	// given up before completion, evicted or expired.
+	abandoned func(src ed25519.PublicKey, now time.Time)
+}
+
+// assembly is a FEC broadcast being reassembled.
+type assembly struct {
+	first   *envelope
+	src     [32]byte
+	dec     *fec.Decoder
+	started time.Time
+	expires time.Time
+	forget  time.Time // latest forgetAt of the parts received
+}
+
+func newReceiver(topic Topic) *receiver {
+	return &receiver{
+		topic:   topic,
+		seen:    make(map[[32]byte]time.Time),
+		fec:     make(map[[32]byte]*assembly),
+		sources: make(map[[32]byte]int),
+	}
+}
+
+// receive handles one validated message. It returns the broadcast once it
+// is complete, nil while a FEC broadcast is still missing parts, or an error
+// when the message is refused.
+func (r *receiver) receive(msg []byte, now time.Time) (*Broadcast, error) {
+	e, err := unmarshalEnvelope(msg)
+	if err != nil {
+		return nil, err
+	}
+	r.sweep(now)
+	hash := e.id()
+	if _, ok := r.seen[hash]; ok {
+		if e.fec != nil {
+			// Parts keep arriving after the payload was rebuilt.
+			return nil, nil
+		}
+		return nil, ErrDuplicate
+	}
+	if e.fec == nil {
+		r.seen[hash] = e.forgetAt(now)
+		return r.broadcast(e, hash, e.data), nil
+	}
+
+	a, ok := r.fec[hash]
+	if !ok {
+		dec, err := fec.NewDecoder(*e.fec)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadBroadcast, err)
+		}
+		a = &assembly{first: e, src: adnl.KeyID(e.src), dec: dec, started: now, expires: now.Add(seenTTL)}
+		r.makeRoom(a.src, now)
+		r.fec[hash] = a
+		r.sources[a.src]++
+	}
+	done, err := a.dec.Add(int(e.seqno), e.data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadBroadcast, err)
+	}
+	if forget := e.forgetAt(now); forget.After(a.forget) {
+		a.forget = forget
+	}
+	if !done {
+		return nil, nil
+	}
+	r.remove(hash, a)
+	r.seen[hash] = a.forget
+	data, err := a.dec.Data()
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); !bytes.Equal(sum[:], e.dataHash[:]) {
+		return nil, fmt.Errorf("%w: FEC payload does not match its hash", ErrBadBroadcast)
+	}
+	b := r.broadcast(a.first, hash, data)
+	b.FEC = true
+	return b, nil
+}
+
+func (r *receiver) broadcast(e *envelope, hash [32]byte, data []byte) *Broadcast {
+	return &Broadcast{
+		Topic:  r.topic,
+		Source: e.src,
+		Hash:   hash,
+		Date:   time.Unix(int64(e.date), 0),
+		Data:   append([]byte(nil), data...),
+	}
+}
+
+// makeRoom abandons the least complete reassembly of src when it has
+// maxFECPerSource in flight, then the least complete of all when
+// maxFECInFlight are in flight.
+func (r *receiver) makeRoom(src [32]byte, now time.Time) {
+	if r.sources[src] >= maxFECPerSource {
+		r.abandonWorst(func(a *assembly) bool { return a.src == src }, now)
+	}
+	if len(r.fec) >= maxFECInFlight {
+		r.abandonWorst(func(*assembly) bool { return true }, now)
+	}
+}
+
+// abandonWorst abandons the least complete of the reassemblies that match.
+func (r *receiver) abandonWorst(match func(*assembly) bool, now time.Time) {
+	var (
+		worst [32]byte
+		wa    *assembly
+	)
+	for h, a := range r.fec {
+		if match(a) && (wa == nil || a.behind(wa)) {
+			worst, wa = h, a
+		}
+	}
+	if wa != nil {
+		r.abandon(worst, wa, now)
+	}
+}
+
+// behind reports whether a has a smaller share of its symbols than b, or the
+// same share and started earlier.
+func (a *assembly) behind(b *assembly) bool {
+	pa := a.dec.Received() * b.first.fec.SymbolsCount
+	pb := b.dec.Received() * a.first.fec.SymbolsCount
+	if pa != pb {
+		return pa < pb
+	}
+	return a.started.Before(b.started)
+}
+
+// abandon gives up the reassembly of hash and reports its source.
+func (r *receiver) abandon(hash [32]byte, a *assembly, now time.Time) {
+	r.remove(hash, a)
+	if r.abandoned != nil {
+		r.abandoned(a.first.src, now)
+	}
+}
+
+func (r *receiver) remove(hash [32]byte, a *assembly) {
+	delete(r.fec, hash)
+	if r.sources[a.src]--; r.sources[a.src] <= 0 {
+		delete(r.sources, a.src)
+	}
+}
+
+// sweep forgets expired hashes and abandons stalled reassemblies.
+func (r *receiver) sweep(now time.Time) {
+	if now.Before(r.nextSweep) {
+		return
+	}
+	r.nextSweep = now.Add(sweepInterval)
+	for h, t := range r.seen {
+		if !t.After(now) {
+			delete(r.seen, h)
+		}
+	}
+	for h, a := range r.fec {
+		if !a.expires.After(now) {
+			r.abandon(h, a, now)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package overlay
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+	"github.com/grishinium-blockchain/grishinium-go/dht"
+	"github.com/grishinium-blockchain/grishinium-go/internal/netstack"
+	"github.com/grishinium-blockchain/grishinium-go/internal/netstack/mock"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+)
+
+func testIdentity(seed byte) keyring.Identity {
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+	return keyring.Identity{Private: priv, Public: priv.Public().(ed25519.PublicKey)}
+}
+
+// newTestAdapter returns a started adapter with identity id on a node of nw.
+func newTestAdapter(t *testing.T, nw *mock.Network, id keyring.Identity) *Adapter {
+	t.Helper()
+	return newTestAdapterWith(t, nw, Config{Identity: id})
+}
+
+// newTestAdapterWith returns a started adapter configured by cfg on a node
+// of nw.
+func newTestAdapterWith(t *testing.T, nw *mock.Network, cfg Config) *Adapter {
+	t.Helper()
+	ctx := context.Background()
+	n := nw.NewNode(netstack.Config{})
+	if err := n.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	self := dht.Peer{ID: n.PeerID(), Addr: n.Addr(), Addrs: []string{n.Addr()}}
+	a := NewAdapter(n, dht.NewAdapter(n, self, cfg.Identity, nil), cfg)
+	if err := a.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = a.Close(ctx)
+		_ = n.Close(ctx)
+	})
+	return a
+}
+
+// fecParts seals a payload large enough to be sent as FEC parts.
+func fecParts(t *testing.T, id keyring.Identity, tag string, now time.Time) [][]byte {
+	t.Helper()
+	data := bytes.Repeat([]byte(tag), 4*MaxSimpleBroadcastSize/len(tag)+1)
+	parts, err := sealBroadcasts(id, nil, data, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) < 2 {
+		t.Fatalf("%d byte payload sealed into %d parts", len(data), len(parts))
+	}
+	return parts
+}
+
+func TestReceiverFECEviction(t *testing.T) {
+	now := time.Now()
+	flooder, honest := testIdentity(1), testIdentity(2)
+	r := newReceiver("topic")
+	var abandoned []ed25519.PublicKey
+	r.abandoned = func(src ed25519.PublicKey, now time.Time) { abandoned = append(abandoned, src) }
+
+	// The honest source's broadcast is half received when the flood starts.
+	honestParts := fecParts(t, honest, "honest", now)
+	for _, p := range honestParts[:2] {
+		if b, err := r.receive(p, now); b != nil || err != nil {
+			t.Fatalf("first parts: %v, %v", b, err)
+		}
+	}
+	// The flooder starts more broadcasts than it may have in flight and
+	// never finishes them; its own oldest reassemblies are given up.
+	for i := 0; i < 3*maxFECPerSource; i++ {
+		if _, err := r.receive(fecParts(t, flooder, fmt.Sprint("flood", i), now)[0], now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := r.sources[adnl.KeyID(flooder.Public)]; n != maxFECPerSource {
+		t.Fatalf("flooder has %d reassemblies in flight, want %d", n, maxFECPerSource)
+	}
+	if len(abandoned) != 2*maxFECPerSource {
+		t.Fatalf("%d reassemblies abandoned, want %d", len(abandoned), 2*maxFECPerSource)
+	}
+	for _, src := range abandoned {
+		if !src.Equal(flooder.Public) {
+			t.Fatal("abandoned reassembly held against the wrong source")
+		}
+	}
+
+	// The honest broadcast survives and completes.
+	var got []byte
+	for _, p := range honestParts[2:] {
+		b, err := r.receive(p, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b != nil {
+			got = b.Data
+			break
+		}
+	}
+	if got == nil || !bytes.HasPrefix(got, []byte("honest")) {
+		t.Fatal("honest FEC broadcast was not rebuilt")
+	}
+
+	// Many sources together fill the subscription; the least complete
+	// reassemblies, the flooder's oldest, go first.
+	abandoned = nil
+	before := len(r.fec)
+	for i := 0; i < maxFECInFlight+1; i++ {
+		// Later arrivals: of equally complete reassemblies the oldest goes.
+		at := now.Add(time.Duration(i+1) * time.Millisecond)
+		if _, err := r.receive(fecParts(t, testIdentity(byte(10+i)), "other", now)[0], at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(r.fec) != maxFECInFlight {
+		t.Fatalf("%d reassemblies in flight, want %d", len(r.fec), maxFECInFlight)
+	}
+	if len(abandoned) != before+1 {
+		t.Fatalf("%d reassemblies abandoned, want %d", len(abandoned), before+1)
+	}
+	for _, src := range abandoned[:before] {
+		if !src.Equal(flooder.Public) {
+			t.Fatal("a newer reassembly was abandoned before the flooder's")
+		}
+	}
+
+	// Reassemblies that stall expire and are held against their source too.
+	abandoned = nil
+	r.sweep(now.Add(seenTTL + sweepInterval))
+	if len(r.fec) != 0 || len(r.sources) != 0 || len(abandoned) != maxFECInFlight {
+		t.Fatalf("after expiry: %d in flight, %d sources, %d abandoned", len(r.fec), len(r.sources), len(abandoned))
+	}
+}
+
+// TestReceiverReplayWindow replays a broadcast dated as far ahead as
+// accepted, until well after its date leaves the window: every replay is
+// refused, as a duplicate while the hash is remembered and as stale after.
+func TestReceiverReplayWindow(t *testing.T) {
+	src := testIdentity(1)
+	now := time.Now().Truncate(time.Second)
+	tests := []struct {
+		name string
+		date time.Time
+		data []byte
+	}{
+		{"simple, dated ahead", now.Add(maxClockSkew), []byte("simple")},
+		{"simple, dated behind", now.Add(-seenTTL / 2), []byte("simple")},
+		{"fec, dated ahead", now.Add(maxClockSkew), bytes.Repeat([]byte("fec"), MaxSimpleBroadcastSize)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, err := sealBroadcasts(src, nil, tt.data, tt.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := newReceiver("topic")
+			// deliver runs the checks of Adapter.validate that the receiver
+			// relies on, then the receiver.
+			deliver := func(at time.Time) (delivered bool, err error) {
+				for _, msg := range msgs {
+					e, err := unmarshalEnvelope(msg)
+					if err != nil {
+						return false, err
+					}
+					if err := e.checkDate(at); err != nil {
+						return false, err
+					}
+					b, err := r.receive(msg, at)
+					if err != nil {
+						return false, err
+					}
+					delivered = delivered || b != nil
+				}
+				return delivered, nil
+			}
+			if ok, err := deliver(now); !ok || err != nil {
+				t.Fatalf("first delivery: %v, %v", ok, err)
+			}
+			end := tt.date.Add(seenTTL + 2*sweepInterval)
+			for at := now.Add(time.Second); at.Before(end); at = at.Add(time.Second) {
+				if ok, _ := deliver(at); ok {
+					t.Fatalf("replay accepted %v after the first delivery", at.Sub(now))
+				}
+			}
+		})
+	}
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	src, authority := testIdentity(1), testIdentity(2)
+	now := time.Now()
+	cert := IssueCertificate(authority.Private, IDOf([]byte("overlay")), src.Public, now.Add(time.Hour), MaxFECBroadcastSize)
+	tests := []struct {
+		name string
+		cert *Certificate
+		data []byte
+	}{
+		{"simple", nil, []byte("simple")},
+		{"empty", nil, nil},
+		{"simple with certificate", cert, []byte("certified")},
+		{"fec", nil, bytes.Repeat([]byte("fec"), MaxSimpleBroadcastSize)},
+		{"fec with certificate", cert, bytes.Repeat([]byte("fec"), MaxSimpleBroadcastSize)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, err := sealBroadcasts(src, tt.cert, tt.data, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var hash [32]byte
+			for i, msg := range msgs {
+				e, err := unmarshalEnvelope(msg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := e.verify(); err != nil {
+					t.Fatalf("part %d: %v", i, err)
+				}
+				if !bytes.Equal(e.marshal(), msg) {
+					t.Fatalf("part %d does not marshal back to the same bytes", i)
+				}
+				if !e.src.Equal(src.Public) || (e.cert != nil) != (tt.cert != nil) || e.date != int32(now.Unix()) {
+					t.Fatalf("part %d decoded with the wrong source, certificate or date", i)
+				}
+				if e.size() != len(tt.data) {
+					t.Fatalf("part %d: size %d, want %d", i, e.size(), len(tt.data))
+				}
+				if i == 0 {
+					hash = e.id()
+				} else if e.id() != hash {
+					t.Fatalf("part %d has another broadcast hash", i)
+				}
+
+				// A changed signature or payload no longer verifies. The
+				// certificate is signed by its authority, not the source.
+				bad := slices.Clone(msg)
+				bad[len(bad)-8] ^= 1 // in the signature, before the TL padding
+				if e, err := unmarshalEnvelope(bad); err != nil || e.verify() == nil {
+					t.Fatalf("part %d with a changed signature: %v", i, err)
+				}
+				if len(e.data) > 0 {
+					e.data[0] ^= 1
+					if e.verify() == nil {
+						t.Fatalf("part %d verifies with a changed payload", i)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestBroadcastOverMockNetwork sends broadcasts to a subscribed adapter over
+// a mock network, from a member publishing them and from a relay forwarding
+// sealed messages as a peer would, and checks that each broadcast is
+// delivered once and forged or stale ones never are.
+func TestBroadcastOverMockNetwork(t *testing.T) {
+	ctx := context.Background()
+	nw := mock.NewNetwork()
+	src := testIdentity(1)
+	desc := []byte("overlay")
+	topic := IDOf(desc).Topic("blocks")
+
+	sender := newTestAdapter(t, nw, src)
+	receiver := newTestAdapter(t, nw, testIdentity(2))
+	for _, a := range []*Adapter{sender, receiver} {
+		if _, err := a.Join(ctx, desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ch, err := receiver.Subscribe(ctx, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay := nw.NewNode(netstack.Config{})
+	if err := relay.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = relay.Close(ctx) })
+
+	seal := func(data []byte, date time.Time) [][]byte {
+		msgs, err := sealBroadcasts(src, nil, data, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msgs
+	}
+	forward := func(msgs ...[][]byte) func() error {
+		return func() error {
+			for _, m := range msgs {
+				for _, msg := range m {
+					if err := relay.Publish(ctx, string(topic), msg); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+	}
+	// delivered returns the broadcasts delivered before a marker broadcast
+	// sent after them.
+	markers := 0
+	delivered := func() []Broadcast {
+		markers++
+		marker := fmt.Sprint("marker ", markers)
+		if err := forward(seal([]byte(marker), time.Now()))(); err != nil {
+			t.Fatal(err)
+		}
+		var got []Broadcast
+		for {
+			select {
+			case b := <-ch:
+				if string(b.Data) == marker {
+					return got
+				}
+				got = append(got, b)
+			case <-time.After(5 * time.Second):
+				t.Fatal("marker broadcast not delivered")
+			}
+		}
+	}
+
+	now := time.Now()
+	large := bytes.Repeat([]byte("large"), MaxSimpleBroadcastSize)
+	fecMsgs := seal(bytes.Repeat([]byte("parts"), MaxSimpleBroadcastSize), now)
+	reordered := slices.Clone(fecMsgs[1:]) // the first part is lost
+	slices.Reverse(reordered)
+	tampered := seal([]byte("tampered"), now)
+	tampered[0][len(tampered[0])-8] ^= 1 // in the signature
+	replayed := seal([]byte("replayed"), now)
+
+	tests := []struct {
+		name string
+		send func() error
+		want [][]byte // payloads delivered, in order
+		fec  bool
+	}{
+		{"published", func() error { return sender.Publish(ctx, topic, []byte("published")) }, [][]byte{[]byte("published")}, false},
+		{"published as fec", func() error { return sender.Publish(ctx, topic, large) }, [][]byte{large}, true},
+		{"republished", func() error { return sender.Publish(ctx, topic, []byte("published")) }, nil, false},
+		{"forwarded twice", forward(replayed, replayed), [][]byte{[]byte("replayed")}, false},
+		{"replayed later", forward(replayed), nil, false},
+		{"fec parts lost and reordered", forward(reordered, fecMsgs), [][]byte{bytes.Repeat([]byte("parts"), MaxSimpleBroadcastSize)}, true},
+		{"tampered", forward(tampered), nil, false},
+		{"stale", forward(seal([]byte("stale"), now.Add(-2*seenTTL))), nil, false},
+		{"dated too far ahead", forward(seal([]byte("ahead"), now.Add(2*maxClockSkew))), nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.send(); err != nil {
+				t.Fatal(err)
+			}
+			got := delivered()
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d broadcasts delivered, want %d", len(got), len(tt.want))
+			}
+			for i, b := range got {
+				if !bytes.Equal(b.Data, tt.want[i]) || b.FEC != tt.fec || !b.Source.Equal(src.Public) || b.Topic != topic {
+					t.Fatalf("broadcast %d delivered as %d bytes, fec %v, from %x", i, len(b.Data), b.FEC, b.SourceID())
+				}
+			}
+		})
+	}
+}
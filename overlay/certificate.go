@@ -0,0 +1,146 @@
+package overlay
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/adnl"
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+var (
+	// ErrBadCertificate is returned for certificates whose signatures do not
+	// verify or that were issued for another overlay or key.
+	ErrBadCertificate = errors.New("overlay: bad certificate")
+	// ErrCertificateExpired is returned for certificates past their expiry.
+	ErrCertificateExpired = errors.New("overlay: certificate expired")
+)
+
+// Certificate admits a key to a private overlay on behalf of an authority
+// (overlay.certificate). It is bound to one overlay and one member key, and
+// limits the size of the member's broadcasts.
+type Certificate struct {
+	IssuedBy  ed25519.PublicKey
+	ExpireAt  int32 // unix time
+	MaxSize   int32 // largest broadcast payload or request the member may send
+	Signature []byte
+}
+
+// IssueCertificate returns a certificate signed by authority that admits
+// member to the overlay until expireAt.
+func IssueCertificate(authority ed25519.PrivateKey, overlay ID, member ed25519.PublicKey, expireAt time.Time, maxSize int) *Certificate {
+	c := &Certificate{
+		IssuedBy: authority.Public().(ed25519.PublicKey),
+		ExpireAt: int32(expireAt.Unix()),
+		MaxSize:  int32(maxSize),
+	}
+	c.Signature = ed25519.Sign(authority, c.signedPayload(overlay, member))
+	return c
+}
+
+// Expires returns the time the certificate stops being valid.
+func (c *Certificate) Expires() time.Time { return time.Unix(int64(c.ExpireAt), 0) }
+
+// Verify checks that the certificate admits member to the overlay at now.
+// It does not check that the issuer is an authority of the overlay.
+func (c *Certificate) Verify(overlay ID, member ed25519.PublicKey, now time.Time) error {
+	if len(c.IssuedBy) != ed25519.PublicKeySize || len(member) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: invalid public key", ErrBadCertificate)
+	}
+	if !ed25519.Verify(c.IssuedBy, c.signedPayload(overlay, member), c.Signature) {
+		return ErrBadCertificate
+	}
+	if !c.Expires().After(now) {
+		return ErrCertificateExpired
+	}
+	return nil
+}
+
+// signedPayload is the boxed overlay.certificateId.
+func (c *Certificate) signedPayload(overlay ID, member ed25519.PublicKey) []byte {
+	node := adnl.KeyID(member)
+	var w tl.Writer
+	w.WriteUint32(tlCertificateID)
+	w.WriteRaw(overlay[:])
+	w.WriteRaw(node[:])
+	w.WriteInt32(c.ExpireAt)
+	w.WriteInt32(c.MaxSize)
+	return w.Bytes()
+}
+
+// MarshalTL returns the boxed overlay.certificate form, as handed to members.
+func (c *Certificate) MarshalTL() []byte {
+	var w tl.Writer
+	writeCertificate(&w, c)
+	return w.Bytes()
+}
+
+// UnmarshalCertificate decodes a boxed overlay.certificate. The signature is
+// not verified.
+func UnmarshalCertificate(b []byte) (*Certificate, error) {
+	r := tl.NewReader(b)
+	c, err := readCertificate(r)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, errors.New("overlay: empty certificate")
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("overlay: trailing bytes after overlay.certificate")
+	}
+	return c, nil
+}
+
+// writeCertificate appends c, or overlay.emptyCertificate when c is nil.
+func writeCertificate(w *tl.Writer, c *Certificate) {
+	if c == nil {
+		w.WriteUint32(tlEmptyCertificate)
+		return
+	}
+	w.WriteUint32(tlCertificate)
+	w.WriteUint32(tlPubEd25519)
+	w.WriteRaw(c.IssuedBy)
+	w.WriteInt32(c.ExpireAt)
+	w.WriteInt32(c.MaxSize)
+	w.WriteBytes(c.Signature)
+}
+
+// readCertificate reads an overlay.Certificate; the empty one reads as nil.
+func readCertificate(r *tl.Reader) (*Certificate, error) {
+	switch c := r.Uint32(); c {
+	case tlEmptyCertificate:
+		return nil, r.Err()
+	case tlCertificate:
+	default:
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+		return nil, fmt.Errorf("overlay: unexpected constructor %08x for overlay.Certificate", c)
+	}
+	issuer, err := readPublicKey(r)
+	if err != nil {
+		return nil, err
+	}
+	c := &Certificate{IssuedBy: issuer}
+	c.ExpireAt = r.Int32()
+	c.MaxSize = r.Int32()
+	c.Signature = r.Bytes()
+	return c, r.Err()
+}
+
+func readPublicKey(r *tl.Reader) (ed25519.PublicKey, error) {
+	if c := r.Uint32(); c != tlPubEd25519 {
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+		return nil, fmt.Errorf("overlay: unsupported public key type %08x", c)
+	}
+	pub := r.Raw(ed25519.PublicKeySize)
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	return ed25519.PublicKey(append([]byte(nil), pub...)), nil
+}
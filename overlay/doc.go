@@ -1,3 +1,8 @@
-package overlay
-
 // Package overlay implements overlay network logic on top of ADNL/DHT.
+//
+// Large broadcasts are sent as overlay.broadcastFec parts encoded with the
+// Reed-Solomon code of package fec, not raptorQ. FEC broadcasts therefore
+// only interoperate between nodes of this implementation: other nodes drop
+// the parts, and raptorQ parts they send are refused here. Simple broadcasts
+// are not affected.
+package overlay
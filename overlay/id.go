@@ -0,0 +1,65 @@
+package overlay
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/grishinium-blockchain/grishinium-go/dht"
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+// ID identifies an overlay: the hash of its description, boxed as a
+// pub.overlay key. Members announce themselves in the DHT under it.
+type ID [32]byte
+
+// IDOf returns the ID of the overlay with the given description.
+func IDOf(description []byte) ID { return ID(dht.OverlayID(description)) }
+
+func (id ID) String() string { return hex.EncodeToString(id[:]) }
+
+// topicPrefix starts the names of overlay-scoped topics.
+const topicPrefix = "overlay/"
+
+// Topic returns the topic name within the overlay. Scoped topics of
+// different overlays never share messages, even when name is the same.
+func (id ID) Topic(name string) Topic {
+	return Topic(topicPrefix + id.String() + "/" + name)
+}
+
+// overlayOf returns the overlay a scoped topic belongs to.
+func overlayOf(t Topic) (ID, bool) {
+	rest, ok := strings.CutPrefix(string(t), topicPrefix)
+	if !ok {
+		return ID{}, false
+	}
+	h, _, ok := strings.Cut(rest, "/")
+	var id ID
+	if !ok || len(h) != 2*len(id) {
+		return ID{}, false
+	}
+	if _, err := hex.Decode(id[:], []byte(h)); err != nil {
+		return ID{}, false
+	}
+	return id, true
+}
+
+// metricLabel returns the overlay label of metrics about topic: the overlay
+// ID, or empty for unscoped topics.
+func metricLabel(t Topic) string {
+	if id, ok := overlayOf(t); ok {
+		return id.String()
+	}
+	return ""
+}
+
+// ShardDescription returns the description of the public overlay of a shard
+// (tonNode.shardPublicOverlayId). zeroStateFileHash is the file hash of the
+// network's zero state, so overlays of different networks do not mix.
+func ShardDescription(workchain int32, shard int64, zeroStateFileHash [32]byte) []byte {
+	var w tl.Writer
+	w.WriteUint32(tlShardPublicOverlayID)
+	w.WriteInt32(workchain)
+	w.WriteInt64(shard)
+	w.WriteRaw(zeroStateFileHash[:])
+	return w.Bytes()
+}
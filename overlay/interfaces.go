@@ -1,6 +1,14 @@
 package overlay
 
-import "context"
+import (
+	"context"
+	"errors"
+
+	"github.com/grishinium-blockchain/grishinium-go/dht"
+)
+
+// ErrNotJoined is returned for operations on an overlay this node has not joined.
+var ErrNotJoined = errors.New("overlay: not joined")
 
 // Topic represents an overlay broadcast topic.
 type Topic string
@@ -16,15 +24,35 @@ type Publisher interface {
 type Subscriber interface {
 	Start(ctx context.Context) error
 	Close(ctx context.Context) error
-	Subscribe(ctx context.Context, topic Topic) (<-chan []byte, error)
+	Subscribe(ctx context.Context, topic Topic) (<-chan Broadcast, error)
 	Unsubscribe(ctx context.Context, topic Topic) error
 }
 
-// Manager unifies publisher/subscriber aspects and membership controls.
+// Manager unifies publisher/subscriber aspects, membership controls and
+// point-to-point queries between members.
+// Topics scoped to an overlay (see ID.Topic) can only be used while the
+// overlay is joined.
 type Manager interface {
 	Publisher
 	Subscriber
 
-	Join(ctx context.Context, overlayID string) error
-	Leave(ctx context.Context, overlayID string) error
+	// Join makes this node a member of the overlay with the given
+	// description and returns the overlay's ID.
+	Join(ctx context.Context, description []byte) (ID, error)
+	// JoinPrivate joins the overlay as a private one, whose broadcasts are
+	// only delivered when sent by one of members.
+	JoinPrivate(ctx context.Context, description []byte, members Members) (ID, error)
+	// Leave stops announcing membership and closes the overlay's
+	// subscriptions.
+	Leave(ctx context.Context, id ID) error
+	// Peers returns the current sample of other members of a joined overlay.
+	Peers(id ID) ([]dht.Peer, error)
+
+	// SetHandler registers the handler of queries and messages sent to this
+	// node in a joined overlay.
+	SetHandler(id ID, h Handler) error
+	// Query asks a member of a joined overlay and returns its answer.
+	Query(ctx context.Context, id ID, peer dht.Peer, data []byte) ([]byte, error)
+	// SendMessage sends a one-way message to a member of a joined overlay.
+	SendMessage(ctx context.Context, id ID, peer dht.Peer, data []byte) error
 }
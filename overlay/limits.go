@@ -0,0 +1,265 @@
+package overlay
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	ns "github.com/grishinium-blockchain/grishinium-go/internal/netstack"
+)
+
+const (
+	// DefaultPeerRate is the overlay messages and queries accepted per second
+	// from one peer, across all overlays.
+	DefaultPeerRate = 500
+	// DefaultOverlayRate is the messages accepted per second in one overlay,
+	// from all peers together.
+	DefaultOverlayRate = 2000
+	// DefaultMaxMessageSize caps received broadcast messages.
+	DefaultMaxMessageSize = 1 << 20
+	// MinMessageSize is the smallest message cap that still fits every part
+	// of a MaxFECBroadcastSize broadcast.
+	MinMessageSize = MaxFECBroadcastSize/maxFECSourceSymbols + 1024
+	// DefaultBanThreshold is the penalty score at which a peer is banned.
+	DefaultBanThreshold = 100
+	// DefaultBanDuration is how long a banned peer is ignored.
+	DefaultBanDuration = 10 * time.Minute
+
+	// Penalties added to a peer's score; the score halves every
+	// scoreHalfLife, so occasional mistakes are forgiven.
+	penaltyInvalid   = 10 // undecodable, unsigned, non-member or oversized traffic
+	penaltyExcess    = 1  // rate limit exceeded, stale broadcasts
+	penaltyAbandoned = 5  // a source's FEC broadcast given up before it was rebuilt
+	scoreHalfLife    = time.Minute
+	// peerSweepInterval is how often idle peers are forgotten.
+	peerSweepInterval = time.Minute
+)
+
+var (
+	// ErrRateLimited is returned for traffic above a peer or overlay rate.
+	// It wraps netstack.ErrIgnore: the message is dropped, but the relaying
+	// peer is not held responsible by the network stack.
+	ErrRateLimited = fmt.Errorf("overlay: rate limit exceeded: %w", ns.ErrIgnore)
+	// ErrBanned is returned for traffic from a banned peer.
+	ErrBanned = fmt.Errorf("overlay: peer banned: %w", ns.ErrIgnore)
+
+	errPeerRate = fmt.Errorf("%w by peer", ErrRateLimited)
+)
+
+// Limits configures the flood protection of an Adapter. Zero values select
+// the defaults; a negative rate disables that limit and a negative
+// BanThreshold disables banning.
+//
+// Every peer has a token bucket refilled at PeerRate and holding up to
+// PeerBurst messages, and so does every overlay with OverlayRate and
+// OverlayBurst. Traffic above either rate is dropped. Invalid traffic, and
+// traffic above the peer's own rate, raises the peer's penalty score; at
+// BanThreshold the peer is disconnected and its traffic ignored for
+// BanDuration.
+type Limits struct {
+	PeerRate     float64
+	PeerBurst    int // defaults to twice PeerRate
+	OverlayRate  float64
+	OverlayBurst int // defaults to twice OverlayRate
+	// MaxMessageSize caps received broadcast messages, each a simple
+	// broadcast or one FEC part.
+	MaxMessageSize int
+	// MaxQuerySize caps received queries and messages; it defaults to
+	// netstack.MaxQuerySize.
+	MaxQuerySize int
+	BanThreshold float64
+	BanDuration  time.Duration
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.PeerRate == 0 {
+		l.PeerRate = DefaultPeerRate
+	}
+	if l.PeerBurst <= 0 {
+		l.PeerBurst = max(1, int(2*l.PeerRate))
+	}
+	if l.OverlayRate == 0 {
+		l.OverlayRate = DefaultOverlayRate
+	}
+	if l.OverlayBurst <= 0 {
+		l.OverlayBurst = max(1, int(2*l.OverlayRate))
+	}
+	if l.MaxMessageSize <= 0 {
+		l.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if l.MaxQuerySize <= 0 {
+		l.MaxQuerySize = ns.MaxQuerySize
+	}
+	if l.BanThreshold == 0 {
+		l.BanThreshold = DefaultBanThreshold
+	}
+	if l.BanDuration <= 0 {
+		l.BanDuration = DefaultBanDuration
+	}
+	return l
+}
+
+// bucket is a token bucket; the zero value is full.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take spends one token, refilled at rate up to burst, and reports whether
+// one was left. A negative rate always allows.
+func (b *bucket) take(rate float64, burst int, now time.Time) bool {
+	if rate < 0 {
+		return true
+	}
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// peerState is what the limiter knows of one peer.
+type peerState struct {
+	bucket
+	score       float64
+	scored      time.Time // when score was last decayed
+	bannedUntil time.Time
+}
+
+// decay brings the score to now.
+func (p *peerState) decay(now time.Time) {
+	if !p.scored.IsZero() {
+		p.score *= math.Exp2(-now.Sub(p.scored).Seconds() / scoreHalfLife.Seconds())
+	}
+	p.scored = now
+}
+
+// limiter enforces Limits. Peers are identified by peerKey, broadcast
+// sources by sourceKey.
+type limiter struct {
+	cfg Limits
+
+	mu        sync.Mutex
+	peers     map[string]*peerState
+	overlays  map[string]*bucket // by overlay ID, or topic when unscoped
+	nextSweep time.Time
+}
+
+func newLimiter(cfg Limits) *limiter {
+	return &limiter{cfg: cfg, peers: make(map[string]*peerState), overlays: make(map[string]*bucket)}
+}
+
+// allow takes a token from peer's bucket and, when scope is not empty, from
+// the bucket of the overlay scope.
+func (l *limiter) allow(peer, scope string, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	p := l.peer(peer)
+	if now.Before(p.bannedUntil) {
+		return ErrBanned
+	}
+	if !p.take(l.cfg.PeerRate, l.cfg.PeerBurst, now) {
+		return errPeerRate
+	}
+	if scope == "" {
+		return nil
+	}
+	b, ok := l.overlays[scope]
+	if !ok {
+		b = new(bucket)
+		l.overlays[scope] = b
+	}
+	if !b.take(l.cfg.OverlayRate, l.cfg.OverlayBurst, now) {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// penalise adds penalty to the score of peer and reports whether this got
+// the peer banned.
+func (l *limiter) penalise(peer string, penalty float64, now time.Time) bool {
+	if l.cfg.BanThreshold < 0 {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p := l.peer(peer)
+	if now.Before(p.bannedUntil) {
+		return false
+	}
+	p.decay(now)
+	p.score += penalty
+	if p.score < l.cfg.BanThreshold {
+		return false
+	}
+	p.score = 0
+	p.bannedUntil = now.Add(l.cfg.BanDuration)
+	return true
+}
+
+// banned reports whether key is banned at now.
+func (l *limiter) banned(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p, ok := l.peers[key]
+	return ok && now.Before(p.bannedUntil)
+}
+
+// sourceKey is the limiter key of a broadcast source, distinct from any
+// peer key.
+func sourceKey(src ed25519.PublicKey) string {
+	return "source:" + hex.EncodeToString(src)
+}
+
+// peer returns the state of peer, creating it; l.mu must be held.
+func (l *limiter) peer(key string) *peerState {
+	p, ok := l.peers[key]
+	if !ok {
+		p = new(peerState)
+		l.peers[key] = p
+	}
+	return p
+}
+
+// sweep forgets peers and overlays whose buckets have refilled and which
+// are neither banned nor noticeably penalised; l.mu must be held.
+func (l *limiter) sweep(now time.Time) {
+	if now.Before(l.nextSweep) {
+		return
+	}
+	l.nextSweep = now.Add(peerSweepInterval)
+	for k, p := range l.peers {
+		p.decay(now)
+		if now.Sub(p.last) >= peerSweepInterval && !now.Before(p.bannedUntil) && p.score < penaltyExcess {
+			delete(l.peers, k)
+		}
+	}
+	for k, b := range l.overlays {
+		if now.Sub(b.last) >= peerSweepInterval {
+			delete(l.overlays, k)
+		}
+	}
+}
+
+// penalty returns the score a peer earns for traffic refused with err.
+func penalty(err error) float64 {
+	switch {
+	case errors.Is(err, errPeerRate), errors.Is(err, ErrStale):
+		return penaltyExcess
+	case errors.Is(err, ns.ErrIgnore), errors.Is(err, ErrDuplicate), errors.Is(err, ErrNoHandler):
+		return 0
+	default:
+		return penaltyInvalid
+	}
+}
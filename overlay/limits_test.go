@@ -0,0 +1,196 @@
+package overlay
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ns "github.com/grishinium-blockchain/grishinium-go/internal/netstack"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	type step struct {
+		peer, scope string
+		at          time.Duration // since the first step
+		want        error
+	}
+	tests := []struct {
+		name   string
+		limits Limits
+		steps  []step
+	}{
+		{
+			name:   "per peer",
+			limits: Limits{PeerRate: 2, PeerBurst: 3, OverlayRate: -1},
+			steps: []step{
+				{"a", "", 0, nil},
+				{"a", "", 0, nil},
+				{"a", "o", 0, nil},
+				{"a", "", 0, errPeerRate},
+				{"b", "", 0, nil}, // every peer has its own bucket
+				{"a", "", 500 * time.Millisecond, nil},
+				{"a", "", 500 * time.Millisecond, errPeerRate},
+				// An idle peer refills up to the burst only.
+				{"a", "", 10 * time.Second, nil},
+				{"a", "", 10 * time.Second, nil},
+				{"a", "", 10 * time.Second, nil},
+				{"a", "", 10 * time.Second, errPeerRate},
+			},
+		},
+		{
+			name:   "per overlay",
+			limits: Limits{PeerRate: -1, OverlayRate: 1, OverlayBurst: 2},
+			steps: []step{
+				{"a", "o", 0, nil},
+				{"b", "o", 0, nil},
+				{"c", "o", 0, ErrRateLimited}, // the overlay is shared by all peers
+				{"c", "p", 0, nil},            // other overlays are not
+				{"c", "", 0, nil},             // unscoped traffic has no overlay bucket
+				{"c", "o", time.Second, nil},
+				{"a", "o", time.Second, ErrRateLimited},
+			},
+		},
+		{
+			name:   "peer bucket first",
+			limits: Limits{PeerRate: 1, PeerBurst: 1, OverlayRate: 1, OverlayBurst: 2},
+			steps: []step{
+				{"a", "o", 0, nil},
+				{"a", "o", 0, errPeerRate},
+				// The refused message took no overlay token.
+				{"b", "o", 0, nil},
+				{"c", "o", 0, ErrRateLimited},
+			},
+		},
+		{
+			name:   "disabled",
+			limits: Limits{PeerRate: -1, OverlayRate: -1},
+			steps: []step{
+				{"a", "o", 0, nil},
+				{"a", "o", 0, nil},
+				{"a", "o", 0, nil},
+				{"a", "o", 0, nil},
+				{"a", "o", 0, nil},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLimiter(tt.limits.withDefaults())
+			start := time.Unix(1700000000, 0)
+			for i, s := range tt.steps {
+				err := l.allow(s.peer, s.scope, start.Add(s.at))
+				if err != s.want {
+					t.Fatalf("step %d: allow(%q, %q) = %v, want %v", i, s.peer, s.scope, err, s.want)
+				}
+				if err != nil && !errors.Is(err, ns.ErrIgnore) {
+					t.Fatalf("step %d: %v does not wrap netstack.ErrIgnore", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterPenalise(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	l := newLimiter(Limits{}.withDefaults())
+
+	for i := 1; i < DefaultBanThreshold/penaltyInvalid; i++ {
+		if l.penalise("a", penaltyInvalid, start) {
+			t.Fatalf("banned after %d penalties", i)
+		}
+	}
+	if !l.penalise("a", penaltyInvalid, start) {
+		t.Fatal("not banned at the threshold")
+	}
+	if !l.banned("a", start) || l.banned("b", start) {
+		t.Fatal("ban not held against the penalised peer only")
+	}
+	if err := l.allow("a", "", start); err != ErrBanned {
+		t.Fatalf("allow of a banned peer = %v, want ErrBanned", err)
+	}
+	if l.penalise("a", DefaultBanThreshold, start.Add(time.Second)) {
+		t.Fatal("a banned peer was banned again")
+	}
+
+	// The ban expires, and the peer starts again with a clean score.
+	end := start.Add(DefaultBanDuration)
+	if !l.banned("a", end.Add(-time.Nanosecond)) || l.banned("a", end) {
+		t.Fatal("ban does not last exactly BanDuration")
+	}
+	if err := l.allow("a", "", end); err != nil {
+		t.Fatalf("allow after the ban = %v", err)
+	}
+	if l.penalise("a", DefaultBanThreshold-1, end) {
+		t.Fatal("score survived the ban")
+	}
+
+	// Scores halve every scoreHalfLife.
+	for _, tt := range []struct {
+		peer   string
+		second float64
+		want   bool
+	}{
+		{"c", DefaultBanThreshold / 2, false},
+		{"d", DefaultBanThreshold/2 + 1, true},
+	} {
+		l.penalise(tt.peer, DefaultBanThreshold-2, start)
+		if got := l.penalise(tt.peer, tt.second, start.Add(scoreHalfLife)); got != tt.want {
+			t.Errorf("peer %s: banned = %v, want %v", tt.peer, got, tt.want)
+		}
+	}
+
+	// A negative threshold disables banning.
+	l = newLimiter(Limits{BanThreshold: -1}.withDefaults())
+	if l.penalise("a", 1e9, start) || l.banned("a", start) {
+		t.Fatal("banned with banning disabled")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	l := newLimiter(Limits{}.withDefaults())
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+	use := func(peer, scope string, d time.Duration) {
+		t.Helper()
+		if err := l.allow(peer, scope, at(d)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sweep := func(d time.Duration) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.sweep(at(d))
+	}
+	use("idle", "quiet", 0)
+	use("busy", "active", peerSweepInterval/2)
+	l.penalise("penalised", DefaultBanThreshold/2, at(0))
+	l.penalise("banned", DefaultBanThreshold, at(0))
+	check := func(when string, peers, overlays []string) {
+		t.Helper()
+		if len(l.peers) != len(peers) || len(l.overlays) != len(overlays) {
+			t.Fatalf("%s: %d peers and %d overlays kept, want %v and %v", when, len(l.peers), len(l.overlays), peers, overlays)
+		}
+		for _, k := range peers {
+			if l.peers[k] == nil {
+				t.Fatalf("%s: peer %s forgotten", when, k)
+			}
+		}
+		for _, k := range overlays {
+			if l.overlays[k] == nil {
+				t.Fatalf("%s: overlay %s forgotten", when, k)
+			}
+		}
+	}
+
+	// Sweeps run at most once per peerSweepInterval: the first allow swept.
+	sweep(peerSweepInterval - time.Second)
+	check("throttled", []string{"idle", "busy", "penalised", "banned"}, []string{"quiet", "active"})
+
+	// Idle entries go; recent, penalised and banned peers stay.
+	sweep(peerSweepInterval)
+	check("first sweep", []string{"busy", "penalised", "banned"}, []string{"active"})
+
+	// Once the ban is over and the score has decayed, everything goes.
+	sweep(DefaultBanDuration)
+	check("after the ban", nil, nil)
+}
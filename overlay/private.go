@@ -0,0 +1,61 @@
+package overlay
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotMember is returned when a key is not admitted to a private overlay.
+	ErrNotMember = errors.New("overlay: not a member")
+	// ErrTooLarge is returned for broadcasts and requests above the sender's
+	// certificate limit.
+	ErrTooLarge = errors.New("overlay: broadcast exceeds certificate max size")
+)
+
+// Members decides who may broadcast and send queries and messages in a
+// private overlay: the holders of Keys, and the holders of a certificate
+// issued for the overlay by one of Authorities.
+type Members struct {
+	Keys        []ed25519.PublicKey
+	Authorities []ed25519.PublicKey
+	// Certificate admits this node when its own key is not in Keys. It is
+	// attached to every broadcast and request the node sends.
+	Certificate *Certificate
+}
+
+// clone copies the key lists so that callers may reuse theirs.
+func (m Members) clone() *Members {
+	m.Keys = append([]ed25519.PublicKey(nil), m.Keys...)
+	m.Authorities = append([]ed25519.PublicKey(nil), m.Authorities...)
+	return &m
+}
+
+// Admit checks that src may send a broadcast or request of size bytes in the
+// overlay at now, either as a listed key or through cert.
+func (m *Members) Admit(overlay ID, src ed25519.PublicKey, cert *Certificate, size int, now time.Time) error {
+	if hasKey(m.Keys, src) {
+		return nil
+	}
+	if cert == nil || !hasKey(m.Authorities, cert.IssuedBy) {
+		return ErrNotMember
+	}
+	if err := cert.Verify(overlay, src, now); err != nil {
+		return err
+	}
+	if size > int(cert.MaxSize) {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+func hasKey(keys []ed25519.PublicKey, k ed25519.PublicKey) bool {
+	for _, key := range keys {
+		if bytes.Equal(key, k) {
+			return true
+		}
+	}
+	return false
+}
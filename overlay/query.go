@@ -0,0 +1,244 @@
+package overlay
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/dht"
+	"github.com/grishinium-blockchain/grishinium-go/internal/metrics"
+	ns "github.com/grishinium-blockchain/grishinium-go/internal/netstack"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+// queryProtocol is the netstack protocol that carries queries and messages
+// to overlay members. Requests start with an overlay.query or
+// overlay.message prefix naming the overlay; in private overlays the prefix
+// is followed by an overlay.memberAuth signed by the sender.
+const queryProtocol = "overlay"
+
+// prefixSize is the size of the overlay.query and overlay.message prefixes.
+const prefixSize = 4 + 32
+
+var (
+	// ErrNoHandler is returned when a member has no handler for the overlay.
+	ErrNoHandler = errors.New("overlay: no handler")
+	// ErrBadRequest is returned for requests that cannot be decoded or whose
+	// member signature does not verify.
+	ErrBadRequest = errors.New("overlay: bad request")
+)
+
+// Handler answers the queries and messages sent to this node inside an
+// overlay; the answer to a message is discarded. from is the sender, usable
+// as the target of Query and SendMessage. In private overlays key is the
+// sender's overlay key, verified to belong to a member; it is nil in public
+// overlays.
+type Handler func(ctx context.Context, from dht.Peer, key ed25519.PublicKey, data []byte) ([]byte, error)
+
+// SetHandler registers h for the queries and messages of a joined overlay;
+// a nil h removes it. Leaving the overlay removes it too.
+func (a *Adapter) SetHandler(id ID, h Handler) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	m, ok := a.overlays[id]
+	if !ok {
+		return ErrNotJoined
+	}
+	m.handler = h
+	return nil
+}
+
+// Query sends data to a member of a joined overlay and returns the answer
+// of its handler.
+func (a *Adapter) Query(ctx context.Context, id ID, peer dht.Peer, data []byte) ([]byte, error) {
+	addr, req, err := a.request(tlQuery, id, peer, data)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.node.Query(ctx, addr, queryProtocol, req)
+	metrics.OverlayQuery(metrics.Sent, err)
+	return resp, err
+}
+
+// SendMessage sends a one-way message to a member of a joined overlay.
+func (a *Adapter) SendMessage(ctx context.Context, id ID, peer dht.Peer, data []byte) error {
+	addr, req, err := a.request(tlMessage, id, peer, data)
+	if err != nil {
+		return err
+	}
+	err = a.node.Send(ctx, addr, queryProtocol, req)
+	metrics.OverlayQuery(metrics.Sent, err)
+	return err
+}
+
+// request returns the netstack address of peer and the request that
+// carries data, as long as the overlay is joined. In private overlays the
+// request is signed with the node's identity.
+func (a *Adapter) request(constructor uint32, id ID, peer dht.Peer, data []byte) (string, []byte, error) {
+	a.mu.Lock()
+	m, ok := a.overlays[id]
+	var private *Members
+	if ok {
+		private = m.private
+	}
+	a.mu.Unlock()
+	if !ok {
+		return "", nil, ErrNotJoined
+	}
+	addr := peer.Addr
+	if addr == "" {
+		addr = peer.ID
+	}
+	if addr == "" {
+		return "", nil, errors.New("overlay: peer has no address")
+	}
+	prefix := prefixed(constructor, id, nil)
+	if private == nil {
+		return addr, append(prefix, data...), nil
+	}
+	var w tl.Writer
+	w.WriteRaw(prefix)
+	writeMemberAuth(&w, a.cfg.Identity, private.Certificate, prefix, data, time.Now())
+	w.WriteRaw(data)
+	return addr, w.Bytes(), nil
+}
+
+// serve dispatches a request received on queryProtocol to the handler of
+// its overlay, within the limits of the sending peer and of the overlay.
+func (a *Adapter) serve(ctx context.Context, from string, req []byte) ([]byte, error) {
+	now := time.Now()
+	h, key, data, err := a.admitRequest(from, req, now)
+	if err != nil {
+		metrics.OverlayQuery(metrics.Received, err)
+		a.penalise(from, err, now)
+		return nil, err
+	}
+	resp, err := h(ctx, fromPeer(from), key, data)
+	metrics.OverlayQuery(metrics.Received, err)
+	return resp, err
+}
+
+func prefixed(constructor uint32, id ID, data []byte) []byte {
+	var w tl.Writer
+	w.WriteUint32(constructor)
+	w.WriteRaw(id[:])
+	w.WriteRaw(data)
+	return w.Bytes()
+}
+
+// admitRequest checks a request against the limits and, in private
+// overlays, the sender's membership. It returns the handler of the overlay,
+// the sender's verified key in private overlays and the payload.
+func (a *Adapter) admitRequest(from string, req []byte, now time.Time) (Handler, ed25519.PublicKey, []byte, error) {
+	local := a.isLocal(from)
+	if !local && len(req) > a.cfg.Limits.MaxQuerySize {
+		return nil, nil, nil, fmt.Errorf("%w: %d byte request", ns.ErrTooLarge, len(req))
+	}
+	r := tl.NewReader(req)
+	c := r.Uint32()
+	id := ID(r.Int256())
+	if r.Err() != nil || (c != tlQuery && c != tlMessage) {
+		return nil, nil, nil, fmt.Errorf("%w: prefix %08x", ErrBadRequest, c)
+	}
+	if !local {
+		if err := a.limits.allow(peerKey(fromPeer(from)), id.String(), now); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	a.mu.Lock()
+	var (
+		h       Handler
+		private *Members
+	)
+	if m, ok := a.overlays[id]; ok {
+		h, private = m.handler, m.private
+	}
+	a.mu.Unlock()
+	if h == nil {
+		return nil, nil, nil, fmt.Errorf("%w: %s", ErrNoHandler, id)
+	}
+	if private == nil {
+		return h, nil, r.Rest(), nil
+	}
+	key, data, err := admitMember(id, private, req[:prefixSize], r, now)
+	if err != nil {
+		metrics.OverlayDropped(id.String(), dropReason(err))
+		log.Debug("overlay request dropped", "overlay", id.String(), "peer", from, "err", err)
+		return nil, nil, nil, err
+	}
+	return h, key, data, nil
+}
+
+// writeMemberAuth appends the overlay.memberAuth by which id, a member of a
+// private overlay as a listed key or through cert, signs the request made
+// of prefix and data.
+func writeMemberAuth(w *tl.Writer, id keyring.Identity, cert *Certificate, prefix, data []byte, now time.Time) {
+	date := int32(now.Unix())
+	w.WriteUint32(tlMemberAuth)
+	w.WriteUint32(tlPubEd25519)
+	w.WriteRaw(id.Public)
+	writeCertificate(w, cert)
+	w.WriteInt32(date)
+	w.WriteBytes(ed25519.Sign(id.Private, memberAuthPayload(prefix, data, date)))
+}
+
+// admitMember reads the overlay.memberAuth of a request to a private
+// overlay, checks its date and signature and that the signer is a member,
+// and returns the signer's key and the payload that follows.
+func admitMember(id ID, private *Members, prefix []byte, r *tl.Reader, now time.Time) (ed25519.PublicKey, []byte, error) {
+	if c := r.Uint32(); c != tlMemberAuth {
+		return nil, nil, fmt.Errorf("%w: no member signature", ErrBadRequest)
+	}
+	src, err := readPublicKey(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrBadRequest, err)
+	}
+	cert, err := readCertificate(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrBadRequest, err)
+	}
+	date := r.Int32()
+	sig := r.Bytes()
+	if r.Err() != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrBadRequest, r.Err())
+	}
+	data := r.Rest()
+	if err := checkDate(date, now); err != nil {
+		return nil, nil, err
+	}
+	if !ed25519.Verify(src, memberAuthPayload(prefix, data, date), sig) {
+		return nil, nil, fmt.Errorf("%w: member signature does not verify", ErrBadRequest)
+	}
+	if err := private.Admit(id, src, cert, len(data), now); err != nil {
+		return nil, nil, err
+	}
+	return src, data, nil
+}
+
+// memberAuthPayload is the boxed overlay.memberAuth.toSign of a request made
+// of prefix and data.
+func memberAuthPayload(prefix, data []byte, date int32) []byte {
+	h := sha256.New()
+	h.Write(prefix)
+	h.Write(data)
+	var w tl.Writer
+	w.WriteUint32(tlMemberAuthToSign)
+	w.WriteRaw(h.Sum(nil))
+	w.WriteInt32(date)
+	return w.Bytes()
+}
+
+// fromPeer describes the sender of a request; libp2p addresses end in
+// /p2p/<id>.
+func fromPeer(addr string) dht.Peer {
+	p := dht.Peer{Addr: addr, Addrs: []string{addr}}
+	if i := strings.LastIndex(addr, "/p2p/"); i >= 0 {
+		p.ID = addr[i+len("/p2p/"):]
+	}
+	return p
+}
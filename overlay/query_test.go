@@ -0,0 +1,141 @@
+package overlay
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grishinium-blockchain/grishinium-go/dht"
+	"github.com/grishinium-blockchain/grishinium-go/internal/netstack/mock"
+	"github.com/grishinium-blockchain/grishinium-go/keyring"
+	"github.com/grishinium-blockchain/grishinium-go/tl"
+)
+
+func TestPrivateOverlayQuery(t *testing.T) {
+	ctx := context.Background()
+	nw := mock.NewNetwork()
+	ownerID, listedID, certID, outsiderID, authority := testIdentity(1), testIdentity(2), testIdentity(3), testIdentity(4), testIdentity(5)
+	desc := []byte("private overlay")
+	id := IDOf(desc)
+	members := Members{Keys: []ed25519.PublicKey{ownerID.Public, listedID.Public}, Authorities: []ed25519.PublicKey{authority.Public}}
+
+	owner := newTestAdapter(t, nw, ownerID)
+	if _, err := owner.JoinPrivate(ctx, desc, members); err != nil {
+		t.Fatal(err)
+	}
+	var got ed25519.PublicKey
+	if err := owner.SetHandler(id, func(ctx context.Context, from dht.Peer, key ed25519.PublicKey, data []byte) ([]byte, error) {
+		got = key
+		return append([]byte("re: "), data...), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	target := dht.Peer{Addr: owner.node.Addr()}
+
+	listed := newTestAdapter(t, nw, listedID)
+	if _, err := listed.JoinPrivate(ctx, desc, members); err != nil {
+		t.Fatal(err)
+	}
+	certified := newTestAdapter(t, nw, certID)
+	withCert := members
+	withCert.Certificate = IssueCertificate(authority.Private, id, certID.Public, time.Now().Add(time.Hour), 1024)
+	if _, err := certified.JoinPrivate(ctx, desc, withCert); err != nil {
+		t.Fatal(err)
+	}
+	// The outsider cannot join the private overlay, so it joins the same
+	// description as a public one and sends unsigned requests.
+	outsider := newTestAdapter(t, nw, outsiderID)
+	if _, err := outsider.Join(ctx, desc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		from *Adapter
+		want ed25519.PublicKey // nil when the request must be refused
+	}{
+		{"listed member", listed, listedID.Public},
+		{"certified member", certified, certID.Public},
+		{"outsider", outsider, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			answer, err := tt.from.Query(ctx, id, target, []byte("hello"))
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("query answered: %q", answer)
+				}
+				if got != nil {
+					t.Fatal("handler called for a refused query")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(answer) != "re: hello" {
+				t.Fatalf("answer %q", answer)
+			}
+			if !got.Equal(tt.want) {
+				t.Fatal("handler given the wrong sender key")
+			}
+		})
+	}
+}
+
+func TestAdmitMember(t *testing.T) {
+	member, outsider, authority := testIdentity(1), testIdentity(2), testIdentity(3)
+	desc := []byte("private overlay")
+	id := IDOf(desc)
+	private := &Members{Keys: []ed25519.PublicKey{member.Public}, Authorities: []ed25519.PublicKey{authority.Public}}
+	now := time.Now()
+	prefix := prefixed(tlQuery, id, nil)
+	request := func(signer keyring.Identity, cert *Certificate, data []byte, at time.Time) []byte {
+		var w tl.Writer
+		w.WriteRaw(prefix)
+		writeMemberAuth(&w, signer, cert, prefix, data, at)
+		w.WriteRaw(data)
+		return w.Bytes()
+	}
+	tampered := request(member, nil, []byte("data"), now)
+	tampered[len(tampered)-1] ^= 1
+	otherOverlay := request(member, nil, []byte("data"), now)
+	otherOverlay[4] ^= 1
+
+	tests := []struct {
+		name string
+		req  []byte
+		want error
+	}{
+		{"listed member", request(member, nil, []byte("data"), now), nil},
+		{"certified member", request(outsider, IssueCertificate(authority.Private, id, outsider.Public, now.Add(time.Hour), 16), []byte("data"), now), nil},
+		{"certificate too small", request(outsider, IssueCertificate(authority.Private, id, outsider.Public, now.Add(time.Hour), 2), []byte("data"), now), ErrTooLarge},
+		{"expired certificate", request(outsider, IssueCertificate(authority.Private, id, outsider.Public, now.Add(-time.Hour), 16), []byte("data"), now), ErrCertificateExpired},
+		{"non-member", request(outsider, nil, []byte("data"), now), ErrNotMember},
+		{"tampered payload", tampered, ErrBadRequest},
+		{"signed for another overlay", otherOverlay, ErrBadRequest},
+		{"stale", request(member, nil, []byte("data"), now.Add(-2*seenTTL)), ErrStale},
+		{"unsigned", append(append([]byte(nil), prefix...), "data"...), ErrBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tl.NewReader(tt.req)
+			r.Raw(prefixSize)
+			key, data, err := admitMember(id, private, tt.req[:prefixSize], r, now)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("admitMember = %v, want %v", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "data" || len(key) != ed25519.PublicKeySize {
+				t.Fatalf("admitted %x with %q", key, data)
+			}
+		})
+	}
+}
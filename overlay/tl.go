@@ -0,0 +1,32 @@
+package overlay
+
+// TL constructors of the overlay protocol. IDs are the CRC32 of the schema
+// line, so they match other implementations of the same schema.
+const (
+	tlPubEd25519 uint32 = 0x4813b4c6 // pub.ed25519 key:int256 = PublicKey
+
+	tlQuery   uint32 = 0xccfd8443 // overlay.query overlay:int256 = True (prefix of queries to a member)
+	tlMessage uint32 = 0x75252420 // overlay.message overlay:int256 = overlay.Message (prefix of messages to a member)
+
+	// overlay.memberAuth follows the prefix of requests in private overlays.
+	tlMemberAuth       uint32 = 0x61d312cd // overlay.memberAuth src:PublicKey certificate:overlay.Certificate date:int signature:bytes = overlay.MemberAuth
+	tlMemberAuthToSign uint32 = 0x3bf798bb // overlay.memberAuth.toSign request_hash:int256 date:int = overlay.memberAuth.ToSign
+
+	tlShardPublicOverlayID uint32 = 0x4d9ed329 // tonNode.shardPublicOverlayId workchain:int shard:long zero_state_file_hash:int256 = tonNode.ShardPublicOverlayId
+
+	tlEmptyCertificate uint32 = 0x32dabccf // overlay.emptyCertificate = overlay.Certificate
+	tlCertificate      uint32 = 0xe09ed731 // overlay.certificate issued_by:PublicKey expire_at:int max_size:int signature:bytes = overlay.Certificate
+	tlCertificateID    uint32 = 0x8fae60b9 // overlay.certificateId overlay_id:int256 node:int256 expire_at:int max_size:int = overlay.CertificateId
+
+	tlBroadcast       uint32 = 0xb15a2b6b // overlay.broadcast src:PublicKey certificate:overlay.Certificate flags:int data:bytes date:int signature:bytes = overlay.Broadcast
+	tlBroadcastID     uint32 = 0x51fd789a // overlay.broadcast.id src:int256 data_hash:int256 flags:int = overlay.broadcast.Id
+	tlBroadcastToSign uint32 = 0xfa374e7c // overlay.broadcast.toSign hash:int256 date:int = overlay.broadcast.ToSign
+
+	tlBroadcastFEC       uint32 = 0xbad7c36a // overlay.broadcastFec src:PublicKey certificate:overlay.Certificate data_hash:int256 data_size:int flags:int data:bytes seqno:int fec:fec.Type date:int signature:bytes = overlay.Broadcast
+	tlBroadcastFECID     uint32 = 0xfb3155a6 // overlay.broadcastFec.id src:int256 type:int256 data_hash:int256 size:int flags:int = overlay.broadcastFec.Id
+	tlBroadcastFECPartID uint32 = 0xa46962d0 // overlay.broadcastFec.partId broadcast_hash:int256 data_hash:int256 seqno:int = overlay.broadcastFec.PartId
+
+	// fec.reedSolomon is our FEC type, the systematic code of package fec;
+	// peers that only know fec.raptorQ drop such broadcasts.
+	tlFECReedSolomon uint32 = 0x067f213e // fec.reedSolomon data_size:int symbol_size:int symbols_count:int = fec.Type
+)
@@ -0,0 +1,175 @@
+package tl
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Boxed boolean constructors.
+const (
+	BoolTrue  uint32 = 0x997275b5
+	BoolFalse uint32 = 0xbc799737
+)
+
+// ErrShortBuffer is reported when a Reader runs out of input.
+var ErrShortBuffer = errors.New("tl: short buffer")
+
+// Writer serializes TL primitives in little-endian order. The zero value is ready to use.
+type Writer struct {
+	buf []byte
+}
+
+// Bytes returns the serialized data.
+func (w *Writer) Bytes() []byte { return w.buf }
+
+func (w *Writer) WriteUint32(v uint32) { w.buf = binary.LittleEndian.AppendUint32(w.buf, v) }
+func (w *Writer) WriteInt32(v int32)   { w.WriteUint32(uint32(v)) }
+func (w *Writer) WriteUint64(v uint64) { w.buf = binary.LittleEndian.AppendUint64(w.buf, v) }
+func (w *Writer) WriteInt64(v int64)   { w.WriteUint64(uint64(v)) }
+
+// WriteRaw appends b as-is (int128/int256 fields).
+func (w *Writer) WriteRaw(b []byte) { w.buf = append(w.buf, b...) }
+
+// WriteBool appends a boxed Bool.
+func (w *Writer) WriteBool(v bool) {
+	if v {
+		w.WriteUint32(BoolTrue)
+	} else {
+		w.WriteUint32(BoolFalse)
+	}
+}
+
+// WriteBytes appends b using the TL bytes encoding: a 1-byte (or 0xfe + 3-byte)
+// length prefix followed by the data, padded to a multiple of 4.
+func (w *Writer) WriteBytes(b []byte) {
+	n := len(b)
+	var hdr int
+	if n < 254 {
+		w.buf = append(w.buf, byte(n))
+		hdr = 1
+	} else {
+		w.buf = append(w.buf, 0xfe, byte(n), byte(n>>8), byte(n>>16))
+		hdr = 4
+	}
+	w.buf = append(w.buf, b...)
+	if pad := (hdr + n) % 4; pad != 0 {
+		w.buf = append(w.buf, make([]byte, 4-pad)...)
+	}
+}
+
+// WriteString appends s using the TL bytes encoding.
+func (w *Writer) WriteString(s string) { w.WriteBytes([]byte(s)) }
+
+// Reader decodes TL primitives. The first error is sticky and returned by Err.
+type Reader struct {
+	b   []byte
+	err error
+}
+
+// NewReader returns a Reader over b.
+func NewReader(b []byte) *Reader { return &Reader{b: b} }
+
+// Err returns the first decoding error, if any.
+func (r *Reader) Err() error { return r.err }
+
+// Len returns the number of unread bytes.
+func (r *Reader) Len() int { return len(r.b) }
+
+// Rest returns the unread bytes and consumes them.
+func (r *Reader) Rest() []byte {
+	out := r.b
+	r.b = nil
+	return out
+}
+
+// Raw consumes exactly n bytes.
+func (r *Reader) Raw(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.b) < n {
+		r.err = ErrShortBuffer
+		return nil
+	}
+	out := r.b[:n:n]
+	r.b = r.b[n:]
+	return out
+}
+
+func (r *Reader) Uint32() uint32 {
+	b := r.Raw(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *Reader) Int32() int32 { return int32(r.Uint32()) }
+
+func (r *Reader) Uint64() uint64 {
+	b := r.Raw(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (r *Reader) Int64() int64 { return int64(r.Uint64()) }
+
+// Int256 consumes a 32-byte field.
+func (r *Reader) Int256() [32]byte {
+	var out [32]byte
+	copy(out[:], r.Raw(32))
+	return out
+}
+
+// Bool consumes a boxed Bool.
+func (r *Reader) Bool() bool {
+	switch r.Uint32() {
+	case BoolTrue:
+		return true
+	case BoolFalse:
+		return false
+	default:
+		if r.err == nil {
+			r.err = errors.New("tl: invalid Bool constructor")
+		}
+		return false
+	}
+}
+
+// Bytes consumes a TL bytes field.
+func (r *Reader) Bytes() []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.b) == 0 {
+		r.err = ErrShortBuffer
+		return nil
+	}
+	n, hdr := int(r.b[0]), 1
+	if n == 0xfe {
+		if len(r.b) < 4 {
+			r.err = ErrShortBuffer
+			return nil
+		}
+		n, hdr = int(r.b[1])|int(r.b[2])<<8|int(r.b[3])<<16, 4
+	} else if n == 0xff {
+		r.err = errors.New("tl: invalid bytes length prefix")
+		return nil
+	}
+	total := hdr + n
+	if pad := total % 4; pad != 0 {
+		total += 4 - pad
+	}
+	if len(r.b) < total {
+		r.err = ErrShortBuffer
+		return nil
+	}
+	out := r.b[hdr : hdr+n : hdr+n]
+	r.b = r.b[total:]
+	return out
+}
+
+// String consumes a TL bytes field as a string.
+func (r *Reader) String() string { return string(r.Bytes()) }